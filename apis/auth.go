@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/maruel/natural"
@@ -12,13 +13,34 @@ import (
 	"github.com/nanoteck137/authlab/render"
 	"github.com/nanoteck137/authlab/service"
 	"github.com/nanoteck137/pyrin"
+	"github.com/nanoteck137/pyrin/anvil"
 )
 
 type GetMe struct {
-	Id          string `json:"id"`
-	Email       string `json:"email"`
-	DisplayName string `json:"displayName"`
-	Role        string `json:"role"`
+	Id            string `json:"id"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"emailVerified"`
+	DisplayName   string `json:"displayName"`
+	Role          string `json:"role"`
+}
+
+const (
+	PrincipalTypeUser    = "user"
+	PrincipalTypeMachine = "machine"
+)
+
+// GetWhoAmI describes the caller, the users and the machine clients
+type GetWhoAmI struct {
+	Type     string   `json:"type"`
+	Id       string   `json:"id"`
+	Name     string   `json:"name"`
+	ClientId string   `json:"clientId"`
+	Scopes   []string `json:"scopes"`
+	Audience []string `json:"audience"`
+
+	// The clients acting on behalf of the user, the most recent actor
+	// first
+	Actors []string `json:"actors"`
 }
 
 type AuthInitiate struct {
@@ -50,7 +72,8 @@ type AuthLoginWithCodeBody struct {
 }
 
 type AuthFinishProvider struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
 }
 
 type AuthFinishProviderBody struct {
@@ -65,14 +88,36 @@ type AuthProvider struct {
 
 type GetAuthProviders struct {
 	Providers []AuthProvider `json:"providers"`
+
+	// If the users can log in with a username and a password
+	LocalAccounts bool `json:"localAccounts"`
+
+	// If the users can log in with a link sent to the email
+	MagicLinks bool `json:"magicLinks"`
+
+	// If the users can log in with a passkey
+	Passkeys bool `json:"passkeys"`
 }
 
 type AuthClaimQuickConnectCodeBody struct {
 	Code string `json:"code"`
 }
 
+func (b *AuthClaimQuickConnectCodeBody) Transform() {
+	b.Code = strings.ToUpper(anvil.String(b.Code))
+}
+
+type AuthDenyQuickConnectCodeBody struct {
+	Code string `json:"code"`
+}
+
+func (b *AuthDenyQuickConnectCodeBody) Transform() {
+	b.Code = strings.ToUpper(anvil.String(b.Code))
+}
+
 type AuthFinishQuickConnect struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
 }
 
 type AuthFinishQuickConnectBody struct {
@@ -89,6 +134,15 @@ type AuthGetQuickConnectStatusBody struct {
 	Challenge string `json:"challenge"`
 }
 
+type AuthRefreshToken struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+type AuthRefreshTokenBody struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
 type AuthGetProviderStatus struct {
 	Status string `json:"status"`
 }
@@ -110,7 +164,10 @@ func InstallAuthHandlers(app core.App, group pyrin.Group) {
 				providers := app.Config().OidcProviders
 
 				res := GetAuthProviders{
-					Providers: make([]AuthProvider, 0, len(providers)),
+					Providers:     make([]AuthProvider, 0, len(providers)),
+					LocalAccounts: app.AuthService().LocalAccountsEnabled(),
+					MagicLinks:    app.AuthService().MagicLinksEnabled(),
+					Passkeys:      app.AuthService().PasskeysEnabled(),
 				}
 
 				for id, provider := range providers {
@@ -161,22 +218,35 @@ func InstallAuthHandlers(app core.App, group pyrin.Group) {
 			Method: http.MethodGet,
 			Path:   "/auth/providers/callback",
 			HandlerFunc: func(c pyrin.Context) error {
-				url := c.Request().URL
-				state := url.Query().Get("state")
-				code := url.Query().Get("code")
+				query := c.Request().URL.Query()
 
 				authService := app.AuthService()
 
-				err := authService.CompleteProviderRequest(state, code)
+				err := authService.CompleteProviderRequest(service.ProviderCallback{
+					State:            query.Get("state"),
+					Code:             query.Get("code"),
+					Issuer:           query.Get("iss"),
+					Error:            query.Get("error"),
+					ErrorDescription: query.Get("error_description"),
+				})
 				if err != nil {
-					if errors.Is(err, service.ErrAuthServiceRequestExpired) {
-						render.RenderCallbackRequestExpired(c.Response())
-						c.Response().WriteHeader(http.StatusOK)
+					var providerErr *service.ProviderCallbackError
 
-						return nil
+					switch {
+					case errors.As(err, &providerErr):
+						render.RenderCallbackProviderError(c.Response(), providerErr.Code, providerErr.Description)
+					case errors.Is(err, service.ErrAuthServiceRequestExpired):
+						render.RenderCallbackRequestExpired(c.Response())
+					case errors.Is(err, service.ErrAuthServiceRequestAlreadyUsed):
+						render.RenderCallbackRequestAlreadyUsed(c.Response())
+					case errors.Is(err, service.ErrAuthServiceInvalidState),
+						errors.Is(err, service.ErrAuthServiceProviderMismatch),
+						errors.Is(err, service.ErrAuthServiceRequestNotFound):
+						render.RenderCallbackInvalidRequest(c.Response())
+					default:
+						render.RenderCallbackError(c.Response())
 					}
 
-					render.RenderCallbackError(c.Response())
 					c.Response().WriteHeader(http.StatusOK)
 
 					return nil
@@ -195,6 +265,7 @@ func InstallAuthHandlers(app core.App, group pyrin.Group) {
 			Method:       http.MethodPost,
 			ResponseType: AuthFinishProvider{},
 			BodyType:     AuthFinishProviderBody{},
+			Errors:       []pyrin.ErrorType{ErrTypeEmailNotVerified, ErrTypeProviderEmailNotVerified, ErrTypeMfaRequired},
 			HandlerFunc: func(c pyrin.Context) (any, error) {
 				body, err := pyrin.Body[AuthFinishProviderBody](c)
 				if err != nil {
@@ -203,18 +274,31 @@ func InstallAuthHandlers(app core.App, group pyrin.Group) {
 
 				authService := app.AuthService()
 
-				token, err := authService.CreateAuthTokenForProvider(body.RequestId, body.Challenge)
+				tokens, err := authService.CreateAuthTokenForProvider(body.RequestId, body.Challenge, ClientInfo(app, c))
 				if err != nil {
 					if errors.Is(err, service.ErrAuthServiceRequestNotFound) {
 						// TODO(patrik): Better error
 						return nil, errors.New("request not found")
 					}
 
+					if errors.Is(err, service.ErrAuthServiceEmailNotVerified) {
+						return nil, EmailNotVerified()
+					}
+
+					if errors.Is(err, service.ErrAuthServiceProviderEmailNotVerified) {
+						return nil, ProviderEmailNotVerified()
+					}
+
+					if errors.Is(err, service.ErrAuthServiceMfaRequired) {
+						return nil, MfaRequired(err)
+					}
+
 					return nil, err
 				}
 
 				return AuthFinishProvider{
-					Token: token,
+					Token:        tokens.AccessToken,
+					RefreshToken: tokens.RefreshToken,
 				}, nil
 			},
 		},
@@ -269,7 +353,7 @@ func InstallAuthHandlers(app core.App, group pyrin.Group) {
 				return AuthQuickConnectInitiate{
 					Code:      res.Code,
 					Challenge: res.Challenge,
-					AuthUrl:   "FIX ME",
+					AuthUrl:   DeviceVerificationUrl(app, c),
 					ExpiresAt: res.Expires.Format(time.RFC3339Nano),
 				}, nil
 			},
@@ -302,6 +386,33 @@ func InstallAuthHandlers(app core.App, group pyrin.Group) {
 			},
 		},
 
+		pyrin.ApiHandler{
+			Name:     "AuthDenyQuickConnectCode",
+			Method:   http.MethodPost,
+			Path:     "/auth/quick-connect/deny",
+			BodyType: AuthDenyQuickConnectCodeBody{},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				body, err := pyrin.Body[AuthDenyQuickConnectCodeBody](c)
+				if err != nil {
+					return nil, err
+				}
+
+				_, err = User(app, c)
+				if err != nil {
+					return nil, err
+				}
+
+				authService := app.AuthService()
+
+				err = authService.DenyQuickConnectRequest(body.Code)
+				if err != nil {
+					return nil, err
+				}
+
+				return nil, nil
+			},
+		},
+
 		pyrin.ApiHandler{
 			Name:         "AuthGetQuickConnectStatus",
 			Path:         "/auth/quick-connect/status",
@@ -338,6 +449,7 @@ func InstallAuthHandlers(app core.App, group pyrin.Group) {
 			Method:       http.MethodPost,
 			ResponseType: AuthFinishQuickConnect{},
 			BodyType:     AuthFinishQuickConnectBody{},
+			Errors:       []pyrin.ErrorType{ErrTypeEmailNotVerified, ErrTypeMfaRequired},
 			HandlerFunc: func(c pyrin.Context) (any, error) {
 				body, err := pyrin.Body[AuthFinishQuickConnectBody](c)
 				if err != nil {
@@ -346,18 +458,27 @@ func InstallAuthHandlers(app core.App, group pyrin.Group) {
 
 				authService := app.AuthService()
 
-				token, err := authService.CreateAuthTokenForQuickConnect(body.Code, body.Challenge)
+				tokens, err := authService.CreateAuthTokenForQuickConnect(body.Code, body.Challenge, ClientInfo(app, c))
 				if err != nil {
 					if errors.Is(err, service.ErrAuthServiceRequestNotFound) {
 						// TODO(patrik): Better error
 						return nil, errors.New("request not found")
 					}
 
+					if errors.Is(err, service.ErrAuthServiceEmailNotVerified) {
+						return nil, EmailNotVerified()
+					}
+
+					if errors.Is(err, service.ErrAuthServiceMfaRequired) {
+						return nil, MfaRequired(err)
+					}
+
 					return nil, err
 				}
 
 				return AuthFinishQuickConnect{
-					Token: token,
+					Token:        tokens.AccessToken,
+					RefreshToken: tokens.RefreshToken,
 				}, nil
 			},
 		},
@@ -365,6 +486,38 @@ func InstallAuthHandlers(app core.App, group pyrin.Group) {
 
 	// NOTE(patrik): Other Authentication related stuff
 	group.Register(
+		pyrin.ApiHandler{
+			Name:         "AuthRefreshToken",
+			Path:         "/auth/token/refresh",
+			Method:       http.MethodPost,
+			ResponseType: AuthRefreshToken{},
+			BodyType:     AuthRefreshTokenBody{},
+			Errors:       []pyrin.ErrorType{ErrTypeInvalidRefreshToken},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				body, err := pyrin.Body[AuthRefreshTokenBody](c)
+				if err != nil {
+					return nil, err
+				}
+
+				authService := app.AuthService()
+
+				tokens, err := authService.RefreshUserTokens(c.Request().Context(), body.RefreshToken, "")
+				if err != nil {
+					if errors.Is(err, service.ErrAuthServiceInvalidRefreshToken) ||
+						errors.Is(err, service.ErrAuthServiceRefreshTokenReused) {
+						return nil, InvalidRefreshToken()
+					}
+
+					return nil, err
+				}
+
+				return AuthRefreshToken{
+					Token:        tokens.AccessToken,
+					RefreshToken: tokens.RefreshToken,
+				}, nil
+			},
+		},
+
 		pyrin.ApiHandler{
 			Name:         "GetMe",
 			Path:         "/auth/me",
@@ -377,12 +530,52 @@ func InstallAuthHandlers(app core.App, group pyrin.Group) {
 				}
 
 				return GetMe{
-					Id:          user.Id,
-					Email:       user.Email,
-					DisplayName: user.DisplayName,
-					Role:        user.Role,
+					Id:            user.Id,
+					Email:         user.Email,
+					EmailVerified: user.EmailVerified > 0,
+					DisplayName:   user.DisplayName,
+					Role:          user.Role,
 				}, nil
 			},
 		},
+
+		pyrin.ApiHandler{
+			Name:         "GetWhoAmI",
+			Path:         "/auth/whoami",
+			Method:       http.MethodGet,
+			ResponseType: GetWhoAmI{},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				principal, err := GetPrincipal(app, c)
+				if err != nil {
+					return nil, err
+				}
+
+				res := GetWhoAmI{
+					Type:     PrincipalTypeUser,
+					Id:       principal.Id(),
+					ClientId: principal.ClientId,
+					Scopes:   strings.Fields(principal.Scope),
+					Audience: principal.Audience,
+					Actors:   principal.Actors,
+				}
+
+				if principal.IsMachine() {
+					res.Type = PrincipalTypeMachine
+					res.Name = principal.Client.Name
+				} else {
+					res.Name = principal.User.DisplayName
+				}
+
+				if res.Audience == nil {
+					res.Audience = []string{}
+				}
+
+				if res.Actors == nil {
+					res.Actors = []string{}
+				}
+
+				return res, nil
+			},
+		},
 	)
 }
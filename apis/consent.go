@@ -0,0 +1,206 @@
+package apis
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nanoteck137/authlab/core"
+	"github.com/nanoteck137/authlab/render"
+	"github.com/nanoteck137/authlab/service"
+	"github.com/nanoteck137/authlab/tools/utils"
+	"github.com/nanoteck137/pyrin"
+)
+
+const (
+	consentCsrfCookie = "authlab_consent_csrf"
+	consentCsrfMaxAge = 10 * time.Minute
+)
+
+const (
+	ConsentActionAllow = "allow"
+	ConsentActionDeny  = "deny"
+)
+
+var scopeDescriptions = map[string]string{
+	service.ScopeOpenId:  "Sign you in with your account",
+	service.ScopeProfile: "See your name and profile information",
+	service.ScopeEmail:   "See your email address",
+}
+
+func scopeDescription(scope string) string {
+	if desc, exists := scopeDescriptions[scope]; exists {
+		return desc
+	}
+
+	return scope
+}
+
+// consentCsrfToken returns the CSRF token stored in the cookie, a new
+// token is created if the browser doesn't have one
+func consentCsrfToken(app core.App, c pyrin.Context) (string, error) {
+	cookie, err := c.Request().Cookie(consentCsrfCookie)
+	if err == nil && cookie.Value != "" {
+		return cookie.Value, nil
+	}
+
+	token, err := utils.GenerateAuthChallenge()
+	if err != nil {
+		return "", err
+	}
+
+	http.SetCookie(c.Response(), &http.Cookie{
+		Name:     consentCsrfCookie,
+		Value:    token,
+		Path:     "/oauth/consent",
+		MaxAge:   int(consentCsrfMaxAge.Seconds()),
+		Secure:   strings.HasPrefix(PublicUrl(app, c), "https://"),
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	return token, nil
+}
+
+// consentUrl is the url the user is sent to when the user needs to
+// approve the client
+func consentUrl(app core.App, c pyrin.Context, requestId string) string {
+	return PublicUrl(app, c) + "/oauth/consent?request=" + requestId
+}
+
+func writeConsentHtml(c pyrin.Context, status int, f func(w http.ResponseWriter) error) error {
+	header := c.Response().Header()
+	header.Set("Content-Type", "text/html; charset=utf-8")
+	header.Set("Cache-Control", "no-store")
+
+	// NOTE(patrik): Stop other sites from putting the consent page
+	// inside a frame and tricking the user into clicking allow
+	header.Set("X-Frame-Options", "DENY")
+	header.Set("Content-Security-Policy", "frame-ancestors 'none'")
+
+	c.Response().WriteHeader(status)
+	return f(c.Response())
+}
+
+func writeConsentError(c pyrin.Context, err error) error {
+	if errors.Is(err, service.ErrAuthServiceConsentRequestNotFound) || errors.Is(err, service.ErrAuthServiceConsentRequestInvalid) {
+		return writeConsentHtml(c, http.StatusBadRequest, func(w http.ResponseWriter) error {
+			return render.RenderConsentRequestInvalid(w)
+		})
+	}
+
+	slog.Error("Failed to handle consent request", "err", err)
+
+	return writeConsentHtml(c, http.StatusInternalServerError, func(w http.ResponseWriter) error {
+		return render.RenderCallbackError(w)
+	})
+}
+
+// InstallConsentHandlers installs the consent page shown when a client
+// that isn't trusted asks for scopes the user hasn't approved before
+func InstallConsentHandlers(app core.App, group pyrin.Group) {
+	group.Register(
+		pyrin.NormalHandler{
+			Name:   "OAuthConsent",
+			Method: http.MethodGet,
+			Path:   "/oauth/consent",
+			HandlerFunc: func(c pyrin.Context) error {
+				ctx := c.Request().Context()
+
+				csrfToken, err := consentCsrfToken(app, c)
+				if err != nil {
+					return writeConsentError(c, err)
+				}
+
+				request, err := app.AuthService().GetConsentRequest(ctx, c.Request().URL.Query().Get("request"), csrfToken)
+				if err != nil {
+					return writeConsentError(c, err)
+				}
+
+				user, err := app.DB().GetUserById(ctx, request.UserId)
+				if err != nil {
+					return writeConsentError(c, err)
+				}
+
+				userName := user.Email
+				if user.DisplayName != "" {
+					userName = user.DisplayName
+				}
+
+				scopes := strings.Fields(request.Request.Scope)
+				descriptions := make([]string, len(scopes))
+				for i, scope := range scopes {
+					descriptions[i] = scopeDescription(scope)
+				}
+
+				return writeConsentHtml(c, http.StatusOK, func(w http.ResponseWriter) error {
+					return render.RenderConsent(w, render.ConsentData{
+						ClientName:    request.Client.Name,
+						ClientLogoUrl: request.Client.LogoUrl,
+						UserName:      userName,
+						Scopes:        descriptions,
+						RequestId:     request.Id,
+						CsrfToken:     csrfToken,
+					})
+				})
+			},
+		},
+
+		pyrin.NormalHandler{
+			Name:   "OAuthConsentAnswer",
+			Method: http.MethodPost,
+			Path:   "/oauth/consent",
+			HandlerFunc: func(c pyrin.Context) error {
+				ctx := c.Request().Context()
+
+				r := c.Request()
+				err := r.ParseForm()
+				if err != nil {
+					return writeConsentError(c, service.ErrAuthServiceConsentRequestInvalid)
+				}
+
+				requestId := r.PostForm.Get("request")
+				csrfToken := r.PostForm.Get("csrf")
+
+				// NOTE(patrik): The token inside the form needs to match
+				// the token inside the cookie, the service then checks
+				// that the request is bound to the token
+				cookie, err := r.Cookie(consentCsrfCookie)
+				if err != nil || csrfToken == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(csrfToken)) != 1 {
+					return writeConsentError(c, service.ErrAuthServiceConsentRequestInvalid)
+				}
+
+				authService := app.AuthService()
+
+				switch r.PostForm.Get("action") {
+				case ConsentActionAllow:
+					request, code, err := authService.ApproveConsentRequest(ctx, requestId, csrfToken)
+					if err != nil {
+						return writeConsentError(c, err)
+					}
+
+					http.Redirect(c.Response(), r, authorizeCodeRedirect(app, c, request.Request.RedirectUri, request.Request.State, code), http.StatusFound)
+					return nil
+				case ConsentActionDeny:
+					request, err := authService.DenyConsentRequest(ctx, requestId, csrfToken)
+					if err != nil {
+						return writeConsentError(c, err)
+					}
+
+					body := OAuthAuthorizeBody{
+						RedirectUri: request.Request.RedirectUri,
+						State:       request.Request.State,
+					}
+
+					http.Redirect(c.Response(), r, authorizeErrorRedirect(app, c, body, OAuthErrAccessDenied, "the user denied the request"), http.StatusFound)
+					return nil
+				}
+
+				return writeConsentError(c, service.ErrAuthServiceConsentRequestInvalid)
+			},
+		},
+	)
+}
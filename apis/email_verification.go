@@ -0,0 +1,158 @@
+package apis
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/nanoteck137/authlab/core"
+	"github.com/nanoteck137/authlab/mailer"
+	"github.com/nanoteck137/authlab/render"
+	"github.com/nanoteck137/authlab/service"
+	"github.com/nanoteck137/pyrin"
+	"github.com/nanoteck137/pyrin/anvil"
+	"github.com/nanoteck137/validate"
+)
+
+type AuthRequestEmailVerificationBody struct {
+	Email string `json:"email"`
+}
+
+func (b *AuthRequestEmailVerificationBody) Transform() {
+	b.Email = anvil.String(b.Email)
+}
+
+func (b AuthRequestEmailVerificationBody) Validate() error {
+	return validate.ValidateStruct(&b,
+		validate.Field(&b.Email, validate.Required),
+	)
+}
+
+type AuthVerifyEmailBody struct {
+	Token string `json:"token"`
+}
+
+func (b AuthVerifyEmailBody) Validate() error {
+	return validate.ValidateStruct(&b,
+		validate.Field(&b.Token, validate.Required),
+	)
+}
+
+type SetUserEmailVerifiedBody struct {
+	Verified bool `json:"verified"`
+}
+
+// sendEmailVerification sends the verification email to the user with
+// the email, nothing is sent if there is no user with the email or if
+// the email is already verified
+func sendEmailVerification(app core.App, c pyrin.Context, email string) error {
+	linkUrl, err := emailLinkUrl(app)
+	if err != nil {
+		return err
+	}
+
+	user, token, err := app.AuthService().CreateEmailVerificationToken(c.Request().Context(), email)
+	if err != nil {
+		if errors.Is(err, service.ErrAuthServiceUserNotFound) ||
+			errors.Is(err, service.ErrAuthServiceEmailAlreadyVerified) {
+			return nil
+		}
+
+		return err
+	}
+
+	text, err := render.RenderEmailVerificationMail(render.MailData{
+		UserName: userDisplayName(&user),
+		Link:     linkUrl + "/verify-email?token=" + url.QueryEscape(token),
+	})
+	if err != nil {
+		return err
+	}
+
+	sendMail(app, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email",
+		Text:    text,
+	})
+
+	return nil
+}
+
+func InstallEmailVerificationHandlers(app core.App, group pyrin.Group) {
+	group.Register(
+		pyrin.ApiHandler{
+			Name:     "AuthRequestEmailVerification",
+			Method:   http.MethodPost,
+			Path:     "/auth/email/verify/request",
+			BodyType: AuthRequestEmailVerificationBody{},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				body, err := pyrin.Body[AuthRequestEmailVerificationBody](c)
+				if err != nil {
+					return nil, err
+				}
+
+				// NOTE(patrik): The response is the same if the user
+				// exists or not, so the endpoint can't be used to find
+				// out who has an account
+				return nil, sendEmailVerification(app, c, body.Email)
+			},
+		},
+
+		pyrin.ApiHandler{
+			Name:     "AuthVerifyEmail",
+			Method:   http.MethodPost,
+			Path:     "/auth/email/verify/confirm",
+			BodyType: AuthVerifyEmailBody{},
+			Errors:   []pyrin.ErrorType{ErrTypeInvalidVerificationToken},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				body, err := pyrin.Body[AuthVerifyEmailBody](c)
+				if err != nil {
+					return nil, err
+				}
+
+				err = app.AuthService().VerifyEmail(c.Request().Context(), body.Token)
+				if err != nil {
+					if errors.Is(err, service.ErrAuthServiceInvalidVerificationToken) {
+						return nil, InvalidVerificationToken()
+					}
+
+					return nil, err
+				}
+
+				return nil, nil
+			},
+		},
+
+		pyrin.ApiHandler{
+			Name:     "SetUserEmailVerified",
+			Method:   http.MethodPost,
+			Path:     "/users/:id/email/verified",
+			BodyType: SetUserEmailVerifiedBody{},
+			Errors:   []pyrin.ErrorType{ErrTypeUserNotFound},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				_, err := User(app, c, RequireAdmin)
+				if err != nil {
+					return nil, err
+				}
+
+				body, err := pyrin.Body[SetUserEmailVerifiedBody](c)
+				if err != nil {
+					return nil, err
+				}
+
+				user, err := getUserById(app, c.Param("id"))
+				if err != nil {
+					return nil, err
+				}
+
+				err = app.AuthService().SetEmailVerified(context.TODO(), user.Id, body.Verified)
+				if err != nil {
+					return nil, err
+				}
+
+				return nil, nil
+			},
+		},
+	)
+}
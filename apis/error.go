@@ -21,6 +21,44 @@ const (
 	ErrTypeUserNotFound       pyrin.ErrorType = "USER_NOT_FOUND"
 	ErrTypeInvalidCredentials pyrin.ErrorType = "INVALID_CREDENTIALS"
 
+	ErrTypeInvalidRefreshToken pyrin.ErrorType = "INVALID_REFRESH_TOKEN"
+	ErrTypeSessionNotFound     pyrin.ErrorType = "SESSION_NOT_FOUND"
+	ErrTypeInvalidOAuthClient  pyrin.ErrorType = "INVALID_OAUTH_CLIENT"
+
+	ErrTypeOAuthClientNotFound      pyrin.ErrorType = "OAUTH_CLIENT_NOT_FOUND"
+	ErrTypeOAuthClientAlreadyExists pyrin.ErrorType = "OAUTH_CLIENT_ALREADY_EXISTS"
+
+	ErrTypeInitialAccessTokenNotFound pyrin.ErrorType = "INITIAL_ACCESS_TOKEN_NOT_FOUND"
+	ErrTypeGrantNotFound              pyrin.ErrorType = "GRANT_NOT_FOUND"
+
+	ErrTypeInvalidRedirect pyrin.ErrorType = "INVALID_REDIRECT"
+
+	ErrTypeLocalAccountsDisabled pyrin.ErrorType = "LOCAL_ACCOUNTS_DISABLED"
+	ErrTypeInvalidResetToken     pyrin.ErrorType = "INVALID_RESET_TOKEN"
+
+	ErrTypeEmailNotVerified         pyrin.ErrorType = "EMAIL_NOT_VERIFIED"
+	ErrTypeInvalidVerificationToken pyrin.ErrorType = "INVALID_VERIFICATION_TOKEN"
+	ErrTypeProviderEmailNotVerified pyrin.ErrorType = "PROVIDER_EMAIL_NOT_VERIFIED"
+
+	ErrTypeMfaRequired         pyrin.ErrorType = "MFA_REQUIRED"
+	ErrTypeInvalidMfaChallenge pyrin.ErrorType = "INVALID_MFA_CHALLENGE"
+	ErrTypeInvalidMfaCode      pyrin.ErrorType = "INVALID_MFA_CODE"
+	ErrTypeTotpAlreadyEnabled  pyrin.ErrorType = "TOTP_ALREADY_ENABLED"
+	ErrTypeTotpNotEnabled      pyrin.ErrorType = "TOTP_NOT_ENABLED"
+	ErrTypeMfaNotEnabled       pyrin.ErrorType = "MFA_NOT_ENABLED"
+	ErrTypeReauthRequired      pyrin.ErrorType = "REAUTH_REQUIRED"
+	ErrTypeMfaLocked           pyrin.ErrorType = "MFA_LOCKED"
+
+	ErrTypeMagicLinksDisabled       pyrin.ErrorType = "MAGIC_LINKS_DISABLED"
+	ErrTypeMagicLinkRequestNotFound pyrin.ErrorType = "MAGIC_LINK_REQUEST_NOT_FOUND"
+	ErrTypeMagicLinkRequestNotReady pyrin.ErrorType = "MAGIC_LINK_REQUEST_NOT_READY"
+	ErrTypeTooManyMagicLinks        pyrin.ErrorType = "TOO_MANY_MAGIC_LINKS"
+
+	ErrTypePasskeysDisabled       pyrin.ErrorType = "PASSKEYS_DISABLED"
+	ErrTypePasskeyNotFound        pyrin.ErrorType = "PASSKEY_NOT_FOUND"
+	ErrTypePasskeyRequestNotFound pyrin.ErrorType = "PASSKEY_REQUEST_NOT_FOUND"
+	ErrTypeInvalidPasskey         pyrin.ErrorType = "INVALID_PASSKEY"
+
 	ErrTypePlaylistNotFound        pyrin.ErrorType = "PLAYLIST_NOT_FOUND"
 	ErrTypePlaylistAlreadyHasTrack pyrin.ErrorType = "PLAYLIST_ALREADY_HAS_TRACK"
 )
@@ -121,6 +159,230 @@ func InvalidCredentials() *pyrin.Error {
 	}
 }
 
+func InvalidRefreshToken() *pyrin.Error {
+	return &pyrin.Error{
+		Code:    http.StatusUnauthorized,
+		Type:    ErrTypeInvalidRefreshToken,
+		Message: "Invalid refresh token",
+	}
+}
+
+func SessionNotFound() *pyrin.Error {
+	return &pyrin.Error{
+		Code:    http.StatusNotFound,
+		Type:    ErrTypeSessionNotFound,
+		Message: "Session not found",
+	}
+}
+
+func InvalidOAuthClient(message string) *pyrin.Error {
+	return &pyrin.Error{
+		Code:    http.StatusBadRequest,
+		Type:    ErrTypeInvalidOAuthClient,
+		Message: "Invalid OAuth client: " + message,
+	}
+}
+
+func OAuthClientNotFound() *pyrin.Error {
+	return &pyrin.Error{
+		Code:    http.StatusNotFound,
+		Type:    ErrTypeOAuthClientNotFound,
+		Message: "OAuth client not found",
+	}
+}
+
+func OAuthClientAlreadyExists() *pyrin.Error {
+	return &pyrin.Error{
+		Code:    http.StatusBadRequest,
+		Type:    ErrTypeOAuthClientAlreadyExists,
+		Message: "OAuth client already exists",
+	}
+}
+
+func InitialAccessTokenNotFound() *pyrin.Error {
+	return &pyrin.Error{
+		Code:    http.StatusNotFound,
+		Type:    ErrTypeInitialAccessTokenNotFound,
+		Message: "Initial access token not found",
+	}
+}
+
+func GrantNotFound() *pyrin.Error {
+	return &pyrin.Error{
+		Code:    http.StatusNotFound,
+		Type:    ErrTypeGrantNotFound,
+		Message: "Grant not found",
+	}
+}
+
+func InvalidRedirect() *pyrin.Error {
+	return &pyrin.Error{
+		Code:    http.StatusBadRequest,
+		Type:    ErrTypeInvalidRedirect,
+		Message: "Redirect is not allowed",
+	}
+}
+
+func LocalAccountsDisabled() *pyrin.Error {
+	return &pyrin.Error{
+		Code:    http.StatusForbidden,
+		Type:    ErrTypeLocalAccountsDisabled,
+		Message: "Local accounts are disabled",
+	}
+}
+
+func InvalidResetToken() *pyrin.Error {
+	return &pyrin.Error{
+		Code:    http.StatusBadRequest,
+		Type:    ErrTypeInvalidResetToken,
+		Message: "Invalid or expired password reset link",
+	}
+}
+
+func EmailNotVerified() *pyrin.Error {
+	return &pyrin.Error{
+		Code:    http.StatusForbidden,
+		Type:    ErrTypeEmailNotVerified,
+		Message: "Email needs to be verified before logging in",
+	}
+}
+
+func ProviderEmailNotVerified() *pyrin.Error {
+	return &pyrin.Error{
+		Code:    http.StatusForbidden,
+		Type:    ErrTypeProviderEmailNotVerified,
+		Message: "The provider has not verified the email, an account with the email already exists",
+	}
+}
+
+func InvalidVerificationToken() *pyrin.Error {
+	return &pyrin.Error{
+		Code:    http.StatusBadRequest,
+		Type:    ErrTypeInvalidVerificationToken,
+		Message: "Invalid or expired email verification link",
+	}
+}
+
+func InvalidMfaChallenge() *pyrin.Error {
+	return &pyrin.Error{
+		Code:    http.StatusBadRequest,
+		Type:    ErrTypeInvalidMfaChallenge,
+		Message: "Invalid or expired login, please log in again",
+	}
+}
+
+func InvalidMfaCode() *pyrin.Error {
+	return &pyrin.Error{
+		Code:    http.StatusBadRequest,
+		Type:    ErrTypeInvalidMfaCode,
+		Message: "Invalid code",
+	}
+}
+
+func TotpAlreadyEnabled() *pyrin.Error {
+	return &pyrin.Error{
+		Code:    http.StatusBadRequest,
+		Type:    ErrTypeTotpAlreadyEnabled,
+		Message: "Authenticator app is already enabled",
+	}
+}
+
+func TotpNotEnabled() *pyrin.Error {
+	return &pyrin.Error{
+		Code:    http.StatusBadRequest,
+		Type:    ErrTypeTotpNotEnabled,
+		Message: "Authenticator app is not enabled",
+	}
+}
+
+func MfaNotEnabled() *pyrin.Error {
+	return &pyrin.Error{
+		Code:    http.StatusBadRequest,
+		Type:    ErrTypeMfaNotEnabled,
+		Message: "No second factor is enabled",
+	}
+}
+
+func ReauthRequired() *pyrin.Error {
+	return &pyrin.Error{
+		Code:    http.StatusForbidden,
+		Type:    ErrTypeReauthRequired,
+		Message: "Log in again to continue",
+	}
+}
+
+func MfaLocked() *pyrin.Error {
+	return &pyrin.Error{
+		Code:    http.StatusTooManyRequests,
+		Type:    ErrTypeMfaLocked,
+		Message: "Too many wrong codes, try again later",
+	}
+}
+
+func MagicLinksDisabled() *pyrin.Error {
+	return &pyrin.Error{
+		Code:    http.StatusForbidden,
+		Type:    ErrTypeMagicLinksDisabled,
+		Message: "Magic links are disabled",
+	}
+}
+
+func TooManyMagicLinks() *pyrin.Error {
+	return &pyrin.Error{
+		Code:    http.StatusTooManyRequests,
+		Type:    ErrTypeTooManyMagicLinks,
+		Message: "Too many login links requested, try again later",
+	}
+}
+
+func MagicLinkRequestNotFound() *pyrin.Error {
+	return &pyrin.Error{
+		Code:    http.StatusNotFound,
+		Type:    ErrTypeMagicLinkRequestNotFound,
+		Message: "Login request not found or expired",
+	}
+}
+
+func MagicLinkRequestNotReady() *pyrin.Error {
+	return &pyrin.Error{
+		Code:    http.StatusBadRequest,
+		Type:    ErrTypeMagicLinkRequestNotReady,
+		Message: "The link has not been opened yet",
+	}
+}
+
+func PasskeysDisabled() *pyrin.Error {
+	return &pyrin.Error{
+		Code:    http.StatusForbidden,
+		Type:    ErrTypePasskeysDisabled,
+		Message: "Passkeys are disabled",
+	}
+}
+
+func PasskeyNotFound() *pyrin.Error {
+	return &pyrin.Error{
+		Code:    http.StatusNotFound,
+		Type:    ErrTypePasskeyNotFound,
+		Message: "Passkey not found",
+	}
+}
+
+func PasskeyRequestNotFound() *pyrin.Error {
+	return &pyrin.Error{
+		Code:    http.StatusNotFound,
+		Type:    ErrTypePasskeyRequestNotFound,
+		Message: "Passkey request not found or expired",
+	}
+}
+
+func InvalidPasskey() *pyrin.Error {
+	return &pyrin.Error{
+		Code:    http.StatusBadRequest,
+		Type:    ErrTypeInvalidPasskey,
+		Message: "The passkey could not be verified",
+	}
+}
+
 func PlaylistNotFound() *pyrin.Error {
 	return &pyrin.Error{
 		Code:    http.StatusNotFound,
@@ -0,0 +1,232 @@
+package apis
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/nanoteck137/authlab/core"
+	"github.com/nanoteck137/authlab/service"
+	"github.com/nanoteck137/authlab/tools/utils"
+	"github.com/nanoteck137/pyrin"
+	"github.com/nanoteck137/pyrin/anvil"
+)
+
+const forwardSessionCookie = "authlab_forward_session"
+
+type AuthCreateForwardSession struct {
+	Redirect string `json:"redirect"`
+}
+
+type AuthCreateForwardSessionBody struct {
+	// The url the user tried to reach before the login, optional
+	Redirect string `json:"redirect"`
+}
+
+func (b *AuthCreateForwardSessionBody) Transform() {
+	b.Redirect = anvil.String(b.Redirect)
+}
+
+// forwardedUrl returns the url the user tried to reach. nginx sends the
+// url inside "X-Original-URL" while Traefik and Caddy splits it up into
+// the "X-Forwarded-*" headers.
+func forwardedUrl(r *http.Request) (*url.URL, error) {
+	if original := r.Header.Get("X-Original-URL"); original != "" {
+		u, err := url.Parse(original)
+		if err != nil || u.Host == "" {
+			return nil, errors.New("invalid X-Original-URL header")
+		}
+
+		return u, nil
+	}
+
+	host := r.Header.Get("X-Forwarded-Host")
+	if host == "" {
+		return nil, errors.New("missing X-Forwarded-Host header")
+	}
+
+	proto := r.Header.Get("X-Forwarded-Proto")
+	if proto == "" {
+		proto = "http"
+	}
+
+	uri := r.Header.Get("X-Forwarded-Uri")
+	if !strings.HasPrefix(uri, "/") {
+		uri = "/" + uri
+	}
+
+	u, err := url.Parse(proto + "://" + host + uri)
+	if err != nil {
+		return nil, errors.New("invalid X-Forwarded-* headers")
+	}
+
+	return u, nil
+}
+
+// forwardShouldRedirect checks if the user should be sent to the login
+// page, only page loads inside the browser are redirected. nginx can't
+// pass on redirects from auth_request so it always gets 401 and has to
+// redirect with "error_page 401".
+func forwardShouldRedirect(r *http.Request) bool {
+	if r.Header.Get("X-Original-URL") != "" {
+		return false
+	}
+
+	method := r.Header.Get("X-Forwarded-Method")
+	if method == "" {
+		method = r.Method
+	}
+
+	if method != http.MethodGet && method != http.MethodHead {
+		return false
+	}
+
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// forwardAuthenticate authenticates the request with the token headers
+// if the reverse proxy passed them on, otherwise with the session cookie
+func forwardAuthenticate(app core.App, c pyrin.Context) (authInfo, error) {
+	r := c.Request()
+
+	if r.Header.Get("X-Api-Token") != "" || utils.ParseAuthHeader(r.Header.Get("Authorization")) != "" {
+		return getAuth(app, c)
+	}
+
+	cookie, err := r.Cookie(forwardSessionCookie)
+	if err != nil || cookie.Value == "" {
+		return authInfo{}, InvalidAuth("missing session cookie")
+	}
+
+	return validateForwardSession(app, r.Context(), cookie.Value)
+}
+
+// InstallForwardAuthApiHandlers installs the endpoint the web app uses to
+// give the browser the session cookie after the login
+func InstallForwardAuthApiHandlers(app core.App, group pyrin.Group) {
+	group.Register(
+		pyrin.ApiHandler{
+			Name:         "AuthCreateForwardSession",
+			Method:       http.MethodPost,
+			Path:         "/auth/forward/session",
+			ResponseType: AuthCreateForwardSession{},
+			BodyType:     AuthCreateForwardSessionBody{},
+			Errors:       []pyrin.ErrorType{ErrTypeInvalidRedirect},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				body, err := pyrin.Body[AuthCreateForwardSessionBody](c)
+				if err != nil {
+					return nil, err
+				}
+
+				auth, err := getAuth(app, c)
+				if err != nil {
+					return nil, err
+				}
+
+				// NOTE(patrik): Api tokens can't be turned into a cookie,
+				// the cookie needs a session so it can be revoked
+				if auth.SessionId == "" {
+					return nil, InvalidAuth("token can't be used to create a session")
+				}
+
+				authService := app.AuthService()
+
+				if body.Redirect != "" && !authService.IsForwardRedirectAllowed(body.Redirect) {
+					return nil, InvalidRedirect()
+				}
+
+				value, expires, err := authService.CreateForwardSession(auth.User.Id, auth.SessionId)
+				if err != nil {
+					return nil, err
+				}
+
+				http.SetCookie(c.Response(), &http.Cookie{
+					Name:     forwardSessionCookie,
+					Value:    value,
+					Path:     "/",
+					Domain:   app.Config().ForwardAuth.CookieDomain,
+					Expires:  expires,
+					Secure:   strings.HasPrefix(PublicUrl(app, c), "https://"),
+					HttpOnly: true,
+					SameSite: http.SameSiteLaxMode,
+				})
+
+				return AuthCreateForwardSession{
+					Redirect: body.Redirect,
+				}, nil
+			},
+		},
+	)
+}
+
+// InstallForwardAuthHandlers installs the forward auth endpoint for
+// reverse proxies, Traefik (forwardAuth), Caddy (forward_auth) and nginx
+// (auth_request). The endpoint returns 200 with the "Remote-*" headers
+// when the user is allowed to reach the host.
+func InstallForwardAuthHandlers(app core.App, group pyrin.Group) {
+	handler := func(c pyrin.Context) error {
+		r := c.Request()
+		w := c.Response()
+
+		w.Header().Set("Cache-Control", "no-store")
+
+		originalUrl, err := forwardedUrl(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return nil
+		}
+
+		auth, err := forwardAuthenticate(app, c)
+		if err != nil {
+			var pyrinErr *pyrin.Error
+			if !errors.As(err, &pyrinErr) {
+				return err
+			}
+
+			if forwardShouldRedirect(r) {
+				loginUrl := PublicUrl(app, c) + "/login?rd=" + url.QueryEscape(originalUrl.String())
+				http.Redirect(w, r, loginUrl, http.StatusFound)
+				return nil
+			}
+
+			w.WriteHeader(http.StatusUnauthorized)
+			return nil
+		}
+
+		err = app.AuthService().CheckForwardAccess(&auth.User, originalUrl.Host)
+		if err != nil {
+			if errors.Is(err, service.ErrAuthServiceForwardAccessDenied) {
+				w.WriteHeader(http.StatusForbidden)
+				return nil
+			}
+
+			return err
+		}
+
+		header := w.Header()
+		header.Set("Remote-User", auth.User.Id)
+		header.Set("Remote-Email", auth.User.Email)
+		header.Set("Remote-Name", auth.User.DisplayName)
+		header.Set("Remote-Role", auth.User.Role)
+
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}
+
+	group.Register(
+		pyrin.NormalHandler{
+			Name:        "AuthForward",
+			Method:      http.MethodGet,
+			Path:        "/auth/forward",
+			HandlerFunc: handler,
+		},
+
+		pyrin.NormalHandler{
+			Name:        "AuthForwardHead",
+			Method:      http.MethodHead,
+			Path:        "/auth/forward",
+			HandlerFunc: handler,
+		},
+	)
+}
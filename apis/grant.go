@@ -0,0 +1,89 @@
+package apis
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/nanoteck137/authlab/core"
+	"github.com/nanoteck137/authlab/service"
+	"github.com/nanoteck137/pyrin"
+)
+
+type Grant struct {
+	ClientId      string   `json:"clientId"`
+	ClientName    string   `json:"clientName"`
+	ClientLogoUrl string   `json:"clientLogoUrl"`
+	Scopes        []string `json:"scopes"`
+	Created       string   `json:"created"`
+	Updated       string   `json:"updated"`
+}
+
+type GetGrants struct {
+	Grants []Grant `json:"grants"`
+}
+
+// InstallGrantHandlers installs the endpoints for the users to see and
+// revoke the clients they have given consent to
+func InstallGrantHandlers(app core.App, group pyrin.Group) {
+	group.Register(
+		pyrin.ApiHandler{
+			Name:         "GetGrants",
+			Method:       http.MethodGet,
+			Path:         "/user/grants",
+			ResponseType: GetGrants{},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				user, err := User(app, c)
+				if err != nil {
+					return nil, err
+				}
+
+				grants, err := app.AuthService().GetUserGrants(c.Request().Context(), user.Id)
+				if err != nil {
+					return nil, err
+				}
+
+				res := GetGrants{
+					Grants: make([]Grant, len(grants)),
+				}
+
+				for i, grant := range grants {
+					res.Grants[i] = Grant{
+						ClientId:      grant.Client.Id,
+						ClientName:    grant.Client.Name,
+						ClientLogoUrl: grant.Client.LogoUrl,
+						Scopes:        grant.Scopes,
+						Created:       grant.Created.Format(time.RFC3339Nano),
+						Updated:       grant.Updated.Format(time.RFC3339Nano),
+					}
+				}
+
+				return res, nil
+			},
+		},
+
+		pyrin.ApiHandler{
+			Name:   "RevokeGrant",
+			Method: http.MethodDelete,
+			Path:   "/user/grants/:clientId",
+			Errors: []pyrin.ErrorType{ErrTypeGrantNotFound},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				user, err := User(app, c)
+				if err != nil {
+					return nil, err
+				}
+
+				err = app.AuthService().RevokeUserGrant(c.Request().Context(), user.Id, c.Param("clientId"))
+				if err != nil {
+					if errors.Is(err, service.ErrAuthServiceGrantNotFound) {
+						return nil, GrantNotFound()
+					}
+
+					return nil, err
+				}
+
+				return nil, nil
+			},
+		},
+	)
+}
@@ -5,10 +5,19 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/nanoteck137/authlab/core"
 	"github.com/nanoteck137/authlab/database"
+	"github.com/nanoteck137/authlab/mailer"
+	"github.com/nanoteck137/authlab/service"
 	"github.com/nanoteck137/authlab/tools/utils"
 	"github.com/nanoteck137/authlab/types"
 	"github.com/nanoteck137/pyrin"
@@ -25,78 +34,504 @@ func RequireAdmin(user *database.User) error {
 }
 
 func User(app core.App, c pyrin.Context, checks ...UserCheckFunc) (*database.User, error) {
-	user, err := getUser(app, c)
+	auth, err := getAuth(app, c)
 	if err != nil {
 		return nil, err
 	}
 
 	for _, check := range checks {
-		err := check(user)
+		err := check(&auth.User)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	return user, nil
+	return &auth.User, nil
 }
 
-func getUser(app core.App, c pyrin.Context) (*database.User, error) {
-	apiTokenHeader := c.Request().Header.Get("X-Api-Token")
-	if apiTokenHeader != "" {
-		ctx := context.TODO()
-		token, err := app.DB().GetApiTokenById(ctx, apiTokenHeader)
+// Principal is the caller of a request, either a user or a machine
+// client using a token from the client credentials grant
+type Principal struct {
+	// Set when the caller is a user
+	User *database.User
+
+	// Set when the caller is a machine client
+	Client *service.OAuthClient
+
+	// The OAuth client the token was issued to, empty for the tokens
+	// issued to the first party clients and for api tokens
+	ClientId string
+
+	// The scopes of the token separated by spaces
+	Scope string
+
+	// The audiences of the token, the tokens issued to the users are
+	// only restricted to an audience when they come from the token
+	// exchange grant
+	Audience []string
+
+	// The clients acting on behalf of the user, the most recent actor
+	// first. Only set for tokens from the token exchange grant.
+	Actors []string
+}
+
+func (p *Principal) IsMachine() bool {
+	return p.Client != nil
+}
+
+// Id returns the id of the user or the machine client
+func (p *Principal) Id() string {
+	if p.Client != nil {
+		return p.Client.Id
+	}
+
+	return p.User.Id
+}
+
+// HasScope checks that the token has the scope, the tokens issued to the
+// first party clients and the api tokens has no scopes and are allowed
+// to do everything
+func (p *Principal) HasScope(scope string) bool {
+	if p.ClientId == "" {
+		return true
+	}
+
+	return slices.Contains(strings.Fields(p.Scope), scope)
+}
+
+type PrincipalCheckFunc func(principal *Principal) error
+
+func RequireMachine(principal *Principal) error {
+	if !principal.IsMachine() {
+		return InvalidAuth("endpoint requires a machine client")
+	}
+
+	return nil
+}
+
+func RequireScope(scope string) PrincipalCheckFunc {
+	return func(principal *Principal) error {
+		if !principal.HasScope(scope) {
+			return InvalidAuth(fmt.Sprintf("token requires the '%s' scope", scope))
+		}
+
+		return nil
+	}
+}
+
+// RequireAudience checks that the token was issued for the audience, the
+// tokens of machine clients and exchanged tokens are always checked
+// while the other tokens of the users has no audience
+func RequireAudience(audience string) PrincipalCheckFunc {
+	return func(principal *Principal) error {
+		restricted := principal.IsMachine() || len(principal.Audience) > 0
+		if restricted && !slices.Contains(principal.Audience, audience) {
+			return InvalidAuth(fmt.Sprintf("token is not issued for the '%s' audience", audience))
+		}
+
+		return nil
+	}
+}
+
+// GetPrincipal works like User but also accepts machine clients
+func GetPrincipal(app core.App, c pyrin.Context, checks ...PrincipalCheckFunc) (*Principal, error) {
+	auth, err := authenticate(app, c)
+	if err != nil {
+		return nil, err
+	}
+
+	principal := &Principal{
+		Client:   auth.Client,
+		ClientId: auth.ClientId,
+		Scope:    auth.Scope,
+		Audience: auth.Audience,
+		Actors:   auth.Actors,
+	}
+
+	if auth.Client == nil {
+		principal.User = &auth.User
+	}
+
+	for _, check := range checks {
+		err := check(principal)
 		if err != nil {
-			if errors.Is(err, database.ErrItemNotFound) {
-				return nil, InvalidAuth("invalid api token")
+			return nil, err
+		}
+	}
+
+	return principal, nil
+}
+
+const (
+	TokenTypeAccessToken  = "access_token"
+	TokenTypeRefreshToken = "refresh_token"
+	TokenTypeApiToken     = "api_token"
+
+	// The session cookie of the forward auth endpoint
+	TokenTypeForwardSession = "forward_session"
+)
+
+// authInfo is the result of authenticating a request or validating a
+// token
+type authInfo struct {
+	User database.User
+
+	// The type of the token, TokenTypeAccessToken, TokenTypeApiToken or
+	// TokenTypeForwardSession
+	TokenType string
+
+	// The session the JWT token was issued for, empty when the request
+	// was authenticated with an api token
+	SessionId string
+
+	// The id of the token, the "jti" claim for JWT tokens and the token
+	// itself for api tokens
+	TokenId string
+
+	// The scopes of the token separated by spaces, empty when the token
+	// has no scopes
+	Scope string
+
+	// The OAuth client the token was issued to, empty for the tokens
+	// issued to the first party clients and for api tokens
+	ClientId string
+
+	// The client that is the caller when the token was issued with the
+	// client credentials grant, User is empty for these tokens
+	Client *service.OAuthClient
+
+	// The audiences of tokens issued with the client credentials grant
+	// or the token exchange grant
+	Audience []string
+
+	// The clients that has exchanged the token, the most recent actor
+	// first
+	Actors []string
+
+	// When the token was issued, and when the token expires. Api tokens
+	// never expires so Expires is zero for them
+	IssuedAt time.Time
+	Expires  time.Time
+}
+
+// ClientInfo returns the infomation about the client that is saved
+// with new sessions
+func ClientInfo(app core.App, c pyrin.Context) service.ClientInfo {
+	r := c.Request()
+
+	return service.ClientInfo{
+		UserAgent: r.UserAgent(),
+		IpAddress: clientIp(app, r),
+	}
+}
+
+// clientIp returns the address of the client. Anyone can set the
+// X-Forwarded-For header, so it's only used when the request comes from
+// one of the "trusted_proxies", and the address is the first one from
+// the right that isn't a trusted proxy.
+func clientIp(app core.App, r *http.Request) string {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ip = host
+	}
+
+	trusted := app.Config().TrustedProxies
+	if !isTrustedProxy(trusted, ip) {
+		return ip
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr := strings.TrimSpace(forwarded[i])
+		if addr == "" {
+			continue
+		}
+
+		ip = addr
+
+		if !isTrustedProxy(trusted, addr) {
+			break
+		}
+	}
+
+	return ip
+}
+
+func isTrustedProxy(trusted []string, ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+
+	addr = addr.Unmap()
+
+	for _, proxy := range trusted {
+		if prefix, err := netip.ParsePrefix(proxy); err == nil {
+			if prefix.Contains(addr) {
+				return true
 			}
 
-			return nil, err
+			continue
 		}
 
-		user, err := app.DB().GetUserById(c.Request().Context(), token.UserId)
-		if err != nil {
-			return nil, InvalidAuth("invalid api token")
+		if proxyAddr, err := netip.ParseAddr(proxy); err == nil && proxyAddr.Unmap() == addr {
+			return true
 		}
+	}
+
+	return false
+}
+
+// getAuth authenticates the request, only the users of the first party
+// clients are accepted. Use GetPrincipal for endpoints that machine
+// clients and OAuth clients can call.
+func getAuth(app core.App, c pyrin.Context) (authInfo, error) {
+	info, err := authenticate(app, c)
+	if err != nil {
+		return authInfo{}, err
+	}
+
+	if info.Client != nil {
+		return authInfo{}, InvalidAuth("endpoint requires a user")
+	}
+
+	// NOTE(patrik): The tokens issued to OAuth clients are limited by
+	// their scopes, and the endpoints using getAuth doesn't check
+	// scopes
+	if info.ClientId != "" {
+		return authInfo{}, InvalidAuth("token is issued to an oauth client")
+	}
 
-		return &user, nil
+	// NOTE(patrik): Tokens with an audience are meant for other
+	// services
+	if len(info.Audience) > 0 {
+		return authInfo{}, InvalidAuth("token is issued for another audience")
+	}
+
+	return info, nil
+}
+
+func authenticate(app core.App, c pyrin.Context) (authInfo, error) {
+	ctx := c.Request().Context()
+
+	apiTokenHeader := c.Request().Header.Get("X-Api-Token")
+	if apiTokenHeader != "" {
+		return validateApiToken(app, ctx, apiTokenHeader)
 	}
 
 	authHeader := c.Request().Header.Get("Authorization")
 	tokenString := utils.ParseAuthHeader(authHeader)
 	if tokenString == "" {
-		return nil, InvalidAuth("invalid authorization header")
+		return authInfo{}, InvalidAuth("invalid authorization header")
 	}
 
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (any, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	return validateAccessToken(app, ctx, tokenString)
+}
+
+// validateApiToken checks that the api token exists and returns the
+// user it belongs to, returns InvalidAuth if the token is not valid
+func validateApiToken(app core.App, ctx context.Context, tokenId string) (authInfo, error) {
+	token, err := app.DB().GetApiTokenById(ctx, tokenId)
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return authInfo{}, InvalidAuth("invalid api token")
 		}
 
-		return []byte(app.Config().JwtSecret), nil
-	})
+		return authInfo{}, err
+	}
+
+	user, err := app.DB().GetUserById(ctx, token.UserId)
+	if err != nil {
+		return authInfo{}, InvalidAuth("invalid api token")
+	}
+
+	return authInfo{
+		User:      user,
+		TokenType: TokenTypeApiToken,
+		TokenId:   token.Id,
+		IssuedAt:  time.UnixMilli(token.Created),
+	}, nil
+}
+
+// validateForwardSession checks the session cookie of the forward auth
+// endpoint and that the session it was created for is still active,
+// returns InvalidAuth if the cookie is not valid
+func validateForwardSession(app core.App, ctx context.Context, value string) (authInfo, error) {
+	authService := app.AuthService()
+
+	userId, sessionId, err := authService.VerifyForwardSession(value)
+	if err != nil {
+		return authInfo{}, InvalidAuth("invalid session cookie")
+	}
+
+	err = authService.CheckSession(ctx, sessionId, userId)
+	if err != nil {
+		if errors.Is(err, service.ErrAuthServiceSessionNotFound) {
+			return authInfo{}, InvalidAuth("session revoked")
+		}
+
+		return authInfo{}, err
+	}
+
+	user, err := app.DB().GetUserById(ctx, userId)
+	if err != nil {
+		return authInfo{}, InvalidAuth("invalid session cookie")
+	}
+
+	return authInfo{
+		User:      user,
+		TokenType: TokenTypeForwardSession,
+		SessionId: sessionId,
+	}, nil
+}
+
+// validateAccessToken verifies the JWT access token and checks that the
+// session it was issued for is still active, returns InvalidAuth if the
+// token is not valid
+func validateAccessToken(app core.App, ctx context.Context, tokenString string) (authInfo, error) {
+	// NOTE(patrik): The key is picked by the "kid" header of the token,
+	// the key service makes sure the algorithm matches the key
+	keys := app.KeyService()
+	token, err := jwt.Parse(tokenString, keys.Keyfunc, jwt.WithValidMethods(keys.ValidMethods()))
 
 	if err != nil {
 		// TODO(patrik): Handle error better
-		return nil, InvalidAuth("invalid authorization token")
+		return authInfo{}, InvalidAuth("invalid authorization token")
 	}
 
-	jwtValidator := jwt.NewValidator(jwt.WithIssuedAt())
+	jwtValidator := jwt.NewValidator(jwt.WithIssuedAt(), jwt.WithExpirationRequired())
 
 	if claims, ok := token.Claims.(jwt.MapClaims); ok {
 		if err := jwtValidator.Validate(token.Claims); err != nil {
-			return nil, InvalidAuth("invalid authorization token")
+			return authInfo{}, InvalidAuth("invalid authorization token")
 		}
 
-		userId := claims["userId"].(string)
-		user, err := app.DB().GetUserById(c.Request().Context(), userId)
-		if err != nil {
-			return nil, InvalidAuth("invalid authorization token")
+		userId, _ := claims["userId"].(string)
+		sessionId, _ := claims["sid"].(string)
+		clientId, _ := claims["client_id"].(string)
+
+		// NOTE(patrik): Tokens from the client credentials grant has no
+		// user and no session, and tokens exchanged from api tokens has
+		// no session
+		actors := service.ParseActorClaim(claims["act"])
+		isMachine := userId == "" && sessionId == "" && clientId != ""
+		if !isMachine && (userId == "" || (sessionId == "" && len(actors) == 0)) {
+			return authInfo{}, InvalidAuth("invalid authorization token")
+		}
+
+		authService := app.AuthService()
+
+		// NOTE(patrik): Tokens from before the "jti" claim was added
+		// can't be revoked, they expire on their own
+		tokenId, _ := claims["jti"].(string)
+		if tokenId != "" {
+			revoked, err := authService.IsAccessTokenRevoked(ctx, tokenId)
+			if err != nil {
+				return authInfo{}, err
+			}
+
+			if revoked {
+				return authInfo{}, InvalidAuth("token revoked")
+			}
 		}
 
-		return &user, nil
+		res := authInfo{
+			TokenType: TokenTypeAccessToken,
+			TokenId:   tokenId,
+			ClientId:  clientId,
+			Actors:    actors,
+		}
+
+		if aud, err := claims.GetAudience(); err == nil {
+			res.Audience = aud
+		}
+
+		// NOTE(patrik): The client that exchanged the token needs to
+		// still be allowed to exchange tokens
+		if len(actors) > 0 {
+			_, err := authService.CheckClientGrant(ctx, actors[0], service.GrantTypeTokenExchange)
+			if err != nil {
+				if errors.Is(err, service.ErrAuthServiceUnauthorizedClient) {
+					return authInfo{}, InvalidAuth("client not allowed")
+				}
+
+				return authInfo{}, err
+			}
+		}
+
+		if isMachine {
+			client, err := authService.CheckClientGrant(ctx, clientId, service.GrantTypeClientCredentials)
+			if err != nil {
+				if errors.Is(err, service.ErrAuthServiceUnauthorizedClient) {
+					return authInfo{}, InvalidAuth("client not allowed")
+				}
+
+				return authInfo{}, err
+			}
+
+			res.Client = client
+		} else {
+			// Check that the session is still active, if the session
+			// was revoked then the token is not valid anymore
+			if sessionId != "" {
+				err := authService.CheckSession(ctx, sessionId, userId)
+				if err != nil {
+					if errors.Is(err, service.ErrAuthServiceSessionNotFound) {
+						return authInfo{}, InvalidAuth("session revoked")
+					}
+
+					return authInfo{}, err
+				}
+			}
+
+			user, err := app.DB().GetUserById(ctx, userId)
+			if err != nil {
+				return authInfo{}, InvalidAuth("invalid authorization token")
+			}
+
+			res.User = user
+			res.SessionId = sessionId
+		}
+
+		res.Scope, _ = claims["scope"].(string)
+
+		if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+			res.IssuedAt = iat.Time
+		}
+
+		if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+			res.Expires = exp.Time
+		}
+
+		return res, nil
 	}
 
-	return nil, InvalidAuth("invalid authorization token")
+	return authInfo{}, InvalidAuth("invalid authorization token")
+}
+
+// userDisplayName returns the name used when talking to the user, falls
+// back to the email for users without a display name
+func userDisplayName(user *database.User) string {
+	if user.DisplayName != "" {
+		return user.DisplayName
+	}
+
+	return user.Email
+}
+
+// sendMail sends the email in the background, so the response time of
+// the request doesn't depend on the mail server or tell if an email
+// was sent
+func sendMail(app core.App, msg mailer.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		err := app.Mailer().Send(ctx, msg)
+		if err != nil {
+			slog.Error("Failed to send email", "subject", msg.Subject, "err", err)
+		}
+	}()
 }
 
 func ConvertSqlNullString(value sql.NullString) *string {
@@ -114,3 +549,38 @@ func ConvertSqlNullInt64(value sql.NullInt64) *int64 {
 
 	return nil
 }
+
+// emailLinkUrl returns the address the links inside the emails points
+// to, only the "public_url" config is used. The links are never built
+// from the request, the Host header is picked by whoever sends the
+// request and the email goes to someone else.
+func emailLinkUrl(app core.App) (string, error) {
+	url := app.Config().PublicUrl
+	if url == "" {
+		return "", errors.New("public_url needs to be set to send emails with links")
+	}
+
+	return strings.TrimSuffix(url, "/"), nil
+}
+
+// PublicUrl returns the address that clients can reach authlab on,
+// uses the "public_url" config and falls back to the address of the
+// current request
+func PublicUrl(app core.App, c pyrin.Context) string {
+	if url := app.Config().PublicUrl; url != "" {
+		return strings.TrimSuffix(url, "/")
+	}
+
+	r := c.Request()
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+
+	return scheme + "://" + r.Host
+}
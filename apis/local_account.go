@@ -0,0 +1,335 @@
+package apis
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+
+	"github.com/nanoteck137/authlab/core"
+	"github.com/nanoteck137/authlab/mailer"
+	"github.com/nanoteck137/authlab/render"
+	"github.com/nanoteck137/authlab/service"
+	"github.com/nanoteck137/pyrin"
+	"github.com/nanoteck137/pyrin/anvil"
+	"github.com/nanoteck137/validate"
+	"github.com/nanoteck137/validate/is"
+)
+
+var usernameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]*$`)
+
+const (
+	minPasswordLength = 8
+
+	// NOTE(patrik): argon2 hashes the whole password, so the length is
+	// limited to stop huge passwords from being sent
+	maxPasswordLength = 256
+)
+
+func passwordRules() []validate.Rule {
+	return []validate.Rule{
+		validate.Required,
+		validate.Length(minPasswordLength, maxPasswordLength),
+	}
+}
+
+type AuthLocalSignup struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+type AuthLocalSignupBody struct {
+	Username    string `json:"username"`
+	Email       string `json:"email"`
+	Password    string `json:"password"`
+	DisplayName string `json:"displayName"`
+}
+
+func (b *AuthLocalSignupBody) Transform() {
+	b.Username = service.NormalizeUsername(b.Username)
+	b.Email = anvil.String(b.Email)
+	b.DisplayName = anvil.String(b.DisplayName)
+}
+
+func (b AuthLocalSignupBody) Validate() error {
+	return validate.ValidateStruct(&b,
+		validate.Field(&b.Username, validate.Required, validate.Length(3, 32), validate.Match(usernameRegex)),
+		validate.Field(&b.Email, validate.Required, is.EmailFormat),
+		validate.Field(&b.Password, passwordRules()...),
+	)
+}
+
+type AuthLocalLogin struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+type AuthLocalLoginBody struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func (b AuthLocalLoginBody) Validate() error {
+	return validate.ValidateStruct(&b,
+		validate.Field(&b.Username, validate.Required),
+		validate.Field(&b.Password, validate.Required),
+	)
+}
+
+type AuthChangePasswordBody struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+func (b AuthChangePasswordBody) Validate() error {
+	return validate.ValidateStruct(&b,
+		validate.Field(&b.CurrentPassword, validate.Required),
+		validate.Field(&b.NewPassword, passwordRules()...),
+	)
+}
+
+type AuthRequestPasswordResetBody struct {
+	Email string `json:"email"`
+}
+
+func (b *AuthRequestPasswordResetBody) Transform() {
+	b.Email = anvil.String(b.Email)
+}
+
+func (b AuthRequestPasswordResetBody) Validate() error {
+	return validate.ValidateStruct(&b,
+		validate.Field(&b.Email, validate.Required),
+	)
+}
+
+type AuthResetPasswordBody struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"newPassword"`
+}
+
+func (b AuthResetPasswordBody) Validate() error {
+	return validate.ValidateStruct(&b,
+		validate.Field(&b.Token, validate.Required),
+		validate.Field(&b.NewPassword, passwordRules()...),
+	)
+}
+
+func InstallLocalAccountHandlers(app core.App, group pyrin.Group) {
+	group.Register(
+		pyrin.ApiHandler{
+			Name:         "AuthLocalSignup",
+			Method:       http.MethodPost,
+			Path:         "/auth/local/signup",
+			ResponseType: AuthLocalSignup{},
+			BodyType:     AuthLocalSignupBody{},
+			Errors:       []pyrin.ErrorType{ErrTypeLocalAccountsDisabled, ErrTypeUserAlreadyExists, ErrTypeEmailNotVerified},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				body, err := pyrin.Body[AuthLocalSignupBody](c)
+				if err != nil {
+					return nil, err
+				}
+
+				tokens, err := app.AuthService().SignupLocalUser(c.Request().Context(), service.SignupLocalUserParams{
+					Username:    body.Username,
+					Email:       body.Email,
+					Password:    body.Password,
+					DisplayName: body.DisplayName,
+				}, ClientInfo(app, c))
+				if err != nil {
+					if errors.Is(err, service.ErrAuthServiceLocalAccountsDisabled) {
+						return nil, LocalAccountsDisabled()
+					}
+
+					if errors.Is(err, service.ErrAuthServiceUsernameTaken) ||
+						errors.Is(err, service.ErrAuthServiceEmailTaken) {
+						return nil, UserAlreadyExists()
+					}
+
+					// NOTE(patrik): The account is created but the user
+					// can't log in until the email is verified
+					if errors.Is(err, service.ErrAuthServiceEmailNotVerified) {
+						err := sendEmailVerification(app, c, body.Email)
+						if err != nil {
+							return nil, err
+						}
+
+						return nil, EmailNotVerified()
+					}
+
+					return nil, err
+				}
+
+				err = sendEmailVerification(app, c, body.Email)
+				if err != nil {
+					return nil, err
+				}
+
+				return AuthLocalSignup{
+					Token:        tokens.AccessToken,
+					RefreshToken: tokens.RefreshToken,
+				}, nil
+			},
+		},
+
+		pyrin.ApiHandler{
+			Name:         "AuthLocalLogin",
+			Method:       http.MethodPost,
+			Path:         "/auth/local/login",
+			ResponseType: AuthLocalLogin{},
+			BodyType:     AuthLocalLoginBody{},
+			Errors:       []pyrin.ErrorType{ErrTypeLocalAccountsDisabled, ErrTypeInvalidCredentials, ErrTypeEmailNotVerified, ErrTypeMfaRequired},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				body, err := pyrin.Body[AuthLocalLoginBody](c)
+				if err != nil {
+					return nil, err
+				}
+
+				tokens, err := app.AuthService().LoginLocalUser(c.Request().Context(), body.Username, body.Password, ClientInfo(app, c))
+				if err != nil {
+					if errors.Is(err, service.ErrAuthServiceLocalAccountsDisabled) {
+						return nil, LocalAccountsDisabled()
+					}
+
+					if errors.Is(err, service.ErrAuthServiceInvalidCredentials) {
+						return nil, InvalidCredentials()
+					}
+
+					if errors.Is(err, service.ErrAuthServiceEmailNotVerified) {
+						return nil, EmailNotVerified()
+					}
+
+					if errors.Is(err, service.ErrAuthServiceMfaRequired) {
+						return nil, MfaRequired(err)
+					}
+
+					return nil, err
+				}
+
+				return AuthLocalLogin{
+					Token:        tokens.AccessToken,
+					RefreshToken: tokens.RefreshToken,
+				}, nil
+			},
+		},
+
+		pyrin.ApiHandler{
+			Name:     "AuthChangePassword",
+			Method:   http.MethodPost,
+			Path:     "/auth/local/password",
+			BodyType: AuthChangePasswordBody{},
+			Errors:   []pyrin.ErrorType{ErrTypeLocalAccountsDisabled, ErrTypeInvalidCredentials},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				body, err := pyrin.Body[AuthChangePasswordBody](c)
+				if err != nil {
+					return nil, err
+				}
+
+				auth, err := getAuth(app, c)
+				if err != nil {
+					return nil, err
+				}
+
+				// NOTE(patrik): The password can only be changed by the
+				// user, not by api tokens
+				if auth.SessionId == "" {
+					return nil, InvalidAuth("token can't be used to change the password")
+				}
+
+				err = app.AuthService().ChangePassword(c.Request().Context(), auth.User.Id, auth.SessionId, body.CurrentPassword, body.NewPassword)
+				if err != nil {
+					if errors.Is(err, service.ErrAuthServiceLocalAccountsDisabled) {
+						return nil, LocalAccountsDisabled()
+					}
+
+					if errors.Is(err, service.ErrAuthServiceInvalidCredentials) {
+						return nil, InvalidCredentials()
+					}
+
+					return nil, err
+				}
+
+				return nil, nil
+			},
+		},
+
+		pyrin.ApiHandler{
+			Name:     "AuthRequestPasswordReset",
+			Method:   http.MethodPost,
+			Path:     "/auth/local/password/reset",
+			BodyType: AuthRequestPasswordResetBody{},
+			Errors:   []pyrin.ErrorType{ErrTypeLocalAccountsDisabled},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				body, err := pyrin.Body[AuthRequestPasswordResetBody](c)
+				if err != nil {
+					return nil, err
+				}
+
+				user, token, err := app.AuthService().CreatePasswordResetToken(c.Request().Context(), body.Email)
+				if err != nil {
+					if errors.Is(err, service.ErrAuthServiceLocalAccountsDisabled) {
+						return nil, LocalAccountsDisabled()
+					}
+
+					// NOTE(patrik): The response is the same if the user
+					// exists or not, so the endpoint can't be used to find
+					// out who has an account
+					if errors.Is(err, service.ErrAuthServiceUserNotFound) {
+						return nil, nil
+					}
+
+					return nil, err
+				}
+
+				linkUrl, err := emailLinkUrl(app)
+				if err != nil {
+					return nil, err
+				}
+
+				text, err := render.RenderPasswordResetMail(render.MailData{
+					UserName: userDisplayName(&user),
+					Link:     linkUrl + "/reset-password?token=" + url.QueryEscape(token),
+				})
+				if err != nil {
+					return nil, err
+				}
+
+				sendMail(app, mailer.Message{
+					To:      user.Email,
+					Subject: "Reset your password",
+					Text:    text,
+				})
+
+				return nil, nil
+			},
+		},
+
+		pyrin.ApiHandler{
+			Name:     "AuthResetPassword",
+			Method:   http.MethodPost,
+			Path:     "/auth/local/password/reset/confirm",
+			BodyType: AuthResetPasswordBody{},
+			Errors:   []pyrin.ErrorType{ErrTypeLocalAccountsDisabled, ErrTypeInvalidResetToken},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				body, err := pyrin.Body[AuthResetPasswordBody](c)
+				if err != nil {
+					return nil, err
+				}
+
+				err = app.AuthService().ResetPassword(c.Request().Context(), body.Token, body.NewPassword)
+				if err != nil {
+					if errors.Is(err, service.ErrAuthServiceLocalAccountsDisabled) {
+						return nil, LocalAccountsDisabled()
+					}
+
+					if errors.Is(err, service.ErrAuthServiceInvalidResetToken) {
+						return nil, InvalidResetToken()
+					}
+
+					return nil, err
+				}
+
+				return nil, nil
+			},
+		},
+	)
+}
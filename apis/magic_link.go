@@ -0,0 +1,279 @@
+package apis
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/nanoteck137/authlab/core"
+	"github.com/nanoteck137/authlab/mailer"
+	"github.com/nanoteck137/authlab/render"
+	"github.com/nanoteck137/authlab/service"
+	"github.com/nanoteck137/pyrin"
+	"github.com/nanoteck137/pyrin/anvil"
+	"github.com/nanoteck137/validate"
+	"github.com/nanoteck137/validate/is"
+)
+
+type AuthMagicLinkInitiate struct {
+	RequestId string `json:"requestId"`
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+	ExpiresAt string `json:"expiresAt"`
+}
+
+type AuthMagicLinkInitiateBody struct {
+	Email string `json:"email"`
+}
+
+func (b *AuthMagicLinkInitiateBody) Transform() {
+	b.Email = anvil.String(b.Email)
+}
+
+func (b AuthMagicLinkInitiateBody) Validate() error {
+	return validate.ValidateStruct(&b,
+		validate.Field(&b.Email, validate.Required, is.EmailFormat),
+	)
+}
+
+type AuthGetMagicLinkStatus struct {
+	Status string `json:"status"`
+}
+
+type AuthGetMagicLinkStatusBody struct {
+	RequestId string `json:"requestId"`
+	Challenge string `json:"challenge"`
+}
+
+type AuthFinishMagicLink struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+type AuthFinishMagicLinkBody struct {
+	RequestId string `json:"requestId"`
+	Challenge string `json:"challenge"`
+}
+
+func isMagicLinkRequestError(err error) bool {
+	return errors.Is(err, service.ErrAuthServiceRequestNotFound) ||
+		errors.Is(err, service.ErrAuthServiceRequestInvalid) ||
+		errors.Is(err, service.ErrAuthServiceRequestExpired) ||
+		errors.Is(err, service.ErrAuthServiceRequestAlreadyUsed)
+}
+
+// magicLinkUrl is the url sent inside the email
+func magicLinkUrl(app core.App, token string) (string, error) {
+	linkUrl, err := emailLinkUrl(app)
+	if err != nil {
+		return "", err
+	}
+
+	return linkUrl + "/auth/magic-link?token=" + url.QueryEscape(token), nil
+}
+
+func writeMagicLinkError(c pyrin.Context, err error) error {
+	switch {
+	case errors.Is(err, service.ErrAuthServiceRequestExpired):
+		return writeConsentHtml(c, http.StatusBadRequest, func(w http.ResponseWriter) error {
+			return render.RenderCallbackRequestExpired(w)
+		})
+	case errors.Is(err, service.ErrAuthServiceRequestAlreadyUsed):
+		return writeConsentHtml(c, http.StatusBadRequest, func(w http.ResponseWriter) error {
+			return render.RenderCallbackRequestAlreadyUsed(w)
+		})
+	case errors.Is(err, service.ErrAuthServiceRequestNotFound),
+		errors.Is(err, service.ErrAuthServiceRequestInvalid),
+		errors.Is(err, service.ErrAuthServiceMagicLinksDisabled):
+		return writeConsentHtml(c, http.StatusBadRequest, func(w http.ResponseWriter) error {
+			return render.RenderCallbackInvalidRequest(w)
+		})
+	}
+
+	slog.Error("Failed to handle magic link", "err", err)
+
+	return writeConsentHtml(c, http.StatusInternalServerError, func(w http.ResponseWriter) error {
+		return render.RenderCallbackError(w)
+	})
+}
+
+func InstallMagicLinkApiHandlers(app core.App, group pyrin.Group) {
+	group.Register(
+		pyrin.ApiHandler{
+			Name:         "AuthMagicLinkInitiate",
+			Method:       http.MethodPost,
+			Path:         "/auth/magic-link/initiate",
+			ResponseType: AuthMagicLinkInitiate{},
+			BodyType:     AuthMagicLinkInitiateBody{},
+			Errors:       []pyrin.ErrorType{ErrTypeMagicLinksDisabled, ErrTypeTooManyMagicLinks},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				body, err := pyrin.Body[AuthMagicLinkInitiateBody](c)
+				if err != nil {
+					return nil, err
+				}
+
+				res, err := app.AuthService().CreateMagicLinkRequest(c.Request().Context(), body.Email, ClientInfo(app, c))
+				if err != nil {
+					if errors.Is(err, service.ErrAuthServiceMagicLinksDisabled) {
+						return nil, MagicLinksDisabled()
+					}
+
+					if errors.Is(err, service.ErrAuthServiceTooManyRequests) {
+						return nil, TooManyMagicLinks()
+					}
+
+					return nil, err
+				}
+
+				link, err := magicLinkUrl(app, res.Token)
+				if err != nil {
+					return nil, err
+				}
+
+				text, err := render.RenderMagicLinkMail(render.MailData{
+					Link: link,
+					Code: res.Code,
+				})
+				if err != nil {
+					return nil, err
+				}
+
+				// NOTE(patrik): The email is sent even if there is no user
+				// with the email, the user is created when the link is
+				// opened
+				sendMail(app, mailer.Message{
+					To:      body.Email,
+					Subject: "Your login link",
+					Text:    text,
+				})
+
+				return AuthMagicLinkInitiate{
+					RequestId: res.RequestId,
+					Challenge: res.Challenge,
+					Code:      res.Code,
+					ExpiresAt: res.Expires.Format(time.RFC3339Nano),
+				}, nil
+			},
+		},
+
+		pyrin.ApiHandler{
+			Name:         "AuthGetMagicLinkStatus",
+			Method:       http.MethodPost,
+			Path:         "/auth/magic-link/status",
+			ResponseType: AuthGetMagicLinkStatus{},
+			BodyType:     AuthGetMagicLinkStatusBody{},
+			Errors:       []pyrin.ErrorType{ErrTypeMagicLinkRequestNotFound},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				body, err := pyrin.Body[AuthGetMagicLinkStatusBody](c)
+				if err != nil {
+					return nil, err
+				}
+
+				status, err := app.AuthService().CheckMagicLinkRequestStatus(c.Request().Context(), body.RequestId, body.Challenge)
+				if err != nil {
+					if isMagicLinkRequestError(err) {
+						return nil, MagicLinkRequestNotFound()
+					}
+
+					return nil, err
+				}
+
+				return AuthGetMagicLinkStatus{
+					Status: string(status),
+				}, nil
+			},
+		},
+
+		pyrin.ApiHandler{
+			Name:         "AuthFinishMagicLink",
+			Method:       http.MethodPost,
+			Path:         "/auth/magic-link/finish",
+			ResponseType: AuthFinishMagicLink{},
+			BodyType:     AuthFinishMagicLinkBody{},
+			Errors:       []pyrin.ErrorType{ErrTypeMagicLinkRequestNotFound, ErrTypeMagicLinkRequestNotReady, ErrTypeMfaRequired},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				body, err := pyrin.Body[AuthFinishMagicLinkBody](c)
+				if err != nil {
+					return nil, err
+				}
+
+				tokens, err := app.AuthService().CreateAuthTokenForMagicLink(c.Request().Context(), body.RequestId, body.Challenge, ClientInfo(app, c))
+				if err != nil {
+					if isMagicLinkRequestError(err) {
+						return nil, MagicLinkRequestNotFound()
+					}
+
+					if errors.Is(err, service.ErrAuthServiceRequestNotReady) {
+						return nil, MagicLinkRequestNotReady()
+					}
+
+					if errors.Is(err, service.ErrAuthServiceMfaRequired) {
+						return nil, MfaRequired(err)
+					}
+
+					return nil, err
+				}
+
+				return AuthFinishMagicLink{
+					Token:        tokens.AccessToken,
+					RefreshToken: tokens.RefreshToken,
+				}, nil
+			},
+		},
+	)
+}
+
+// InstallMagicLinkHandlers installs the page the link inside the email
+// opens, the page can be opened on another device than the one that
+// asked for the link
+func InstallMagicLinkHandlers(app core.App, group pyrin.Group) {
+	group.Register(
+		pyrin.NormalHandler{
+			Name:   "AuthMagicLink",
+			Method: http.MethodGet,
+			Path:   "/auth/magic-link",
+			HandlerFunc: func(c pyrin.Context) error {
+				token := c.Request().URL.Query().Get("token")
+
+				request, err := app.AuthService().GetMagicLinkRequest(c.Request().Context(), token)
+				if err != nil {
+					return writeMagicLinkError(c, err)
+				}
+
+				return writeConsentHtml(c, http.StatusOK, func(w http.ResponseWriter) error {
+					return render.RenderMagicLink(w, render.MagicLinkData{
+						Email:     request.Email,
+						Code:      request.Code,
+						UserAgent: request.UserAgent,
+						IpAddress: request.IpAddress,
+						Token:     token,
+					})
+				})
+			},
+		},
+
+		pyrin.NormalHandler{
+			Name:   "AuthMagicLinkConfirm",
+			Method: http.MethodPost,
+			Path:   "/auth/magic-link",
+			HandlerFunc: func(c pyrin.Context) error {
+				r := c.Request()
+				err := r.ParseForm()
+				if err != nil {
+					return writeMagicLinkError(c, service.ErrAuthServiceRequestInvalid)
+				}
+
+				err = app.AuthService().ConfirmMagicLink(r.Context(), r.PostForm.Get("token"))
+				if err != nil {
+					return writeMagicLinkError(c, err)
+				}
+
+				return writeConsentHtml(c, http.StatusOK, func(w http.ResponseWriter) error {
+					return render.RenderCallbackSuccess(w)
+				})
+			},
+		},
+	)
+}
@@ -0,0 +1,330 @@
+package apis
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/nanoteck137/authlab/core"
+	"github.com/nanoteck137/authlab/service"
+	"github.com/nanoteck137/pyrin"
+	"github.com/nanoteck137/pyrin/anvil"
+	"github.com/nanoteck137/validate"
+	"github.com/skip2/go-qrcode"
+)
+
+// MfaRequiredExtra is the extra data of the MFA_REQUIRED error, the
+// client completes the login by sending the challenge together with the
+// code to AuthVerifyMfa
+type MfaRequiredExtra struct {
+	Challenge string   `json:"challenge"`
+	Methods   []string `json:"methods"`
+	ExpiresAt string   `json:"expiresAt"`
+}
+
+func MfaRequired(err error) *pyrin.Error {
+	var extra MfaRequiredExtra
+
+	var mfaErr *service.MfaRequiredError
+	if errors.As(err, &mfaErr) {
+		extra = MfaRequiredExtra{
+			Challenge: mfaErr.Challenge,
+			Methods:   mfaErr.Methods,
+			ExpiresAt: mfaErr.Expires.Format(time.RFC3339Nano),
+		}
+	}
+
+	return &pyrin.Error{
+		Code:    http.StatusUnauthorized,
+		Type:    ErrTypeMfaRequired,
+		Message: "Second factor required",
+		Extra:   extra,
+	}
+}
+
+type GetMfaStatus struct {
+	TotpEnabled bool `json:"totpEnabled"`
+
+	// How many of the recovery codes hasn't been used
+	RecoveryCodesRemaining int `json:"recoveryCodesRemaining"`
+}
+
+type AuthEnrollTotp struct {
+	Secret string `json:"secret"`
+	Uri    string `json:"uri"`
+
+	// PNG of the QR code as a data url
+	QrCode string `json:"qrCode"`
+}
+
+type AuthConfirmTotp struct {
+	// Only set the first time a second factor is enabled, the codes
+	// can't be shown again
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+type AuthRegenerateRecoveryCodes struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+type AuthTotpCodeBody struct {
+	Code string `json:"code"`
+}
+
+func (b *AuthTotpCodeBody) Transform() {
+	b.Code = anvil.String(b.Code)
+}
+
+func (b AuthTotpCodeBody) Validate() error {
+	return validate.ValidateStruct(&b,
+		validate.Field(&b.Code, validate.Required),
+	)
+}
+
+type AuthVerifyMfa struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+type AuthVerifyMfaBody struct {
+	Challenge string `json:"challenge"`
+	Method    string `json:"method"`
+	Code      string `json:"code"`
+}
+
+func (b *AuthVerifyMfaBody) Transform() {
+	b.Code = anvil.String(b.Code)
+}
+
+func (b AuthVerifyMfaBody) Validate() error {
+	return validate.ValidateStruct(&b,
+		validate.Field(&b.Challenge, validate.Required),
+		validate.Field(&b.Method, validate.Required),
+		validate.Field(&b.Code, validate.Required),
+	)
+}
+
+// getMfaAuth returns the auth of the user managing the second factors,
+// only the user can do that not api tokens
+func getMfaAuth(app core.App, c pyrin.Context) (authInfo, error) {
+	auth, err := getAuth(app, c)
+	if err != nil {
+		return authInfo{}, err
+	}
+
+	if auth.SessionId == "" {
+		return authInfo{}, InvalidAuth("token can't be used to manage the second factors")
+	}
+
+	return auth, nil
+}
+
+func InstallMfaHandlers(app core.App, group pyrin.Group) {
+	group.Register(
+		pyrin.ApiHandler{
+			Name:         "GetMfaStatus",
+			Method:       http.MethodGet,
+			Path:         "/auth/mfa",
+			ResponseType: GetMfaStatus{},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				auth, err := getMfaAuth(app, c)
+				if err != nil {
+					return nil, err
+				}
+
+				ctx := c.Request().Context()
+
+				totpEnabled, err := app.AuthService().TotpEnabled(ctx, auth.User.Id)
+				if err != nil {
+					return nil, err
+				}
+
+				remaining, err := app.AuthService().RecoveryCodesRemaining(ctx, auth.User.Id)
+				if err != nil {
+					return nil, err
+				}
+
+				return GetMfaStatus{
+					TotpEnabled:            totpEnabled,
+					RecoveryCodesRemaining: remaining,
+				}, nil
+			},
+		},
+
+		pyrin.ApiHandler{
+			Name:         "AuthEnrollTotp",
+			Method:       http.MethodPost,
+			Path:         "/auth/mfa/totp/enroll",
+			ResponseType: AuthEnrollTotp{},
+			Errors:       []pyrin.ErrorType{ErrTypeTotpAlreadyEnabled, ErrTypeReauthRequired},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				auth, err := getMfaAuth(app, c)
+				if err != nil {
+					return nil, err
+				}
+
+				enrollment, err := app.AuthService().EnrollTotp(c.Request().Context(), auth.User, auth.SessionId)
+				if err != nil {
+					switch {
+					case errors.Is(err, service.ErrAuthServiceTotpAlreadyEnabled):
+						return nil, TotpAlreadyEnabled()
+					case errors.Is(err, service.ErrAuthServiceReauthRequired):
+						return nil, ReauthRequired()
+					}
+
+					return nil, err
+				}
+
+				png, err := qrcode.Encode(enrollment.Uri, qrcode.Medium, 256)
+				if err != nil {
+					return nil, err
+				}
+
+				return AuthEnrollTotp{
+					Secret: enrollment.Secret,
+					Uri:    enrollment.Uri,
+					QrCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+				}, nil
+			},
+		},
+
+		pyrin.ApiHandler{
+			Name:         "AuthConfirmTotp",
+			Method:       http.MethodPost,
+			Path:         "/auth/mfa/totp/confirm",
+			ResponseType: AuthConfirmTotp{},
+			BodyType:     AuthTotpCodeBody{},
+			Errors:       []pyrin.ErrorType{ErrTypeTotpAlreadyEnabled, ErrTypeTotpNotEnabled, ErrTypeInvalidMfaCode, ErrTypeReauthRequired},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				body, err := pyrin.Body[AuthTotpCodeBody](c)
+				if err != nil {
+					return nil, err
+				}
+
+				auth, err := getMfaAuth(app, c)
+				if err != nil {
+					return nil, err
+				}
+
+				recoveryCodes, err := app.AuthService().ConfirmTotp(c.Request().Context(), auth.User.Id, auth.SessionId, body.Code, ClientInfo(app, c))
+				if err != nil {
+					switch {
+					case errors.Is(err, service.ErrAuthServiceTotpAlreadyEnabled):
+						return nil, TotpAlreadyEnabled()
+					case errors.Is(err, service.ErrAuthServiceTotpNotEnabled):
+						return nil, TotpNotEnabled()
+					case errors.Is(err, service.ErrAuthServiceInvalidMfaCode):
+						return nil, InvalidMfaCode()
+					case errors.Is(err, service.ErrAuthServiceReauthRequired):
+						return nil, ReauthRequired()
+					}
+
+					return nil, err
+				}
+
+				return AuthConfirmTotp{
+					RecoveryCodes: recoveryCodes,
+				}, nil
+			},
+		},
+
+		pyrin.ApiHandler{
+			Name:     "AuthDisableTotp",
+			Method:   http.MethodPost,
+			Path:     "/auth/mfa/totp/disable",
+			BodyType: AuthTotpCodeBody{},
+			Errors:   []pyrin.ErrorType{ErrTypeTotpNotEnabled, ErrTypeInvalidMfaCode},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				body, err := pyrin.Body[AuthTotpCodeBody](c)
+				if err != nil {
+					return nil, err
+				}
+
+				auth, err := getMfaAuth(app, c)
+				if err != nil {
+					return nil, err
+				}
+
+				err = app.AuthService().DisableTotp(c.Request().Context(), auth.User.Id, body.Code)
+				if err != nil {
+					switch {
+					case errors.Is(err, service.ErrAuthServiceTotpNotEnabled):
+						return nil, TotpNotEnabled()
+					case errors.Is(err, service.ErrAuthServiceInvalidMfaCode):
+						return nil, InvalidMfaCode()
+					}
+
+					return nil, err
+				}
+
+				return nil, nil
+			},
+		},
+
+		pyrin.ApiHandler{
+			Name:         "AuthRegenerateRecoveryCodes",
+			Method:       http.MethodPost,
+			Path:         "/auth/mfa/recovery-codes",
+			ResponseType: AuthRegenerateRecoveryCodes{},
+			Errors:       []pyrin.ErrorType{ErrTypeMfaNotEnabled, ErrTypeReauthRequired},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				auth, err := getMfaAuth(app, c)
+				if err != nil {
+					return nil, err
+				}
+
+				recoveryCodes, err := app.AuthService().RegenerateRecoveryCodes(c.Request().Context(), auth.User.Id, auth.SessionId, ClientInfo(app, c))
+				if err != nil {
+					switch {
+					case errors.Is(err, service.ErrAuthServiceMfaNotEnabled):
+						return nil, MfaNotEnabled()
+					case errors.Is(err, service.ErrAuthServiceReauthRequired):
+						return nil, ReauthRequired()
+					}
+
+					return nil, err
+				}
+
+				return AuthRegenerateRecoveryCodes{
+					RecoveryCodes: recoveryCodes,
+				}, nil
+			},
+		},
+
+		pyrin.ApiHandler{
+			Name:         "AuthVerifyMfa",
+			Method:       http.MethodPost,
+			Path:         "/auth/mfa/verify",
+			ResponseType: AuthVerifyMfa{},
+			BodyType:     AuthVerifyMfaBody{},
+			Errors:       []pyrin.ErrorType{ErrTypeInvalidMfaChallenge, ErrTypeInvalidMfaCode, ErrTypeMfaLocked},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				body, err := pyrin.Body[AuthVerifyMfaBody](c)
+				if err != nil {
+					return nil, err
+				}
+
+				tokens, err := app.AuthService().CompleteMfaChallenge(c.Request().Context(), body.Challenge, body.Method, body.Code, ClientInfo(app, c))
+				if err != nil {
+					switch {
+					case errors.Is(err, service.ErrAuthServiceInvalidMfaChallenge):
+						return nil, InvalidMfaChallenge()
+					case errors.Is(err, service.ErrAuthServiceInvalidMfaCode),
+						errors.Is(err, service.ErrAuthServiceUnknownMfaMethod):
+						return nil, InvalidMfaCode()
+					case errors.Is(err, service.ErrAuthServiceMfaLocked):
+						return nil, MfaLocked()
+					}
+
+					return nil, err
+				}
+
+				return AuthVerifyMfa{
+					Token:        tokens.AccessToken,
+					RefreshToken: tokens.RefreshToken,
+				}, nil
+			},
+		},
+	)
+}
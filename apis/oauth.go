@@ -0,0 +1,817 @@
+package apis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nanoteck137/authlab/core"
+	"github.com/nanoteck137/authlab/database"
+	"github.com/nanoteck137/authlab/service"
+	"github.com/nanoteck137/pyrin"
+)
+
+const (
+	GrantTypeAuthorizationCode = service.GrantTypeAuthorizationCode
+	GrantTypeRefreshToken      = service.GrantTypeRefreshToken
+	GrantTypeClientCredentials = service.GrantTypeClientCredentials
+	GrantTypeTokenExchange     = service.GrantTypeTokenExchange
+	GrantTypeDeviceCode        = service.GrantTypeDeviceCode
+)
+
+const ResponseTypeCode = "code"
+
+// NOTE(patrik): Token types used by the token exchange grant (RFC 8693
+// section 3), the api tokens uses our own type
+const (
+	TokenTypeUrnAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeUrnJwt         = "urn:ietf:params:oauth:token-type:jwt"
+	TokenTypeUrnApiToken    = "urn:authlab:params:oauth:token-type:api_token"
+)
+
+// NOTE(patrik): Error codes from RFC 6749, RFC 6750, RFC 8628 and
+// RFC 8707
+const (
+	OAuthErrInvalidRequest       = "invalid_request"
+	OAuthErrInvalidClient        = "invalid_client"
+	OAuthErrUnauthorizedClient   = "unauthorized_client"
+	OAuthErrInvalidGrant         = "invalid_grant"
+	OAuthErrUnsupportedGrantType = "unsupported_grant_type"
+	OAuthErrAuthorizationPending = "authorization_pending"
+	OAuthErrSlowDown             = "slow_down"
+	OAuthErrAccessDenied         = "access_denied"
+	OAuthErrExpiredToken         = "expired_token"
+	OAuthErrServerError          = "server_error"
+	OAuthErrInvalidToken         = "invalid_token"
+	OAuthErrInvalidScope         = "invalid_scope"
+	OAuthErrUnsupportedResponse  = "unsupported_response_type"
+	OAuthErrInsufficientScope    = "insufficient_scope"
+	OAuthErrInvalidTarget        = "invalid_target"
+
+	// NOTE(patrik): Not from a RFC, used when the user of the device
+	// code grant has a second factor enabled
+	OAuthErrMfaRequired = "mfa_required"
+)
+
+type OAuthError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// OAuthMfaRequired is the "mfa_required" error, the device completes the
+// login by sending the challenge together with the code to AuthVerifyMfa
+type OAuthMfaRequired struct {
+	Error            string   `json:"error"`
+	ErrorDescription string   `json:"error_description,omitempty"`
+	MfaChallenge     string   `json:"mfa_challenge"`
+	MfaMethods       []string `json:"mfa_methods"`
+	ExpiresIn        int64    `json:"expires_in"`
+}
+
+type OAuthDeviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationUri         string `json:"verification_uri"`
+	VerificationUriComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+type OAuthToken struct {
+	AccessToken     string `json:"access_token"`
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+	TokenType       string `json:"token_type"`
+	ExpiresIn       int64  `json:"expires_in,omitempty"`
+	RefreshToken    string `json:"refresh_token,omitempty"`
+	IdToken         string `json:"id_token,omitempty"`
+	Scope           string `json:"scope,omitempty"`
+}
+
+// OAuthIntrospection is the response of the introspection endpoint
+// (RFC 7662), only "active" is set when the token is not active
+type OAuthIntrospection struct {
+	Active    bool     `json:"active"`
+	Sub       string   `json:"sub,omitempty"`
+	Username  string   `json:"username,omitempty"`
+	ClientId  string   `json:"client_id,omitempty"`
+	Aud       []string `json:"aud,omitempty"`
+	Scope     string   `json:"scope,omitempty"`
+	TokenType string   `json:"token_type,omitempty"`
+	Exp       int64    `json:"exp,omitempty"`
+	Iat       int64    `json:"iat,omitempty"`
+	Sid       string   `json:"sid,omitempty"`
+	Role      string   `json:"role,omitempty"`
+
+	// The clients acting on behalf of the user, set for tokens from
+	// the token exchange grant
+	Act map[string]any `json:"act,omitempty"`
+}
+
+func newOAuthToken(tokens service.UserTokens) OAuthToken {
+	return OAuthToken{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(time.Until(tokens.AccessTokenExpires) / time.Second),
+		RefreshToken: tokens.RefreshToken,
+	}
+}
+
+// writeOAuthJson writes the response the way the OAuth2 RFCs wants it,
+// without the pyrin response wrapper
+func writeOAuthJson(c pyrin.Context, status int, data any) error {
+	w := c.Response()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(status)
+
+	return json.NewEncoder(w).Encode(data)
+}
+
+func writeOAuthError(c pyrin.Context, status int, code, description string) error {
+	return writeOAuthJson(c, status, OAuthError{
+		Error:            code,
+		ErrorDescription: description,
+	})
+}
+
+// DeviceVerificationUrl returns the url the user should visit to
+// enter the quick connect code
+func DeviceVerificationUrl(app core.App, c pyrin.Context) string {
+	return PublicUrl(app, c) + "/device"
+}
+
+func InstallOAuthHandlers(app core.App, group pyrin.Group) {
+	group.Register(
+		pyrin.NormalHandler{
+			Name:   "OAuthDeviceAuthorization",
+			Method: http.MethodPost,
+			Path:   "/oauth/device_authorization",
+			HandlerFunc: func(c pyrin.Context) error {
+				err := c.Request().ParseForm()
+				if err != nil {
+					return writeOAuthError(c, http.StatusBadRequest, OAuthErrInvalidRequest, "failed to parse form")
+				}
+
+				form := c.Request().PostForm
+
+				client, err := authenticateClient(app, c, form)
+				if err != nil {
+					return writeClientError(c, err)
+				}
+
+				authService := app.AuthService()
+
+				res, err := authService.CreateDeviceAuthorization(client, form.Get("scope"))
+				if err != nil {
+					switch {
+					case errors.Is(err, service.ErrAuthServiceUnauthorizedClient):
+						return writeOAuthError(c, http.StatusBadRequest, OAuthErrUnauthorizedClient, "")
+					case errors.Is(err, service.ErrAuthServiceInvalidScope):
+						return writeOAuthError(c, http.StatusBadRequest, OAuthErrInvalidScope, "")
+					}
+
+					return writeOAuthError(c, http.StatusInternalServerError, OAuthErrServerError, "")
+				}
+
+				verificationUri := DeviceVerificationUrl(app, c)
+
+				return writeOAuthJson(c, http.StatusOK, OAuthDeviceAuthorization{
+					DeviceCode:              res.Challenge,
+					UserCode:                res.Code,
+					VerificationUri:         verificationUri,
+					VerificationUriComplete: verificationUri + "?code=" + url.QueryEscape(res.Code),
+					ExpiresIn:               int64(time.Until(res.Expires) / time.Second),
+					Interval:                int64(res.Interval / time.Second),
+				})
+			},
+		},
+
+		pyrin.NormalHandler{
+			Name:   "OAuthToken",
+			Method: http.MethodPost,
+			Path:   "/oauth/token",
+			HandlerFunc: func(c pyrin.Context) error {
+				err := c.Request().ParseForm()
+				if err != nil {
+					return writeOAuthError(c, http.StatusBadRequest, OAuthErrInvalidRequest, "failed to parse form")
+				}
+
+				form := c.Request().PostForm
+
+				switch form.Get("grant_type") {
+				case GrantTypeAuthorizationCode:
+					return handleAuthorizationCodeGrant(app, c, form)
+				case GrantTypeRefreshToken:
+					return handleRefreshTokenGrant(app, c, form)
+				case GrantTypeDeviceCode:
+					return handleDeviceCodeGrant(app, c, form)
+				case GrantTypeClientCredentials:
+					return handleClientCredentialsGrant(app, c, form)
+				case GrantTypeTokenExchange:
+					return handleTokenExchangeGrant(app, c, form)
+				case "":
+					return writeOAuthError(c, http.StatusBadRequest, OAuthErrInvalidRequest, "missing grant_type")
+				default:
+					return writeOAuthError(c, http.StatusBadRequest, OAuthErrUnsupportedGrantType, "")
+				}
+			},
+		},
+
+		pyrin.NormalHandler{
+			Name:   "OAuthIntrospect",
+			Method: http.MethodPost,
+			Path:   "/oauth/introspect",
+			HandlerFunc: func(c pyrin.Context) error {
+				err := c.Request().ParseForm()
+				if err != nil {
+					return writeOAuthError(c, http.StatusBadRequest, OAuthErrInvalidRequest, "failed to parse form")
+				}
+
+				form := c.Request().PostForm
+
+				// NOTE(patrik): Introspection is for the resource servers,
+				// the caller is a confidential client that authenticates
+				// with the client credentials or with a token from the
+				// client credentials grant (RFC 7662 section 2.1)
+				err = authenticateIntrospectionClient(app, c, form)
+				if err != nil {
+					return writeClientError(c, err)
+				}
+
+				token := form.Get("token")
+				if token == "" {
+					return writeOAuthError(c, http.StatusBadRequest, OAuthErrInvalidRequest, "missing token")
+				}
+
+				info, err := introspectToken(app, c, token, form.Get("token_type_hint"))
+				if err != nil {
+					var pyrinErr *pyrin.Error
+					if errors.As(err, &pyrinErr) {
+						return writeOAuthJson(c, http.StatusOK, OAuthIntrospection{Active: false})
+					}
+
+					return writeOAuthError(c, http.StatusInternalServerError, OAuthErrServerError, "")
+				}
+
+				res := OAuthIntrospection{
+					Active:    true,
+					Sub:       info.User.Id,
+					Username:  info.User.Email,
+					ClientId:  info.ClientId,
+					Aud:       info.Audience,
+					Scope:     info.Scope,
+					TokenType: info.TokenType,
+					Sid:       info.SessionId,
+					Role:      info.User.Role,
+					Act:       service.ActorClaim(info.Actors),
+				}
+
+				// NOTE(patrik): The subject of tokens from the client
+				// credentials grant is the client
+				if info.Client != nil {
+					res.Sub = info.Client.Id
+				}
+
+				if !info.IssuedAt.IsZero() {
+					res.Iat = info.IssuedAt.Unix()
+				}
+
+				if !info.Expires.IsZero() {
+					res.Exp = info.Expires.Unix()
+				}
+
+				return writeOAuthJson(c, http.StatusOK, res)
+			},
+		},
+
+		pyrin.NormalHandler{
+			Name:   "OAuthRevoke",
+			Method: http.MethodPost,
+			Path:   "/oauth/revoke",
+			HandlerFunc: func(c pyrin.Context) error {
+				err := c.Request().ParseForm()
+				if err != nil {
+					return writeOAuthError(c, http.StatusBadRequest, OAuthErrInvalidRequest, "failed to parse form")
+				}
+
+				form := c.Request().PostForm
+
+				token := form.Get("token")
+				if token == "" {
+					return writeOAuthError(c, http.StatusBadRequest, OAuthErrInvalidRequest, "missing token")
+				}
+
+				// NOTE(patrik): The clients can only revoke the tokens
+				// issued to them, and the first party clients sends no
+				// client, a client that is sent needs to authenticate
+				// (RFC 7009 section 2.1). Unknown and invalid tokens are
+				// not errors
+				clientId := ""
+				if _, ok := requestClientId(c, form); ok {
+					client, err := authenticateClient(app, c, form)
+					if err != nil {
+						return writeClientError(c, err)
+					}
+
+					clientId = client.Id
+				}
+
+				err = revokeToken(app, c, token, form.Get("token_type_hint"), clientId)
+				if err != nil {
+					if errors.Is(err, service.ErrAuthServiceTokenClientMismatch) {
+						return writeOAuthError(c, http.StatusBadRequest, OAuthErrUnauthorizedClient, "token was issued to another client")
+					}
+
+					return writeOAuthError(c, http.StatusInternalServerError, OAuthErrServerError, "")
+				}
+
+				c.Response().Header().Set("Cache-Control", "no-store")
+				c.Response().WriteHeader(http.StatusOK)
+
+				return nil
+			},
+		},
+	)
+}
+
+// tokenRevoker revokes the token if it's the type the revoker handles,
+// returns false if the token was not found. The token needs to be
+// issued to the client, ErrAuthServiceTokenClientMismatch is returned
+// otherwise
+type tokenRevoker func(app core.App, ctx context.Context, token, clientId string) (bool, error)
+
+var tokenRevokers = map[string]tokenRevoker{
+	TokenTypeAccessToken:  revokeAccessToken,
+	TokenTypeRefreshToken: revokeRefreshToken,
+	TokenTypeApiToken:     revokeApiToken,
+}
+
+// revokeToken tries to revoke the token as the type from the hint
+// first, and then the other types
+func revokeToken(app core.App, c pyrin.Context, token, hint, clientId string) error {
+	ctx := c.Request().Context()
+
+	order := []string{
+		TokenTypeAccessToken,
+		TokenTypeRefreshToken,
+		TokenTypeApiToken,
+	}
+
+	if idx := slices.Index(order, hint); idx != -1 {
+		order = slices.Delete(order, idx, idx+1)
+		order = slices.Insert(order, 0, hint)
+	}
+
+	for _, tokenType := range order {
+		found, err := tokenRevokers[tokenType](app, ctx, token, clientId)
+		if err != nil {
+			return err
+		}
+
+		if found {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func revokeAccessToken(app core.App, ctx context.Context, token, clientId string) (bool, error) {
+	if strings.Count(token, ".") != 2 {
+		return false, nil
+	}
+
+	info, err := validateAccessToken(app, ctx, token)
+	if err != nil {
+		var pyrinErr *pyrin.Error
+		if errors.As(err, &pyrinErr) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	if info.ClientId != clientId {
+		return false, service.ErrAuthServiceTokenClientMismatch
+	}
+
+	// NOTE(patrik): Tokens without a "jti" claim can't be added to the
+	// denylist, they are short lived so we let them expire
+	if info.TokenId == "" {
+		return true, nil
+	}
+
+	err = app.AuthService().RevokeAccessToken(ctx, info.TokenId, info.Expires)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func revokeRefreshToken(app core.App, ctx context.Context, token, clientId string) (bool, error) {
+	err := app.AuthService().RevokeRefreshToken(ctx, token, clientId)
+	if err != nil {
+		if errors.Is(err, service.ErrAuthServiceInvalidRefreshToken) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+func revokeApiToken(app core.App, ctx context.Context, token, clientId string) (bool, error) {
+	apiToken, err := app.DB().GetApiTokenById(ctx, token)
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	// NOTE(patrik): Api tokens are never issued to OAuth clients
+	if clientId != "" {
+		return false, service.ErrAuthServiceTokenClientMismatch
+	}
+
+	err = app.DB().DeleteApiToken(ctx, apiToken.Id)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// authenticateIntrospectionClient authenticates the caller of the
+// introspection endpoint, public clients can't prove who they are so
+// they are not allowed
+func authenticateIntrospectionClient(app core.App, c pyrin.Context, form url.Values) error {
+	if _, _, ok := c.Request().BasicAuth(); !ok && form.Get("client_id") == "" {
+		auth, err := authenticate(app, c)
+		if err != nil {
+			var pyrinErr *pyrin.Error
+			if errors.As(err, &pyrinErr) {
+				return service.ErrAuthServiceInvalidClient
+			}
+
+			return err
+		}
+
+		if auth.Client == nil {
+			return service.ErrAuthServiceInvalidClient
+		}
+
+		return nil
+	}
+
+	client, err := authenticateClient(app, c, form)
+	if err != nil {
+		return err
+	}
+
+	if client.IsPublic() {
+		return service.ErrAuthServiceInvalidClient
+	}
+
+	return nil
+}
+
+// introspectToken validates the token as the type from the hint first,
+// and falls back to the other type
+func introspectToken(app core.App, c pyrin.Context, token, hint string) (authInfo, error) {
+	ctx := c.Request().Context()
+
+	// NOTE(patrik): JWTs always has 3 parts, api tokens never contains
+	// dots so this is used when there is no hint
+	isJwt := strings.Count(token, ".") == 2
+	switch hint {
+	case TokenTypeAccessToken:
+		isJwt = true
+	case TokenTypeApiToken:
+		isJwt = false
+	}
+
+	validators := []func(core.App, context.Context, string) (authInfo, error){
+		validateApiToken,
+		validateAccessToken,
+	}
+
+	if isJwt {
+		slices.Reverse(validators)
+	}
+
+	var err error
+	for _, validate := range validators {
+		var info authInfo
+		info, err = validate(app, ctx, token)
+		if err == nil {
+			return info, nil
+		}
+
+		var pyrinErr *pyrin.Error
+		if !errors.As(err, &pyrinErr) {
+			return authInfo{}, err
+		}
+	}
+
+	return authInfo{}, err
+}
+
+func handleDeviceCodeGrant(app core.App, c pyrin.Context, form url.Values) error {
+	client, err := authenticateClient(app, c, form)
+	if err != nil {
+		return writeClientError(c, err)
+	}
+
+	deviceCode := form.Get("device_code")
+	if deviceCode == "" {
+		return writeOAuthError(c, http.StatusBadRequest, OAuthErrInvalidRequest, "missing device_code")
+	}
+
+	authService := app.AuthService()
+
+	tokens, err := authService.CreateAuthTokenForDeviceCode(client, deviceCode, ClientInfo(app, c))
+	if err != nil {
+		var mfaErr *service.MfaRequiredError
+		if errors.As(err, &mfaErr) {
+			return writeOAuthJson(c, http.StatusForbidden, OAuthMfaRequired{
+				Error:            OAuthErrMfaRequired,
+				ErrorDescription: "the user needs to complete the second factor",
+				MfaChallenge:     mfaErr.Challenge,
+				MfaMethods:       mfaErr.Methods,
+				ExpiresIn:        int64(time.Until(mfaErr.Expires) / time.Second),
+			})
+		}
+
+		switch {
+		case errors.Is(err, service.ErrAuthServiceUnauthorizedClient):
+			return writeOAuthError(c, http.StatusBadRequest, OAuthErrUnauthorizedClient, "")
+		case errors.Is(err, service.ErrAuthServiceAuthorizationPending):
+			return writeOAuthError(c, http.StatusBadRequest, OAuthErrAuthorizationPending, "")
+		case errors.Is(err, service.ErrAuthServiceSlowDown):
+			return writeOAuthError(c, http.StatusBadRequest, OAuthErrSlowDown, "")
+		case errors.Is(err, service.ErrAuthServiceRequestExpired):
+			return writeOAuthError(c, http.StatusBadRequest, OAuthErrExpiredToken, "")
+		case errors.Is(err, service.ErrAuthServiceRequestDenied):
+			return writeOAuthError(c, http.StatusBadRequest, OAuthErrAccessDenied, "")
+		case errors.Is(err, service.ErrAuthServiceEmailNotVerified):
+			return writeOAuthError(c, http.StatusBadRequest, OAuthErrAccessDenied, "the email of the user is not verified")
+		case errors.Is(err, service.ErrAuthServiceRequestNotFound),
+			errors.Is(err, service.ErrAuthServiceRequestInvalid):
+			return writeOAuthError(c, http.StatusBadRequest, OAuthErrInvalidGrant, "")
+		}
+
+		return writeOAuthError(c, http.StatusInternalServerError, OAuthErrServerError, "")
+	}
+
+	return writeOAuthJson(c, http.StatusOK, newOAuthToken(tokens))
+}
+
+func handleClientCredentialsGrant(app core.App, c pyrin.Context, form url.Values) error {
+	client, err := authenticateClient(app, c, form)
+	if err != nil {
+		return writeClientError(c, err)
+	}
+
+	// NOTE(patrik): The audience parameter can be repeated, and each
+	// value can contain multiple audiences separated by spaces
+	audience := strings.Fields(strings.Join(form["audience"], " "))
+
+	tokens, err := app.AuthService().IssueClientToken(client, form.Get("scope"), audience)
+	if err != nil {
+		return writeIssueTokenError(c, err)
+	}
+
+	return writeOAuthJson(c, http.StatusOK, OAuthToken{
+		AccessToken: tokens.AccessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(time.Until(tokens.AccessTokenExpires) / time.Second),
+		Scope:       tokens.Scope,
+	})
+}
+
+// writeIssueTokenError writes the errors from the grants that checks the
+// requested scopes and audiences against the policy of the client
+func writeIssueTokenError(c pyrin.Context, err error) error {
+	switch {
+	case errors.Is(err, service.ErrAuthServiceUnauthorizedClient):
+		return writeOAuthError(c, http.StatusBadRequest, OAuthErrUnauthorizedClient, "")
+	case errors.Is(err, service.ErrAuthServiceInvalidScope):
+		return writeOAuthError(c, http.StatusBadRequest, OAuthErrInvalidScope, "")
+	case errors.Is(err, service.ErrAuthServiceInvalidAudience):
+		return writeOAuthError(c, http.StatusBadRequest, OAuthErrInvalidTarget, "audience is not allowed for the client")
+	}
+
+	return writeOAuthError(c, http.StatusInternalServerError, OAuthErrServerError, "")
+}
+
+func handleTokenExchangeGrant(app core.App, c pyrin.Context, form url.Values) error {
+	client, err := authenticateClient(app, c, form)
+	if err != nil {
+		return writeClientError(c, err)
+	}
+
+	subjectToken := form.Get("subject_token")
+	if subjectToken == "" {
+		return writeOAuthError(c, http.StatusBadRequest, OAuthErrInvalidRequest, "missing subject_token")
+	}
+
+	// NOTE(patrik): Delegation with a separate actor token is not
+	// supported, the authenticated client is always the actor
+	if form.Get("actor_token") != "" {
+		return writeOAuthError(c, http.StatusBadRequest, OAuthErrInvalidRequest, "actor_token is not supported")
+	}
+
+	switch form.Get("requested_token_type") {
+	case "", TokenTypeUrnAccessToken, TokenTypeUrnJwt:
+	default:
+		return writeOAuthError(c, http.StatusBadRequest, OAuthErrInvalidRequest, "unsupported requested_token_type")
+	}
+
+	ctx := c.Request().Context()
+
+	var info authInfo
+	switch form.Get("subject_token_type") {
+	case TokenTypeUrnAccessToken, TokenTypeUrnJwt:
+		info, err = validateAccessToken(app, ctx, subjectToken)
+	case TokenTypeUrnApiToken:
+		info, err = validateApiToken(app, ctx, subjectToken)
+	case "":
+		return writeOAuthError(c, http.StatusBadRequest, OAuthErrInvalidRequest, "missing subject_token_type")
+	default:
+		return writeOAuthError(c, http.StatusBadRequest, OAuthErrInvalidRequest, "unsupported subject_token_type")
+	}
+
+	if err != nil {
+		var pyrinErr *pyrin.Error
+		if errors.As(err, &pyrinErr) {
+			return writeOAuthError(c, http.StatusBadRequest, OAuthErrInvalidGrant, "invalid subject_token")
+		}
+
+		return writeOAuthError(c, http.StatusInternalServerError, OAuthErrServerError, "")
+	}
+
+	if info.Client != nil {
+		return writeOAuthError(c, http.StatusBadRequest, OAuthErrInvalidGrant, "subject_token needs to belong to a user")
+	}
+
+	audience := strings.Fields(strings.Join(form["audience"], " "))
+
+	tokens, err := app.AuthService().ExchangeToken(client, service.ExchangeSubject{
+		UserId:    info.User.Id,
+		SessionId: info.SessionId,
+		ClientId:  info.ClientId,
+		Scope:     info.Scope,
+		Actors:    info.Actors,
+		Expires:   info.Expires,
+	}, form.Get("scope"), audience)
+	if err != nil {
+		return writeIssueTokenError(c, err)
+	}
+
+	return writeOAuthJson(c, http.StatusOK, OAuthToken{
+		AccessToken:     tokens.AccessToken,
+		IssuedTokenType: TokenTypeUrnAccessToken,
+		TokenType:       "Bearer",
+		ExpiresIn:       int64(time.Until(tokens.AccessTokenExpires) / time.Second),
+		Scope:           tokens.Scope,
+	})
+}
+
+func handleRefreshTokenGrant(app core.App, c pyrin.Context, form url.Values) error {
+	refreshToken := form.Get("refresh_token")
+	if refreshToken == "" {
+		return writeOAuthError(c, http.StatusBadRequest, OAuthErrInvalidRequest, "missing refresh_token")
+	}
+
+	// NOTE(patrik): Refresh tokens issued to OAuth clients can only be
+	// used by the same client. The first party clients sends no client,
+	// a client that is sent needs to authenticate
+	clientId := ""
+	if _, ok := requestClientId(c, form); ok {
+		client, err := authenticateClient(app, c, form)
+		if err != nil {
+			return writeClientError(c, err)
+		}
+
+		if !client.HasGrantType(GrantTypeRefreshToken) {
+			return writeOAuthError(c, http.StatusBadRequest, OAuthErrUnauthorizedClient, "")
+		}
+
+		clientId = client.Id
+	}
+
+	authService := app.AuthService()
+
+	tokens, err := authService.RefreshUserTokens(c.Request().Context(), refreshToken, clientId)
+	if err != nil {
+		if errors.Is(err, service.ErrAuthServiceInvalidRefreshToken) ||
+			errors.Is(err, service.ErrAuthServiceRefreshTokenReused) {
+			return writeOAuthError(c, http.StatusBadRequest, OAuthErrInvalidGrant, "")
+		}
+
+		return writeOAuthError(c, http.StatusInternalServerError, OAuthErrServerError, "")
+	}
+
+	return writeOAuthJson(c, http.StatusOK, newOAuthToken(tokens))
+}
+
+func handleAuthorizationCodeGrant(app core.App, c pyrin.Context, form url.Values) error {
+	client, err := authenticateClient(app, c, form)
+	if err != nil {
+		return writeClientError(c, err)
+	}
+
+	code := form.Get("code")
+	if code == "" {
+		return writeOAuthError(c, http.StatusBadRequest, OAuthErrInvalidRequest, "missing code")
+	}
+
+	authService := app.AuthService()
+
+	tokens, err := authService.ExchangeAuthorizationCode(c.Request().Context(), service.ExchangeAuthorizationCodeParams{
+		Client:       client,
+		Code:         code,
+		RedirectUri:  form.Get("redirect_uri"),
+		CodeVerifier: form.Get("code_verifier"),
+		Issuer:       PublicUrl(app, c),
+		Info:         ClientInfo(app, c),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrAuthServiceInvalidAuthorizationCode):
+			return writeOAuthError(c, http.StatusBadRequest, OAuthErrInvalidGrant, "")
+		case errors.Is(err, service.ErrAuthServiceUnauthorizedClient):
+			return writeOAuthError(c, http.StatusBadRequest, OAuthErrUnauthorizedClient, "")
+		}
+
+		return writeOAuthError(c, http.StatusInternalServerError, OAuthErrServerError, "")
+	}
+
+	res := newOAuthToken(tokens.UserTokens)
+	res.IdToken = tokens.IdToken
+	res.Scope = tokens.Scope
+
+	return writeOAuthJson(c, http.StatusOK, res)
+}
+
+// requestClientId returns the client_id from the HTTP Basic auth header
+// or the form
+func requestClientId(c pyrin.Context, form url.Values) (string, bool) {
+	clientId, _, ok := c.Request().BasicAuth()
+	if ok {
+		clientId, err := url.QueryUnescape(clientId)
+		return clientId, err == nil && clientId != ""
+	}
+
+	clientId = form.Get("client_id")
+	return clientId, clientId != ""
+}
+
+// authenticateClient authenticates the client with HTTP Basic auth
+// (client_secret_basic) or with the form (client_secret_post), public
+// clients only sends the client_id
+func authenticateClient(app core.App, c pyrin.Context, form url.Values) (*service.OAuthClient, error) {
+	clientId, secret, ok := c.Request().BasicAuth()
+	if ok {
+		// NOTE(patrik): The credentials are form encoded before they
+		// are put inside the header (RFC 6749 section 2.3.1)
+		var err error
+		clientId, err = url.QueryUnescape(clientId)
+		if err != nil {
+			return nil, service.ErrAuthServiceInvalidClient
+		}
+
+		secret, err = url.QueryUnescape(secret)
+		if err != nil {
+			return nil, service.ErrAuthServiceInvalidClient
+		}
+	} else {
+		clientId = form.Get("client_id")
+		secret = form.Get("client_secret")
+	}
+
+	if clientId == "" {
+		return nil, service.ErrAuthServiceInvalidClient
+	}
+
+	return app.AuthService().AuthenticateOAuthClient(c.Request().Context(), clientId, secret)
+}
+
+func writeClientError(c pyrin.Context, err error) error {
+	if errors.Is(err, service.ErrAuthServiceInvalidClient) {
+		c.Response().Header().Set("WWW-Authenticate", "Basic")
+		return writeOAuthError(c, http.StatusUnauthorized, OAuthErrInvalidClient, "")
+	}
+
+	return writeOAuthError(c, http.StatusInternalServerError, OAuthErrServerError, "")
+}
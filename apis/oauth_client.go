@@ -0,0 +1,488 @@
+package apis
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/nanoteck137/authlab/core"
+	"github.com/nanoteck137/authlab/service"
+	"github.com/nanoteck137/pyrin"
+	"github.com/nanoteck137/pyrin/anvil"
+	"github.com/nanoteck137/validate"
+)
+
+type OAuthClient struct {
+	Id           string   `json:"id"`
+	Name         string   `json:"name"`
+	LogoUrl      string   `json:"logoUrl"`
+	Public       bool     `json:"public"`
+	Trusted      bool     `json:"trusted"`
+	RedirectUris []string `json:"redirectUris"`
+	GrantTypes   []string `json:"grantTypes"`
+	Scopes       []string `json:"scopes"`
+	Audiences    []string `json:"audiences"`
+	Static       bool     `json:"static"`
+
+	ExchangeAudiences []string `json:"exchangeAudiences"`
+	ExchangeScopes    []string `json:"exchangeScopes"`
+
+	Created string `json:"created"`
+	Updated string `json:"updated"`
+}
+
+func newOAuthClient(client *service.OAuthClient) OAuthClient {
+	// NOTE(patrik): The clients from the config has no timestamps
+	created := ""
+	updated := ""
+	if !client.Static {
+		created = client.Created.Format(time.RFC3339Nano)
+		updated = client.Updated.Format(time.RFC3339Nano)
+	}
+
+	return OAuthClient{
+		Id:           client.Id,
+		Name:         client.Name,
+		LogoUrl:      client.LogoUrl,
+		Public:       client.Public,
+		Trusted:      client.Trusted,
+		RedirectUris: client.RedirectUris,
+		GrantTypes:   client.GrantTypes,
+		Scopes:       client.Scopes,
+		Audiences:    client.Audiences,
+		Static:       client.Static,
+
+		ExchangeAudiences: client.ExchangeAudiences,
+		ExchangeScopes:    client.ExchangeScopes,
+
+		Created: created,
+		Updated: updated,
+	}
+}
+
+type GetOAuthClients struct {
+	Clients []OAuthClient `json:"clients"`
+}
+
+type CreateOAuthClient struct {
+	Client OAuthClient `json:"client"`
+
+	// The secret is only returned here, empty for public clients
+	Secret string `json:"secret"`
+}
+
+type CreateOAuthClientBody struct {
+	Id           string   `json:"id,omitempty"`
+	Name         string   `json:"name"`
+	LogoUrl      string   `json:"logoUrl,omitempty"`
+	Public       bool     `json:"public,omitempty"`
+	Trusted      bool     `json:"trusted,omitempty"`
+	RedirectUris []string `json:"redirectUris"`
+	GrantTypes   []string `json:"grantTypes,omitempty"`
+	Scopes       []string `json:"scopes,omitempty"`
+	Audiences    []string `json:"audiences,omitempty"`
+
+	ExchangeAudiences []string `json:"exchangeAudiences,omitempty"`
+	ExchangeScopes    []string `json:"exchangeScopes,omitempty"`
+}
+
+func (b *CreateOAuthClientBody) Transform() {
+	b.Id = anvil.String(b.Id)
+	b.Name = anvil.String(b.Name)
+	b.LogoUrl = anvil.String(b.LogoUrl)
+	anvil.StringArrayPtr(&b.RedirectUris)
+	anvil.StringArrayPtr(&b.GrantTypes)
+	anvil.StringArrayPtr(&b.Scopes)
+	anvil.StringArrayPtr(&b.Audiences)
+	anvil.StringArrayPtr(&b.ExchangeAudiences)
+	anvil.StringArrayPtr(&b.ExchangeScopes)
+}
+
+func (b CreateOAuthClientBody) Validate() error {
+	return validate.ValidateStruct(&b,
+		validate.Field(&b.Name, validate.Required),
+	)
+}
+
+type UpdateOAuthClientBody struct {
+	Name         *string   `json:"name,omitempty"`
+	LogoUrl      *string   `json:"logoUrl,omitempty"`
+	Trusted      *bool     `json:"trusted,omitempty"`
+	RedirectUris *[]string `json:"redirectUris,omitempty"`
+	GrantTypes   *[]string `json:"grantTypes,omitempty"`
+	Scopes       *[]string `json:"scopes,omitempty"`
+	Audiences    *[]string `json:"audiences,omitempty"`
+
+	ExchangeAudiences *[]string `json:"exchangeAudiences,omitempty"`
+	ExchangeScopes    *[]string `json:"exchangeScopes,omitempty"`
+}
+
+func (b *UpdateOAuthClientBody) Transform() {
+	b.Name = anvil.StringPtr(b.Name)
+	b.LogoUrl = anvil.StringPtr(b.LogoUrl)
+	b.RedirectUris = anvil.StringArrayPtr(b.RedirectUris)
+	b.GrantTypes = anvil.StringArrayPtr(b.GrantTypes)
+	b.Scopes = anvil.StringArrayPtr(b.Scopes)
+	b.Audiences = anvil.StringArrayPtr(b.Audiences)
+	b.ExchangeAudiences = anvil.StringArrayPtr(b.ExchangeAudiences)
+	b.ExchangeScopes = anvil.StringArrayPtr(b.ExchangeScopes)
+}
+
+func (b UpdateOAuthClientBody) Validate() error {
+	return validate.ValidateStruct(&b,
+		validate.Field(&b.Name,
+			validate.Required.When(b.Name != nil),
+		),
+	)
+}
+
+type RotateOAuthClientSecret struct {
+	Secret string `json:"secret"`
+}
+
+type InitialAccessToken struct {
+	Id       string `json:"id"`
+	Name     string `json:"name"`
+	Expires  string `json:"expires"`
+	LastUsed string `json:"lastUsed"`
+	Created  string `json:"created"`
+}
+
+func formatOptionalTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Format(time.RFC3339Nano)
+}
+
+func newInitialAccessToken(token service.InitialAccessToken) InitialAccessToken {
+	return InitialAccessToken{
+		Id:       token.Id,
+		Name:     token.Name,
+		Expires:  formatOptionalTime(token.Expires),
+		LastUsed: formatOptionalTime(token.LastUsed),
+		Created:  token.Created.Format(time.RFC3339Nano),
+	}
+}
+
+type GetInitialAccessTokens struct {
+	Tokens []InitialAccessToken `json:"tokens"`
+}
+
+type CreateInitialAccessToken struct {
+	InitialToken InitialAccessToken `json:"initialToken"`
+
+	// The token is only returned here
+	Token string `json:"token"`
+}
+
+type CreateInitialAccessTokenBody struct {
+	Name string `json:"name"`
+
+	// How many seconds the token is valid for, 0 for a token that never
+	// expires
+	ExpiresIn int64 `json:"expiresIn,omitempty"`
+}
+
+func (b *CreateInitialAccessTokenBody) Transform() {
+	b.Name = anvil.String(b.Name)
+}
+
+func (b CreateInitialAccessTokenBody) Validate() error {
+	return validate.ValidateStruct(&b,
+		validate.Field(&b.Name, validate.Required),
+		validate.Field(&b.ExpiresIn, validate.Min(0)),
+	)
+}
+
+// oauthClientError converts the errors from the client registry to api
+// errors
+func oauthClientError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrAuthServiceClientNotFound):
+		return OAuthClientNotFound()
+	case errors.Is(err, service.ErrAuthServiceClientAlreadyExists):
+		return OAuthClientAlreadyExists()
+	case errors.Is(err, service.ErrAuthServiceClientIsStatic):
+		return InvalidOAuthClient("client is defined in the config and can't be changed")
+	case errors.Is(err, service.ErrAuthServiceClientIsPublic):
+		return InvalidOAuthClient("public clients has no secret")
+	case errors.Is(err, service.ErrAuthServiceInvalidRedirectUri):
+		return InvalidOAuthClient("redirect uris needs to be absolute uris without a fragment, at least one is required for the \"authorization_code\" grant type")
+	case errors.Is(err, service.ErrAuthServiceInvalidGrantType):
+		return InvalidOAuthClient("unsupported grant type")
+	case errors.Is(err, service.ErrAuthServiceInvalidScope):
+		return InvalidOAuthClient("invalid scope")
+	case errors.Is(err, service.ErrAuthServiceInvalidAudience):
+		return InvalidOAuthClient("invalid audience")
+	case errors.Is(err, service.ErrAuthServicePublicClientGrant):
+		return InvalidOAuthClient("public clients can't use the \"client_credentials\" and the token exchange grant types")
+	case errors.Is(err, service.ErrAuthServiceInvalidLogoUrl):
+		return InvalidOAuthClient("logo url needs to be a http or https url")
+	}
+
+	return err
+}
+
+// InstallOAuthClientHandlers installs the admin endpoints for managing
+// the clients that can use authlab as an OpenID Connect provider
+func InstallOAuthClientHandlers(app core.App, group pyrin.Group) {
+	group.Register(
+		pyrin.ApiHandler{
+			Name:         "GetOAuthClients",
+			Method:       http.MethodGet,
+			Path:         "/oauth/clients",
+			ResponseType: GetOAuthClients{},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				_, err := User(app, c, RequireAdmin)
+				if err != nil {
+					return nil, err
+				}
+
+				clients, err := app.AuthService().GetAllOAuthClients(c.Request().Context())
+				if err != nil {
+					return nil, err
+				}
+
+				res := GetOAuthClients{
+					Clients: make([]OAuthClient, len(clients)),
+				}
+
+				for i, client := range clients {
+					res.Clients[i] = newOAuthClient(client)
+				}
+
+				return res, nil
+			},
+		},
+
+		pyrin.ApiHandler{
+			Name:         "GetOAuthClientById",
+			Method:       http.MethodGet,
+			Path:         "/oauth/clients/:id",
+			ResponseType: OAuthClient{},
+			Errors:       []pyrin.ErrorType{ErrTypeOAuthClientNotFound},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				_, err := User(app, c, RequireAdmin)
+				if err != nil {
+					return nil, err
+				}
+
+				client, err := app.AuthService().GetOAuthClient(c.Request().Context(), c.Param("id"))
+				if err != nil {
+					return nil, oauthClientError(err)
+				}
+
+				return newOAuthClient(client), nil
+			},
+		},
+
+		pyrin.ApiHandler{
+			Name:         "CreateOAuthClient",
+			Method:       http.MethodPost,
+			Path:         "/oauth/clients",
+			ResponseType: CreateOAuthClient{},
+			BodyType:     CreateOAuthClientBody{},
+			Errors:       []pyrin.ErrorType{ErrTypeOAuthClientAlreadyExists, ErrTypeInvalidOAuthClient},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				_, err := User(app, c, RequireAdmin)
+				if err != nil {
+					return nil, err
+				}
+
+				body, err := pyrin.Body[CreateOAuthClientBody](c)
+				if err != nil {
+					return nil, err
+				}
+
+				client, secret, err := app.AuthService().CreateOAuthClient(c.Request().Context(), service.CreateOAuthClientParams{
+					Id:           body.Id,
+					Name:         body.Name,
+					LogoUrl:      body.LogoUrl,
+					Public:       body.Public,
+					Trusted:      body.Trusted,
+					RedirectUris: body.RedirectUris,
+					GrantTypes:   body.GrantTypes,
+					Scopes:       body.Scopes,
+					Audiences:    body.Audiences,
+
+					ExchangeAudiences: body.ExchangeAudiences,
+					ExchangeScopes:    body.ExchangeScopes,
+				})
+				if err != nil {
+					return nil, oauthClientError(err)
+				}
+
+				return CreateOAuthClient{
+					Client: newOAuthClient(client),
+					Secret: secret,
+				}, nil
+			},
+		},
+
+		pyrin.ApiHandler{
+			Name:         "UpdateOAuthClient",
+			Method:       http.MethodPatch,
+			Path:         "/oauth/clients/:id",
+			ResponseType: OAuthClient{},
+			BodyType:     UpdateOAuthClientBody{},
+			Errors:       []pyrin.ErrorType{ErrTypeOAuthClientNotFound, ErrTypeInvalidOAuthClient},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				_, err := User(app, c, RequireAdmin)
+				if err != nil {
+					return nil, err
+				}
+
+				body, err := pyrin.Body[UpdateOAuthClientBody](c)
+				if err != nil {
+					return nil, err
+				}
+
+				client, err := app.AuthService().UpdateOAuthClient(c.Request().Context(), c.Param("id"), service.OAuthClientChanges{
+					Name:         body.Name,
+					LogoUrl:      body.LogoUrl,
+					Trusted:      body.Trusted,
+					RedirectUris: body.RedirectUris,
+					GrantTypes:   body.GrantTypes,
+					Scopes:       body.Scopes,
+					Audiences:    body.Audiences,
+
+					ExchangeAudiences: body.ExchangeAudiences,
+					ExchangeScopes:    body.ExchangeScopes,
+				})
+				if err != nil {
+					return nil, oauthClientError(err)
+				}
+
+				return newOAuthClient(client), nil
+			},
+		},
+
+		pyrin.ApiHandler{
+			Name:         "RotateOAuthClientSecret",
+			Method:       http.MethodPost,
+			Path:         "/oauth/clients/:id/secret",
+			ResponseType: RotateOAuthClientSecret{},
+			Errors:       []pyrin.ErrorType{ErrTypeOAuthClientNotFound, ErrTypeInvalidOAuthClient},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				_, err := User(app, c, RequireAdmin)
+				if err != nil {
+					return nil, err
+				}
+
+				secret, err := app.AuthService().RotateOAuthClientSecret(c.Request().Context(), c.Param("id"))
+				if err != nil {
+					return nil, oauthClientError(err)
+				}
+
+				return RotateOAuthClientSecret{
+					Secret: secret,
+				}, nil
+			},
+		},
+
+		pyrin.ApiHandler{
+			Name:   "DeleteOAuthClient",
+			Method: http.MethodDelete,
+			Path:   "/oauth/clients/:id",
+			Errors: []pyrin.ErrorType{ErrTypeOAuthClientNotFound, ErrTypeInvalidOAuthClient},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				_, err := User(app, c, RequireAdmin)
+				if err != nil {
+					return nil, err
+				}
+
+				err = app.AuthService().DeleteOAuthClient(c.Request().Context(), c.Param("id"))
+				if err != nil {
+					return nil, oauthClientError(err)
+				}
+
+				return nil, nil
+			},
+		},
+
+		pyrin.ApiHandler{
+			Name:         "GetInitialAccessTokens",
+			Method:       http.MethodGet,
+			Path:         "/oauth/initial-tokens",
+			ResponseType: GetInitialAccessTokens{},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				_, err := User(app, c, RequireAdmin)
+				if err != nil {
+					return nil, err
+				}
+
+				tokens, err := app.AuthService().GetAllInitialAccessTokens(c.Request().Context())
+				if err != nil {
+					return nil, err
+				}
+
+				res := GetInitialAccessTokens{
+					Tokens: make([]InitialAccessToken, len(tokens)),
+				}
+
+				for i, token := range tokens {
+					res.Tokens[i] = newInitialAccessToken(token)
+				}
+
+				return res, nil
+			},
+		},
+
+		pyrin.ApiHandler{
+			Name:         "CreateInitialAccessToken",
+			Method:       http.MethodPost,
+			Path:         "/oauth/initial-tokens",
+			ResponseType: CreateInitialAccessToken{},
+			BodyType:     CreateInitialAccessTokenBody{},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				user, err := User(app, c, RequireAdmin)
+				if err != nil {
+					return nil, err
+				}
+
+				body, err := pyrin.Body[CreateInitialAccessTokenBody](c)
+				if err != nil {
+					return nil, err
+				}
+
+				duration := time.Duration(body.ExpiresIn) * time.Second
+
+				initialToken, token, err := app.AuthService().CreateInitialAccessToken(c.Request().Context(), user.Id, body.Name, duration)
+				if err != nil {
+					return nil, err
+				}
+
+				return CreateInitialAccessToken{
+					InitialToken: newInitialAccessToken(initialToken),
+					Token:        token,
+				}, nil
+			},
+		},
+
+		pyrin.ApiHandler{
+			Name:   "DeleteInitialAccessToken",
+			Method: http.MethodDelete,
+			Path:   "/oauth/initial-tokens/:id",
+			Errors: []pyrin.ErrorType{ErrTypeInitialAccessTokenNotFound},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				_, err := User(app, c, RequireAdmin)
+				if err != nil {
+					return nil, err
+				}
+
+				err = app.AuthService().DeleteInitialAccessToken(c.Request().Context(), c.Param("id"))
+				if err != nil {
+					if errors.Is(err, service.ErrAuthServiceInitialAccessTokenNotFound) {
+						return nil, InitialAccessTokenNotFound()
+					}
+
+					return nil, err
+				}
+
+				return nil, nil
+			},
+		},
+	)
+}
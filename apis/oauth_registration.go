@@ -0,0 +1,295 @@
+package apis
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/nanoteck137/authlab/core"
+	"github.com/nanoteck137/authlab/service"
+	"github.com/nanoteck137/authlab/tools/utils"
+	"github.com/nanoteck137/pyrin"
+)
+
+// NOTE(patrik): Error codes from RFC 7591
+const (
+	OAuthErrInvalidRedirectUri    = "invalid_redirect_uri"
+	OAuthErrInvalidClientMetadata = "invalid_client_metadata"
+)
+
+const (
+	TokenEndpointAuthMethodNone              = "none"
+	TokenEndpointAuthMethodClientSecretBasic = "client_secret_basic"
+	TokenEndpointAuthMethodClientSecretPost  = "client_secret_post"
+)
+
+// OAuthClientMetadata is the client metadata sent to the dynamic client
+// registration endpoint (RFC 7591 section 2)
+type OAuthClientMetadata struct {
+	ClientId                string   `json:"client_id,omitempty"`
+	ClientName              string   `json:"client_name,omitempty"`
+	LogoUri                 string   `json:"logo_uri,omitempty"`
+	RedirectUris            []string `json:"redirect_uris"`
+	GrantTypes              []string `json:"grant_types,omitempty"`
+	ResponseTypes           []string `json:"response_types,omitempty"`
+	Scope                   string   `json:"scope,omitempty"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method,omitempty"`
+}
+
+// clientMetadata validates the metadata sent by the client, returns the
+// OAuth error code and description when the metadata is invalid
+func (m OAuthClientMetadata) clientMetadata() (service.ClientMetadata, string, string) {
+	public := false
+	switch m.TokenEndpointAuthMethod {
+	case TokenEndpointAuthMethodNone:
+		public = true
+	case "", TokenEndpointAuthMethodClientSecretBasic, TokenEndpointAuthMethodClientSecretPost:
+	default:
+		return service.ClientMetadata{}, OAuthErrInvalidClientMetadata, "unsupported token_endpoint_auth_method"
+	}
+
+	for _, responseType := range m.ResponseTypes {
+		if responseType != ResponseTypeCode {
+			return service.ClientMetadata{}, OAuthErrInvalidClientMetadata, "only the \"code\" response type is supported"
+		}
+	}
+
+	// NOTE(patrik): The "code" response type is used together with the
+	// "authorization_code" grant type (RFC 7591 section 2.1)
+	if len(m.ResponseTypes) > 0 && len(m.GrantTypes) > 0 && !slices.Contains(m.GrantTypes, GrantTypeAuthorizationCode) {
+		return service.ClientMetadata{}, OAuthErrInvalidClientMetadata, "the \"code\" response type requires the \"authorization_code\" grant type"
+	}
+
+	return service.ClientMetadata{
+		Name:         strings.TrimSpace(m.ClientName),
+		LogoUrl:      strings.TrimSpace(m.LogoUri),
+		Public:       public,
+		RedirectUris: m.RedirectUris,
+		GrantTypes:   m.GrantTypes,
+		Scopes:       strings.Fields(m.Scope),
+	}, "", ""
+}
+
+// OAuthClientRegistration is the response of the dynamic client
+// registration endpoints (RFC 7591 section 3.2.1 and RFC 7592 section 3)
+type OAuthClientRegistration struct {
+	ClientId                string   `json:"client_id"`
+	ClientSecret            string   `json:"client_secret,omitempty"`
+	ClientIdIssuedAt        int64    `json:"client_id_issued_at"`
+	ClientSecretExpiresAt   *int64   `json:"client_secret_expires_at,omitempty"`
+	RegistrationAccessToken string   `json:"registration_access_token,omitempty"`
+	RegistrationClientUri   string   `json:"registration_client_uri"`
+	ClientName              string   `json:"client_name"`
+	LogoUri                 string   `json:"logo_uri,omitempty"`
+	RedirectUris            []string `json:"redirect_uris"`
+	GrantTypes              []string `json:"grant_types"`
+	ResponseTypes           []string `json:"response_types"`
+	Scope                   string   `json:"scope"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method"`
+}
+
+func newOAuthClientRegistration(app core.App, c pyrin.Context, client *service.OAuthClient) OAuthClientRegistration {
+	authMethod := TokenEndpointAuthMethodClientSecretBasic
+	if client.Public {
+		authMethod = TokenEndpointAuthMethodNone
+	}
+
+	responseTypes := []string{}
+	if client.HasGrantType(GrantTypeAuthorizationCode) {
+		responseTypes = append(responseTypes, ResponseTypeCode)
+	}
+
+	return OAuthClientRegistration{
+		ClientId:                client.Id,
+		ClientIdIssuedAt:        client.Created.Unix(),
+		RegistrationClientUri:   PublicUrl(app, c) + "/oauth/register/" + client.Id,
+		ClientName:              client.Name,
+		LogoUri:                 client.LogoUrl,
+		RedirectUris:            client.RedirectUris,
+		GrantTypes:              client.GrantTypes,
+		ResponseTypes:           responseTypes,
+		Scope:                   strings.Join(client.Scopes, " "),
+		TokenEndpointAuthMethod: authMethod,
+	}
+}
+
+func readClientMetadata(c pyrin.Context) (OAuthClientMetadata, error) {
+	var metadata OAuthClientMetadata
+
+	decoder := json.NewDecoder(c.Request().Body)
+	err := decoder.Decode(&metadata)
+	if err != nil {
+		return OAuthClientMetadata{}, err
+	}
+
+	return metadata, nil
+}
+
+func writeRegistrationTokenError(c pyrin.Context) error {
+	c.Response().Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	return writeOAuthError(c, http.StatusUnauthorized, OAuthErrInvalidToken, "")
+}
+
+func writeClientMetadataError(c pyrin.Context, err error) error {
+	switch {
+	case errors.Is(err, service.ErrAuthServiceInvalidRedirectUri):
+		return writeOAuthError(c, http.StatusBadRequest, OAuthErrInvalidRedirectUri, "redirect uris needs to be absolute uris without a fragment")
+	case errors.Is(err, service.ErrAuthServiceInvalidGrantType):
+		return writeOAuthError(c, http.StatusBadRequest, OAuthErrInvalidClientMetadata, "unsupported grant type")
+	case errors.Is(err, service.ErrAuthServiceInvalidScope):
+		return writeOAuthError(c, http.StatusBadRequest, OAuthErrInvalidClientMetadata, "invalid scope")
+	case errors.Is(err, service.ErrAuthServicePublicClientGrant):
+		return writeOAuthError(c, http.StatusBadRequest, OAuthErrInvalidClientMetadata, "the \"client_credentials\" and the token exchange grant types requires a confidential client")
+	case errors.Is(err, service.ErrAuthServiceInvalidLogoUrl):
+		return writeOAuthError(c, http.StatusBadRequest, OAuthErrInvalidClientMetadata, "logo_uri needs to be a http or https url")
+	case errors.Is(err, service.ErrAuthServiceClientTypeChanged):
+		return writeOAuthError(c, http.StatusBadRequest, OAuthErrInvalidClientMetadata, "token_endpoint_auth_method can't be changed")
+	}
+
+	return writeOAuthError(c, http.StatusInternalServerError, OAuthErrServerError, "")
+}
+
+// InstallOAuthRegistrationHandlers installs the dynamic client
+// registration endpoints (RFC 7591 and RFC 7592)
+func InstallOAuthRegistrationHandlers(app core.App, group pyrin.Group) {
+	// authenticateRegistration checks the registration access token of
+	// the request, the token is bound to the client in the path
+	authenticateRegistration := func(c pyrin.Context) (*service.OAuthClient, error) {
+		token := utils.ParseAuthHeader(c.Request().Header.Get("Authorization"))
+		return app.AuthService().AuthenticateClientRegistration(c.Request().Context(), c.Param("id"), token)
+	}
+
+	group.Register(
+		pyrin.NormalHandler{
+			Name:   "OAuthRegisterClient",
+			Method: http.MethodPost,
+			Path:   "/oauth/register",
+			HandlerFunc: func(c pyrin.Context) error {
+				token := utils.ParseAuthHeader(c.Request().Header.Get("Authorization"))
+				if token == "" {
+					return writeRegistrationTokenError(c)
+				}
+
+				body, err := readClientMetadata(c)
+				if err != nil {
+					return writeOAuthError(c, http.StatusBadRequest, OAuthErrInvalidClientMetadata, "invalid json body")
+				}
+
+				metadata, code, description := body.clientMetadata()
+				if code != "" {
+					return writeOAuthError(c, http.StatusBadRequest, code, description)
+				}
+
+				res, err := app.AuthService().RegisterOAuthClient(c.Request().Context(), token, metadata)
+				if err != nil {
+					if errors.Is(err, service.ErrAuthServiceInvalidInitialAccessToken) {
+						return writeRegistrationTokenError(c)
+					}
+
+					return writeClientMetadataError(c, err)
+				}
+
+				registration := newOAuthClientRegistration(app, c, res.Client)
+				registration.RegistrationAccessToken = res.RegistrationToken
+
+				if res.Secret != "" {
+					// NOTE(patrik): The secrets never expires, the client
+					// needs to be updated by an admin to get a new secret
+					expiresAt := int64(0)
+
+					registration.ClientSecret = res.Secret
+					registration.ClientSecretExpiresAt = &expiresAt
+
+					if body.TokenEndpointAuthMethod != "" {
+						registration.TokenEndpointAuthMethod = body.TokenEndpointAuthMethod
+					}
+				}
+
+				return writeOAuthJson(c, http.StatusCreated, registration)
+			},
+		},
+
+		pyrin.NormalHandler{
+			Name:   "OAuthGetClientRegistration",
+			Method: http.MethodGet,
+			Path:   "/oauth/register/:id",
+			HandlerFunc: func(c pyrin.Context) error {
+				client, err := authenticateRegistration(c)
+				if err != nil {
+					if errors.Is(err, service.ErrAuthServiceInvalidRegistrationToken) {
+						return writeRegistrationTokenError(c)
+					}
+
+					return writeOAuthError(c, http.StatusInternalServerError, OAuthErrServerError, "")
+				}
+
+				return writeOAuthJson(c, http.StatusOK, newOAuthClientRegistration(app, c, client))
+			},
+		},
+
+		pyrin.NormalHandler{
+			Name:   "OAuthUpdateClientRegistration",
+			Method: http.MethodPut,
+			Path:   "/oauth/register/:id",
+			HandlerFunc: func(c pyrin.Context) error {
+				client, err := authenticateRegistration(c)
+				if err != nil {
+					if errors.Is(err, service.ErrAuthServiceInvalidRegistrationToken) {
+						return writeRegistrationTokenError(c)
+					}
+
+					return writeOAuthError(c, http.StatusInternalServerError, OAuthErrServerError, "")
+				}
+
+				body, err := readClientMetadata(c)
+				if err != nil {
+					return writeOAuthError(c, http.StatusBadRequest, OAuthErrInvalidClientMetadata, "invalid json body")
+				}
+
+				// NOTE(patrik): The request needs to include the client_id
+				// of the client (RFC 7592 section 2.2)
+				if body.ClientId != client.Id {
+					return writeOAuthError(c, http.StatusBadRequest, OAuthErrInvalidClientMetadata, "client_id doesn't match the client")
+				}
+
+				metadata, code, description := body.clientMetadata()
+				if code != "" {
+					return writeOAuthError(c, http.StatusBadRequest, code, description)
+				}
+
+				client, err = app.AuthService().UpdateRegisteredOAuthClient(c.Request().Context(), client, metadata)
+				if err != nil {
+					return writeClientMetadataError(c, err)
+				}
+
+				return writeOAuthJson(c, http.StatusOK, newOAuthClientRegistration(app, c, client))
+			},
+		},
+
+		pyrin.NormalHandler{
+			Name:   "OAuthDeleteClientRegistration",
+			Method: http.MethodDelete,
+			Path:   "/oauth/register/:id",
+			HandlerFunc: func(c pyrin.Context) error {
+				client, err := authenticateRegistration(c)
+				if err != nil {
+					if errors.Is(err, service.ErrAuthServiceInvalidRegistrationToken) {
+						return writeRegistrationTokenError(c)
+					}
+
+					return writeOAuthError(c, http.StatusInternalServerError, OAuthErrServerError, "")
+				}
+
+				err = app.AuthService().DeleteOAuthClient(c.Request().Context(), client.Id)
+				if err != nil {
+					return writeOAuthError(c, http.StatusInternalServerError, OAuthErrServerError, "")
+				}
+
+				c.Response().WriteHeader(http.StatusNoContent)
+				return nil
+			},
+		},
+	)
+}
@@ -0,0 +1,309 @@
+package apis
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nanoteck137/authlab/core"
+	"github.com/nanoteck137/authlab/database"
+	"github.com/nanoteck137/authlab/render"
+	"github.com/nanoteck137/authlab/service"
+	"github.com/nanoteck137/authlab/tools/utils"
+	"github.com/nanoteck137/pyrin"
+)
+
+type OAuthAuthorize struct {
+	RedirectUrl string `json:"redirectUrl"`
+}
+
+type OAuthAuthorizeBody struct {
+	ResponseType        string `json:"responseType"`
+	ClientId            string `json:"clientId"`
+	RedirectUri         string `json:"redirectUri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	Nonce               string `json:"nonce"`
+	CodeChallenge       string `json:"codeChallenge"`
+	CodeChallengeMethod string `json:"codeChallengeMethod"`
+}
+
+func (b OAuthAuthorizeBody) authorizeRequest() service.AuthorizeRequest {
+	return service.AuthorizeRequest{
+		ClientId:            b.ClientId,
+		RedirectUri:         b.RedirectUri,
+		Scope:               b.Scope,
+		Nonce:               b.Nonce,
+		State:               b.State,
+		CodeChallenge:       b.CodeChallenge,
+		CodeChallengeMethod: b.CodeChallengeMethod,
+	}
+}
+
+// authorizeBodyFromQuery reads the authorization request from the query
+// parameters sent by the client
+func authorizeBodyFromQuery(query url.Values) OAuthAuthorizeBody {
+	return OAuthAuthorizeBody{
+		ResponseType:        query.Get("response_type"),
+		ClientId:            query.Get("client_id"),
+		RedirectUri:         query.Get("redirect_uri"),
+		Scope:               query.Get("scope"),
+		State:               query.Get("state"),
+		Nonce:               query.Get("nonce"),
+		CodeChallenge:       query.Get("code_challenge"),
+		CodeChallengeMethod: query.Get("code_challenge_method"),
+	}
+}
+
+// authorizeRedirect creates the url that sends the user back to the
+// client with the parameters, the parameters are added to the query
+// already inside the redirect uri
+func authorizeRedirect(redirectUri string, params url.Values) string {
+	u, err := url.Parse(redirectUri)
+	if err != nil {
+		return redirectUri
+	}
+
+	query := u.Query()
+	for key, values := range params {
+		for _, value := range values {
+			query.Add(key, value)
+		}
+	}
+
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+// authorizeCodeRedirect creates the url that sends the user back to the
+// client with the authorization code
+func authorizeCodeRedirect(app core.App, c pyrin.Context, redirectUri, state, code string) string {
+	params := url.Values{}
+	params.Set("code", code)
+	if state != "" {
+		params.Set("state", state)
+	}
+	params.Set("iss", PublicUrl(app, c))
+
+	return authorizeRedirect(redirectUri, params)
+}
+
+func authorizeErrorRedirect(app core.App, c pyrin.Context, body OAuthAuthorizeBody, code, description string) string {
+	params := url.Values{}
+	params.Set("error", code)
+	if description != "" {
+		params.Set("error_description", description)
+	}
+	if body.State != "" {
+		params.Set("state", body.State)
+	}
+	params.Set("iss", PublicUrl(app, c))
+
+	return authorizeRedirect(body.RedirectUri, params)
+}
+
+// validateAuthorizeBody validates the authorization request, returns the
+// url to redirect the user to when the request is invalid. The error is
+// set when the client or the redirect uri is invalid, then the user
+// can't be sent back to the client.
+func validateAuthorizeBody(app core.App, c pyrin.Context, body OAuthAuthorizeBody) (string, error) {
+	authService := app.AuthService()
+
+	request := body.authorizeRequest()
+
+	client, err := authService.ValidateAuthorizeClient(c.Request().Context(), request)
+	if err != nil {
+		return "", err
+	}
+
+	if body.ResponseType != ResponseTypeCode {
+		return authorizeErrorRedirect(app, c, body, OAuthErrUnsupportedResponse, "only the \"code\" response type is supported"), nil
+	}
+
+	err = authService.ValidateAuthorizeRequest(client, request)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrAuthServiceUnauthorizedClient):
+			return authorizeErrorRedirect(app, c, body, OAuthErrUnauthorizedClient, ""), nil
+		case errors.Is(err, service.ErrAuthServiceInvalidScope):
+			return authorizeErrorRedirect(app, c, body, OAuthErrInvalidScope, ""), nil
+		case errors.Is(err, service.ErrAuthServicePkceRequired):
+			return authorizeErrorRedirect(app, c, body, OAuthErrInvalidRequest, "code_challenge required"), nil
+		case errors.Is(err, service.ErrAuthServiceUnsupportedPkceMethod):
+			return authorizeErrorRedirect(app, c, body, OAuthErrInvalidRequest, "only the S256 code_challenge_method is supported"), nil
+		}
+
+		return authorizeErrorRedirect(app, c, body, OAuthErrServerError, ""), nil
+	}
+
+	return "", nil
+}
+
+func invalidClientMessage(err error) string {
+	if errors.Is(err, service.ErrAuthServiceInvalidRedirectUri) {
+		return "redirect_uri is not registered for the client"
+	}
+
+	return "unknown client_id"
+}
+
+// InstallOidcHandlers installs the endpoints that the clients talks to
+// directly when using authlab as an OpenID Connect provider
+func InstallOidcHandlers(app core.App, group pyrin.Group) {
+	userInfo := func(c pyrin.Context) error {
+		tokenString := utils.ParseAuthHeader(c.Request().Header.Get("Authorization"))
+		if tokenString == "" {
+			c.Response().Header().Set("WWW-Authenticate", "Bearer")
+			return writeOAuthError(c, http.StatusUnauthorized, OAuthErrInvalidToken, "")
+		}
+
+		info, err := validateAccessToken(app, c.Request().Context(), tokenString)
+		if err != nil {
+			var pyrinErr *pyrin.Error
+			if errors.As(err, &pyrinErr) {
+				c.Response().Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				return writeOAuthError(c, http.StatusUnauthorized, OAuthErrInvalidToken, "")
+			}
+
+			return writeOAuthError(c, http.StatusInternalServerError, OAuthErrServerError, "")
+		}
+
+		// NOTE(patrik): Tokens from the client credentials grant has no
+		// user to return the claims for
+		if info.Client != nil || !slices.Contains(strings.Fields(info.Scope), service.ScopeOpenId) {
+			c.Response().Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+			return writeOAuthError(c, http.StatusForbidden, OAuthErrInsufficientScope, "")
+		}
+
+		return writeOAuthJson(c, http.StatusOK, service.UserClaims(info.User, info.Scope))
+	}
+
+	group.Register(
+		pyrin.NormalHandler{
+			Name:   "OAuthAuthorizeRedirect",
+			Method: http.MethodGet,
+			Path:   "/oauth/authorize",
+			HandlerFunc: func(c pyrin.Context) error {
+				query := c.Request().URL.Query()
+				body := authorizeBodyFromQuery(query)
+
+				redirect, err := validateAuthorizeBody(app, c, body)
+				if err != nil {
+					c.Response().Header().Set("Content-Type", "text/html; charset=utf-8")
+					c.Response().WriteHeader(http.StatusBadRequest)
+					return render.RenderAuthorizeInvalidClient(c.Response(), invalidClientMessage(err))
+				}
+
+				if redirect != "" {
+					http.Redirect(c.Response(), c.Request(), redirect, http.StatusFound)
+					return nil
+				}
+
+				// NOTE(patrik): The user logs in and authorizes the
+				// request inside the web app, the web app then calls
+				// the authorize api endpoint
+				http.Redirect(c.Response(), c.Request(), PublicUrl(app, c)+"/authorize?"+query.Encode(), http.StatusFound)
+				return nil
+			},
+		},
+
+		pyrin.NormalHandler{
+			Name:        "OAuthUserInfo",
+			Method:      http.MethodGet,
+			Path:        "/oauth/userinfo",
+			HandlerFunc: userInfo,
+		},
+
+		pyrin.NormalHandler{
+			Name:        "OAuthUserInfoPost",
+			Method:      http.MethodPost,
+			Path:        "/oauth/userinfo",
+			HandlerFunc: userInfo,
+		},
+	)
+}
+
+// InstallOidcApiHandlers installs the endpoints used by the web app
+// during the authorization request
+func InstallOidcApiHandlers(app core.App, group pyrin.Group) {
+	group.Register(
+		pyrin.ApiHandler{
+			Name:         "OAuthAuthorize",
+			Method:       http.MethodPost,
+			Path:         "/oauth/authorize",
+			ResponseType: OAuthAuthorize{},
+			BodyType:     OAuthAuthorizeBody{},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				auth, err := getAuth(app, c)
+				if err != nil {
+					return nil, err
+				}
+
+				body, err := pyrin.Body[OAuthAuthorizeBody](c)
+				if err != nil {
+					return nil, err
+				}
+
+				redirect, err := validateAuthorizeBody(app, c, body)
+				if err != nil {
+					return nil, InvalidOAuthClient(invalidClientMessage(err))
+				}
+
+				if redirect != "" {
+					return OAuthAuthorize{
+						RedirectUrl: redirect,
+					}, nil
+				}
+
+				// NOTE(patrik): The user authenticated when the session
+				// was created, api tokens has no session so they count
+				// as authenticating right now
+				authTime := time.Now()
+				if auth.SessionId != "" {
+					session, err := app.DB().GetSessionById(c.Request().Context(), auth.SessionId)
+					if err != nil && !errors.Is(err, database.ErrItemNotFound) {
+						return nil, err
+					}
+
+					if err == nil {
+						authTime = time.UnixMilli(session.Created)
+					}
+				}
+
+				authService := app.AuthService()
+
+				needsConsent, err := authService.NeedsConsent(c.Request().Context(), auth.User.Id, body.ClientId, body.Scope)
+				if err != nil {
+					return nil, err
+				}
+
+				// NOTE(patrik): The user approves the client on the
+				// consent page, the consent page then sends the user
+				// back to the client
+				if needsConsent {
+					requestId, err := authService.CreateConsentRequest(c.Request().Context(), auth.User.Id, authTime, body.authorizeRequest())
+					if err != nil {
+						return nil, err
+					}
+
+					return OAuthAuthorize{
+						RedirectUrl: consentUrl(app, c, requestId),
+					}, nil
+				}
+
+				code, err := authService.CreateAuthorizationCode(c.Request().Context(), auth.User.Id, authTime, body.authorizeRequest())
+				if err != nil {
+					return nil, err
+				}
+
+				return OAuthAuthorize{
+					RedirectUrl: authorizeCodeRedirect(app, c, body.RedirectUri, body.State, code),
+				}, nil
+			},
+		},
+	)
+}
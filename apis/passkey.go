@@ -0,0 +1,410 @@
+package apis
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/nanoteck137/authlab/core"
+	"github.com/nanoteck137/authlab/database"
+	"github.com/nanoteck137/authlab/service"
+	"github.com/nanoteck137/pyrin"
+	"github.com/nanoteck137/pyrin/anvil"
+	"github.com/nanoteck137/validate"
+)
+
+// The name used when the user doesn't name the passkey
+const defaultPasskeyName = "Passkey"
+
+type Passkey struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+
+	// Empty if the passkey has never been used
+	LastUsed string `json:"lastUsed"`
+	Created  string `json:"created"`
+}
+
+func convertPasskey(passkey database.Passkey) Passkey {
+	lastUsed := ""
+	if passkey.LastUsed > 0 {
+		lastUsed = time.UnixMilli(passkey.LastUsed).Format(time.RFC3339Nano)
+	}
+
+	return Passkey{
+		Id:       passkey.Id,
+		Name:     passkey.Name,
+		LastUsed: lastUsed,
+		Created:  time.UnixMilli(passkey.Created).Format(time.RFC3339Nano),
+	}
+}
+
+type AuthFinishPasskeyRegistration struct {
+	Passkey Passkey `json:"passkey"`
+
+	// Only set the first time a second factor is enabled, the codes
+	// can't be shown again
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+type GetPasskeys struct {
+	Passkeys []Passkey `json:"passkeys"`
+}
+
+// PasskeyOptions is the start of a passkey ceremony, the options are the
+// json for navigator.credentials and the response is sent back together
+// with the request id
+type PasskeyOptions struct {
+	RequestId string `json:"requestId"`
+	Options   string `json:"options"`
+	ExpiresAt string `json:"expiresAt"`
+}
+
+func convertPasskeyOptions(options service.PasskeyOptions) PasskeyOptions {
+	return PasskeyOptions{
+		RequestId: options.RequestId,
+		Options:   string(options.Options),
+		ExpiresAt: options.Expires.Format(time.RFC3339Nano),
+	}
+}
+
+type AuthFinishPasskeyRegistrationBody struct {
+	RequestId string `json:"requestId"`
+	Name      string `json:"name"`
+
+	// The json of the PublicKeyCredential from the browser
+	Credential string `json:"credential"`
+}
+
+func (b *AuthFinishPasskeyRegistrationBody) Transform() {
+	b.Name = anvil.String(b.Name)
+	if b.Name == "" {
+		b.Name = defaultPasskeyName
+	}
+}
+
+func (b AuthFinishPasskeyRegistrationBody) Validate() error {
+	return validate.ValidateStruct(&b,
+		validate.Field(&b.RequestId, validate.Required),
+		validate.Field(&b.Name, validate.Length(1, 64)),
+		validate.Field(&b.Credential, validate.Required),
+	)
+}
+
+type UpdatePasskeyBody struct {
+	Name string `json:"name"`
+}
+
+func (b *UpdatePasskeyBody) Transform() {
+	b.Name = anvil.String(b.Name)
+}
+
+func (b UpdatePasskeyBody) Validate() error {
+	return validate.ValidateStruct(&b,
+		validate.Field(&b.Name, validate.Required, validate.Length(1, 64)),
+	)
+}
+
+type AuthFinishPasskeyLogin struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+type AuthFinishPasskeyLoginBody struct {
+	RequestId  string `json:"requestId"`
+	Credential string `json:"credential"`
+}
+
+func (b AuthFinishPasskeyLoginBody) Validate() error {
+	return validate.ValidateStruct(&b,
+		validate.Field(&b.RequestId, validate.Required),
+		validate.Field(&b.Credential, validate.Required),
+	)
+}
+
+type AuthBeginPasskeyMfaBody struct {
+	Challenge string `json:"challenge"`
+}
+
+func (b AuthBeginPasskeyMfaBody) Validate() error {
+	return validate.ValidateStruct(&b,
+		validate.Field(&b.Challenge, validate.Required),
+	)
+}
+
+type AuthFinishPasskeyMfa struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+type AuthFinishPasskeyMfaBody struct {
+	Challenge  string `json:"challenge"`
+	RequestId  string `json:"requestId"`
+	Credential string `json:"credential"`
+}
+
+func (b AuthFinishPasskeyMfaBody) Validate() error {
+	return validate.ValidateStruct(&b,
+		validate.Field(&b.Challenge, validate.Required),
+		validate.Field(&b.RequestId, validate.Required),
+		validate.Field(&b.Credential, validate.Required),
+	)
+}
+
+// passkeyError converts the passkey errors from the service, the other
+// errors are returned as is
+func passkeyError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrAuthServicePasskeysDisabled):
+		return PasskeysDisabled()
+	case errors.Is(err, service.ErrAuthServicePasskeyNotFound):
+		return PasskeyNotFound()
+	case errors.Is(err, service.ErrAuthServiceInvalidPasskey):
+		return InvalidPasskey()
+	case errors.Is(err, service.ErrAuthServiceReauthRequired):
+		return ReauthRequired()
+	case errors.Is(err, service.ErrAuthServiceRequestNotFound),
+		errors.Is(err, service.ErrAuthServiceRequestExpired),
+		errors.Is(err, service.ErrAuthServiceRequestAlreadyUsed):
+		return PasskeyRequestNotFound()
+	}
+
+	return err
+}
+
+func InstallPasskeyHandlers(app core.App, group pyrin.Group) {
+	group.Register(
+		pyrin.ApiHandler{
+			Name:         "GetPasskeys",
+			Method:       http.MethodGet,
+			Path:         "/auth/passkeys",
+			ResponseType: GetPasskeys{},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				auth, err := getMfaAuth(app, c)
+				if err != nil {
+					return nil, err
+				}
+
+				passkeys, err := app.AuthService().GetPasskeys(c.Request().Context(), auth.User.Id)
+				if err != nil {
+					return nil, err
+				}
+
+				res := GetPasskeys{
+					Passkeys: make([]Passkey, len(passkeys)),
+				}
+
+				for i, passkey := range passkeys {
+					res.Passkeys[i] = convertPasskey(passkey)
+				}
+
+				return res, nil
+			},
+		},
+
+		pyrin.ApiHandler{
+			Name:         "AuthBeginPasskeyRegistration",
+			Method:       http.MethodPost,
+			Path:         "/auth/passkeys/register/begin",
+			ResponseType: PasskeyOptions{},
+			Errors:       []pyrin.ErrorType{ErrTypePasskeysDisabled, ErrTypeReauthRequired},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				auth, err := getMfaAuth(app, c)
+				if err != nil {
+					return nil, err
+				}
+
+				options, err := app.AuthService().BeginPasskeyRegistration(c.Request().Context(), auth.User, auth.SessionId)
+				if err != nil {
+					return nil, passkeyError(err)
+				}
+
+				return convertPasskeyOptions(options), nil
+			},
+		},
+
+		pyrin.ApiHandler{
+			Name:         "AuthFinishPasskeyRegistration",
+			Method:       http.MethodPost,
+			Path:         "/auth/passkeys/register/finish",
+			ResponseType: AuthFinishPasskeyRegistration{},
+			BodyType:     AuthFinishPasskeyRegistrationBody{},
+			Errors:       []pyrin.ErrorType{ErrTypePasskeysDisabled, ErrTypePasskeyRequestNotFound, ErrTypeInvalidPasskey},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				body, err := pyrin.Body[AuthFinishPasskeyRegistrationBody](c)
+				if err != nil {
+					return nil, err
+				}
+
+				auth, err := getMfaAuth(app, c)
+				if err != nil {
+					return nil, err
+				}
+
+				res, err := app.AuthService().FinishPasskeyRegistration(c.Request().Context(), auth.User.Id, body.RequestId, body.Name, []byte(body.Credential), ClientInfo(app, c))
+				if err != nil {
+					return nil, passkeyError(err)
+				}
+
+				return AuthFinishPasskeyRegistration{
+					Passkey:       convertPasskey(res.Passkey),
+					RecoveryCodes: res.RecoveryCodes,
+				}, nil
+			},
+		},
+
+		pyrin.ApiHandler{
+			Name:     "UpdatePasskey",
+			Method:   http.MethodPatch,
+			Path:     "/auth/passkeys/:id",
+			BodyType: UpdatePasskeyBody{},
+			Errors:   []pyrin.ErrorType{ErrTypePasskeyNotFound},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				body, err := pyrin.Body[UpdatePasskeyBody](c)
+				if err != nil {
+					return nil, err
+				}
+
+				auth, err := getMfaAuth(app, c)
+				if err != nil {
+					return nil, err
+				}
+
+				err = app.AuthService().RenamePasskey(c.Request().Context(), auth.User.Id, c.Param("id"), body.Name)
+				if err != nil {
+					return nil, passkeyError(err)
+				}
+
+				return nil, nil
+			},
+		},
+
+		pyrin.ApiHandler{
+			Name:   "DeletePasskey",
+			Method: http.MethodDelete,
+			Path:   "/auth/passkeys/:id",
+			Errors: []pyrin.ErrorType{ErrTypePasskeyNotFound, ErrTypeReauthRequired},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				auth, err := getMfaAuth(app, c)
+				if err != nil {
+					return nil, err
+				}
+
+				err = app.AuthService().DeletePasskey(c.Request().Context(), auth.User.Id, auth.SessionId, c.Param("id"))
+				if err != nil {
+					return nil, passkeyError(err)
+				}
+
+				return nil, nil
+			},
+		},
+
+		pyrin.ApiHandler{
+			Name:         "AuthBeginPasskeyLogin",
+			Method:       http.MethodPost,
+			Path:         "/auth/passkey/login/begin",
+			ResponseType: PasskeyOptions{},
+			Errors:       []pyrin.ErrorType{ErrTypePasskeysDisabled},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				options, err := app.AuthService().BeginPasskeyLogin(c.Request().Context())
+				if err != nil {
+					return nil, passkeyError(err)
+				}
+
+				return convertPasskeyOptions(options), nil
+			},
+		},
+
+		pyrin.ApiHandler{
+			Name:         "AuthFinishPasskeyLogin",
+			Method:       http.MethodPost,
+			Path:         "/auth/passkey/login/finish",
+			ResponseType: AuthFinishPasskeyLogin{},
+			BodyType:     AuthFinishPasskeyLoginBody{},
+			Errors:       []pyrin.ErrorType{ErrTypePasskeysDisabled, ErrTypePasskeyRequestNotFound, ErrTypeInvalidPasskey, ErrTypeEmailNotVerified},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				body, err := pyrin.Body[AuthFinishPasskeyLoginBody](c)
+				if err != nil {
+					return nil, err
+				}
+
+				tokens, err := app.AuthService().FinishPasskeyLogin(c.Request().Context(), body.RequestId, []byte(body.Credential), ClientInfo(app, c))
+				if err != nil {
+					if errors.Is(err, service.ErrAuthServiceEmailNotVerified) {
+						return nil, EmailNotVerified()
+					}
+
+					return nil, passkeyError(err)
+				}
+
+				return AuthFinishPasskeyLogin{
+					Token:        tokens.AccessToken,
+					RefreshToken: tokens.RefreshToken,
+				}, nil
+			},
+		},
+
+		pyrin.ApiHandler{
+			Name:         "AuthBeginPasskeyMfa",
+			Method:       http.MethodPost,
+			Path:         "/auth/mfa/passkey/begin",
+			ResponseType: PasskeyOptions{},
+			BodyType:     AuthBeginPasskeyMfaBody{},
+			Errors:       []pyrin.ErrorType{ErrTypePasskeysDisabled, ErrTypePasskeyNotFound, ErrTypeInvalidMfaChallenge, ErrTypeMfaLocked},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				body, err := pyrin.Body[AuthBeginPasskeyMfaBody](c)
+				if err != nil {
+					return nil, err
+				}
+
+				options, err := app.AuthService().BeginPasskeyMfa(c.Request().Context(), body.Challenge)
+				if err != nil {
+					switch {
+					case errors.Is(err, service.ErrAuthServiceInvalidMfaChallenge):
+						return nil, InvalidMfaChallenge()
+					case errors.Is(err, service.ErrAuthServiceMfaLocked):
+						return nil, MfaLocked()
+					}
+
+					return nil, passkeyError(err)
+				}
+
+				return convertPasskeyOptions(options), nil
+			},
+		},
+
+		pyrin.ApiHandler{
+			Name:         "AuthFinishPasskeyMfa",
+			Method:       http.MethodPost,
+			Path:         "/auth/mfa/passkey/finish",
+			ResponseType: AuthFinishPasskeyMfa{},
+			BodyType:     AuthFinishPasskeyMfaBody{},
+			Errors:       []pyrin.ErrorType{ErrTypePasskeysDisabled, ErrTypePasskeyRequestNotFound, ErrTypeInvalidMfaChallenge, ErrTypeInvalidMfaCode, ErrTypeMfaLocked},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				body, err := pyrin.Body[AuthFinishPasskeyMfaBody](c)
+				if err != nil {
+					return nil, err
+				}
+
+				tokens, err := app.AuthService().CompletePasskeyMfa(c.Request().Context(), body.Challenge, body.RequestId, []byte(body.Credential), ClientInfo(app, c))
+				if err != nil {
+					switch {
+					case errors.Is(err, service.ErrAuthServiceInvalidMfaChallenge):
+						return nil, InvalidMfaChallenge()
+					case errors.Is(err, service.ErrAuthServiceInvalidMfaCode):
+						return nil, InvalidMfaCode()
+					case errors.Is(err, service.ErrAuthServiceMfaLocked):
+						return nil, MfaLocked()
+					}
+
+					return nil, passkeyError(err)
+				}
+
+				return AuthFinishPasskeyMfa{
+					Token:        tokens.AccessToken,
+					RefreshToken: tokens.RefreshToken,
+				}, nil
+			},
+		},
+	)
+}
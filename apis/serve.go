@@ -12,10 +12,29 @@ import (
 func RegisterHandlers(app core.App, router pyrin.Router) {
 	g := router.Group("/api/v1")
 	InstallAuthHandlers(app, g)
+	InstallLocalAccountHandlers(app, g)
+	InstallMagicLinkApiHandlers(app, g)
+	InstallEmailVerificationHandlers(app, g)
+	InstallMfaHandlers(app, g)
+	InstallPasskeyHandlers(app, g)
 	InstallSystemHandlers(app, g)
 	InstallUserHandlers(app, g)
+	InstallSessionHandlers(app, g)
+	InstallUserEventHandlers(app, g)
+	InstallOidcApiHandlers(app, g)
+	InstallOAuthClientHandlers(app, g)
+	InstallGrantHandlers(app, g)
+	InstallForwardAuthApiHandlers(app, g)
 
 	g = router.Group("")
+	InstallOAuthHandlers(app, g)
+	InstallOidcHandlers(app, g)
+	InstallConsentHandlers(app, g)
+	InstallOAuthRegistrationHandlers(app, g)
+	InstallWellKnownHandlers(app, g)
+	InstallForwardAuthHandlers(app, g)
+	InstallMagicLinkHandlers(app, g)
+
 	g.Register(
 		pyrin.NormalHandler{
 			Method:      http.MethodGet,
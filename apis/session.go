@@ -0,0 +1,223 @@
+package apis
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/nanoteck137/authlab/core"
+	"github.com/nanoteck137/authlab/database"
+	"github.com/nanoteck137/authlab/service"
+	"github.com/nanoteck137/pyrin"
+)
+
+type Session struct {
+	Id         string `json:"id"`
+	AuthMethod string `json:"authMethod"`
+	UserAgent  string `json:"userAgent"`
+	IpAddress  string `json:"ipAddress"`
+	Current    bool   `json:"current"`
+	LastSeen   string `json:"lastSeen"`
+	Created    string `json:"created"`
+}
+
+type GetSessions struct {
+	Sessions []Session `json:"sessions"`
+}
+
+func getSessions(app core.App, userId, currentSessionId string) (GetSessions, error) {
+	ctx := context.TODO()
+
+	sessions, err := app.DB().GetAllSessionsForUser(ctx, userId)
+	if err != nil {
+		return GetSessions{}, err
+	}
+
+	res := GetSessions{
+		Sessions: make([]Session, len(sessions)),
+	}
+
+	for i, session := range sessions {
+		res.Sessions[i] = Session{
+			Id:         session.Id,
+			AuthMethod: session.AuthMethod,
+			UserAgent:  session.UserAgent,
+			IpAddress:  session.IpAddress,
+			Current:    session.Id == currentSessionId,
+			LastSeen:   time.UnixMilli(session.LastSeen).Format(time.RFC3339Nano),
+			Created:    time.UnixMilli(session.Created).Format(time.RFC3339Nano),
+		}
+	}
+
+	return res, nil
+}
+
+func revokeSession(app core.App, userId, sessionId string) error {
+	err := app.AuthService().RevokeSession(context.TODO(), userId, sessionId)
+	if err != nil {
+		if errors.Is(err, service.ErrAuthServiceSessionNotFound) {
+			return SessionNotFound()
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func getUserById(app core.App, id string) (database.User, error) {
+	user, err := app.DB().GetUserById(context.TODO(), id)
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return database.User{}, UserNotFound()
+		}
+
+		return database.User{}, err
+	}
+
+	return user, nil
+}
+
+func InstallSessionHandlers(app core.App, group pyrin.Group) {
+	group.Register(
+		pyrin.ApiHandler{
+			Name:         "GetSessions",
+			Method:       http.MethodGet,
+			Path:         "/auth/sessions",
+			ResponseType: GetSessions{},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				auth, err := getAuth(app, c)
+				if err != nil {
+					return nil, err
+				}
+
+				return getSessions(app, auth.User.Id, auth.SessionId)
+			},
+		},
+
+		pyrin.ApiHandler{
+			Name:   "RevokeSession",
+			Method: http.MethodDelete,
+			Path:   "/auth/sessions/:id",
+			Errors: []pyrin.ErrorType{ErrTypeSessionNotFound},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				sessionId := c.Param("id")
+
+				user, err := User(app, c)
+				if err != nil {
+					return nil, err
+				}
+
+				return nil, revokeSession(app, user.Id, sessionId)
+			},
+		},
+
+		pyrin.ApiHandler{
+			Name:   "RevokeAllSessions",
+			Method: http.MethodDelete,
+			Path:   "/auth/sessions",
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				user, err := User(app, c)
+				if err != nil {
+					return nil, err
+				}
+
+				err = app.AuthService().RevokeAllSessions(context.TODO(), user.Id)
+				if err != nil {
+					return nil, err
+				}
+
+				return nil, nil
+			},
+		},
+
+		pyrin.ApiHandler{
+			Name:   "AuthLogout",
+			Method: http.MethodPost,
+			Path:   "/auth/logout",
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				auth, err := getAuth(app, c)
+				if err != nil {
+					return nil, err
+				}
+
+				// NOTE(patrik): Api tokens doesn't have a session
+				if auth.SessionId == "" {
+					return nil, nil
+				}
+
+				return nil, revokeSession(app, auth.User.Id, auth.SessionId)
+			},
+		},
+	)
+
+	// NOTE(patrik): Admin variants
+	group.Register(
+		pyrin.ApiHandler{
+			Name:         "GetUserSessions",
+			Method:       http.MethodGet,
+			Path:         "/users/:id/sessions",
+			ResponseType: GetSessions{},
+			Errors:       []pyrin.ErrorType{ErrTypeUserNotFound},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				_, err := User(app, c, RequireAdmin)
+				if err != nil {
+					return nil, err
+				}
+
+				user, err := getUserById(app, c.Param("id"))
+				if err != nil {
+					return nil, err
+				}
+
+				return getSessions(app, user.Id, "")
+			},
+		},
+
+		pyrin.ApiHandler{
+			Name:   "RevokeUserSession",
+			Method: http.MethodDelete,
+			Path:   "/users/:id/sessions/:sessionId",
+			Errors: []pyrin.ErrorType{ErrTypeUserNotFound, ErrTypeSessionNotFound},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				_, err := User(app, c, RequireAdmin)
+				if err != nil {
+					return nil, err
+				}
+
+				user, err := getUserById(app, c.Param("id"))
+				if err != nil {
+					return nil, err
+				}
+
+				return nil, revokeSession(app, user.Id, c.Param("sessionId"))
+			},
+		},
+
+		pyrin.ApiHandler{
+			Name:   "RevokeAllUserSessions",
+			Method: http.MethodDelete,
+			Path:   "/users/:id/sessions",
+			Errors: []pyrin.ErrorType{ErrTypeUserNotFound},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				_, err := User(app, c, RequireAdmin)
+				if err != nil {
+					return nil, err
+				}
+
+				user, err := getUserById(app, c.Param("id"))
+				if err != nil {
+					return nil, err
+				}
+
+				err = app.AuthService().RevokeAllSessions(context.TODO(), user.Id)
+				if err != nil {
+					return nil, err
+				}
+
+				return nil, nil
+			},
+		},
+	)
+}
@@ -0,0 +1,88 @@
+package apis
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/nanoteck137/authlab/core"
+	"github.com/nanoteck137/pyrin"
+)
+
+type UserEvent struct {
+	Id        string `json:"id"`
+	Type      string `json:"type"`
+	UserAgent string `json:"userAgent"`
+	IpAddress string `json:"ipAddress"`
+	Created   string `json:"created"`
+}
+
+type GetUserEvents struct {
+	Events []UserEvent `json:"events"`
+}
+
+func getUserEvents(app core.App, userId string) (GetUserEvents, error) {
+	events, err := app.AuthService().GetUserEvents(context.TODO(), userId)
+	if err != nil {
+		return GetUserEvents{}, err
+	}
+
+	res := GetUserEvents{
+		Events: make([]UserEvent, len(events)),
+	}
+
+	for i, event := range events {
+		res.Events[i] = UserEvent{
+			Id:        event.Id,
+			Type:      event.Type,
+			UserAgent: event.UserAgent,
+			IpAddress: event.IpAddress,
+			Created:   time.UnixMilli(event.Created).Format(time.RFC3339Nano),
+		}
+	}
+
+	return res, nil
+}
+
+func InstallUserEventHandlers(app core.App, group pyrin.Group) {
+	group.Register(
+		pyrin.ApiHandler{
+			Name:         "GetEvents",
+			Method:       http.MethodGet,
+			Path:         "/auth/events",
+			ResponseType: GetUserEvents{},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				user, err := User(app, c)
+				if err != nil {
+					return nil, err
+				}
+
+				return getUserEvents(app, user.Id)
+			},
+		},
+	)
+
+	// NOTE(patrik): Admin variants
+	group.Register(
+		pyrin.ApiHandler{
+			Name:         "GetUserEvents",
+			Method:       http.MethodGet,
+			Path:         "/users/:id/events",
+			ResponseType: GetUserEvents{},
+			Errors:       []pyrin.ErrorType{ErrTypeUserNotFound},
+			HandlerFunc: func(c pyrin.Context) (any, error) {
+				_, err := User(app, c, RequireAdmin)
+				if err != nil {
+					return nil, err
+				}
+
+				user, err := getUserById(app, c.Param("id"))
+				if err != nil {
+					return nil, err
+				}
+
+				return getUserEvents(app, user.Id)
+			},
+		},
+	)
+}
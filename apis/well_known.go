@@ -0,0 +1,119 @@
+package apis
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/nanoteck137/authlab/core"
+	"github.com/nanoteck137/authlab/service"
+	"github.com/nanoteck137/pyrin"
+)
+
+// OpenIdConfiguration is the OpenID Connect discovery document
+type OpenIdConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JwksUri                           string   `json:"jwks_uri"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	IntrospectionEndpointAuthMethods  []string `json:"introspection_endpoint_auth_methods_supported"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint"`
+	RegistrationEndpoint              string   `json:"registration_endpoint"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IdTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+	AuthorizationResponseIssParameter bool     `json:"authorization_response_iss_parameter_supported"`
+}
+
+func InstallWellKnownHandlers(app core.App, group pyrin.Group) {
+	group.Register(
+		pyrin.NormalHandler{
+			Name:   "WellKnownJwks",
+			Method: http.MethodGet,
+			Path:   "/.well-known/jwks.json",
+			HandlerFunc: func(c pyrin.Context) error {
+				jwks := app.KeyService().JWKS()
+
+				w := c.Response()
+				w.Header().Set("Content-Type", "application/json")
+				// NOTE(patrik): Let the services cache the keys for a
+				// while, they should refetch when they see an unknown kid
+				w.Header().Set("Cache-Control", "public, max-age=300")
+				w.WriteHeader(http.StatusOK)
+
+				return json.NewEncoder(w).Encode(jwks)
+			},
+		},
+
+		pyrin.NormalHandler{
+			Name:   "WellKnownOpenIdConfiguration",
+			Method: http.MethodGet,
+			Path:   "/.well-known/openid-configuration",
+			HandlerFunc: func(c pyrin.Context) error {
+				issuer := PublicUrl(app, c)
+
+				// NOTE(patrik): Only the asymmetric algorithms, the
+				// clients can't verify HMAC signed ID tokens
+				var algs []string
+				for _, alg := range service.Algorithms {
+					if alg != service.AlgorithmHS256 {
+						algs = append(algs, alg)
+					}
+				}
+
+				config := OpenIdConfiguration{
+					Issuer:                      issuer,
+					AuthorizationEndpoint:       issuer + "/oauth/authorize",
+					TokenEndpoint:               issuer + "/oauth/token",
+					UserinfoEndpoint:            issuer + "/oauth/userinfo",
+					JwksUri:                     issuer + "/.well-known/jwks.json",
+					RevocationEndpoint:          issuer + "/oauth/revoke",
+					IntrospectionEndpoint:       issuer + "/oauth/introspect",
+					DeviceAuthorizationEndpoint: issuer + "/oauth/device_authorization",
+					RegistrationEndpoint:        issuer + "/oauth/register",
+					ScopesSupported:             service.SupportedScopes,
+					ResponseTypesSupported:      []string{ResponseTypeCode},
+					GrantTypesSupported: []string{
+						GrantTypeAuthorizationCode,
+						GrantTypeRefreshToken,
+						GrantTypeDeviceCode,
+						GrantTypeClientCredentials,
+						GrantTypeTokenExchange,
+					},
+					SubjectTypesSupported:            []string{"public"},
+					IdTokenSigningAlgValuesSupported: algs,
+					TokenEndpointAuthMethodsSupported: []string{
+						"client_secret_basic",
+						"client_secret_post",
+						"none",
+					},
+					// NOTE(patrik): Public clients can't introspect tokens
+					IntrospectionEndpointAuthMethods: []string{
+						"client_secret_basic",
+						"client_secret_post",
+					},
+					CodeChallengeMethodsSupported: []string{service.PkceMethodS256},
+					ClaimsSupported: []string{
+						"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce",
+						"at_hash", "email", "email_verified", "name", "role",
+					},
+					AuthorizationResponseIssParameter: true,
+				}
+
+				w := c.Response()
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Cache-Control", "public, max-age=300")
+				w.WriteHeader(http.StatusOK)
+
+				return json.NewEncoder(w).Encode(config)
+			},
+		},
+	)
+}
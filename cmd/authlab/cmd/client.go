@@ -0,0 +1,332 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nanoteck137/authlab/service"
+	"github.com/spf13/cobra"
+)
+
+var clientCmd = &cobra.Command{
+	Use:   "client",
+	Short: "Manage the OAuth clients that can use authlab as an OpenID Connect provider",
+}
+
+func printClient(client *service.OAuthClient) {
+	clientType := "confidential"
+	if client.Public {
+		clientType = "public"
+	}
+
+	fmt.Printf("Id: %s\n", client.Id)
+	fmt.Printf("Name: %s\n", client.Name)
+	fmt.Printf("Type: %s\n", clientType)
+	fmt.Printf("Trusted: %t\n", client.Trusted)
+	fmt.Printf("Redirect URIs: %s\n", strings.Join(client.RedirectUris, " "))
+	fmt.Printf("Grant Types: %s\n", strings.Join(client.GrantTypes, " "))
+	fmt.Printf("Scopes: %s\n", strings.Join(client.Scopes, " "))
+	if len(client.Audiences) > 0 {
+		fmt.Printf("Audiences: %s\n", strings.Join(client.Audiences, " "))
+	}
+	if len(client.ExchangeAudiences) > 0 {
+		fmt.Printf("Exchange Audiences: %s\n", strings.Join(client.ExchangeAudiences, " "))
+	}
+	if len(client.ExchangeScopes) > 0 {
+		fmt.Printf("Exchange Scopes: %s\n", strings.Join(client.ExchangeScopes, " "))
+	}
+	if client.LogoUrl != "" {
+		fmt.Printf("Logo URL: %s\n", client.LogoUrl)
+	}
+}
+
+var clientListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all the clients",
+	Run: func(cmd *cobra.Command, args []string) {
+		app := bootstrapApp()
+
+		clients, err := app.AuthService().GetAllOAuthClients(context.Background())
+		if err != nil {
+			slog.Error("Failed to get clients", "err", err)
+			os.Exit(-1)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tTYPE\tGRANT TYPES\tSCOPES\tSOURCE")
+
+		for _, client := range clients {
+			clientType := "confidential"
+			if client.Public {
+				clientType = "public"
+			}
+
+			source := "database"
+			if client.Static {
+				source = "config"
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", client.Id, client.Name, clientType, strings.Join(client.GrantTypes, ","), strings.Join(client.Scopes, ","), source)
+		}
+
+		w.Flush()
+	},
+}
+
+var clientCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Register a new client, the secret is only shown once",
+	Run: func(cmd *cobra.Command, args []string) {
+		id, _ := cmd.Flags().GetString("id")
+		name, _ := cmd.Flags().GetString("name")
+		logoUrl, _ := cmd.Flags().GetString("logo-url")
+		public, _ := cmd.Flags().GetBool("public")
+		trusted, _ := cmd.Flags().GetBool("trusted")
+		redirectUris, _ := cmd.Flags().GetStringSlice("redirect-uri")
+		grantTypes, _ := cmd.Flags().GetStringSlice("grant-type")
+		scopes, _ := cmd.Flags().GetStringSlice("scope")
+		audiences, _ := cmd.Flags().GetStringSlice("audience")
+		exchangeAudiences, _ := cmd.Flags().GetStringSlice("exchange-audience")
+		exchangeScopes, _ := cmd.Flags().GetStringSlice("exchange-scope")
+
+		app := bootstrapApp()
+
+		client, secret, err := app.AuthService().CreateOAuthClient(context.Background(), service.CreateOAuthClientParams{
+			Id:           id,
+			Name:         name,
+			LogoUrl:      logoUrl,
+			Public:       public,
+			Trusted:      trusted,
+			RedirectUris: redirectUris,
+			GrantTypes:   grantTypes,
+			Scopes:       scopes,
+			Audiences:    audiences,
+
+			ExchangeAudiences: exchangeAudiences,
+			ExchangeScopes:    exchangeScopes,
+		})
+		if err != nil {
+			slog.Error("Failed to create client", "err", err)
+			os.Exit(-1)
+		}
+
+		printClient(client)
+		if secret != "" {
+			fmt.Printf("Secret: %s\n", secret)
+		}
+	},
+}
+
+var clientUpdateCmd = &cobra.Command{
+	Use:   "update <CLIENT_ID>",
+	Short: "Update a client, only the given flags are changed",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		changes := service.OAuthClientChanges{}
+
+		if cmd.Flags().Changed("name") {
+			name, _ := cmd.Flags().GetString("name")
+			changes.Name = &name
+		}
+
+		if cmd.Flags().Changed("logo-url") {
+			logoUrl, _ := cmd.Flags().GetString("logo-url")
+			changes.LogoUrl = &logoUrl
+		}
+
+		if cmd.Flags().Changed("trusted") {
+			trusted, _ := cmd.Flags().GetBool("trusted")
+			changes.Trusted = &trusted
+		}
+
+		if cmd.Flags().Changed("redirect-uri") {
+			redirectUris, _ := cmd.Flags().GetStringSlice("redirect-uri")
+			changes.RedirectUris = &redirectUris
+		}
+
+		if cmd.Flags().Changed("grant-type") {
+			grantTypes, _ := cmd.Flags().GetStringSlice("grant-type")
+			changes.GrantTypes = &grantTypes
+		}
+
+		if cmd.Flags().Changed("scope") {
+			scopes, _ := cmd.Flags().GetStringSlice("scope")
+			changes.Scopes = &scopes
+		}
+
+		if cmd.Flags().Changed("audience") {
+			audiences, _ := cmd.Flags().GetStringSlice("audience")
+			changes.Audiences = &audiences
+		}
+
+		if cmd.Flags().Changed("exchange-audience") {
+			exchangeAudiences, _ := cmd.Flags().GetStringSlice("exchange-audience")
+			changes.ExchangeAudiences = &exchangeAudiences
+		}
+
+		if cmd.Flags().Changed("exchange-scope") {
+			exchangeScopes, _ := cmd.Flags().GetStringSlice("exchange-scope")
+			changes.ExchangeScopes = &exchangeScopes
+		}
+
+		app := bootstrapApp()
+
+		client, err := app.AuthService().UpdateOAuthClient(context.Background(), args[0], changes)
+		if err != nil {
+			slog.Error("Failed to update client", "err", err)
+			os.Exit(-1)
+		}
+
+		printClient(client)
+	},
+}
+
+var clientRotateSecretCmd = &cobra.Command{
+	Use:   "rotate-secret <CLIENT_ID>",
+	Short: "Generate a new secret for a client, the old secret stops working right away",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		app := bootstrapApp()
+
+		secret, err := app.AuthService().RotateOAuthClientSecret(context.Background(), args[0])
+		if err != nil {
+			slog.Error("Failed to rotate client secret", "err", err)
+			os.Exit(-1)
+		}
+
+		fmt.Printf("Secret: %s\n", secret)
+	},
+}
+
+var clientDeleteCmd = &cobra.Command{
+	Use:   "delete <CLIENT_ID>",
+	Short: "Delete a client together with the sessions created for the client",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		app := bootstrapApp()
+
+		err := app.AuthService().DeleteOAuthClient(context.Background(), args[0])
+		if err != nil {
+			slog.Error("Failed to delete client", "err", err)
+			os.Exit(-1)
+		}
+
+		fmt.Printf("Deleted client: %s\n", args[0])
+	},
+}
+
+var clientInitialTokenCmd = &cobra.Command{
+	Use:   "initial-token",
+	Short: "Manage the initial access tokens used to register clients with the dynamic client registration endpoint",
+}
+
+var clientInitialTokenListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all the initial access tokens",
+	Run: func(cmd *cobra.Command, args []string) {
+		app := bootstrapApp()
+
+		tokens, err := app.AuthService().GetAllInitialAccessTokens(context.Background())
+		if err != nil {
+			slog.Error("Failed to get initial access tokens", "err", err)
+			os.Exit(-1)
+		}
+
+		formatTime := func(t time.Time) string {
+			if t.IsZero() {
+				return "-"
+			}
+
+			return t.Format(time.RFC3339)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tCREATED\tEXPIRES\tLAST USED")
+
+		for _, token := range tokens {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", token.Id, token.Name, formatTime(token.Created), formatTime(token.Expires), formatTime(token.LastUsed))
+		}
+
+		w.Flush()
+	},
+}
+
+var clientInitialTokenCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create a new initial access token, the token is only shown once",
+	Run: func(cmd *cobra.Command, args []string) {
+		name, _ := cmd.Flags().GetString("name")
+		expires, _ := cmd.Flags().GetDuration("expires")
+
+		app := bootstrapApp()
+
+		initialToken, token, err := app.AuthService().CreateInitialAccessToken(context.Background(), "", name, expires)
+		if err != nil {
+			slog.Error("Failed to create initial access token", "err", err)
+			os.Exit(-1)
+		}
+
+		fmt.Printf("Id: %s\n", initialToken.Id)
+		fmt.Printf("Token: %s\n", token)
+	},
+}
+
+var clientInitialTokenDeleteCmd = &cobra.Command{
+	Use:   "delete <TOKEN_ID>",
+	Short: "Delete an initial access token, the clients registered with the token are kept",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		app := bootstrapApp()
+
+		err := app.AuthService().DeleteInitialAccessToken(context.Background(), args[0])
+		if err != nil {
+			slog.Error("Failed to delete initial access token", "err", err)
+			os.Exit(-1)
+		}
+
+		fmt.Printf("Deleted initial access token: %s\n", args[0])
+	},
+}
+
+func addClientFlags(cmd *cobra.Command) {
+	cmd.Flags().String("name", "", "Name of the client shown to the users")
+	cmd.Flags().String("logo-url", "", "Url to the logo of the client")
+	cmd.Flags().Bool("trusted", false, "Trusted first-party client, the users are not asked for consent")
+	cmd.Flags().StringSlice("redirect-uri", nil, "Allowed redirect uri (can be repeated)")
+	cmd.Flags().StringSlice("grant-type", nil, "Allowed grant type (can be repeated), defaults to authorization_code and refresh_token")
+	cmd.Flags().StringSlice("scope", nil, "Allowed scope (can be repeated), defaults to all the supported scopes")
+	cmd.Flags().StringSlice("audience", nil, "Audience the client can request tokens for with the client_credentials grant (can be repeated)")
+	cmd.Flags().StringSlice("exchange-audience", nil, "Audience the client can exchange user tokens for with the token exchange grant (can be repeated)")
+	cmd.Flags().StringSlice("exchange-scope", nil, "Scope the exchanged tokens can have (can be repeated), the client can't exchange tokens if not set")
+}
+
+func init() {
+	addClientFlags(clientCreateCmd)
+	clientCreateCmd.Flags().String("id", "", "Id of the client, generated if not set")
+	clientCreateCmd.Flags().Bool("public", false, "Create a public client without a secret, public clients are required to use PKCE")
+	clientCreateCmd.MarkFlagRequired("name")
+
+	addClientFlags(clientUpdateCmd)
+
+	clientInitialTokenCreateCmd.Flags().String("name", "", "Name of the token")
+	clientInitialTokenCreateCmd.Flags().Duration("expires", 0, "How long the token is valid for (Example: 24h), never expires if not set")
+	clientInitialTokenCreateCmd.MarkFlagRequired("name")
+
+	clientInitialTokenCmd.AddCommand(clientInitialTokenListCmd)
+	clientInitialTokenCmd.AddCommand(clientInitialTokenCreateCmd)
+	clientInitialTokenCmd.AddCommand(clientInitialTokenDeleteCmd)
+
+	clientCmd.AddCommand(clientListCmd)
+	clientCmd.AddCommand(clientCreateCmd)
+	clientCmd.AddCommand(clientUpdateCmd)
+	clientCmd.AddCommand(clientRotateSecretCmd)
+	clientCmd.AddCommand(clientDeleteCmd)
+	clientCmd.AddCommand(clientInitialTokenCmd)
+
+	rootCmd.AddCommand(clientCmd)
+}
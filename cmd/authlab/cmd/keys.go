@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var keysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "Manage the keys used to sign user tokens",
+}
+
+var keysListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all the keys",
+	Run: func(cmd *cobra.Command, args []string) {
+		app := bootstrapApp()
+
+		keys, err := app.KeyService().List()
+		if err != nil {
+			slog.Error("Failed to list keys", "err", err)
+			os.Exit(-1)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tALGORITHM\tSTATUS\tCREATED\tEXPIRES")
+
+		for _, key := range keys {
+			id := key.Id
+			if key.FromConfig {
+				id += " (jwt_secret)"
+			}
+
+			expires := "-"
+			if !key.Expires.IsZero() {
+				expires = key.Expires.Format(time.RFC3339)
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", id, key.Algorithm, key.Status, key.Created.Format(time.RFC3339), expires)
+		}
+
+		w.Flush()
+	},
+}
+
+var keysRotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Generate a new signing key, the old key is kept until the issued tokens have expired",
+	Run: func(cmd *cobra.Command, args []string) {
+		algorithm, _ := cmd.Flags().GetString("algorithm")
+
+		app := bootstrapApp()
+
+		id, err := app.KeyService().Rotate(algorithm)
+		if err != nil {
+			slog.Error("Failed to rotate key", "err", err)
+			os.Exit(-1)
+		}
+
+		fmt.Printf("New signing key: %s\n", id)
+	},
+}
+
+var keysRetireCmd = &cobra.Command{
+	Use:   "retire <KEY_ID>",
+	Short: "Retire a key, tokens signed with the key stops working right away",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		app := bootstrapApp()
+
+		err := app.KeyService().Retire(args[0])
+		if err != nil {
+			slog.Error("Failed to retire key", "err", err)
+			os.Exit(-1)
+		}
+
+		fmt.Printf("Retired key: %s\n", args[0])
+	},
+}
+
+func init() {
+	keysRotateCmd.Flags().String("algorithm", "", "Algorithm of the new key (HS256, RS256, ES256 or EdDSA), defaults to jwt_signing_algorithm")
+
+	keysCmd.AddCommand(keysListCmd)
+	keysCmd.AddCommand(keysRotateCmd)
+	keysCmd.AddCommand(keysRetireCmd)
+
+	rootCmd.AddCommand(keysCmd)
+}
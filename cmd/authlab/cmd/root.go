@@ -6,6 +6,7 @@ import (
 
 	"github.com/nanoteck137/authlab"
 	"github.com/nanoteck137/authlab/config"
+	"github.com/nanoteck137/authlab/core"
 	"github.com/spf13/cobra"
 )
 
@@ -21,6 +22,20 @@ func Execute() {
 	}
 }
 
+// bootstrapApp bootstraps the app for the commands that works on the
+// data directory directly
+func bootstrapApp() *core.BaseApp {
+	app := core.NewBaseApp(&config.LoadedConfig)
+
+	err := app.Bootstrap()
+	if err != nil {
+		slog.Error("Failed to bootstrap app", "err", err)
+		os.Exit(-1)
+	}
+
+	return app
+}
+
 func init() {
 	rootCmd.SetVersionTemplate(authlab.VersionTemplate(authlab.AppName))
 
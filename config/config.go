@@ -1,8 +1,12 @@
 package config
 
 import (
+	"fmt"
 	"log/slog"
+	"net/netip"
 	"os"
+	"slices"
+	"time"
 
 	"github.com/nanoteck137/authlab"
 	"github.com/nanoteck137/authlab/types"
@@ -15,6 +19,110 @@ type ConfigOidcProvider struct {
 	ClientSecret string `mapstructure:"client_secret"`
 	IssuerUrl    string `mapstructure:"issuer_url"`
 	RedirectUrl  string `mapstructure:"redirect_url"`
+
+	// Some providers rejects requests with PKCE, so we need a way to
+	// disable it for them
+	DisablePkce bool `mapstructure:"disable_pkce"`
+
+	// Optional list of ACR values to request, if set then the "acr" claim
+	// of the ID token needs to be one of these values
+	AcrValues []string `mapstructure:"acr_values"`
+
+	// Optional max age in seconds of the authentication at the provider,
+	// checked against the "auth_time" claim of the ID token
+	MaxAge int `mapstructure:"max_age"`
+}
+
+// ConfigOAuthClient is a client that can use authlab as an OpenID
+// Connect provider
+type ConfigOAuthClient struct {
+	Name string `mapstructure:"name"`
+
+	// The secret for confidential clients, public clients (SPAs, native
+	// apps) have no secret and are required to use PKCE
+	Secret string `mapstructure:"secret"`
+
+	// The allowed redirect uris, the redirect_uri of the authorization
+	// request needs to match one of these exactly
+	RedirectUris []string `mapstructure:"redirect_uris"`
+
+	// Trusted clients are first party apps, the users are not asked to
+	// approve the requested scopes
+	Trusted bool `mapstructure:"trusted"`
+
+	// The grant types the client can use, empty gives the client the
+	// "authorization_code" and "refresh_token" grant types
+	GrantTypes []string `mapstructure:"grant_types"`
+}
+
+// ConfigPasswordHashing is the argon2id parameters used to hash the
+// passwords of the local accounts. The passwords are rehashed with the
+// new parameters the next time the user logs in.
+type ConfigPasswordHashing struct {
+	// The memory in KiB
+	Memory      uint32 `mapstructure:"memory"`
+	Iterations  uint32 `mapstructure:"iterations"`
+	Parallelism uint8  `mapstructure:"parallelism"`
+
+	SaltLength uint32 `mapstructure:"salt_length"`
+	KeyLength  uint32 `mapstructure:"key_length"`
+}
+
+// ConfigMailer is the config for sending emails to the users
+type ConfigMailer struct {
+	// The mailer to use, "log" writes the emails to the log, "file"
+	// writes the emails to the directory and "smtp" sends the emails
+	Type string `mapstructure:"type"`
+
+	// The sender address, "authlab <noreply@example.com>"
+	From string `mapstructure:"from"`
+
+	// The directory for the "file" mailer, defaults to "<data_dir>/mail"
+	Dir string `mapstructure:"dir"`
+
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+
+	// How the connection to the SMTP server is secured, "starttls",
+	// "tls" or "none"
+	Tls string `mapstructure:"tls"`
+}
+
+// ConfigForwardAuthRule limits who can reach the hosts behind the
+// reverse proxy, a user is allowed if the role or the user is inside
+// the lists. A rule without roles and users allows every user.
+type ConfigForwardAuthRule struct {
+	// The hosts the rule applies to, "*.example.com" matches all the
+	// subdomains of example.com
+	Hosts []string `mapstructure:"hosts"`
+
+	Roles []string `mapstructure:"roles"`
+
+	// The ids or the emails of the allowed users
+	Users []string `mapstructure:"users"`
+}
+
+// ConfigForwardAuth is the config for the forward auth endpoint used by
+// reverse proxies like Traefik, Caddy and nginx
+type ConfigForwardAuth struct {
+	// The domain of the session cookie, needs to be a parent domain of
+	// both authlab and the protected hosts. Empty means the cookie is
+	// only sent to the host of authlab.
+	CookieDomain string `mapstructure:"cookie_domain"`
+
+	// How long the session cookie is valid for, the cookie stops working
+	// before that if the session is revoked
+	SessionDuration time.Duration `mapstructure:"session_duration"`
+
+	// What happens with hosts without a rule, "authenticated" allows
+	// every user and "deny" blocks the host
+	DefaultPolicy string `mapstructure:"default_policy"`
+
+	// The rules are checked in order and the first rule that matches the
+	// host is used
+	Rules []ConfigForwardAuthRule `mapstructure:"rules"`
 }
 
 type Config struct {
@@ -22,8 +130,48 @@ type Config struct {
 	ListenAddr       string `mapstructure:"listen_addr"`
 	DataDir          string `mapstructure:"data_dir"`
 	JwtSecret        string `mapstructure:"jwt_secret"`
+	PublicUrl        string `mapstructure:"public_url"`
+
+	// The algorithm used to sign user tokens, one of HS256, RS256, ES256
+	// or EdDSA. The asymmetric keys are generated and stored inside the
+	// data directory
+	JwtSigningAlgorithm string `mapstructure:"jwt_signing_algorithm"`
+
+	// How often the signing key is rotated, zero disables the scheduled
+	// rotation. Keys can also be rotated with "authlab keys rotate"
+	KeyRotationInterval time.Duration `mapstructure:"key_rotation_interval"`
+
+	AccessTokenDuration  time.Duration `mapstructure:"access_token_duration"`
+	RefreshTokenDuration time.Duration `mapstructure:"refresh_token_duration"`
+
+	// The addresses or CIDR ranges of the reverse proxies in front of
+	// authlab, the X-Forwarded-For header is only used for requests
+	// from these
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
 
 	OidcProviders map[string]ConfigOidcProvider `mapstructure:"oidc_providers"`
+
+	// Lets the users sign up and log in with a username and a password,
+	// works alongside the providers
+	EnableLocalAccounts bool                  `mapstructure:"enable_local_accounts"`
+	PasswordHashing     ConfigPasswordHashing `mapstructure:"password_hashing"`
+
+	// Lets the users log in with a link sent to the email, users that
+	// doesn't exist are created when they open the link
+	EnableMagicLinks bool `mapstructure:"enable_magic_links"`
+
+	// Stops the users from logging in until the email is verified
+	RequireVerifiedEmail bool `mapstructure:"require_verified_email"`
+
+	// Lets the users log in with passkeys and use them as a second
+	// factor, the passkeys are bound to the host of the public url
+	EnablePasskeys bool `mapstructure:"enable_passkeys"`
+
+	OAuthClients map[string]ConfigOAuthClient `mapstructure:"oauth_clients"`
+
+	ForwardAuth ConfigForwardAuth `mapstructure:"forward_auth"`
+
+	Mailer ConfigMailer `mapstructure:"mailer"`
 }
 
 func (c *Config) WorkDir() types.WorkDir {
@@ -33,8 +181,28 @@ func (c *Config) WorkDir() types.WorkDir {
 func setDefaults() {
 	viper.SetDefault("run_migrations", "true")
 	viper.SetDefault("listen_addr", ":3000")
+	viper.SetDefault("access_token_duration", "15m")
+	viper.SetDefault("refresh_token_duration", "720h")
+	viper.SetDefault("jwt_signing_algorithm", "HS256")
+	viper.SetDefault("key_rotation_interval", "0s")
+	viper.SetDefault("enable_local_accounts", "false")
+	viper.SetDefault("enable_magic_links", "false")
+	viper.SetDefault("require_verified_email", "false")
+	viper.SetDefault("enable_passkeys", "false")
+	viper.SetDefault("password_hashing.memory", 64*1024)
+	viper.SetDefault("password_hashing.iterations", 3)
+	viper.SetDefault("password_hashing.parallelism", 4)
+	viper.SetDefault("password_hashing.salt_length", 16)
+	viper.SetDefault("password_hashing.key_length", 32)
+	viper.SetDefault("mailer.type", "log")
+	viper.SetDefault("mailer.from", "authlab <noreply@localhost>")
+	viper.SetDefault("mailer.port", 587)
+	viper.SetDefault("mailer.tls", "starttls")
+	viper.SetDefault("forward_auth.session_duration", "24h")
+	viper.SetDefault("forward_auth.default_policy", "authenticated")
 	viper.BindEnv("data_dir")
 	viper.BindEnv("jwt_secret")
+	viper.BindEnv("public_url")
 }
 
 func validateConfig(config *Config) {
@@ -52,6 +220,61 @@ func validateConfig(config *Config) {
 	validate(config.ListenAddr == "", "listen_addr needs to be set")
 	validate(config.DataDir == "", "data_dir needs to be set")
 	validate(config.JwtSecret == "", "jwt_secret needs to be set")
+	validate(!slices.Contains([]string{"HS256", "RS256", "ES256", "EdDSA"}, config.JwtSigningAlgorithm), "jwt_signing_algorithm needs to be one of HS256, RS256, ES256 or EdDSA")
+	validate(config.KeyRotationInterval < 0, "key_rotation_interval can't be negative")
+	validate(config.AccessTokenDuration <= 0, "access_token_duration needs to be positive")
+	validate(config.RefreshTokenDuration <= 0, "refresh_token_duration needs to be positive")
+
+	for _, proxy := range config.TrustedProxies {
+		_, prefixErr := netip.ParsePrefix(proxy)
+		_, addrErr := netip.ParseAddr(proxy)
+		validate(prefixErr != nil && addrErr != nil, "trusted_proxies needs to be addresses or CIDR ranges, got "+proxy)
+	}
+
+	if len(config.OAuthClients) > 0 {
+		// NOTE(patrik): The issuer of the ID tokens needs to be the same
+		// no matter how the clients reaches authlab, and the clients
+		// needs a public key to verify the ID tokens with
+		validate(config.PublicUrl == "", "public_url needs to be set when oauth_clients are configured")
+		validate(config.JwtSigningAlgorithm == "HS256", "jwt_signing_algorithm needs to be RS256, ES256 or EdDSA when oauth_clients are configured")
+	}
+
+	// NOTE(patrik): The browser only lets the passkeys be used on the
+	// host they were registered on
+	validate(config.EnablePasskeys && config.PublicUrl == "", "public_url needs to be set when enable_passkeys is set")
+
+	// NOTE(patrik): The links inside the emails are only built from the
+	// public_url, the Host header of the request can't be trusted
+	sendsEmails := config.Mailer.Type == "smtp" ||
+		config.EnableLocalAccounts ||
+		config.EnableMagicLinks ||
+		config.RequireVerifiedEmail
+	validate(sendsEmails && config.PublicUrl == "", "public_url needs to be set when the mailer, local accounts, magic links or email verification is enabled")
+
+	for id, client := range config.OAuthClients {
+		// NOTE(patrik): Only the authorization code grant redirects back
+		// to the client, device clients doesn't need any redirect uris
+		needsRedirect := len(client.GrantTypes) == 0 || slices.Contains(client.GrantTypes, "authorization_code")
+		validate(needsRedirect && len(client.RedirectUris) == 0, "oauth_clients."+id+".redirect_uris needs to be set")
+	}
+
+	hashing := config.PasswordHashing
+	validate(hashing.Iterations < 1, "password_hashing.iterations needs to be at least 1")
+	validate(hashing.Parallelism < 1, "password_hashing.parallelism needs to be at least 1")
+	validate(hashing.Memory < 8*uint32(hashing.Parallelism), "password_hashing.memory needs to be at least 8 * parallelism")
+	validate(hashing.SaltLength < 8, "password_hashing.salt_length needs to be at least 8")
+	validate(hashing.KeyLength < 16, "password_hashing.key_length needs to be at least 16")
+
+	validate(!slices.Contains([]string{"log", "file", "smtp"}, config.Mailer.Type), "mailer.type needs to be log, file or smtp")
+	validate(!slices.Contains([]string{"starttls", "tls", "none"}, config.Mailer.Tls), "mailer.tls needs to be starttls, tls or none")
+	validate(config.Mailer.Type == "smtp" && config.Mailer.Host == "", "mailer.host needs to be set when mailer.type is smtp")
+
+	validate(config.ForwardAuth.SessionDuration <= 0, "forward_auth.session_duration needs to be positive")
+	validate(!slices.Contains([]string{"authenticated", "deny"}, config.ForwardAuth.DefaultPolicy), "forward_auth.default_policy needs to be authenticated or deny")
+
+	for i, rule := range config.ForwardAuth.Rules {
+		validate(len(rule.Hosts) == 0, fmt.Sprintf("forward_auth.rules[%d].hosts needs to be set", i))
+	}
 
 	if hasError {
 		slog.Error("Config not valid")
@@ -88,7 +311,7 @@ func InitConfig() {
 
 	err = viper.Unmarshal(&LoadedConfig)
 	if err != nil {
-		slog.Error("Failed to unmarshal config: ", err)
+		slog.Error("Failed to unmarshal config", "err", err)
 		os.Exit(-1)
 	}
 
@@ -3,6 +3,7 @@ package core
 import (
 	"github.com/nanoteck137/authlab/config"
 	"github.com/nanoteck137/authlab/database"
+	"github.com/nanoteck137/authlab/mailer"
 	"github.com/nanoteck137/authlab/service"
 	"github.com/nanoteck137/authlab/types"
 )
@@ -14,6 +15,9 @@ type App interface {
 	Config() *config.Config
 
 	AuthService() *service.AuthService
+	KeyService() *service.KeyService
+
+	Mailer() mailer.Mailer
 
 	WorkDir() types.WorkDir
 
@@ -1,8 +1,11 @@
 package core
 
 import (
+	"os"
+
 	"github.com/nanoteck137/authlab/config"
 	"github.com/nanoteck137/authlab/database"
+	"github.com/nanoteck137/authlab/mailer"
 	"github.com/nanoteck137/authlab/service"
 	"github.com/nanoteck137/authlab/types"
 )
@@ -14,12 +17,23 @@ type BaseApp struct {
 	config *config.Config
 
 	authService *service.AuthService
+	keyService  *service.KeyService
+
+	mailer mailer.Mailer
 }
 
 func (app *BaseApp) AuthService() *service.AuthService {
 	return app.authService
 }
 
+func (app *BaseApp) KeyService() *service.KeyService {
+	return app.keyService
+}
+
+func (app *BaseApp) Mailer() mailer.Mailer {
+	return app.mailer
+}
+
 func (app *BaseApp) DB() *database.Database {
 	return app.db
 }
@@ -37,14 +51,16 @@ func (app *BaseApp) Bootstrap() error {
 
 	workDir := app.config.WorkDir()
 
-	// dirs := []string{}
-	//
-	// for _, dir := range dirs {
-	// 	err = os.Mkdir(dir, 0755)
-	// 	if err != nil && !os.IsExist(err) {
-	// 		return err
-	// 	}
-	// }
+	dirs := []string{
+		workDir.KeysDir(),
+	}
+
+	for _, dir := range dirs {
+		err = os.Mkdir(dir, 0700)
+		if err != nil && !os.IsExist(err) {
+			return err
+		}
+	}
 
 	app.db, err = database.Open(workDir.DatabaseFile())
 	if err != nil {
@@ -58,9 +74,24 @@ func (app *BaseApp) Bootstrap() error {
 		}
 	}
 
-	app.authService = service.NewAuthService(app.db, app.config)
+	app.keyService, err = service.NewKeyService(workDir.KeysDir(), app.config)
+	if err != nil {
+		return err
+	}
+
+	app.mailer, err = mailer.New(app.config.Mailer, workDir)
+	if err != nil {
+		return err
+	}
+
+	app.authService, err = service.NewAuthService(app.db, app.keyService, app.config)
+	if err != nil {
+		return err
+	}
+
 	// TODO(patrik): This should be a worker
 	go app.authService.CleanRoutine()
+	go app.keyService.RotateRoutine()
 
 	return nil
 }
@@ -106,3 +106,15 @@ func (db DB) DeleteApiToken(ctx context.Context, id string) error {
 
 	return nil
 }
+
+func (db DB) DeleteAllApiTokensForUser(ctx context.Context, userId string) error {
+	query := dialect.Delete("api_tokens").
+		Where(goqu.I("api_tokens.user_id").Eq(userId))
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,200 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/nanoteck137/authlab/types"
+	"github.com/nanoteck137/pyrin/ember"
+)
+
+type AuthProviderRequest struct {
+	Id         string `db:"id"`
+	ProviderId string `db:"provider_id"`
+
+	Status    string `db:"status"`
+	Challenge string `db:"challenge"`
+
+	OAuth2Url  string         `db:"oauth2_url"`
+	OAuth2Code sql.NullString `db:"oauth2_code"`
+
+	PkceVerifier string `db:"pkce_verifier"`
+	Nonce        string `db:"nonce"`
+
+	Expires  int64 `db:"expires"`
+	DeleteAt int64 `db:"delete_at"`
+
+	Created int64 `db:"created"`
+	Updated int64 `db:"updated"`
+}
+
+func AuthProviderRequestQuery() *goqu.SelectDataset {
+	query := dialect.From("auth_provider_requests").
+		Select(
+			"auth_provider_requests.id",
+			"auth_provider_requests.provider_id",
+
+			"auth_provider_requests.status",
+			"auth_provider_requests.challenge",
+
+			"auth_provider_requests.oauth2_url",
+			"auth_provider_requests.oauth2_code",
+
+			"auth_provider_requests.pkce_verifier",
+			"auth_provider_requests.nonce",
+
+			"auth_provider_requests.expires",
+			"auth_provider_requests.delete_at",
+
+			"auth_provider_requests.created",
+			"auth_provider_requests.updated",
+		).
+		Prepared(true)
+
+	return query
+}
+
+func (db DB) GetAuthProviderRequestById(ctx context.Context, id string) (AuthProviderRequest, error) {
+	query := AuthProviderRequestQuery().
+		Where(goqu.I("auth_provider_requests.id").Eq(id))
+
+	return ember.Single[AuthProviderRequest](db.db, ctx, query)
+}
+
+type CreateAuthProviderRequestParams struct {
+	Id         string
+	ProviderId string
+
+	Status    string
+	Challenge string
+
+	OAuth2Url string
+
+	PkceVerifier string
+	Nonce        string
+
+	Expires  int64
+	DeleteAt int64
+
+	Created int64
+	Updated int64
+}
+
+func (db DB) CreateAuthProviderRequest(ctx context.Context, params CreateAuthProviderRequestParams) error {
+	t := time.Now().UnixMilli()
+	created := params.Created
+	updated := params.Updated
+
+	if created == 0 && updated == 0 {
+		created = t
+		updated = t
+	}
+
+	query := dialect.
+		Insert("auth_provider_requests").
+		Rows(goqu.Record{
+			"id":          params.Id,
+			"provider_id": params.ProviderId,
+
+			"status":    params.Status,
+			"challenge": params.Challenge,
+
+			"oauth2_url": params.OAuth2Url,
+
+			"pkce_verifier": params.PkceVerifier,
+			"nonce":         params.Nonce,
+
+			"expires":   params.Expires,
+			"delete_at": params.DeleteAt,
+
+			"created": created,
+			"updated": updated,
+		})
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+type AuthProviderRequestChanges struct {
+	Status     types.Change[string]
+	OAuth2Code types.Change[sql.NullString]
+}
+
+func (db DB) UpdateAuthProviderRequest(ctx context.Context, id string, changes AuthProviderRequestChanges) error {
+	record := goqu.Record{}
+
+	addToRecord(record, "status", changes.Status)
+	addToRecord(record, "oauth2_code", changes.OAuth2Code)
+
+	if len(record) == 0 {
+		return nil
+	}
+
+	record["updated"] = time.Now().UnixMilli()
+
+	ds := dialect.Update("auth_provider_requests").
+		Set(record).
+		Where(goqu.I("auth_provider_requests.id").Eq(id))
+
+	_, err := db.db.Exec(ctx, ds)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UpdateAuthProviderRequestWithStatus only updates the request if the
+// current status of the request is equal to status, returns true if
+// the request was updated
+func (db DB) UpdateAuthProviderRequestWithStatus(ctx context.Context, id, status string, changes AuthProviderRequestChanges) (bool, error) {
+	record := goqu.Record{}
+
+	addToRecord(record, "status", changes.Status)
+	addToRecord(record, "oauth2_code", changes.OAuth2Code)
+
+	if len(record) == 0 {
+		return false, nil
+	}
+
+	record["updated"] = time.Now().UnixMilli()
+
+	ds := dialect.Update("auth_provider_requests").
+		Set(record).
+		Where(
+			goqu.I("auth_provider_requests.id").Eq(id),
+			goqu.I("auth_provider_requests.status").Eq(status),
+		)
+
+	res, err := db.db.Exec(ctx, ds)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+// DeleteOldAuthProviderRequests removes all the requests that are past
+// their deletion date
+func (db DB) DeleteOldAuthProviderRequests(ctx context.Context, now int64) error {
+	query := dialect.Delete("auth_provider_requests").
+		Where(goqu.I("auth_provider_requests.delete_at").Lt(now))
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
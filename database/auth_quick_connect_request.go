@@ -0,0 +1,216 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/nanoteck137/authlab/types"
+	"github.com/nanoteck137/pyrin/ember"
+)
+
+type AuthQuickConnectRequest struct {
+	Code string `db:"code"`
+
+	Status    string `db:"status"`
+	Challenge string `db:"challenge"`
+
+	UserId sql.NullString `db:"user_id"`
+
+	ClientId sql.NullString `db:"client_id"`
+	Scope    string         `db:"scope"`
+
+	PollInterval int64 `db:"poll_interval"`
+	LastPolled   int64 `db:"last_polled"`
+
+	Expires  int64 `db:"expires"`
+	DeleteAt int64 `db:"delete_at"`
+
+	Created int64 `db:"created"`
+	Updated int64 `db:"updated"`
+}
+
+func AuthQuickConnectRequestQuery() *goqu.SelectDataset {
+	query := dialect.From("auth_quick_connect_requests").
+		Select(
+			"auth_quick_connect_requests.code",
+
+			"auth_quick_connect_requests.status",
+			"auth_quick_connect_requests.challenge",
+
+			"auth_quick_connect_requests.user_id",
+
+			"auth_quick_connect_requests.client_id",
+			"auth_quick_connect_requests.scope",
+
+			"auth_quick_connect_requests.poll_interval",
+			"auth_quick_connect_requests.last_polled",
+
+			"auth_quick_connect_requests.expires",
+			"auth_quick_connect_requests.delete_at",
+
+			"auth_quick_connect_requests.created",
+			"auth_quick_connect_requests.updated",
+		).
+		Prepared(true)
+
+	return query
+}
+
+func (db DB) GetAuthQuickConnectRequestByCode(ctx context.Context, code string) (AuthQuickConnectRequest, error) {
+	query := AuthQuickConnectRequestQuery().
+		Where(goqu.I("auth_quick_connect_requests.code").Eq(code))
+
+	return ember.Single[AuthQuickConnectRequest](db.db, ctx, query)
+}
+
+func (db DB) GetAuthQuickConnectRequestByChallenge(ctx context.Context, challenge string) (AuthQuickConnectRequest, error) {
+	query := AuthQuickConnectRequestQuery().
+		Where(goqu.I("auth_quick_connect_requests.challenge").Eq(challenge))
+
+	return ember.Single[AuthQuickConnectRequest](db.db, ctx, query)
+}
+
+type CreateAuthQuickConnectRequestParams struct {
+	Code string
+
+	Status    string
+	Challenge string
+
+	ClientId sql.NullString
+	Scope    string
+
+	PollInterval int64
+
+	Expires  int64
+	DeleteAt int64
+
+	Created int64
+	Updated int64
+}
+
+func (db DB) CreateAuthQuickConnectRequest(ctx context.Context, params CreateAuthQuickConnectRequestParams) error {
+	t := time.Now().UnixMilli()
+	created := params.Created
+	updated := params.Updated
+
+	if created == 0 && updated == 0 {
+		created = t
+		updated = t
+	}
+
+	query := dialect.
+		Insert("auth_quick_connect_requests").
+		Rows(goqu.Record{
+			"code": params.Code,
+
+			"status":    params.Status,
+			"challenge": params.Challenge,
+
+			"client_id": params.ClientId,
+			"scope":     params.Scope,
+
+			"poll_interval": params.PollInterval,
+
+			"expires":   params.Expires,
+			"delete_at": params.DeleteAt,
+
+			"created": created,
+			"updated": updated,
+		})
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+type AuthQuickConnectRequestChanges struct {
+	Status types.Change[string]
+	UserId types.Change[sql.NullString]
+
+	PollInterval types.Change[int64]
+	LastPolled   types.Change[int64]
+}
+
+func (db DB) UpdateAuthQuickConnectRequest(ctx context.Context, code string, changes AuthQuickConnectRequestChanges) error {
+	record := goqu.Record{}
+
+	addToRecord(record, "status", changes.Status)
+	addToRecord(record, "user_id", changes.UserId)
+
+	addToRecord(record, "poll_interval", changes.PollInterval)
+	addToRecord(record, "last_polled", changes.LastPolled)
+
+	if len(record) == 0 {
+		return nil
+	}
+
+	record["updated"] = time.Now().UnixMilli()
+
+	ds := dialect.Update("auth_quick_connect_requests").
+		Set(record).
+		Where(goqu.I("auth_quick_connect_requests.code").Eq(code))
+
+	_, err := db.db.Exec(ctx, ds)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UpdateAuthQuickConnectRequestWithStatus only updates the request if the
+// current status of the request is equal to status, returns true if
+// the request was updated
+func (db DB) UpdateAuthQuickConnectRequestWithStatus(ctx context.Context, code, status string, changes AuthQuickConnectRequestChanges) (bool, error) {
+	record := goqu.Record{}
+
+	addToRecord(record, "status", changes.Status)
+	addToRecord(record, "user_id", changes.UserId)
+
+	addToRecord(record, "poll_interval", changes.PollInterval)
+	addToRecord(record, "last_polled", changes.LastPolled)
+
+	if len(record) == 0 {
+		return false, nil
+	}
+
+	record["updated"] = time.Now().UnixMilli()
+
+	ds := dialect.Update("auth_quick_connect_requests").
+		Set(record).
+		Where(
+			goqu.I("auth_quick_connect_requests.code").Eq(code),
+			goqu.I("auth_quick_connect_requests.status").Eq(status),
+		)
+
+	res, err := db.db.Exec(ctx, ds)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+// DeleteOldAuthQuickConnectRequests removes all the requests that are past
+// their deletion date
+func (db DB) DeleteOldAuthQuickConnectRequests(ctx context.Context, now int64) error {
+	query := dialect.Delete("auth_quick_connect_requests").
+		Where(goqu.I("auth_quick_connect_requests.delete_at").Lt(now))
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
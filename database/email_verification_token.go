@@ -0,0 +1,158 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/nanoteck137/authlab/tools/utils"
+	"github.com/nanoteck137/pyrin/ember"
+)
+
+// EmailVerificationToken is the single use token sent to the user inside
+// the verification email, only the hash of the token is stored
+type EmailVerificationToken struct {
+	Id     string `db:"id"`
+	UserId string `db:"user_id"`
+	Email  string `db:"email"`
+
+	TokenHash string `db:"token_hash"`
+	Used      int    `db:"used"`
+
+	Expires int64 `db:"expires"`
+
+	Created int64 `db:"created"`
+	Updated int64 `db:"updated"`
+}
+
+func EmailVerificationTokenQuery() *goqu.SelectDataset {
+	query := dialect.From("email_verification_tokens").
+		Select(
+			"email_verification_tokens.id",
+			"email_verification_tokens.user_id",
+			"email_verification_tokens.email",
+
+			"email_verification_tokens.token_hash",
+			"email_verification_tokens.used",
+
+			"email_verification_tokens.expires",
+
+			"email_verification_tokens.created",
+			"email_verification_tokens.updated",
+		).
+		Prepared(true)
+
+	return query
+}
+
+func (db DB) GetEmailVerificationTokenByHash(ctx context.Context, tokenHash string) (EmailVerificationToken, error) {
+	query := EmailVerificationTokenQuery().
+		Where(goqu.I("email_verification_tokens.token_hash").Eq(tokenHash))
+
+	return ember.Single[EmailVerificationToken](db.db, ctx, query)
+}
+
+type CreateEmailVerificationTokenParams struct {
+	Id     string
+	UserId string
+	Email  string
+
+	TokenHash string
+
+	Expires int64
+
+	Created int64
+	Updated int64
+}
+
+func (db DB) CreateEmailVerificationToken(ctx context.Context, params CreateEmailVerificationTokenParams) (string, error) {
+	t := time.Now().UnixMilli()
+	created := params.Created
+	updated := params.Updated
+
+	if created == 0 && updated == 0 {
+		created = t
+		updated = t
+	}
+
+	id := params.Id
+	if id == "" {
+		id = utils.CreateId()
+	}
+
+	query := dialect.Insert("email_verification_tokens").Rows(goqu.Record{
+		"id":      id,
+		"user_id": params.UserId,
+		"email":   params.Email,
+
+		"token_hash": params.TokenHash,
+		"used":       0,
+
+		"expires": params.Expires,
+
+		"created": created,
+		"updated": updated,
+	})
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// MarkEmailVerificationTokenUsed marks the token as used, returns false if
+// the token was already marked as used
+func (db DB) MarkEmailVerificationTokenUsed(ctx context.Context, id string) (bool, error) {
+	query := dialect.Update("email_verification_tokens").
+		Set(goqu.Record{
+			"used":    1,
+			"updated": time.Now().UnixMilli(),
+		}).
+		Where(
+			goqu.I("email_verification_tokens.id").Eq(id),
+			goqu.I("email_verification_tokens.used").Eq(0),
+		)
+
+	res, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+// DeleteAllEmailVerificationTokensForUser removes all the verification
+// tokens of the user, used when a new token is requested so only the
+// latest link works
+func (db DB) DeleteAllEmailVerificationTokensForUser(ctx context.Context, userId string) error {
+	query := dialect.Delete("email_verification_tokens").
+		Where(goqu.I("email_verification_tokens.user_id").Eq(userId))
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteExpiredEmailVerificationTokens removes all the tokens that expired
+// before the timestamp
+func (db DB) DeleteExpiredEmailVerificationTokens(ctx context.Context, before int64) error {
+	query := dialect.Delete("email_verification_tokens").
+		Where(goqu.I("email_verification_tokens.expires").Lt(before))
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,208 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/nanoteck137/authlab/tools/utils"
+	"github.com/nanoteck137/pyrin/ember"
+)
+
+// MagicLinkRequest is a login request waiting for the user to open the
+// link sent to the email
+type MagicLinkRequest struct {
+	Id string `db:"id"`
+
+	Email string `db:"email"`
+
+	Code      string `db:"code"`
+	Challenge string `db:"challenge"`
+	Status    string `db:"status"`
+
+	UserId sql.NullString `db:"user_id"`
+
+	UserAgent string `db:"user_agent"`
+	IpAddress string `db:"ip_address"`
+
+	Expires  int64 `db:"expires"`
+	DeleteAt int64 `db:"delete_at"`
+
+	Created int64 `db:"created"`
+	Updated int64 `db:"updated"`
+}
+
+func MagicLinkRequestQuery() *goqu.SelectDataset {
+	query := dialect.From("magic_link_requests").
+		Select(
+			"magic_link_requests.id",
+
+			"magic_link_requests.email",
+
+			"magic_link_requests.code",
+			"magic_link_requests.challenge",
+			"magic_link_requests.status",
+
+			"magic_link_requests.user_id",
+
+			"magic_link_requests.user_agent",
+			"magic_link_requests.ip_address",
+
+			"magic_link_requests.expires",
+			"magic_link_requests.delete_at",
+
+			"magic_link_requests.created",
+			"magic_link_requests.updated",
+		).
+		Prepared(true)
+
+	return query
+}
+
+func (db DB) GetMagicLinkRequestById(ctx context.Context, id string) (MagicLinkRequest, error) {
+	query := MagicLinkRequestQuery().
+		Where(goqu.I("magic_link_requests.id").Eq(id))
+
+	return ember.Single[MagicLinkRequest](db.db, ctx, query)
+}
+
+type CreateMagicLinkRequestParams struct {
+	Id string
+
+	Email string
+
+	Code      string
+	Challenge string
+	Status    string
+
+	UserAgent string
+	IpAddress string
+
+	Expires  int64
+	DeleteAt int64
+
+	Created int64
+	Updated int64
+}
+
+func (db DB) CreateMagicLinkRequest(ctx context.Context, params CreateMagicLinkRequestParams) (string, error) {
+	t := time.Now().UnixMilli()
+	created := params.Created
+	updated := params.Updated
+
+	if created == 0 && updated == 0 {
+		created = t
+		updated = t
+	}
+
+	id := params.Id
+	if id == "" {
+		id = utils.CreateId()
+	}
+
+	query := dialect.Insert("magic_link_requests").Rows(goqu.Record{
+		"id": id,
+
+		"email": params.Email,
+
+		"code":      params.Code,
+		"challenge": params.Challenge,
+		"status":    params.Status,
+
+		"user_agent": params.UserAgent,
+		"ip_address": params.IpAddress,
+
+		"expires":   params.Expires,
+		"delete_at": params.DeleteAt,
+
+		"created": created,
+		"updated": updated,
+	})
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// CountMagicLinkRequestsForEmail returns how many requests for the email
+// has the status and hasn't expired yet, the email is compared without
+// case
+func (db DB) CountMagicLinkRequestsForEmail(ctx context.Context, email, status string, now int64) (int, error) {
+	query := dialect.From("magic_link_requests").
+		Select(goqu.COUNT("*")).
+		Where(
+			goqu.Func("LOWER", goqu.I("magic_link_requests.email")).Eq(strings.ToLower(email)),
+			goqu.I("magic_link_requests.status").Eq(status),
+			goqu.I("magic_link_requests.expires").Gt(now),
+		).
+		Prepared(true)
+
+	return ember.Single[int](db.db, ctx, query)
+}
+
+// CountMagicLinkRequestsForIp returns how many requests the ip address
+// has created after the timestamp
+func (db DB) CountMagicLinkRequestsForIp(ctx context.Context, ipAddress string, after int64) (int, error) {
+	query := dialect.From("magic_link_requests").
+		Select(goqu.COUNT("*")).
+		Where(
+			goqu.I("magic_link_requests.ip_address").Eq(ipAddress),
+			goqu.I("magic_link_requests.created").Gt(after),
+		).
+		Prepared(true)
+
+	return ember.Single[int](db.db, ctx, query)
+}
+
+// SetMagicLinkRequestStatus changes the status of the request if the
+// status is still the expected status, returns false if the status was
+// changed by someone else first. The user id is only set when it's not
+// empty.
+func (db DB) SetMagicLinkRequestStatus(ctx context.Context, id, expected, status, userId string) (bool, error) {
+	record := goqu.Record{
+		"status":  status,
+		"updated": time.Now().UnixMilli(),
+	}
+
+	if userId != "" {
+		record["user_id"] = userId
+	}
+
+	query := dialect.Update("magic_link_requests").
+		Set(record).
+		Where(
+			goqu.I("magic_link_requests.id").Eq(id),
+			goqu.I("magic_link_requests.status").Eq(expected),
+		)
+
+	res, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+// DeleteOldMagicLinkRequests removes all the requests that can be
+// deleted before the timestamp
+func (db DB) DeleteOldMagicLinkRequests(ctx context.Context, before int64) error {
+	query := dialect.Delete("magic_link_requests").
+		Where(goqu.I("magic_link_requests.delete_at").Lt(before))
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,192 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/nanoteck137/authlab/tools/utils"
+	"github.com/nanoteck137/pyrin/ember"
+)
+
+// MfaChallenge is created when the first factor of a login succeeds and
+// the user needs to complete a second factor, only the hash of the
+// challenge is stored
+type MfaChallenge struct {
+	Id     string `db:"id"`
+	UserId string `db:"user_id"`
+
+	ChallengeHash string `db:"challenge_hash"`
+	AuthMethod    string `db:"auth_method"`
+
+	// The OAuth client and the scopes of the session that is created
+	// when the challenge is completed, empty for the first party clients
+	ClientId sql.NullString `db:"client_id"`
+	Scope    string         `db:"scope"`
+
+	Attempts int `db:"attempts"`
+	Used     int `db:"used"`
+
+	Expires int64 `db:"expires"`
+
+	Created int64 `db:"created"`
+	Updated int64 `db:"updated"`
+}
+
+func MfaChallengeQuery() *goqu.SelectDataset {
+	query := dialect.From("mfa_challenges").
+		Select(
+			"mfa_challenges.id",
+			"mfa_challenges.user_id",
+
+			"mfa_challenges.challenge_hash",
+			"mfa_challenges.auth_method",
+
+			"mfa_challenges.client_id",
+			"mfa_challenges.scope",
+
+			"mfa_challenges.attempts",
+			"mfa_challenges.used",
+
+			"mfa_challenges.expires",
+
+			"mfa_challenges.created",
+			"mfa_challenges.updated",
+		).
+		Prepared(true)
+
+	return query
+}
+
+func (db DB) GetMfaChallengeByHash(ctx context.Context, challengeHash string) (MfaChallenge, error) {
+	query := MfaChallengeQuery().
+		Where(goqu.I("mfa_challenges.challenge_hash").Eq(challengeHash))
+
+	return ember.Single[MfaChallenge](db.db, ctx, query)
+}
+
+type CreateMfaChallengeParams struct {
+	Id     string
+	UserId string
+
+	ChallengeHash string
+	AuthMethod    string
+
+	ClientId sql.NullString
+	Scope    string
+
+	Expires int64
+
+	Created int64
+	Updated int64
+}
+
+func (db DB) CreateMfaChallenge(ctx context.Context, params CreateMfaChallengeParams) (string, error) {
+	t := time.Now().UnixMilli()
+	created := params.Created
+	updated := params.Updated
+
+	if created == 0 && updated == 0 {
+		created = t
+		updated = t
+	}
+
+	id := params.Id
+	if id == "" {
+		id = utils.CreateId()
+	}
+
+	query := dialect.Insert("mfa_challenges").Rows(goqu.Record{
+		"id":      id,
+		"user_id": params.UserId,
+
+		"challenge_hash": params.ChallengeHash,
+		"auth_method":    params.AuthMethod,
+
+		"client_id": params.ClientId,
+		"scope":     params.Scope,
+
+		"attempts": 0,
+		"used":     0,
+
+		"expires": params.Expires,
+
+		"created": created,
+		"updated": updated,
+	})
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// AddMfaChallengeAttempt counts a failed attempt, returns false if the
+// challenge already has maxAttempts failed attempts or is used
+func (db DB) AddMfaChallengeAttempt(ctx context.Context, id string, maxAttempts int) (bool, error) {
+	query := dialect.Update("mfa_challenges").
+		Set(goqu.Record{
+			"attempts": goqu.L("attempts + 1"),
+			"updated":  time.Now().UnixMilli(),
+		}).
+		Where(
+			goqu.I("mfa_challenges.id").Eq(id),
+			goqu.I("mfa_challenges.used").Eq(0),
+			goqu.I("mfa_challenges.attempts").Lt(maxAttempts),
+		)
+
+	res, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+// MarkMfaChallengeUsed marks the challenge as used, returns false if the
+// challenge was already marked as used
+func (db DB) MarkMfaChallengeUsed(ctx context.Context, id string) (bool, error) {
+	query := dialect.Update("mfa_challenges").
+		Set(goqu.Record{
+			"used":    1,
+			"updated": time.Now().UnixMilli(),
+		}).
+		Where(
+			goqu.I("mfa_challenges.id").Eq(id),
+			goqu.I("mfa_challenges.used").Eq(0),
+		)
+
+	res, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+// DeleteExpiredMfaChallenges removes all the challenges that expired
+// before the timestamp
+func (db DB) DeleteExpiredMfaChallenges(ctx context.Context, before int64) error {
+	query := dialect.Delete("mfa_challenges").
+		Where(goqu.I("mfa_challenges.expires").Lt(before))
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/nanoteck137/pyrin/ember"
+)
+
+// MfaLockout counts the failed second factor attempts of the user across
+// all the challenges
+type MfaLockout struct {
+	UserId string `db:"user_id"`
+
+	FailedAttempts int   `db:"failed_attempts"`
+	LockedUntil    int64 `db:"locked_until"`
+
+	Created int64 `db:"created"`
+	Updated int64 `db:"updated"`
+}
+
+func MfaLockoutQuery() *goqu.SelectDataset {
+	query := dialect.From("mfa_lockouts").
+		Select(
+			"mfa_lockouts.user_id",
+
+			"mfa_lockouts.failed_attempts",
+			"mfa_lockouts.locked_until",
+
+			"mfa_lockouts.created",
+			"mfa_lockouts.updated",
+		).
+		Prepared(true)
+
+	return query
+}
+
+func (db DB) GetMfaLockout(ctx context.Context, userId string) (MfaLockout, error) {
+	query := MfaLockoutQuery().
+		Where(goqu.I("mfa_lockouts.user_id").Eq(userId))
+
+	return ember.Single[MfaLockout](db.db, ctx, query)
+}
+
+// AddMfaFailedAttempt counts a failed attempt for the user, when the user
+// reaches maxAttempts the count is reset and the user is locked until
+// lockedUntil. Returns true if the attempt locked the user.
+func (db DB) AddMfaFailedAttempt(ctx context.Context, userId string, maxAttempts int, lockedUntil int64) (bool, error) {
+	t := time.Now().UnixMilli()
+
+	query := dialect.Insert("mfa_lockouts").Rows(goqu.Record{
+		"user_id": userId,
+
+		"failed_attempts": 1,
+		"locked_until":    0,
+
+		"created": t,
+		"updated": t,
+	}).
+		OnConflict(goqu.DoUpdate("user_id", goqu.Record{
+			"failed_attempts": goqu.L("mfa_lockouts.failed_attempts + 1"),
+			"updated":         t,
+		}))
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return false, err
+	}
+
+	// NOTE(patrik): Only the attempt that reaches the limit matches, so
+	// the lock isn't extended by the attempts made at the same time
+	lockQuery := dialect.Update("mfa_lockouts").
+		Set(goqu.Record{
+			"failed_attempts": 0,
+			"locked_until":    lockedUntil,
+			"updated":         t,
+		}).
+		Where(
+			goqu.I("mfa_lockouts.user_id").Eq(userId),
+			goqu.I("mfa_lockouts.failed_attempts").Gte(maxAttempts),
+		)
+
+	res, err := db.db.Exec(ctx, lockQuery)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+// ResetMfaFailedAttempts clears the failed attempts of the user, the lock
+// is kept
+func (db DB) ResetMfaFailedAttempts(ctx context.Context, userId string) error {
+	query := dialect.Update("mfa_lockouts").
+		Set(goqu.Record{
+			"failed_attempts": 0,
+			"updated":         time.Now().UnixMilli(),
+		}).
+		Where(goqu.I("mfa_lockouts.user_id").Eq(userId))
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/nanoteck137/authlab/tools/utils"
+	"github.com/nanoteck137/pyrin/ember"
+)
+
+func (db DB) CreateMfaRecoveryCodes(ctx context.Context, userId string, codeHashes []string) error {
+	t := time.Now().UnixMilli()
+
+	rows := make([]any, len(codeHashes))
+	for i, codeHash := range codeHashes {
+		rows[i] = goqu.Record{
+			"id":      utils.CreateId(),
+			"user_id": userId,
+
+			"code_hash": codeHash,
+			"used":      0,
+
+			"created": t,
+			"updated": t,
+		}
+	}
+
+	query := dialect.Insert("mfa_recovery_codes").Rows(rows...)
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// CountUnusedMfaRecoveryCodes returns how many recovery codes the user has
+// left
+func (db DB) CountUnusedMfaRecoveryCodes(ctx context.Context, userId string) (int, error) {
+	query := dialect.From("mfa_recovery_codes").
+		Select(goqu.COUNT("*")).
+		Where(
+			goqu.I("mfa_recovery_codes.user_id").Eq(userId),
+			goqu.I("mfa_recovery_codes.used").Eq(0),
+		).
+		Prepared(true)
+
+	return ember.Single[int](db.db, ctx, query)
+}
+
+// UseMfaRecoveryCode marks the code of the user as used, returns false if
+// the user has no unused code with the hash
+func (db DB) UseMfaRecoveryCode(ctx context.Context, userId, codeHash string) (bool, error) {
+	query := dialect.Update("mfa_recovery_codes").
+		Set(goqu.Record{
+			"used":    1,
+			"updated": time.Now().UnixMilli(),
+		}).
+		Where(
+			goqu.I("mfa_recovery_codes.user_id").Eq(userId),
+			goqu.I("mfa_recovery_codes.code_hash").Eq(codeHash),
+			goqu.I("mfa_recovery_codes.used").Eq(0),
+		)
+
+	res, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+func (db DB) DeleteAllMfaRecoveryCodesForUser(ctx context.Context, userId string) error {
+	query := dialect.Delete("mfa_recovery_codes").
+		Where(goqu.I("mfa_recovery_codes.user_id").Eq(userId))
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,36 @@
+-- +goose Up
+CREATE TABLE auth_provider_requests (
+    id TEXT PRIMARY KEY,
+    provider_id TEXT NOT NULL,
+
+    status TEXT NOT NULL,
+    challenge TEXT NOT NULL,
+
+    oauth2_url TEXT NOT NULL,
+    oauth2_code TEXT,
+
+    expires INTEGER NOT NULL,
+    delete_at INTEGER NOT NULL,
+
+    created INTEGER NOT NULL,
+    updated INTEGER NOT NULL
+);
+
+CREATE TABLE auth_quick_connect_requests (
+    code TEXT PRIMARY KEY,
+
+    status TEXT NOT NULL,
+    challenge TEXT NOT NULL,
+
+    user_id TEXT REFERENCES users(id) ON DELETE CASCADE,
+
+    expires INTEGER NOT NULL,
+    delete_at INTEGER NOT NULL,
+
+    created INTEGER NOT NULL,
+    updated INTEGER NOT NULL
+);
+
+-- +goose Down
+DROP TABLE auth_quick_connect_requests;
+DROP TABLE auth_provider_requests;
@@ -0,0 +1,17 @@
+-- +goose Up
+ALTER TABLE auth_quick_connect_requests ADD COLUMN client_id TEXT;
+ALTER TABLE auth_quick_connect_requests ADD COLUMN scope TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE auth_quick_connect_requests ADD COLUMN poll_interval INTEGER NOT NULL DEFAULT 5;
+ALTER TABLE auth_quick_connect_requests ADD COLUMN last_polled INTEGER NOT NULL DEFAULT 0;
+
+CREATE UNIQUE INDEX auth_quick_connect_requests_challenge_idx ON auth_quick_connect_requests(challenge);
+
+-- +goose Down
+DROP INDEX auth_quick_connect_requests_challenge_idx;
+
+ALTER TABLE auth_quick_connect_requests DROP COLUMN last_polled;
+ALTER TABLE auth_quick_connect_requests DROP COLUMN poll_interval;
+
+ALTER TABLE auth_quick_connect_requests DROP COLUMN scope;
+ALTER TABLE auth_quick_connect_requests DROP COLUMN client_id;
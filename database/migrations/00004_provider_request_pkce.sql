@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE auth_provider_requests ADD COLUMN pkce_verifier TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE auth_provider_requests DROP COLUMN pkce_verifier;
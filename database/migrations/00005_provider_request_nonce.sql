@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE auth_provider_requests ADD COLUMN nonce TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE auth_provider_requests DROP COLUMN nonce;
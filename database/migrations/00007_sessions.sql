@@ -0,0 +1,27 @@
+-- +goose Up
+CREATE TABLE sessions (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+
+    auth_method TEXT NOT NULL,
+    user_agent TEXT NOT NULL,
+    ip_address TEXT NOT NULL,
+
+    last_seen INTEGER NOT NULL,
+
+    created INTEGER NOT NULL,
+    updated INTEGER NOT NULL
+);
+
+CREATE INDEX sessions_user_id_idx ON sessions(user_id);
+
+-- NOTE(patrik): Refresh tokens from before sessions existed can't be
+-- connected to a session, so they are removed
+DELETE FROM refresh_tokens;
+ALTER TABLE refresh_tokens ADD COLUMN session_id TEXT NOT NULL REFERENCES sessions(id) ON DELETE CASCADE;
+
+-- +goose Down
+ALTER TABLE refresh_tokens DROP COLUMN session_id;
+
+DROP INDEX sessions_user_id_idx;
+DROP TABLE sessions;
@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE revoked_tokens (
+    jti TEXT PRIMARY KEY,
+
+    expires INTEGER NOT NULL,
+
+    created INTEGER NOT NULL
+);
+
+-- +goose Down
+DROP TABLE revoked_tokens;
@@ -0,0 +1,34 @@
+-- +goose Up
+ALTER TABLE sessions ADD COLUMN client_id TEXT;
+ALTER TABLE sessions ADD COLUMN scope TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE oauth_authorization_codes (
+    id TEXT PRIMARY KEY,
+    code_hash TEXT NOT NULL UNIQUE,
+
+    client_id TEXT NOT NULL,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+
+    redirect_uri TEXT NOT NULL,
+    scope TEXT NOT NULL,
+    nonce TEXT,
+
+    code_challenge TEXT,
+    code_challenge_method TEXT,
+
+    auth_time INTEGER NOT NULL,
+
+    used INTEGER NOT NULL DEFAULT 0,
+    session_id TEXT,
+
+    expires INTEGER NOT NULL,
+
+    created INTEGER NOT NULL,
+    updated INTEGER NOT NULL
+);
+
+-- +goose Down
+DROP TABLE oauth_authorization_codes;
+
+ALTER TABLE sessions DROP COLUMN scope;
+ALTER TABLE sessions DROP COLUMN client_id;
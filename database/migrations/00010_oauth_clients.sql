@@ -0,0 +1,20 @@
+-- +goose Up
+CREATE TABLE oauth_clients (
+    id TEXT PRIMARY KEY,
+
+    name TEXT NOT NULL CHECK(name<>''),
+    logo_url TEXT,
+
+    public INTEGER NOT NULL DEFAULT 0,
+    secret_hash TEXT,
+
+    redirect_uris TEXT NOT NULL,
+    grant_types TEXT NOT NULL,
+    scopes TEXT NOT NULL,
+
+    created INTEGER NOT NULL,
+    updated INTEGER NOT NULL
+);
+
+-- +goose Down
+DROP TABLE oauth_clients;
@@ -0,0 +1,24 @@
+-- +goose Up
+ALTER TABLE oauth_clients ADD COLUMN registration_token_hash TEXT;
+
+CREATE TABLE oauth_initial_access_tokens (
+    id TEXT PRIMARY KEY,
+    token_hash TEXT NOT NULL UNIQUE,
+
+    name TEXT NOT NULL CHECK(name<>''),
+
+    -- The admin that created the token, not set for tokens created with
+    -- the cli
+    user_id TEXT REFERENCES users(id) ON DELETE CASCADE,
+
+    expires INTEGER,
+    last_used INTEGER,
+
+    created INTEGER NOT NULL,
+    updated INTEGER NOT NULL
+);
+
+-- +goose Down
+DROP TABLE oauth_initial_access_tokens;
+
+ALTER TABLE oauth_clients DROP COLUMN registration_token_hash;
@@ -0,0 +1,47 @@
+-- +goose Up
+ALTER TABLE oauth_clients ADD COLUMN trusted INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE user_grants (
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    client_id TEXT NOT NULL,
+
+    scope TEXT NOT NULL,
+
+    created INTEGER NOT NULL,
+    updated INTEGER NOT NULL,
+
+    PRIMARY KEY(user_id, client_id)
+);
+
+CREATE TABLE oauth_consent_requests (
+    id TEXT PRIMARY KEY,
+
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    client_id TEXT NOT NULL,
+
+    redirect_uri TEXT NOT NULL,
+    scope TEXT NOT NULL,
+    state TEXT NOT NULL,
+    nonce TEXT,
+
+    code_challenge TEXT,
+    code_challenge_method TEXT,
+
+    auth_time INTEGER NOT NULL,
+
+    -- The hash of the CSRF token, set when the consent page is first
+    -- shown and binds the request to that browser
+    csrf_hash TEXT,
+    used INTEGER NOT NULL DEFAULT 0,
+
+    expires INTEGER NOT NULL,
+
+    created INTEGER NOT NULL,
+    updated INTEGER NOT NULL
+);
+
+-- +goose Down
+DROP TABLE oauth_consent_requests;
+DROP TABLE user_grants;
+
+ALTER TABLE oauth_clients DROP COLUMN trusted;
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE oauth_clients ADD COLUMN audiences TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE oauth_clients DROP COLUMN audiences;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE oauth_clients ADD COLUMN exchange_audiences TEXT NOT NULL DEFAULT '';
+ALTER TABLE oauth_clients ADD COLUMN exchange_scopes TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE oauth_clients DROP COLUMN exchange_scopes;
+ALTER TABLE oauth_clients DROP COLUMN exchange_audiences;
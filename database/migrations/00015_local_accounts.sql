@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN username TEXT;
+ALTER TABLE users ADD COLUMN password_hash TEXT;
+
+CREATE UNIQUE INDEX users_username_idx ON users(username);
+
+-- +goose Down
+DROP INDEX users_username_idx;
+
+ALTER TABLE users DROP COLUMN password_hash;
+ALTER TABLE users DROP COLUMN username;
@@ -0,0 +1,24 @@
+-- +goose Up
+CREATE TABLE magic_link_requests (
+    id TEXT PRIMARY KEY,
+
+    email TEXT NOT NULL,
+
+    code TEXT NOT NULL,
+    challenge TEXT NOT NULL,
+    status TEXT NOT NULL,
+
+    user_id TEXT REFERENCES users(id) ON DELETE CASCADE,
+
+    user_agent TEXT NOT NULL,
+    ip_address TEXT NOT NULL,
+
+    expires INTEGER NOT NULL,
+    delete_at INTEGER NOT NULL,
+
+    created INTEGER NOT NULL,
+    updated INTEGER NOT NULL
+);
+
+-- +goose Down
+DROP TABLE magic_link_requests;
@@ -0,0 +1,36 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN email_verified INTEGER NOT NULL DEFAULT 0;
+
+-- The users that already has logged in with a provider or with a magic
+-- link sent to the email has proven the email
+UPDATE users SET email_verified = 1
+WHERE id IN (SELECT user_id FROM user_identities)
+   OR id IN (
+       SELECT user_id FROM magic_link_requests
+       WHERE user_id IS NOT NULL AND LOWER(email) = LOWER(users.email)
+   );
+
+CREATE TABLE email_verification_tokens (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+
+    -- The address the token verifies, the token stops working if the
+    -- email of the user changes
+    email TEXT NOT NULL,
+
+    token_hash TEXT NOT NULL UNIQUE,
+    used INTEGER NOT NULL DEFAULT 0,
+
+    expires INTEGER NOT NULL,
+
+    created INTEGER NOT NULL,
+    updated INTEGER NOT NULL
+);
+
+CREATE INDEX email_verification_tokens_user_id_idx ON email_verification_tokens(user_id);
+
+-- +goose Down
+DROP INDEX email_verification_tokens_user_id_idx;
+DROP TABLE email_verification_tokens;
+
+ALTER TABLE users DROP COLUMN email_verified;
@@ -0,0 +1,45 @@
+-- +goose Up
+CREATE TABLE user_totp (
+    user_id TEXT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+
+    -- The secret is encrypted, the key is derived from the jwt secret
+    secret TEXT NOT NULL,
+
+    -- Set after the user has entered the first code from the
+    -- authenticator app
+    enabled INTEGER NOT NULL DEFAULT 0,
+
+    -- The last time step a code was used for, the same code can't be
+    -- used twice
+    last_used_step INTEGER NOT NULL DEFAULT 0,
+
+    created INTEGER NOT NULL,
+    updated INTEGER NOT NULL
+);
+
+CREATE TABLE mfa_challenges (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+
+    challenge_hash TEXT NOT NULL UNIQUE,
+
+    -- The auth method of the first factor, stored on the session when
+    -- the challenge is completed
+    auth_method TEXT NOT NULL,
+
+    attempts INTEGER NOT NULL DEFAULT 0,
+    used INTEGER NOT NULL DEFAULT 0,
+
+    expires INTEGER NOT NULL,
+
+    created INTEGER NOT NULL,
+    updated INTEGER NOT NULL
+);
+
+CREATE INDEX mfa_challenges_user_id_idx ON mfa_challenges(user_id);
+
+-- +goose Down
+DROP INDEX mfa_challenges_user_id_idx;
+DROP TABLE mfa_challenges;
+
+DROP TABLE user_totp;
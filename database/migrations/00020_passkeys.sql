@@ -0,0 +1,51 @@
+-- +goose Up
+CREATE TABLE passkeys (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+
+    -- The id the authenticator gave the credential, base64url encoded
+    credential_id TEXT NOT NULL UNIQUE,
+
+    name TEXT NOT NULL,
+
+    -- The public key, flags and sign count of the credential stored as
+    -- json, updated after every login
+    credential TEXT NOT NULL,
+
+    last_used INTEGER NOT NULL DEFAULT 0,
+
+    created INTEGER NOT NULL,
+    updated INTEGER NOT NULL
+);
+
+CREATE INDEX passkeys_user_id_idx ON passkeys(user_id);
+
+CREATE TABLE passkey_requests (
+    id TEXT PRIMARY KEY,
+
+    -- Empty for the logins where the user is picked in the browser
+    user_id TEXT REFERENCES users(id) ON DELETE CASCADE,
+
+    -- The ceremony the request is for, "registration", "login" or "mfa"
+    type TEXT NOT NULL,
+
+    -- The session data of the ceremony stored as json, contains the
+    -- challenge the authenticator signs
+    session TEXT NOT NULL,
+
+    -- The mfa challenge completed by the "mfa" requests
+    mfa_challenge_id TEXT REFERENCES mfa_challenges(id) ON DELETE CASCADE,
+
+    used INTEGER NOT NULL DEFAULT 0,
+
+    expires INTEGER NOT NULL,
+
+    created INTEGER NOT NULL,
+    updated INTEGER NOT NULL
+);
+
+-- +goose Down
+DROP TABLE passkey_requests;
+
+DROP INDEX passkeys_user_id_idx;
+DROP TABLE passkeys;
@@ -0,0 +1,36 @@
+-- +goose Up
+CREATE TABLE mfa_recovery_codes (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+
+    -- Only the hash of the code is stored
+    code_hash TEXT NOT NULL,
+
+    used INTEGER NOT NULL DEFAULT 0,
+
+    created INTEGER NOT NULL,
+    updated INTEGER NOT NULL
+);
+
+CREATE INDEX mfa_recovery_codes_user_id_idx ON mfa_recovery_codes(user_id);
+
+CREATE TABLE user_events (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+
+    type TEXT NOT NULL,
+
+    user_agent TEXT NOT NULL,
+    ip_address TEXT NOT NULL,
+
+    created INTEGER NOT NULL
+);
+
+CREATE INDEX user_events_user_id_idx ON user_events(user_id, created);
+
+-- +goose Down
+DROP INDEX user_events_user_id_idx;
+DROP TABLE user_events;
+
+DROP INDEX mfa_recovery_codes_user_id_idx;
+DROP TABLE mfa_recovery_codes;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE mfa_challenges ADD COLUMN client_id TEXT;
+ALTER TABLE mfa_challenges ADD COLUMN scope TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE mfa_challenges DROP COLUMN scope;
+ALTER TABLE mfa_challenges DROP COLUMN client_id;
@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE mfa_lockouts (
+    user_id TEXT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+
+    -- The failed second factor attempts of the user across all the
+    -- challenges, reset when the user is locked out or completes a
+    -- challenge
+    failed_attempts INTEGER NOT NULL DEFAULT 0,
+
+    -- No challenge can be completed before this time
+    locked_until INTEGER NOT NULL DEFAULT 0,
+
+    created INTEGER NOT NULL,
+    updated INTEGER NOT NULL
+);
+
+-- +goose Down
+DROP TABLE mfa_lockouts;
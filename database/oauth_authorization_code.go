@@ -0,0 +1,201 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/nanoteck137/authlab/tools/utils"
+	"github.com/nanoteck137/pyrin/ember"
+)
+
+type OAuthAuthorizationCode struct {
+	Id       string `db:"id"`
+	CodeHash string `db:"code_hash"`
+
+	ClientId string `db:"client_id"`
+	UserId   string `db:"user_id"`
+
+	RedirectUri string         `db:"redirect_uri"`
+	Scope       string         `db:"scope"`
+	Nonce       sql.NullString `db:"nonce"`
+
+	CodeChallenge       sql.NullString `db:"code_challenge"`
+	CodeChallengeMethod sql.NullString `db:"code_challenge_method"`
+
+	AuthTime int64 `db:"auth_time"`
+
+	Used      int            `db:"used"`
+	SessionId sql.NullString `db:"session_id"`
+
+	Expires int64 `db:"expires"`
+
+	Created int64 `db:"created"`
+	Updated int64 `db:"updated"`
+}
+
+func OAuthAuthorizationCodeQuery() *goqu.SelectDataset {
+	query := dialect.From("oauth_authorization_codes").
+		Select(
+			"oauth_authorization_codes.id",
+			"oauth_authorization_codes.code_hash",
+
+			"oauth_authorization_codes.client_id",
+			"oauth_authorization_codes.user_id",
+
+			"oauth_authorization_codes.redirect_uri",
+			"oauth_authorization_codes.scope",
+			"oauth_authorization_codes.nonce",
+
+			"oauth_authorization_codes.code_challenge",
+			"oauth_authorization_codes.code_challenge_method",
+
+			"oauth_authorization_codes.auth_time",
+
+			"oauth_authorization_codes.used",
+			"oauth_authorization_codes.session_id",
+
+			"oauth_authorization_codes.expires",
+
+			"oauth_authorization_codes.created",
+			"oauth_authorization_codes.updated",
+		).
+		Prepared(true)
+
+	return query
+}
+
+func (db DB) GetOAuthAuthorizationCodeByHash(ctx context.Context, hash string) (OAuthAuthorizationCode, error) {
+	query := OAuthAuthorizationCodeQuery().
+		Where(goqu.I("oauth_authorization_codes.code_hash").Eq(hash))
+
+	return ember.Single[OAuthAuthorizationCode](db.db, ctx, query)
+}
+
+type CreateOAuthAuthorizationCodeParams struct {
+	Id       string
+	CodeHash string
+
+	ClientId string
+	UserId   string
+
+	RedirectUri string
+	Scope       string
+	Nonce       sql.NullString
+
+	CodeChallenge       sql.NullString
+	CodeChallengeMethod sql.NullString
+
+	AuthTime int64
+
+	Expires int64
+
+	Created int64
+	Updated int64
+}
+
+func (db DB) CreateOAuthAuthorizationCode(ctx context.Context, params CreateOAuthAuthorizationCodeParams) error {
+	t := time.Now().UnixMilli()
+	created := params.Created
+	updated := params.Updated
+
+	if created == 0 && updated == 0 {
+		created = t
+		updated = t
+	}
+
+	id := params.Id
+	if id == "" {
+		id = utils.CreateId()
+	}
+
+	query := dialect.Insert("oauth_authorization_codes").Rows(goqu.Record{
+		"id":        id,
+		"code_hash": params.CodeHash,
+
+		"client_id": params.ClientId,
+		"user_id":   params.UserId,
+
+		"redirect_uri": params.RedirectUri,
+		"scope":        params.Scope,
+		"nonce":        params.Nonce,
+
+		"code_challenge":        params.CodeChallenge,
+		"code_challenge_method": params.CodeChallengeMethod,
+
+		"auth_time": params.AuthTime,
+
+		"used": 0,
+
+		"expires": params.Expires,
+
+		"created": created,
+		"updated": updated,
+	})
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// MarkOAuthAuthorizationCodeUsed marks the code as used, returns false if
+// the code was already marked as used
+func (db DB) MarkOAuthAuthorizationCodeUsed(ctx context.Context, id string) (bool, error) {
+	query := dialect.Update("oauth_authorization_codes").
+		Set(goqu.Record{
+			"used":    1,
+			"updated": time.Now().UnixMilli(),
+		}).
+		Where(
+			goqu.I("oauth_authorization_codes.id").Eq(id),
+			goqu.I("oauth_authorization_codes.used").Eq(0),
+		)
+
+	res, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+// SetOAuthAuthorizationCodeSession sets the session the code was
+// exchanged for
+func (db DB) SetOAuthAuthorizationCodeSession(ctx context.Context, id, sessionId string) error {
+	query := dialect.Update("oauth_authorization_codes").
+		Set(goqu.Record{
+			"session_id": sessionId,
+			"updated":    time.Now().UnixMilli(),
+		}).
+		Where(goqu.I("oauth_authorization_codes.id").Eq(id))
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteExpiredOAuthAuthorizationCodes removes all the codes that expired
+// before the timestamp
+func (db DB) DeleteExpiredOAuthAuthorizationCodes(ctx context.Context, before int64) error {
+	query := dialect.Delete("oauth_authorization_codes").
+		Where(goqu.I("oauth_authorization_codes.expires").Lt(before))
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,279 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/nanoteck137/authlab/tools/utils"
+	"github.com/nanoteck137/authlab/types"
+	"github.com/nanoteck137/pyrin/ember"
+)
+
+// OAuthClient is a client registered to use authlab as an OpenID
+// Connect provider. The lists (redirect uris, grant types, scopes,
+// audiences and the exchange policy) are stored space separated.
+type OAuthClient struct {
+	Id string `db:"id"`
+
+	Name    string         `db:"name"`
+	LogoUrl sql.NullString `db:"logo_url"`
+
+	Public     int            `db:"public"`
+	SecretHash sql.NullString `db:"secret_hash"`
+
+	// Trusted clients skips the consent screen
+	Trusted int `db:"trusted"`
+
+	// The hash of the token used to manage the client with the dynamic
+	// client registration endpoints, only set for clients registered
+	// that way
+	RegistrationTokenHash sql.NullString `db:"registration_token_hash"`
+
+	RedirectUris string `db:"redirect_uris"`
+	GrantTypes   string `db:"grant_types"`
+	Scopes       string `db:"scopes"`
+
+	// The audiences the client can request tokens for with the client
+	// credentials grant
+	Audiences string `db:"audiences"`
+
+	// The policy for the token exchange grant, the audiences and the
+	// scopes the client can exchange tokens for
+	ExchangeAudiences string `db:"exchange_audiences"`
+	ExchangeScopes    string `db:"exchange_scopes"`
+
+	Created int64 `db:"created"`
+	Updated int64 `db:"updated"`
+}
+
+func OAuthClientQuery() *goqu.SelectDataset {
+	query := dialect.From("oauth_clients").
+		Select(
+			"oauth_clients.id",
+
+			"oauth_clients.name",
+			"oauth_clients.logo_url",
+
+			"oauth_clients.public",
+			"oauth_clients.secret_hash",
+
+			"oauth_clients.trusted",
+
+			"oauth_clients.registration_token_hash",
+
+			"oauth_clients.redirect_uris",
+			"oauth_clients.grant_types",
+			"oauth_clients.scopes",
+
+			"oauth_clients.audiences",
+
+			"oauth_clients.exchange_audiences",
+			"oauth_clients.exchange_scopes",
+
+			"oauth_clients.created",
+			"oauth_clients.updated",
+		).
+		Prepared(true)
+
+	return query
+}
+
+func (db DB) GetOAuthClientById(ctx context.Context, id string) (OAuthClient, error) {
+	query := OAuthClientQuery().
+		Where(goqu.I("oauth_clients.id").Eq(id))
+
+	return ember.Single[OAuthClient](db.db, ctx, query)
+}
+
+func (db DB) GetAllOAuthClients(ctx context.Context) ([]OAuthClient, error) {
+	query := OAuthClientQuery().
+		Order(goqu.I("oauth_clients.created").Asc())
+
+	return ember.Multiple[OAuthClient](db.db, ctx, query)
+}
+
+type CreateOAuthClientParams struct {
+	Id string
+
+	Name    string
+	LogoUrl sql.NullString
+
+	Public     bool
+	SecretHash sql.NullString
+
+	Trusted bool
+
+	RegistrationTokenHash sql.NullString
+
+	RedirectUris string
+	GrantTypes   string
+	Scopes       string
+
+	Audiences string
+
+	ExchangeAudiences string
+	ExchangeScopes    string
+
+	Created int64
+	Updated int64
+}
+
+func (db DB) CreateOAuthClient(ctx context.Context, params CreateOAuthClientParams) (OAuthClient, error) {
+	t := time.Now().UnixMilli()
+	created := params.Created
+	updated := params.Updated
+
+	if created == 0 && updated == 0 {
+		created = t
+		updated = t
+	}
+
+	id := params.Id
+	if id == "" {
+		id = utils.CreateOAuthClientId()
+	}
+
+	public := 0
+	if params.Public {
+		public = 1
+	}
+
+	trusted := 0
+	if params.Trusted {
+		trusted = 1
+	}
+
+	query := dialect.Insert("oauth_clients").Rows(goqu.Record{
+		"id": id,
+
+		"name":     params.Name,
+		"logo_url": params.LogoUrl,
+
+		"public":      public,
+		"secret_hash": params.SecretHash,
+
+		"trusted": trusted,
+
+		"registration_token_hash": params.RegistrationTokenHash,
+
+		"redirect_uris": params.RedirectUris,
+		"grant_types":   params.GrantTypes,
+		"scopes":        params.Scopes,
+
+		"audiences": params.Audiences,
+
+		"exchange_audiences": params.ExchangeAudiences,
+		"exchange_scopes":    params.ExchangeScopes,
+
+		"created": created,
+		"updated": updated,
+	}).
+		Returning(
+			"oauth_clients.id",
+
+			"oauth_clients.name",
+			"oauth_clients.logo_url",
+
+			"oauth_clients.public",
+			"oauth_clients.secret_hash",
+
+			"oauth_clients.trusted",
+
+			"oauth_clients.registration_token_hash",
+
+			"oauth_clients.redirect_uris",
+			"oauth_clients.grant_types",
+			"oauth_clients.scopes",
+
+			"oauth_clients.audiences",
+
+			"oauth_clients.exchange_audiences",
+			"oauth_clients.exchange_scopes",
+
+			"oauth_clients.created",
+			"oauth_clients.updated",
+		)
+
+	return ember.Single[OAuthClient](db.db, ctx, query)
+}
+
+type OAuthClientChanges struct {
+	Name    types.Change[string]
+	LogoUrl types.Change[sql.NullString]
+
+	Trusted types.Change[int]
+
+	RedirectUris types.Change[string]
+	GrantTypes   types.Change[string]
+	Scopes       types.Change[string]
+
+	Audiences types.Change[string]
+
+	ExchangeAudiences types.Change[string]
+	ExchangeScopes    types.Change[string]
+}
+
+func (db DB) UpdateOAuthClient(ctx context.Context, id string, changes OAuthClientChanges) error {
+	record := goqu.Record{}
+
+	addToRecord(record, "name", changes.Name)
+	addToRecord(record, "logo_url", changes.LogoUrl)
+
+	addToRecord(record, "trusted", changes.Trusted)
+
+	addToRecord(record, "redirect_uris", changes.RedirectUris)
+	addToRecord(record, "grant_types", changes.GrantTypes)
+	addToRecord(record, "scopes", changes.Scopes)
+
+	addToRecord(record, "audiences", changes.Audiences)
+
+	addToRecord(record, "exchange_audiences", changes.ExchangeAudiences)
+	addToRecord(record, "exchange_scopes", changes.ExchangeScopes)
+
+	if len(record) == 0 {
+		return nil
+	}
+
+	record["updated"] = time.Now().UnixMilli()
+
+	query := dialect.Update("oauth_clients").
+		Set(record).
+		Where(goqu.I("oauth_clients.id").Eq(id))
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (db DB) UpdateOAuthClientSecret(ctx context.Context, id string, secretHash string) error {
+	query := dialect.Update("oauth_clients").
+		Set(goqu.Record{
+			"secret_hash": secretHash,
+			"updated":     time.Now().UnixMilli(),
+		}).
+		Where(goqu.I("oauth_clients.id").Eq(id))
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (db DB) DeleteOAuthClient(ctx context.Context, id string) error {
+	query := dialect.Delete("oauth_clients").
+		Where(goqu.I("oauth_clients.id").Eq(id))
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,211 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/nanoteck137/authlab/tools/utils"
+	"github.com/nanoteck137/pyrin/ember"
+)
+
+// OAuthConsentRequest is a authorization request waiting for the user
+// to approve or deny the client on the consent page
+type OAuthConsentRequest struct {
+	Id string `db:"id"`
+
+	UserId   string `db:"user_id"`
+	ClientId string `db:"client_id"`
+
+	RedirectUri string         `db:"redirect_uri"`
+	Scope       string         `db:"scope"`
+	State       string         `db:"state"`
+	Nonce       sql.NullString `db:"nonce"`
+
+	CodeChallenge       sql.NullString `db:"code_challenge"`
+	CodeChallengeMethod sql.NullString `db:"code_challenge_method"`
+
+	AuthTime int64 `db:"auth_time"`
+
+	CsrfHash sql.NullString `db:"csrf_hash"`
+	Used     int            `db:"used"`
+
+	Expires int64 `db:"expires"`
+
+	Created int64 `db:"created"`
+	Updated int64 `db:"updated"`
+}
+
+func OAuthConsentRequestQuery() *goqu.SelectDataset {
+	query := dialect.From("oauth_consent_requests").
+		Select(
+			"oauth_consent_requests.id",
+
+			"oauth_consent_requests.user_id",
+			"oauth_consent_requests.client_id",
+
+			"oauth_consent_requests.redirect_uri",
+			"oauth_consent_requests.scope",
+			"oauth_consent_requests.state",
+			"oauth_consent_requests.nonce",
+
+			"oauth_consent_requests.code_challenge",
+			"oauth_consent_requests.code_challenge_method",
+
+			"oauth_consent_requests.auth_time",
+
+			"oauth_consent_requests.csrf_hash",
+			"oauth_consent_requests.used",
+
+			"oauth_consent_requests.expires",
+
+			"oauth_consent_requests.created",
+			"oauth_consent_requests.updated",
+		).
+		Prepared(true)
+
+	return query
+}
+
+func (db DB) GetOAuthConsentRequestById(ctx context.Context, id string) (OAuthConsentRequest, error) {
+	query := OAuthConsentRequestQuery().
+		Where(goqu.I("oauth_consent_requests.id").Eq(id))
+
+	return ember.Single[OAuthConsentRequest](db.db, ctx, query)
+}
+
+type CreateOAuthConsentRequestParams struct {
+	Id string
+
+	UserId   string
+	ClientId string
+
+	RedirectUri string
+	Scope       string
+	State       string
+	Nonce       sql.NullString
+
+	CodeChallenge       sql.NullString
+	CodeChallengeMethod sql.NullString
+
+	AuthTime int64
+
+	Expires int64
+
+	Created int64
+	Updated int64
+}
+
+func (db DB) CreateOAuthConsentRequest(ctx context.Context, params CreateOAuthConsentRequestParams) (string, error) {
+	t := time.Now().UnixMilli()
+	created := params.Created
+	updated := params.Updated
+
+	if created == 0 && updated == 0 {
+		created = t
+		updated = t
+	}
+
+	id := params.Id
+	if id == "" {
+		id = utils.CreateId()
+	}
+
+	query := dialect.Insert("oauth_consent_requests").Rows(goqu.Record{
+		"id": id,
+
+		"user_id":   params.UserId,
+		"client_id": params.ClientId,
+
+		"redirect_uri": params.RedirectUri,
+		"scope":        params.Scope,
+		"state":        params.State,
+		"nonce":        params.Nonce,
+
+		"code_challenge":        params.CodeChallenge,
+		"code_challenge_method": params.CodeChallengeMethod,
+
+		"auth_time": params.AuthTime,
+
+		"used": 0,
+
+		"expires": params.Expires,
+
+		"created": created,
+		"updated": updated,
+	})
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// SetOAuthConsentRequestCsrfHash binds the request to the CSRF token,
+// returns false if the request is already bound to a token
+func (db DB) SetOAuthConsentRequestCsrfHash(ctx context.Context, id, csrfHash string) (bool, error) {
+	query := dialect.Update("oauth_consent_requests").
+		Set(goqu.Record{
+			"csrf_hash": csrfHash,
+			"updated":   time.Now().UnixMilli(),
+		}).
+		Where(
+			goqu.I("oauth_consent_requests.id").Eq(id),
+			goqu.I("oauth_consent_requests.csrf_hash").IsNull(),
+		)
+
+	res, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+// MarkOAuthConsentRequestUsed marks the request as used, returns false
+// if the request was already marked as used
+func (db DB) MarkOAuthConsentRequestUsed(ctx context.Context, id string) (bool, error) {
+	query := dialect.Update("oauth_consent_requests").
+		Set(goqu.Record{
+			"used":    1,
+			"updated": time.Now().UnixMilli(),
+		}).
+		Where(
+			goqu.I("oauth_consent_requests.id").Eq(id),
+			goqu.I("oauth_consent_requests.used").Eq(0),
+		)
+
+	res, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+// DeleteExpiredOAuthConsentRequests removes all the requests that
+// expired before the timestamp
+func (db DB) DeleteExpiredOAuthConsentRequests(ctx context.Context, before int64) error {
+	query := dialect.Delete("oauth_consent_requests").
+		Where(goqu.I("oauth_consent_requests.expires").Lt(before))
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
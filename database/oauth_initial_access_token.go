@@ -0,0 +1,167 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/nanoteck137/authlab/tools/utils"
+	"github.com/nanoteck137/pyrin/ember"
+)
+
+// OAuthInitialAccessToken is a token created by an admin that allows
+// clients to register themselves with the dynamic client registration
+// endpoint (RFC 7591)
+type OAuthInitialAccessToken struct {
+	Id        string `db:"id"`
+	TokenHash string `db:"token_hash"`
+
+	Name   string         `db:"name"`
+	UserId sql.NullString `db:"user_id"`
+
+	Expires  sql.NullInt64 `db:"expires"`
+	LastUsed sql.NullInt64 `db:"last_used"`
+
+	Created int64 `db:"created"`
+	Updated int64 `db:"updated"`
+}
+
+func OAuthInitialAccessTokenQuery() *goqu.SelectDataset {
+	query := dialect.From("oauth_initial_access_tokens").
+		Select(
+			"oauth_initial_access_tokens.id",
+			"oauth_initial_access_tokens.token_hash",
+
+			"oauth_initial_access_tokens.name",
+			"oauth_initial_access_tokens.user_id",
+
+			"oauth_initial_access_tokens.expires",
+			"oauth_initial_access_tokens.last_used",
+
+			"oauth_initial_access_tokens.created",
+			"oauth_initial_access_tokens.updated",
+		).
+		Prepared(true)
+
+	return query
+}
+
+func (db DB) GetOAuthInitialAccessTokenById(ctx context.Context, id string) (OAuthInitialAccessToken, error) {
+	query := OAuthInitialAccessTokenQuery().
+		Where(goqu.I("oauth_initial_access_tokens.id").Eq(id))
+
+	return ember.Single[OAuthInitialAccessToken](db.db, ctx, query)
+}
+
+func (db DB) GetOAuthInitialAccessTokenByHash(ctx context.Context, tokenHash string) (OAuthInitialAccessToken, error) {
+	query := OAuthInitialAccessTokenQuery().
+		Where(goqu.I("oauth_initial_access_tokens.token_hash").Eq(tokenHash))
+
+	return ember.Single[OAuthInitialAccessToken](db.db, ctx, query)
+}
+
+func (db DB) GetAllOAuthInitialAccessTokens(ctx context.Context) ([]OAuthInitialAccessToken, error) {
+	query := OAuthInitialAccessTokenQuery().
+		Order(goqu.I("oauth_initial_access_tokens.created").Asc())
+
+	return ember.Multiple[OAuthInitialAccessToken](db.db, ctx, query)
+}
+
+type CreateOAuthInitialAccessTokenParams struct {
+	Id        string
+	TokenHash string
+
+	Name   string
+	UserId sql.NullString
+
+	Expires sql.NullInt64
+
+	Created int64
+	Updated int64
+}
+
+func (db DB) CreateOAuthInitialAccessToken(ctx context.Context, params CreateOAuthInitialAccessTokenParams) (OAuthInitialAccessToken, error) {
+	t := time.Now().UnixMilli()
+	created := params.Created
+	updated := params.Updated
+
+	if created == 0 && updated == 0 {
+		created = t
+		updated = t
+	}
+
+	id := params.Id
+	if id == "" {
+		id = utils.CreateId()
+	}
+
+	query := dialect.Insert("oauth_initial_access_tokens").Rows(goqu.Record{
+		"id":         id,
+		"token_hash": params.TokenHash,
+
+		"name":    params.Name,
+		"user_id": params.UserId,
+
+		"expires": params.Expires,
+
+		"created": created,
+		"updated": updated,
+	}).
+		Returning(
+			"oauth_initial_access_tokens.id",
+			"oauth_initial_access_tokens.token_hash",
+
+			"oauth_initial_access_tokens.name",
+			"oauth_initial_access_tokens.user_id",
+
+			"oauth_initial_access_tokens.expires",
+			"oauth_initial_access_tokens.last_used",
+
+			"oauth_initial_access_tokens.created",
+			"oauth_initial_access_tokens.updated",
+		)
+
+	return ember.Single[OAuthInitialAccessToken](db.db, ctx, query)
+}
+
+func (db DB) UpdateOAuthInitialAccessTokenLastUsed(ctx context.Context, id string, lastUsed int64) error {
+	query := dialect.Update("oauth_initial_access_tokens").
+		Set(goqu.Record{
+			"last_used": lastUsed,
+		}).
+		Where(goqu.I("oauth_initial_access_tokens.id").Eq(id))
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (db DB) DeleteOAuthInitialAccessToken(ctx context.Context, id string) error {
+	query := dialect.Delete("oauth_initial_access_tokens").
+		Where(goqu.I("oauth_initial_access_tokens.id").Eq(id))
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteExpiredOAuthInitialAccessTokens removes all the tokens that
+// expired before the timestamp, tokens without a expire date are kept
+func (db DB) DeleteExpiredOAuthInitialAccessTokens(ctx context.Context, before int64) error {
+	query := dialect.Delete("oauth_initial_access_tokens").
+		Where(goqu.I("oauth_initial_access_tokens.expires").Lt(before))
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,173 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/nanoteck137/authlab/tools/utils"
+	"github.com/nanoteck137/authlab/types"
+	"github.com/nanoteck137/pyrin/ember"
+)
+
+// Passkey is a WebAuthn credential registered by the user, the user can
+// have many
+type Passkey struct {
+	Id     string `db:"id"`
+	UserId string `db:"user_id"`
+
+	CredentialId string `db:"credential_id"`
+	Name         string `db:"name"`
+	Credential   string `db:"credential"`
+
+	LastUsed int64 `db:"last_used"`
+
+	Created int64 `db:"created"`
+	Updated int64 `db:"updated"`
+}
+
+func PasskeyQuery() *goqu.SelectDataset {
+	query := dialect.From("passkeys").
+		Select(
+			"passkeys.id",
+			"passkeys.user_id",
+
+			"passkeys.credential_id",
+			"passkeys.name",
+			"passkeys.credential",
+
+			"passkeys.last_used",
+
+			"passkeys.created",
+			"passkeys.updated",
+		).
+		Prepared(true)
+
+	return query
+}
+
+func (db DB) GetPasskeyById(ctx context.Context, id string) (Passkey, error) {
+	query := PasskeyQuery().
+		Where(goqu.I("passkeys.id").Eq(id))
+
+	return ember.Single[Passkey](db.db, ctx, query)
+}
+
+func (db DB) GetPasskeyByCredentialId(ctx context.Context, credentialId string) (Passkey, error) {
+	query := PasskeyQuery().
+		Where(goqu.I("passkeys.credential_id").Eq(credentialId))
+
+	return ember.Single[Passkey](db.db, ctx, query)
+}
+
+func (db DB) GetAllPasskeysForUser(ctx context.Context, userId string) ([]Passkey, error) {
+	query := PasskeyQuery().
+		Where(goqu.I("passkeys.user_id").Eq(userId)).
+		Order(goqu.I("passkeys.created").Asc())
+
+	return ember.Multiple[Passkey](db.db, ctx, query)
+}
+
+type CreatePasskeyParams struct {
+	Id     string
+	UserId string
+
+	CredentialId string
+	Name         string
+	Credential   string
+
+	Created int64
+	Updated int64
+}
+
+func (db DB) CreatePasskey(ctx context.Context, params CreatePasskeyParams) (string, error) {
+	t := time.Now().UnixMilli()
+	created := params.Created
+	updated := params.Updated
+
+	if created == 0 && updated == 0 {
+		created = t
+		updated = t
+	}
+
+	id := params.Id
+	if id == "" {
+		id = utils.CreateId()
+	}
+
+	query := dialect.Insert("passkeys").Rows(goqu.Record{
+		"id":      id,
+		"user_id": params.UserId,
+
+		"credential_id": params.CredentialId,
+		"name":          params.Name,
+		"credential":    params.Credential,
+
+		"last_used": 0,
+
+		"created": created,
+		"updated": updated,
+	})
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+type PasskeyChanges struct {
+	Name       types.Change[string]
+	Credential types.Change[string]
+	LastUsed   types.Change[int64]
+}
+
+func (db DB) UpdatePasskey(ctx context.Context, id string, changes PasskeyChanges) error {
+	record := goqu.Record{}
+
+	addToRecord(record, "name", changes.Name)
+	addToRecord(record, "credential", changes.Credential)
+	addToRecord(record, "last_used", changes.LastUsed)
+
+	if len(record) == 0 {
+		return nil
+	}
+
+	record["updated"] = time.Now().UnixMilli()
+
+	query := dialect.Update("passkeys").
+		Set(record).
+		Where(goqu.I("passkeys.id").Eq(id))
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (db DB) DeletePasskey(ctx context.Context, id string) error {
+	query := dialect.Delete("passkeys").
+		Where(goqu.I("passkeys.id").Eq(id))
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (db DB) DeleteAllPasskeysForUser(ctx context.Context, userId string) error {
+	query := dialect.Delete("passkeys").
+		Where(goqu.I("passkeys.user_id").Eq(userId))
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
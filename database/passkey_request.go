@@ -0,0 +1,156 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/nanoteck137/authlab/tools/utils"
+	"github.com/nanoteck137/pyrin/ember"
+)
+
+// PasskeyRequest stores the session data of a WebAuthn ceremony between
+// the options sent to the browser and the response from the
+// authenticator
+type PasskeyRequest struct {
+	Id     string         `db:"id"`
+	UserId sql.NullString `db:"user_id"`
+
+	Type    string `db:"type"`
+	Session string `db:"session"`
+
+	MfaChallengeId sql.NullString `db:"mfa_challenge_id"`
+
+	Used int `db:"used"`
+
+	Expires int64 `db:"expires"`
+
+	Created int64 `db:"created"`
+	Updated int64 `db:"updated"`
+}
+
+func PasskeyRequestQuery() *goqu.SelectDataset {
+	query := dialect.From("passkey_requests").
+		Select(
+			"passkey_requests.id",
+			"passkey_requests.user_id",
+
+			"passkey_requests.type",
+			"passkey_requests.session",
+
+			"passkey_requests.mfa_challenge_id",
+
+			"passkey_requests.used",
+
+			"passkey_requests.expires",
+
+			"passkey_requests.created",
+			"passkey_requests.updated",
+		).
+		Prepared(true)
+
+	return query
+}
+
+func (db DB) GetPasskeyRequestById(ctx context.Context, id string) (PasskeyRequest, error) {
+	query := PasskeyRequestQuery().
+		Where(goqu.I("passkey_requests.id").Eq(id))
+
+	return ember.Single[PasskeyRequest](db.db, ctx, query)
+}
+
+type CreatePasskeyRequestParams struct {
+	Id     string
+	UserId sql.NullString
+
+	Type    string
+	Session string
+
+	MfaChallengeId sql.NullString
+
+	Expires int64
+
+	Created int64
+	Updated int64
+}
+
+func (db DB) CreatePasskeyRequest(ctx context.Context, params CreatePasskeyRequestParams) (string, error) {
+	t := time.Now().UnixMilli()
+	created := params.Created
+	updated := params.Updated
+
+	if created == 0 && updated == 0 {
+		created = t
+		updated = t
+	}
+
+	id := params.Id
+	if id == "" {
+		id = utils.CreateId()
+	}
+
+	query := dialect.Insert("passkey_requests").Rows(goqu.Record{
+		"id":      id,
+		"user_id": params.UserId,
+
+		"type":    params.Type,
+		"session": params.Session,
+
+		"mfa_challenge_id": params.MfaChallengeId,
+
+		"used": 0,
+
+		"expires": params.Expires,
+
+		"created": created,
+		"updated": updated,
+	})
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// MarkPasskeyRequestUsed marks the request as used, returns false if the
+// request was already marked as used
+func (db DB) MarkPasskeyRequestUsed(ctx context.Context, id string) (bool, error) {
+	query := dialect.Update("passkey_requests").
+		Set(goqu.Record{
+			"used":    1,
+			"updated": time.Now().UnixMilli(),
+		}).
+		Where(
+			goqu.I("passkey_requests.id").Eq(id),
+			goqu.I("passkey_requests.used").Eq(0),
+		)
+
+	res, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+// DeleteExpiredPasskeyRequests removes all the requests that expired
+// before the timestamp
+func (db DB) DeleteExpiredPasskeyRequests(ctx context.Context, before int64) error {
+	query := dialect.Delete("passkey_requests").
+		Where(goqu.I("passkey_requests.expires").Lt(before))
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/nanoteck137/authlab/tools/utils"
+	"github.com/nanoteck137/pyrin/ember"
+)
+
+// PasswordResetToken is the single use token sent to the user inside
+// the password reset email, only the hash of the token is stored
+type PasswordResetToken struct {
+	Id     string `db:"id"`
+	UserId string `db:"user_id"`
+
+	TokenHash string `db:"token_hash"`
+	Used      int    `db:"used"`
+
+	Expires int64 `db:"expires"`
+
+	Created int64 `db:"created"`
+	Updated int64 `db:"updated"`
+}
+
+func PasswordResetTokenQuery() *goqu.SelectDataset {
+	query := dialect.From("password_reset_tokens").
+		Select(
+			"password_reset_tokens.id",
+			"password_reset_tokens.user_id",
+
+			"password_reset_tokens.token_hash",
+			"password_reset_tokens.used",
+
+			"password_reset_tokens.expires",
+
+			"password_reset_tokens.created",
+			"password_reset_tokens.updated",
+		).
+		Prepared(true)
+
+	return query
+}
+
+func (db DB) GetPasswordResetTokenByHash(ctx context.Context, tokenHash string) (PasswordResetToken, error) {
+	query := PasswordResetTokenQuery().
+		Where(goqu.I("password_reset_tokens.token_hash").Eq(tokenHash))
+
+	return ember.Single[PasswordResetToken](db.db, ctx, query)
+}
+
+type CreatePasswordResetTokenParams struct {
+	Id     string
+	UserId string
+
+	TokenHash string
+
+	Expires int64
+
+	Created int64
+	Updated int64
+}
+
+func (db DB) CreatePasswordResetToken(ctx context.Context, params CreatePasswordResetTokenParams) (string, error) {
+	t := time.Now().UnixMilli()
+	created := params.Created
+	updated := params.Updated
+
+	if created == 0 && updated == 0 {
+		created = t
+		updated = t
+	}
+
+	id := params.Id
+	if id == "" {
+		id = utils.CreateId()
+	}
+
+	query := dialect.Insert("password_reset_tokens").Rows(goqu.Record{
+		"id":      id,
+		"user_id": params.UserId,
+
+		"token_hash": params.TokenHash,
+		"used":       0,
+
+		"expires": params.Expires,
+
+		"created": created,
+		"updated": updated,
+	})
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// MarkPasswordResetTokenUsed marks the token as used, returns false if
+// the token was already marked as used
+func (db DB) MarkPasswordResetTokenUsed(ctx context.Context, id string) (bool, error) {
+	query := dialect.Update("password_reset_tokens").
+		Set(goqu.Record{
+			"used":    1,
+			"updated": time.Now().UnixMilli(),
+		}).
+		Where(
+			goqu.I("password_reset_tokens.id").Eq(id),
+			goqu.I("password_reset_tokens.used").Eq(0),
+		)
+
+	res, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+// DeleteAllPasswordResetTokensForUser removes all the reset tokens of
+// the user, used when a new token is requested so only the latest link
+// works
+func (db DB) DeleteAllPasswordResetTokensForUser(ctx context.Context, userId string) error {
+	query := dialect.Delete("password_reset_tokens").
+		Where(goqu.I("password_reset_tokens.user_id").Eq(userId))
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteExpiredPasswordResetTokens removes all the tokens that expired
+// before the timestamp
+func (db DB) DeleteExpiredPasswordResetTokens(ctx context.Context, before int64) error {
+	query := dialect.Delete("password_reset_tokens").
+		Where(goqu.I("password_reset_tokens.expires").Lt(before))
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,166 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/nanoteck137/authlab/tools/utils"
+	"github.com/nanoteck137/pyrin/ember"
+)
+
+type RefreshToken struct {
+	Id        string `db:"id"`
+	FamilyId  string `db:"family_id"`
+	UserId    string `db:"user_id"`
+	SessionId string `db:"session_id"`
+
+	TokenHash string `db:"token_hash"`
+	Used      int    `db:"used"`
+
+	Expires int64 `db:"expires"`
+
+	Created int64 `db:"created"`
+	Updated int64 `db:"updated"`
+}
+
+func RefreshTokenQuery() *goqu.SelectDataset {
+	query := dialect.From("refresh_tokens").
+		Select(
+			"refresh_tokens.id",
+			"refresh_tokens.family_id",
+			"refresh_tokens.user_id",
+			"refresh_tokens.session_id",
+
+			"refresh_tokens.token_hash",
+			"refresh_tokens.used",
+
+			"refresh_tokens.expires",
+
+			"refresh_tokens.created",
+			"refresh_tokens.updated",
+		).
+		Prepared(true)
+
+	return query
+}
+
+func (db DB) GetRefreshTokenByHash(ctx context.Context, hash string) (RefreshToken, error) {
+	query := RefreshTokenQuery().
+		Where(goqu.I("refresh_tokens.token_hash").Eq(hash))
+
+	return ember.Single[RefreshToken](db.db, ctx, query)
+}
+
+type CreateRefreshTokenParams struct {
+	Id        string
+	FamilyId  string
+	UserId    string
+	SessionId string
+
+	TokenHash string
+
+	Expires int64
+
+	Created int64
+	Updated int64
+}
+
+func (db DB) CreateRefreshToken(ctx context.Context, params CreateRefreshTokenParams) (RefreshToken, error) {
+	t := time.Now().UnixMilli()
+	created := params.Created
+	updated := params.Updated
+
+	if created == 0 && updated == 0 {
+		created = t
+		updated = t
+	}
+
+	id := params.Id
+	if id == "" {
+		id = utils.CreateId()
+	}
+
+	query := dialect.Insert("refresh_tokens").Rows(goqu.Record{
+		"id":         id,
+		"family_id":  params.FamilyId,
+		"user_id":    params.UserId,
+		"session_id": params.SessionId,
+
+		"token_hash": params.TokenHash,
+		"used":       0,
+
+		"expires": params.Expires,
+
+		"created": created,
+		"updated": updated,
+	}).
+		Returning(
+			"refresh_tokens.id",
+			"refresh_tokens.family_id",
+			"refresh_tokens.user_id",
+			"refresh_tokens.session_id",
+
+			"refresh_tokens.token_hash",
+			"refresh_tokens.used",
+
+			"refresh_tokens.expires",
+
+			"refresh_tokens.created",
+			"refresh_tokens.updated",
+		)
+
+	return ember.Single[RefreshToken](db.db, ctx, query)
+}
+
+// MarkRefreshTokenUsed marks the token as used, returns false if the
+// token was already marked as used
+func (db DB) MarkRefreshTokenUsed(ctx context.Context, id string) (bool, error) {
+	query := dialect.Update("refresh_tokens").
+		Set(goqu.Record{
+			"used":    1,
+			"updated": time.Now().UnixMilli(),
+		}).
+		Where(
+			goqu.I("refresh_tokens.id").Eq(id),
+			goqu.I("refresh_tokens.used").Eq(0),
+		)
+
+	res, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+func (db DB) DeleteRefreshTokenFamily(ctx context.Context, familyId string) error {
+	query := dialect.Delete("refresh_tokens").
+		Where(goqu.I("refresh_tokens.family_id").Eq(familyId))
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteExpiredRefreshTokens removes all the refresh tokens that are
+// expired
+func (db DB) DeleteExpiredRefreshTokens(ctx context.Context, now int64) error {
+	query := dialect.Delete("refresh_tokens").
+		Where(goqu.I("refresh_tokens.expires").Lt(now))
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
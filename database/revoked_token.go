@@ -0,0 +1,85 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/nanoteck137/pyrin/ember"
+)
+
+type RevokedToken struct {
+	Jti string `db:"jti"`
+
+	Expires int64 `db:"expires"`
+
+	Created int64 `db:"created"`
+}
+
+func RevokedTokenQuery() *goqu.SelectDataset {
+	query := dialect.From("revoked_tokens").
+		Select(
+			"revoked_tokens.jti",
+
+			"revoked_tokens.expires",
+
+			"revoked_tokens.created",
+		).
+		Prepared(true)
+
+	return query
+}
+
+func (db DB) GetRevokedTokenByJti(ctx context.Context, jti string) (RevokedToken, error) {
+	query := RevokedTokenQuery().
+		Where(goqu.I("revoked_tokens.jti").Eq(jti))
+
+	return ember.Single[RevokedToken](db.db, ctx, query)
+}
+
+type CreateRevokedTokenParams struct {
+	Jti string
+
+	Expires int64
+
+	Created int64
+}
+
+// CreateRevokedToken adds the token to the denylist, revoking a token
+// that is already revoked is not an error
+func (db DB) CreateRevokedToken(ctx context.Context, params CreateRevokedTokenParams) error {
+	created := params.Created
+	if created == 0 {
+		created = time.Now().UnixMilli()
+	}
+
+	query := dialect.Insert("revoked_tokens").Rows(goqu.Record{
+		"jti": params.Jti,
+
+		"expires": params.Expires,
+
+		"created": created,
+	}).
+		OnConflict(goqu.DoNothing())
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteExpiredRevokedTokens removes the tokens from the denylist that
+// have expired, the tokens are not valid anyway after they expire
+func (db DB) DeleteExpiredRevokedTokens(ctx context.Context, now int64) error {
+	query := dialect.Delete("revoked_tokens").
+		Where(goqu.I("revoked_tokens.expires").Lt(now))
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,235 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/nanoteck137/authlab/tools/utils"
+	"github.com/nanoteck137/pyrin/ember"
+)
+
+type Session struct {
+	Id     string `db:"id"`
+	UserId string `db:"user_id"`
+
+	AuthMethod string `db:"auth_method"`
+	UserAgent  string `db:"user_agent"`
+	IpAddress  string `db:"ip_address"`
+
+	// The OAuth client the session was created for, not set for the
+	// sessions created by logging in to authlab itself
+	ClientId sql.NullString `db:"client_id"`
+	Scope    string         `db:"scope"`
+
+	LastSeen int64 `db:"last_seen"`
+
+	Created int64 `db:"created"`
+	Updated int64 `db:"updated"`
+}
+
+func SessionQuery() *goqu.SelectDataset {
+	query := dialect.From("sessions").
+		Select(
+			"sessions.id",
+			"sessions.user_id",
+
+			"sessions.auth_method",
+			"sessions.user_agent",
+			"sessions.ip_address",
+
+			"sessions.client_id",
+			"sessions.scope",
+
+			"sessions.last_seen",
+
+			"sessions.created",
+			"sessions.updated",
+		).
+		Prepared(true)
+
+	return query
+}
+
+func (db DB) GetSessionById(ctx context.Context, id string) (Session, error) {
+	query := SessionQuery().
+		Where(goqu.I("sessions.id").Eq(id))
+
+	return ember.Single[Session](db.db, ctx, query)
+}
+
+func (db DB) GetAllSessionsForUser(ctx context.Context, userId string) ([]Session, error) {
+	query := SessionQuery().
+		Where(goqu.I("sessions.user_id").Eq(userId)).
+		Order(goqu.I("sessions.last_seen").Desc())
+
+	return ember.Multiple[Session](db.db, ctx, query)
+}
+
+type CreateSessionParams struct {
+	Id     string
+	UserId string
+
+	AuthMethod string
+	UserAgent  string
+	IpAddress  string
+
+	ClientId sql.NullString
+	Scope    string
+
+	Created int64
+	Updated int64
+}
+
+func (db DB) CreateSession(ctx context.Context, params CreateSessionParams) (Session, error) {
+	t := time.Now().UnixMilli()
+	created := params.Created
+	updated := params.Updated
+
+	if created == 0 && updated == 0 {
+		created = t
+		updated = t
+	}
+
+	id := params.Id
+	if id == "" {
+		id = utils.CreateId()
+	}
+
+	query := dialect.Insert("sessions").Rows(goqu.Record{
+		"id":      id,
+		"user_id": params.UserId,
+
+		"auth_method": params.AuthMethod,
+		"user_agent":  params.UserAgent,
+		"ip_address":  params.IpAddress,
+
+		"client_id": params.ClientId,
+		"scope":     params.Scope,
+
+		"last_seen": created,
+
+		"created": created,
+		"updated": updated,
+	}).
+		Returning(
+			"sessions.id",
+			"sessions.user_id",
+
+			"sessions.auth_method",
+			"sessions.user_agent",
+			"sessions.ip_address",
+
+			"sessions.client_id",
+			"sessions.scope",
+
+			"sessions.last_seen",
+
+			"sessions.created",
+			"sessions.updated",
+		)
+
+	return ember.Single[Session](db.db, ctx, query)
+}
+
+func (db DB) UpdateSessionLastSeen(ctx context.Context, id string, lastSeen int64) error {
+	query := dialect.Update("sessions").
+		Set(goqu.Record{
+			"last_seen": lastSeen,
+		}).
+		Where(goqu.I("sessions.id").Eq(id))
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (db DB) DeleteSession(ctx context.Context, id string) error {
+	query := dialect.Delete("sessions").
+		Where(goqu.I("sessions.id").Eq(id))
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (db DB) DeleteAllSessionsForUser(ctx context.Context, userId string) error {
+	query := dialect.Delete("sessions").
+		Where(goqu.I("sessions.user_id").Eq(userId))
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteOtherSessionsForUser removes all the sessions for the user
+// except the session with the id
+func (db DB) DeleteOtherSessionsForUser(ctx context.Context, userId, sessionId string) error {
+	query := dialect.Delete("sessions").
+		Where(
+			goqu.I("sessions.user_id").Eq(userId),
+			goqu.I("sessions.id").Neq(sessionId),
+		)
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteInactiveSessions removes all the sessions that haven't been
+// seen since before the timestamp
+func (db DB) DeleteInactiveSessions(ctx context.Context, before int64) error {
+	query := dialect.Delete("sessions").
+		Where(goqu.I("sessions.last_seen").Lt(before))
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteAllSessionsForClient removes all the sessions created for the
+// OAuth client
+func (db DB) DeleteAllSessionsForClient(ctx context.Context, clientId string) error {
+	query := dialect.Delete("sessions").
+		Where(goqu.I("sessions.client_id").Eq(clientId))
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteAllSessionsForUserClient removes the sessions the user has with
+// the OAuth client
+func (db DB) DeleteAllSessionsForUserClient(ctx context.Context, userId, clientId string) error {
+	query := dialect.Delete("sessions").
+		Where(
+			goqu.I("sessions.user_id").Eq(userId),
+			goqu.I("sessions.client_id").Eq(clientId),
+		)
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -20,6 +20,14 @@ type User struct {
 	Id    string `db:"id"`
 	Email string `db:"email"`
 
+	// Set when the user has proven that the email belongs to them
+	EmailVerified int `db:"email_verified"`
+
+	// Only set for local accounts, the users from the providers logs in
+	// at the provider
+	Username     sql.NullString `db:"username"`
+	PasswordHash sql.NullString `db:"password_hash"`
+
 	DisplayName string `db:"display_name"`
 	Role        string `db:"role"`
 
@@ -40,6 +48,10 @@ func UserQuery() *goqu.SelectDataset {
 		Select(
 			"users.id",
 			"users.email",
+			"users.email_verified",
+
+			"users.username",
+			"users.password_hash",
 
 			"users.display_name",
 			"users.role",
@@ -108,6 +120,11 @@ type CreateUserParams struct {
 	Id    string
 	Email string
 
+	EmailVerified bool
+
+	Username     sql.NullString
+	PasswordHash sql.NullString
+
 	DisplayName string
 	Role        string
 
@@ -129,11 +146,20 @@ func (db DB) CreateUser(ctx context.Context, params CreateUserParams) (User, err
 		params.Id = utils.CreateId()
 	}
 
+	emailVerified := 0
+	if params.EmailVerified {
+		emailVerified = 1
+	}
+
 	query := dialect.
 		Insert("users").
 		Rows(goqu.Record{
-			"id":    params.Id,
-			"email": params.Email,
+			"id":             params.Id,
+			"email":          params.Email,
+			"email_verified": emailVerified,
+
+			"username":      params.Username,
+			"password_hash": params.PasswordHash,
 
 			"display_name": params.DisplayName,
 			"role":         params.Role,
@@ -145,6 +171,10 @@ func (db DB) CreateUser(ctx context.Context, params CreateUserParams) (User, err
 		Returning(
 			"users.id",
 			"users.email",
+			"users.email_verified",
+
+			"users.username",
+			"users.password_hash",
 
 			"users.display_name",
 			"users.role",
@@ -157,8 +187,10 @@ func (db DB) CreateUser(ctx context.Context, params CreateUserParams) (User, err
 }
 
 type UserChanges struct {
-	DisplayName types.Change[string]
-	Role        types.Change[string]
+	DisplayName   types.Change[string]
+	Role          types.Change[string]
+	PasswordHash  types.Change[sql.NullString]
+	EmailVerified types.Change[int]
 
 	Created types.Change[int64]
 }
@@ -168,6 +200,8 @@ func (db DB) UpdateUser(ctx context.Context, id string, changes UserChanges) err
 
 	addToRecord(record, "display_name", changes.DisplayName)
 	addToRecord(record, "role", changes.Role)
+	addToRecord(record, "password_hash", changes.PasswordHash)
+	addToRecord(record, "email_verified", changes.EmailVerified)
 
 	addToRecord(record, "created", changes.Created)
 
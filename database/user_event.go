@@ -0,0 +1,96 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/nanoteck137/authlab/tools/utils"
+	"github.com/nanoteck137/pyrin/ember"
+)
+
+// UserEvent is an entry in the history of the user, used to show the
+// user when the security settings of the account were changed
+type UserEvent struct {
+	Id     string `db:"id"`
+	UserId string `db:"user_id"`
+
+	Type string `db:"type"`
+
+	UserAgent string `db:"user_agent"`
+	IpAddress string `db:"ip_address"`
+
+	Created int64 `db:"created"`
+}
+
+func UserEventQuery() *goqu.SelectDataset {
+	query := dialect.From("user_events").
+		Select(
+			"user_events.id",
+			"user_events.user_id",
+
+			"user_events.type",
+
+			"user_events.user_agent",
+			"user_events.ip_address",
+
+			"user_events.created",
+		).
+		Prepared(true)
+
+	return query
+}
+
+// GetUserEvents returns the newest events of the user, at most limit
+// events are returned
+func (db DB) GetUserEvents(ctx context.Context, userId string, limit uint) ([]UserEvent, error) {
+	query := UserEventQuery().
+		Where(goqu.I("user_events.user_id").Eq(userId)).
+		Order(goqu.I("user_events.created").Desc()).
+		Limit(limit)
+
+	return ember.Multiple[UserEvent](db.db, ctx, query)
+}
+
+type CreateUserEventParams struct {
+	Id     string
+	UserId string
+
+	Type string
+
+	UserAgent string
+	IpAddress string
+
+	Created int64
+}
+
+func (db DB) CreateUserEvent(ctx context.Context, params CreateUserEventParams) (string, error) {
+	created := params.Created
+	if created == 0 {
+		created = time.Now().UnixMilli()
+	}
+
+	id := params.Id
+	if id == "" {
+		id = utils.CreateId()
+	}
+
+	query := dialect.Insert("user_events").Rows(goqu.Record{
+		"id":      id,
+		"user_id": params.UserId,
+
+		"type": params.Type,
+
+		"user_agent": params.UserAgent,
+		"ip_address": params.IpAddress,
+
+		"created": created,
+	})
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
@@ -0,0 +1,117 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/nanoteck137/pyrin/ember"
+)
+
+// UserGrant is the scopes a user has approved for a OAuth client, the
+// user is not asked again as long as the client requests the same or
+// fewer scopes
+type UserGrant struct {
+	UserId   string `db:"user_id"`
+	ClientId string `db:"client_id"`
+
+	Scope string `db:"scope"`
+
+	Created int64 `db:"created"`
+	Updated int64 `db:"updated"`
+}
+
+func UserGrantQuery() *goqu.SelectDataset {
+	query := dialect.From("user_grants").
+		Select(
+			"user_grants.user_id",
+			"user_grants.client_id",
+
+			"user_grants.scope",
+
+			"user_grants.created",
+			"user_grants.updated",
+		).
+		Prepared(true)
+
+	return query
+}
+
+func (db DB) GetUserGrant(ctx context.Context, userId, clientId string) (UserGrant, error) {
+	query := UserGrantQuery().
+		Where(
+			goqu.I("user_grants.user_id").Eq(userId),
+			goqu.I("user_grants.client_id").Eq(clientId),
+		)
+
+	return ember.Single[UserGrant](db.db, ctx, query)
+}
+
+func (db DB) GetAllUserGrantsForUser(ctx context.Context, userId string) ([]UserGrant, error) {
+	query := UserGrantQuery().
+		Where(goqu.I("user_grants.user_id").Eq(userId)).
+		Order(goqu.I("user_grants.updated").Desc())
+
+	return ember.Multiple[UserGrant](db.db, ctx, query)
+}
+
+type SetUserGrantParams struct {
+	UserId   string
+	ClientId string
+
+	Scope string
+}
+
+// SetUserGrant creates the grant or replaces the scope of the existing
+// grant
+func (db DB) SetUserGrant(ctx context.Context, params SetUserGrantParams) error {
+	t := time.Now().UnixMilli()
+
+	query := dialect.Insert("user_grants").Rows(goqu.Record{
+		"user_id":   params.UserId,
+		"client_id": params.ClientId,
+
+		"scope": params.Scope,
+
+		"created": t,
+		"updated": t,
+	}).
+		OnConflict(goqu.DoUpdate("user_id, client_id", goqu.Record{
+			"scope":   params.Scope,
+			"updated": t,
+		}))
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (db DB) DeleteUserGrant(ctx context.Context, userId, clientId string) error {
+	query := dialect.Delete("user_grants").
+		Where(
+			goqu.I("user_grants.user_id").Eq(userId),
+			goqu.I("user_grants.client_id").Eq(clientId),
+		)
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (db DB) DeleteAllUserGrantsForClient(ctx context.Context, clientId string) error {
+	query := dialect.Delete("user_grants").
+		Where(goqu.I("user_grants.client_id").Eq(clientId))
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
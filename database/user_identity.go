@@ -88,3 +88,23 @@ func (db DB) CreateUserIdentity(ctx context.Context, params CreateUserIdentityPa
 
 	return nil
 }
+
+// DeleteOtherUserIdentitiesForUser removes all the identities linked to
+// the user except the identity with the provider and provider id
+func (db DB) DeleteOtherUserIdentitiesForUser(ctx context.Context, userId, provider, providerId string) error {
+	query := dialect.Delete("user_identities").
+		Where(
+			goqu.I("user_identities.user_id").Eq(userId),
+			goqu.Or(
+				goqu.I("user_identities.provider").Neq(provider),
+				goqu.I("user_identities.provider_id").Neq(providerId),
+			),
+		)
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,155 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/nanoteck137/pyrin/ember"
+)
+
+// UserTotp is the TOTP authenticator of the user, the user can only have
+// one
+type UserTotp struct {
+	UserId string `db:"user_id"`
+
+	Secret       string `db:"secret"`
+	Enabled      int    `db:"enabled"`
+	LastUsedStep int64  `db:"last_used_step"`
+
+	Created int64 `db:"created"`
+	Updated int64 `db:"updated"`
+}
+
+func UserTotpQuery() *goqu.SelectDataset {
+	query := dialect.From("user_totp").
+		Select(
+			"user_totp.user_id",
+
+			"user_totp.secret",
+			"user_totp.enabled",
+			"user_totp.last_used_step",
+
+			"user_totp.created",
+			"user_totp.updated",
+		).
+		Prepared(true)
+
+	return query
+}
+
+func (db DB) GetUserTotp(ctx context.Context, userId string) (UserTotp, error) {
+	query := UserTotpQuery().
+		Where(goqu.I("user_totp.user_id").Eq(userId))
+
+	return ember.Single[UserTotp](db.db, ctx, query)
+}
+
+func (db DB) GetAllUserTotps(ctx context.Context) ([]UserTotp, error) {
+	query := UserTotpQuery()
+
+	return ember.Multiple[UserTotp](db.db, ctx, query)
+}
+
+// UpdateUserTotpSecret replaces the secret of the authenticator without
+// changing anything else, used when the secret is encrypted again
+func (db DB) UpdateUserTotpSecret(ctx context.Context, userId, secret string) error {
+	query := dialect.Update("user_totp").
+		Set(goqu.Record{
+			"secret":  secret,
+			"updated": time.Now().UnixMilli(),
+		}).
+		Where(goqu.I("user_totp.user_id").Eq(userId))
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SetUserTotpSecret creates the authenticator of the user, or replaces
+// the secret of the existing one. The authenticator is disabled until
+// EnableUserTotp is called.
+func (db DB) SetUserTotpSecret(ctx context.Context, userId, secret string) error {
+	t := time.Now().UnixMilli()
+
+	query := dialect.Insert("user_totp").Rows(goqu.Record{
+		"user_id": userId,
+
+		"secret":         secret,
+		"enabled":        0,
+		"last_used_step": 0,
+
+		"created": t,
+		"updated": t,
+	}).
+		OnConflict(goqu.DoUpdate("user_id", goqu.Record{
+			"secret":         secret,
+			"enabled":        0,
+			"last_used_step": 0,
+			"updated":        t,
+		}))
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (db DB) EnableUserTotp(ctx context.Context, userId string) error {
+	query := dialect.Update("user_totp").
+		Set(goqu.Record{
+			"enabled": 1,
+			"updated": time.Now().UnixMilli(),
+		}).
+		Where(goqu.I("user_totp.user_id").Eq(userId))
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UseUserTotpStep stores the time step of the code that was used, returns
+// false if a code for the same or a later step has already been used
+func (db DB) UseUserTotpStep(ctx context.Context, userId string, step int64) (bool, error) {
+	query := dialect.Update("user_totp").
+		Set(goqu.Record{
+			"last_used_step": step,
+			"updated":        time.Now().UnixMilli(),
+		}).
+		Where(
+			goqu.I("user_totp.user_id").Eq(userId),
+			goqu.I("user_totp.last_used_step").Lt(step),
+		)
+
+	res, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+func (db DB) DeleteUserTotp(ctx context.Context, userId string) error {
+	query := dialect.Delete("user_totp").
+		Where(goqu.I("user_totp.user_id").Eq(userId))
+
+	_, err := db.db.Exec(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
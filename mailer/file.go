@@ -0,0 +1,44 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/nanoteck137/authlab/tools/utils"
+)
+
+var _ Mailer = (*FileMailer)(nil)
+
+// FileMailer writes every email as an .eml file inside the directory
+type FileMailer struct {
+	from string
+	dir  string
+}
+
+func newFileMailer(from, dir string) (*FileMailer, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileMailer{
+		from: from,
+		dir:  dir,
+	}, nil
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	data, err := buildMessage(m.from, msg)
+	if err != nil {
+		return err
+	}
+
+	// NOTE(patrik): Prefix with the timestamp so the files are sorted
+	// in the order they were sent
+	name := strconv.FormatInt(time.Now().UnixMilli(), 10) + "-" + utils.CreateId() + ".eml"
+
+	return os.WriteFile(path.Join(m.dir, name), data, 0600)
+}
@@ -0,0 +1,18 @@
+package mailer
+
+import (
+	"context"
+	"log/slog"
+)
+
+var _ Mailer = (*LogMailer)(nil)
+
+// LogMailer writes the emails to the log instead of sending them
+type LogMailer struct {
+	from string
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	slog.Info("Mailer: email", "from", m.from, "to", msg.To, "subject", msg.Subject, "text", msg.Text)
+	return nil
+}
@@ -0,0 +1,96 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/nanoteck137/authlab/config"
+	"github.com/nanoteck137/authlab/tools/utils"
+	"github.com/nanoteck137/authlab/types"
+)
+
+const (
+	TypeLog  = "log"
+	TypeFile = "file"
+	TypeSmtp = "smtp"
+)
+
+var ErrInvalidAddress = errors.New("invalid email address")
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+}
+
+// Mailer sends the emails to the users, the log and file mailers are
+// used for development and tests where there is no mail server
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New creates the mailer from the config
+func New(config config.ConfigMailer, workDir types.WorkDir) (Mailer, error) {
+	switch config.Type {
+	case TypeLog:
+		return &LogMailer{from: config.From}, nil
+	case TypeFile:
+		dir := config.Dir
+		if dir == "" {
+			dir = workDir.MailDir()
+		}
+
+		return newFileMailer(config.From, dir)
+	case TypeSmtp:
+		return newSmtpMailer(config), nil
+	}
+
+	return nil, fmt.Errorf("unknown mailer type: %s", config.Type)
+}
+
+// buildMessage creates the raw RFC 5322 message with the headers
+func buildMessage(from string, msg Message) ([]byte, error) {
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return nil, ErrInvalidAddress
+	}
+
+	// NOTE(patrik): The addresses are written by us, but make sure that
+	// nothing can inject extra headers
+	if strings.ContainsAny(msg.Subject, "\r\n") {
+		return nil, errors.New("subject contains a newline")
+	}
+
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", to.String())
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@authlab>\r\n", utils.CreateId())
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+	buf.WriteString("\r\n")
+
+	w := quotedprintable.NewWriter(&buf)
+	_, err = w.Write([]byte(msg.Text))
+	if err != nil {
+		return nil, err
+	}
+
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,131 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"github.com/nanoteck137/authlab/config"
+)
+
+const (
+	SmtpTlsNone     = "none"
+	SmtpTlsStartTls = "starttls"
+	SmtpTlsImplicit = "tls"
+)
+
+// How long the whole conversation with the SMTP server can take
+const smtpTimeout = 30 * time.Second
+
+var _ Mailer = (*SmtpMailer)(nil)
+
+// SmtpMailer sends the emails with a SMTP server
+type SmtpMailer struct {
+	config config.ConfigMailer
+}
+
+func newSmtpMailer(config config.ConfigMailer) *SmtpMailer {
+	return &SmtpMailer{
+		config: config,
+	}
+}
+
+func (m *SmtpMailer) dial(ctx context.Context) (net.Conn, error) {
+	addr := net.JoinHostPort(m.config.Host, strconv.Itoa(m.config.Port))
+	dialer := &net.Dialer{}
+
+	if m.config.Tls == SmtpTlsImplicit {
+		tlsDialer := &tls.Dialer{
+			NetDialer: dialer,
+			Config: &tls.Config{
+				ServerName: m.config.Host,
+			},
+		}
+
+		return tlsDialer.DialContext(ctx, "tcp", addr)
+	}
+
+	return dialer.DialContext(ctx, "tcp", addr)
+}
+
+func (m *SmtpMailer) Send(ctx context.Context, msg Message) error {
+	data, err := buildMessage(m.config.From, msg)
+	if err != nil {
+		return err
+	}
+
+	from, err := mail.ParseAddress(m.config.From)
+	if err != nil {
+		return ErrInvalidAddress
+	}
+
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return ErrInvalidAddress
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, smtpTimeout)
+	defer cancel()
+
+	conn, err := m.dial(ctx)
+	if err != nil {
+		return err
+	}
+
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, m.config.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if m.config.Tls == SmtpTlsStartTls {
+		err = client.StartTLS(&tls.Config{
+			ServerName: m.config.Host,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if m.config.Username != "" {
+		err = client.Auth(smtp.PlainAuth("", m.config.Username, m.config.Password, m.config.Host))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = client.Mail(from.Address)
+	if err != nil {
+		return err
+	}
+
+	err = client.Rcpt(to.Address)
+	if err != nil {
+		return err
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	if err != nil {
+		return err
+	}
+
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
@@ -0,0 +1,48 @@
+package render
+
+import (
+	"embed"
+	"strings"
+	"text/template"
+
+	"github.com/nanoteck137/authlab"
+)
+
+//go:embed mail
+var mailFS embed.FS
+
+// MailData is the data for the plain text emails sent to the users
+type MailData struct {
+	AppName  string
+	UserName string
+	Link     string
+
+	// The code the user compares with the code shown in the browser
+	Code string
+}
+
+var mailTemplates = template.Must(template.New("mail").ParseFS(mailFS, "mail/*.txt"))
+
+func renderMail(name string, data MailData) (string, error) {
+	data.AppName = authlab.AppName
+
+	var b strings.Builder
+	err := mailTemplates.ExecuteTemplate(&b, name, data)
+	if err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+func RenderPasswordResetMail(data MailData) (string, error) {
+	return renderMail("password_reset", data)
+}
+
+func RenderMagicLinkMail(data MailData) (string, error) {
+	return renderMail("magic_link", data)
+}
+
+func RenderEmailVerificationMail(data MailData) (string, error) {
+	return renderMail("email_verification", data)
+}
@@ -19,7 +19,7 @@ type Data struct {
 	Content template.HTML
 }
 
-var templates = template.Must(template.New("index").ParseFS(embedFS, "templates/index.html"))
+var templates = template.Must(template.New("index").ParseFS(embedFS, "templates/*.html"))
 
 func RenderCallbackSuccess(w io.Writer) error {
 	return templates.ExecuteTemplate(w, "base", Data{
@@ -47,3 +47,103 @@ func RenderCallbackError(w io.Writer) error {
 		Content: template.HTML("An unknown error occurred. Please retry<br>You can now close this tab."),
 	})
 }
+
+func RenderCallbackRequestAlreadyUsed(w io.Writer) error {
+	return templates.ExecuteTemplate(w, "base", Data{
+		Icon:    "error",
+		AppName: authlab.AppName,
+		Header:  "Request Already Used!",
+		Content: template.HTML("This request has already been used. Please retry.<br>You can now close this tab."),
+	})
+}
+
+func RenderCallbackInvalidRequest(w io.Writer) error {
+	return templates.ExecuteTemplate(w, "base", Data{
+		Icon:    "error",
+		AppName: authlab.AppName,
+		Header:  "Invalid Request!",
+		Content: template.HTML("This request is not valid. Please retry.<br>You can now close this tab."),
+	})
+}
+
+// RenderCallbackProviderError renders the error the provider returned,
+// the error code and description comes from the query parameters so
+// they need to be escaped
+func RenderCallbackProviderError(w io.Writer, code, description string) error {
+	content := fmt.Sprintf("The provider returned an error: <strong>%s</strong>", template.HTMLEscapeString(code))
+	if description != "" {
+		content += "<br>" + template.HTMLEscapeString(description)
+	}
+	content += "<br>You can now close this tab."
+
+	return templates.ExecuteTemplate(w, "base", Data{
+		Icon:    "error",
+		AppName: authlab.AppName,
+		Header:  "Login Failed!",
+		Content: template.HTML(content),
+	})
+}
+
+// RenderAuthorizeInvalidClient renders the error for authorization
+// requests with an unknown client or redirect uri, we can't redirect
+// back to the client so the error is shown to the user
+func RenderAuthorizeInvalidClient(w io.Writer, message string) error {
+	content := fmt.Sprintf("The application sent an invalid request: <strong>%s</strong>", template.HTMLEscapeString(message))
+	content += "<br>Please contact the owner of the application."
+
+	return templates.ExecuteTemplate(w, "base", Data{
+		Icon:    "error",
+		AppName: authlab.AppName,
+		Header:  "Invalid Request!",
+		Content: template.HTML(content),
+	})
+}
+
+type ConsentData struct {
+	AppName       string
+	ClientName    string
+	ClientLogoUrl string
+	UserName      string
+
+	// Descriptions of the requested scopes
+	Scopes []string
+
+	RequestId string
+	CsrfToken string
+}
+
+// RenderConsent renders the page where the user approves or denies the
+// client access to the account
+func RenderConsent(w io.Writer, data ConsentData) error {
+	data.AppName = authlab.AppName
+	return templates.ExecuteTemplate(w, "consent", data)
+}
+
+func RenderConsentRequestInvalid(w io.Writer) error {
+	return templates.ExecuteTemplate(w, "base", Data{
+		Icon:    "error",
+		AppName: authlab.AppName,
+		Header:  "Invalid Request!",
+		Content: template.HTML("This request is expired or has already been used.<br>Please go back to the application and retry."),
+	})
+}
+
+type MagicLinkData struct {
+	AppName string
+	Email   string
+	Code    string
+
+	// The device that asked for the link
+	UserAgent string
+	IpAddress string
+
+	Token string
+}
+
+// RenderMagicLink renders the page the link inside the email opens, the
+// user needs to press the button so that link scanners inside email
+// clients can't complete the login
+func RenderMagicLink(w io.Writer, data MagicLinkData) error {
+	data.AppName = authlab.AppName
+	return templates.ExecuteTemplate(w, "magic_link", data)
+}
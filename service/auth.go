@@ -2,17 +2,23 @@ package service
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/nanoteck137/authlab/config"
 	"github.com/nanoteck137/authlab/database"
 	"github.com/nanoteck137/authlab/tools/utils"
+	"github.com/nanoteck137/authlab/types"
 	"golang.org/x/oauth2"
 )
 
@@ -25,6 +31,10 @@ func (e *ServiceError) Error() string {
 	return fmt.Sprintf("%s: %s", e.Service, e.Err)
 }
 
+func (e *ServiceError) Unwrap() error {
+	return e.Err
+}
+
 type ServiceErrCreator struct {
 	Service string
 }
@@ -59,6 +69,16 @@ var (
 	ErrAuthServiceRequestExpired       = authErr.Error("request is expired")
 	ErrAuthServiceRequestNotReady      = authErr.Error("request is not ready")
 	ErrAuthServiceRequestInvalid       = authErr.Error("request is invalid")
+	ErrAuthServiceRequestDenied        = authErr.Error("request was denied")
+	ErrAuthServiceRequestAlreadyUsed   = authErr.Error("request is already used")
+
+	ErrAuthServiceInvalidState     = authErr.Error("invalid state")
+	ErrAuthServiceProviderMismatch = authErr.Error("provider mismatch")
+
+	ErrAuthServiceInvalidIdToken = authErr.Error("invalid id token")
+
+	ErrAuthServiceAuthorizationPending = authErr.Error("authorization pending")
+	ErrAuthServiceSlowDown             = authErr.Error("polling too fast")
 )
 
 const (
@@ -67,6 +87,11 @@ const (
 
 	authQuickRequestExpireDuration   = 5 * time.Minute
 	authQuickRequestDeletionDuration = authQuickRequestExpireDuration + 10*time.Minute
+
+	// The minimum amount of time device clients should wait between
+	// polling requests, and how much it's increased by on "slow_down"
+	authQuickRequestPollInterval         = 5 * time.Second
+	authQuickRequestPollIntervalIncrease = 5 * time.Second
 )
 
 type AuthProviderRequestStatus string
@@ -76,6 +101,10 @@ const (
 	AuthProviderRequestStatusCompleted AuthProviderRequestStatus = "completed"
 	AuthProviderRequestStatusExpired   AuthProviderRequestStatus = "expired"
 	AuthProviderRequestStatusFailed    AuthProviderRequestStatus = "failed"
+
+	// The ID token from the provider failed validation, (nonce, at_hash,
+	// auth_time or acr mismatch)
+	AuthProviderRequestStatusInvalidToken AuthProviderRequestStatus = "invalid_token"
 )
 
 type AuthQuickRequestStatus string
@@ -85,6 +114,7 @@ const (
 	AuthQuickRequestStatusCompleted AuthQuickRequestStatus = "completed"
 	AuthQuickRequestStatusExpired   AuthQuickRequestStatus = "expired"
 	AuthQuickRequestStatusFailed    AuthQuickRequestStatus = "failed"
+	AuthQuickRequestStatusDenied    AuthQuickRequestStatus = "denied"
 )
 
 // authProviderRequest holds the infomation for a provider auth request
@@ -110,6 +140,15 @@ type authProviderRequest struct {
 	// token based on the code
 	oauth2Code string
 
+	// The PKCE code verifier for this request, the S256 challenge of this
+	// is sent to the provider and the verifier is sent when exchanging
+	// the code. Empty if PKCE is disabled for the provider
+	pkceVerifier string
+
+	// The nonce sent with the auth url, the ID token returned by the
+	// provider needs to contain the same nonce
+	nonce string
+
 	// The timestamp for when this request is invalid
 	expires time.Time
 
@@ -117,6 +156,23 @@ type authProviderRequest struct {
 	delete time.Time
 }
 
+func providerRequestFromDb(request database.AuthProviderRequest) *authProviderRequest {
+	return &authProviderRequest{
+		id:         request.Id,
+		providerId: request.ProviderId,
+		status:     AuthProviderRequestStatus(request.Status),
+		challenge:  request.Challenge,
+		oauth2Url:  request.OAuth2Url,
+		oauth2Code: request.OAuth2Code.String,
+
+		pkceVerifier: request.PkceVerifier,
+		nonce:        request.Nonce,
+
+		expires: time.UnixMilli(request.Expires),
+		delete:  time.UnixMilli(request.DeleteAt),
+	}
+}
+
 // authProvider hold infomation about the OAuth2/OIDC provider
 type authProvider struct {
 	// If the provider has been initialized
@@ -134,6 +190,10 @@ type authProvider struct {
 	// The OIDC provider object
 	provider     *oidc.Provider
 
+	// The issuer from the discovery document of the provider, this is
+	// what the provider puts in the "iss" parameter and claim
+	issuer string
+
 	// The OAuth2 config object
 	oauth2Config *oauth2.Config
 
@@ -146,13 +206,28 @@ func (p *authProvider) init(ctx context.Context) error {
 		return nil
 	}
 
-	var err error
+	// NOTE(patrik): Some providers normalizes the issuer inside the
+	// discovery document (e.g. adds a trailing slash), so the exact check
+	// of go-oidc is skipped and the issuer from the document is used to
+	// verify the ID tokens and the "iss" parameter
+	discovered, err := oidc.NewProvider(oidc.InsecureIssuerURLContext(ctx, p.config.IssuerUrl), p.config.IssuerUrl)
+	if err != nil {
+		return err
+	}
 
-	p.provider, err = oidc.NewProvider(ctx, p.config.IssuerUrl)
+	var providerConfig oidc.ProviderConfig
+	err = discovered.Claims(&providerConfig)
 	if err != nil {
 		return err
 	}
 
+	if strings.TrimSuffix(providerConfig.IssuerURL, "/") != strings.TrimSuffix(p.config.IssuerUrl, "/") {
+		return fmt.Errorf("issuer %q from the discovery document doesn't match issuer_url %q", providerConfig.IssuerURL, p.config.IssuerUrl)
+	}
+
+	p.provider = providerConfig.NewProvider(ctx)
+	p.issuer = providerConfig.IssuerURL
+
 	p.oauth2Config = &oauth2.Config{
 		ClientID:     p.config.ClientId,
 		ClientSecret: p.config.ClientSecret,
@@ -168,16 +243,63 @@ func (p *authProvider) init(ctx context.Context) error {
 	return nil
 }
 
+// The allowed clock skew when checking the time based claims of ID tokens
+const idTokenClockSkew = 2 * time.Minute
+
+// claimBool is a bool claim that also accepts the string form, some
+// providers sends "true" instead of true
+type claimBool bool
+
+func (b *claimBool) UnmarshalJSON(data []byte) error {
+	*b = string(data) == "true" || string(data) == `"true"`
+	return nil
+}
+
 type providerClaim struct {
 	Email       string `json:"email"`
 	Name        string `json:"name"`
 	DisplayName string `json:"display_name"`
 	Picture     string `json:"picture"`
 	Sub         string `json:"sub"`
+
+	EmailVerified claimBool `json:"email_verified"`
+
+	AuthTime int64  `json:"auth_time"`
+	Acr      string `json:"acr"`
 }
 
-func (p *authProvider) claim(ctx context.Context, code string) (providerClaim, error) {
-	oauth2Token, err := p.oauth2Config.Exchange(ctx, code)
+// authCodeOptions returns the extra options that should be added to the
+// auth url for the request
+func (p *authProvider) authCodeOptions(request *authProviderRequest) []oauth2.AuthCodeOption {
+	opts := []oauth2.AuthCodeOption{
+		oidc.Nonce(request.nonce),
+	}
+
+	if request.pkceVerifier != "" {
+		opts = append(opts, oauth2.S256ChallengeOption(request.pkceVerifier))
+	}
+
+	if len(p.config.AcrValues) > 0 {
+		opts = append(opts, oauth2.SetAuthURLParam("acr_values", strings.Join(p.config.AcrValues, " ")))
+	}
+
+	if p.config.MaxAge > 0 {
+		opts = append(opts, oauth2.SetAuthURLParam("max_age", strconv.Itoa(p.config.MaxAge)))
+	}
+
+	return opts
+}
+
+// claim exchanges the code for the tokens and returns the claims of the
+// ID token, validation errors of the ID token is returned as
+// ErrAuthServiceInvalidIdToken
+func (p *authProvider) claim(ctx context.Context, code string, request *authProviderRequest) (providerClaim, error) {
+	var opts []oauth2.AuthCodeOption
+	if request.pkceVerifier != "" {
+		opts = append(opts, oauth2.VerifierOption(request.pkceVerifier))
+	}
+
+	oauth2Token, err := p.oauth2Config.Exchange(ctx, code, opts...)
 	if err != nil {
 		return providerClaim{}, err
 	}
@@ -189,7 +311,21 @@ func (p *authProvider) claim(ctx context.Context, code string) (providerClaim, e
 
 	idToken, err := p.verifier.Verify(ctx, rawIDToken)
 	if err != nil {
-		return providerClaim{}, err
+		return providerClaim{}, fmt.Errorf("%w: %w", ErrAuthServiceInvalidIdToken, err)
+	}
+
+	// Check that the ID token belongs to this request
+	if idToken.Nonce != request.nonce {
+		return providerClaim{}, fmt.Errorf("%w: nonce mismatch", ErrAuthServiceInvalidIdToken)
+	}
+
+	// The at_hash claim is optional for the code flow, but if it's
+	// present then it needs to match the access token
+	if idToken.AccessTokenHash != "" {
+		err := idToken.VerifyAccessToken(oauth2Token.AccessToken)
+		if err != nil {
+			return providerClaim{}, fmt.Errorf("%w: %w", ErrAuthServiceInvalidIdToken, err)
+		}
 	}
 
 	var claims providerClaim
@@ -198,9 +334,47 @@ func (p *authProvider) claim(ctx context.Context, code string) (providerClaim, e
 		return providerClaim{}, err
 	}
 
+	err = p.validateClaims(claims)
+	if err != nil {
+		return providerClaim{}, fmt.Errorf("%w: %w", ErrAuthServiceInvalidIdToken, err)
+	}
+
 	return claims, nil
 }
 
+// validateClaims checks the auth_time and acr claims against the
+// provider config
+func (p *authProvider) validateClaims(claims providerClaim) error {
+	now := time.Now()
+
+	if claims.AuthTime != 0 {
+		authTime := time.Unix(claims.AuthTime, 0)
+		if authTime.After(now.Add(idTokenClockSkew)) {
+			return errors.New("auth_time is in the future")
+		}
+	}
+
+	if p.config.MaxAge > 0 {
+		if claims.AuthTime == 0 {
+			return errors.New("missing auth_time")
+		}
+
+		maxAge := time.Duration(p.config.MaxAge) * time.Second
+		authTime := time.Unix(claims.AuthTime, 0)
+		if now.Sub(authTime) > maxAge+idTokenClockSkew {
+			return errors.New("auth_time is too old")
+		}
+	}
+
+	if len(p.config.AcrValues) > 0 {
+		if !slices.Contains(p.config.AcrValues, claims.Acr) {
+			return fmt.Errorf("acr %q is not allowed", claims.Acr)
+		}
+	}
+
+	return nil
+}
+
 type authQuickConnectRequest struct {
 	// the status of the request
 	status AuthQuickRequestStatus
@@ -218,6 +392,19 @@ type authQuickConnectRequest struct {
 	// the user that authorized the request
 	userId string
 
+	// The OAuth2 client that started the request, only set for requests
+	// created through the device authorization endpoint
+	clientId string
+
+	// The scope requested by the device client
+	scope string
+
+	// The minimum interval the device client should poll with
+	pollInterval time.Duration
+
+	// The last time the device client polled the token endpoint
+	lastPolled time.Time
+
 	// the expiry date of this request
 	expires time.Time
 
@@ -225,27 +412,77 @@ type authQuickConnectRequest struct {
 	delete time.Time
 }
 
+func quickConnectRequestFromDb(request database.AuthQuickConnectRequest) *authQuickConnectRequest {
+	return &authQuickConnectRequest{
+		status:    AuthQuickRequestStatus(request.Status),
+		code:      request.Code,
+		challenge: request.Challenge,
+		userId:    request.UserId.String,
+
+		clientId:     request.ClientId.String,
+		scope:        request.Scope,
+		pollInterval: time.Duration(request.PollInterval) * time.Second,
+		lastPolled:   time.UnixMilli(request.LastPolled),
+
+		expires: time.UnixMilli(request.Expires),
+		delete:  time.UnixMilli(request.DeleteAt),
+	}
+}
+
 type AuthService struct {
 	// The lock for the service, needs to be claimed when modifing request data
 	mu sync.Mutex
 
-	// Reference to the database
+	// Reference to the database, all the provider and quick connect
+	// requests are stored inside the database so that they survive
+	// restarts of the server
 	db *database.Database
 
-	// the jwt secret used to sign user tokens
-	jwtSecret string
+	// the keys used to sign user tokens
+	keys *KeyService
+
+	// the key used to sign the OAuth2 state sent to the providers
+	stateKey []byte
+
+	// if the users can sign up and log in with a password, and the
+	// parameters used to hash the passwords
+	localAccounts   bool
+	passwordHashing config.ConfigPasswordHashing
+
+	// if the users can log in with a link sent to the email, and the key
+	// used to sign the links
+	magicLinks   bool
+	magicLinkKey []byte
+
+	// if the users needs a verified email to log in
+	requireVerifiedEmail bool
+
+	// the key used to encrypt the TOTP secrets, stored inside the keys
+	// directory so it doesn't change with the jwt_secret
+	totpKey []byte
+
+	// the relying party for the passkeys, nil when the passkeys are
+	// disabled
+	webauthn *webauthn.WebAuthn
+
+	// the key used to sign the session cookies of the forward auth
+	// endpoint, and the rules for the hosts behind the reverse proxy
+	forwardKey  []byte
+	forwardAuth config.ConfigForwardAuth
+
+	// how long the access tokens and refresh tokens are valid for
+	accessTokenDuration  time.Duration
+	refreshTokenDuration time.Duration
 
 	// The available providers
 	providers map[string]*authProvider
 
-	// All the provider based requests
-	ProviderRequests map[string]*authProviderRequest
-
-	// All the quick connect based requests
-	QuickConnectRequests map[string]*authQuickConnectRequest
+	// The clients from the config file, the rest of the clients are
+	// stored inside the database
+	clients map[string]*OAuthClient
 }
 
-func NewAuthService(db *database.Database, config *config.Config) *AuthService {
+func NewAuthService(db *database.Database, keys *KeyService, config *config.Config) (*AuthService, error) {
 	providers := make(map[string]*authProvider, len(config.OidcProviders))
 
 	for id, providerConfig := range config.OidcProviders {
@@ -258,13 +495,147 @@ func NewAuthService(db *database.Database, config *config.Config) *AuthService {
 		providers[id] = res
 	}
 
-	return &AuthService{
-		db:                   db,
-		jwtSecret:            config.JwtSecret,
-		providers:            providers,
-		ProviderRequests:     make(map[string]*authProviderRequest),
-		QuickConnectRequests: make(map[string]*authQuickConnectRequest),
+	clients, err := newOAuthClients(config.OAuthClients)
+	if err != nil {
+		return nil, err
+	}
+
+	var relyingParty *webauthn.WebAuthn
+	if config.EnablePasskeys {
+		relyingParty, err = newWebAuthn(config.PublicUrl)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	totpKey, totpKeyCreated, err := keys.EncryptionKey("totp")
+	if err != nil {
+		return nil, err
 	}
+
+	a := &AuthService{
+		db:        db,
+		keys:      keys,
+		stateKey:  deriveKey(config.JwtSecret, "authlab-oauth2-state"),
+		providers: providers,
+		clients:   clients,
+
+		localAccounts:   config.EnableLocalAccounts,
+		passwordHashing: config.PasswordHashing,
+
+		magicLinks:   config.EnableMagicLinks,
+		magicLinkKey: deriveKey(config.JwtSecret, "authlab-magic-link"),
+
+		requireVerifiedEmail: config.RequireVerifiedEmail,
+
+		totpKey: totpKey,
+
+		webauthn: relyingParty,
+
+		forwardKey:  deriveKey(config.JwtSecret, "authlab-forward-session"),
+		forwardAuth: config.ForwardAuth,
+
+		accessTokenDuration:  config.AccessTokenDuration,
+		refreshTokenDuration: config.RefreshTokenDuration,
+	}
+
+	// NOTE(patrik): The TOTP secrets used to be encrypted with a key
+	// derived from the jwt_secret
+	if totpKeyCreated {
+		err := a.reencryptTotpSecrets(context.Background(), deriveKey(config.JwtSecret, "authlab-totp"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return a, nil
+}
+
+// getProviderRequest loads the provider request from the database
+func (a *AuthService) getProviderRequest(ctx context.Context, requestId string) (*authProviderRequest, error) {
+	request, err := a.db.GetAuthProviderRequestById(ctx, requestId)
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return nil, ErrAuthServiceRequestNotFound
+		}
+
+		return nil, authErr.Errorf("get provider request: %w", err)
+	}
+
+	return providerRequestFromDb(request), nil
+}
+
+// setProviderRequestStatus updates the status of the request, both the
+// local copy and the database entry
+func (a *AuthService) setProviderRequestStatus(ctx context.Context, request *authProviderRequest, status AuthProviderRequestStatus) error {
+	err := a.db.UpdateAuthProviderRequest(ctx, request.id, database.AuthProviderRequestChanges{
+		Status: types.Change[string]{
+			Value:   string(status),
+			Changed: true,
+		},
+	})
+	if err != nil {
+		return authErr.Errorf("update provider request: %w", err)
+	}
+
+	request.status = status
+
+	return nil
+}
+
+// getQuickConnectRequest loads the quick connect request from the database
+func (a *AuthService) getQuickConnectRequest(ctx context.Context, requestCode string) (*authQuickConnectRequest, error) {
+	request, err := a.db.GetAuthQuickConnectRequestByCode(ctx, requestCode)
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return nil, ErrAuthServiceRequestNotFound
+		}
+
+		return nil, authErr.Errorf("get quick connect request: %w", err)
+	}
+
+	return quickConnectRequestFromDb(request), nil
+}
+
+// setQuickConnectRequestStatus updates the status of the request, both the
+// local copy and the database entry
+func (a *AuthService) setQuickConnectRequestStatus(ctx context.Context, request *authQuickConnectRequest, status AuthQuickRequestStatus) error {
+	err := a.db.UpdateAuthQuickConnectRequest(ctx, request.code, database.AuthQuickConnectRequestChanges{
+		Status: types.Change[string]{
+			Value:   string(status),
+			Changed: true,
+		},
+	})
+	if err != nil {
+		return authErr.Errorf("update quick connect request: %w", err)
+	}
+
+	request.status = status
+
+	return nil
+}
+
+// expireCompletedQuickConnectRequest sets the status of a completed
+// request to expired, returns false if the request was no longer
+// completed. Used before the tokens are issued so that only one caller
+// can get the tokens, even when the request is used by multiple
+// instances of the server at the same time.
+func (a *AuthService) expireCompletedQuickConnectRequest(ctx context.Context, request *authQuickConnectRequest) (bool, error) {
+	updated, err := a.db.UpdateAuthQuickConnectRequestWithStatus(ctx, request.code, string(AuthQuickRequestStatusCompleted), database.AuthQuickConnectRequestChanges{
+		Status: types.Change[string]{
+			Value:   string(AuthQuickRequestStatusExpired),
+			Changed: true,
+		},
+	})
+	if err != nil {
+		return false, authErr.Errorf("update quick connect request: %w", err)
+	}
+
+	if updated {
+		request.status = AuthQuickRequestStatusExpired
+	}
+
+	return updated, nil
 }
 
 // ProviderRequestResult is the structure returned by CreateProviderRequest
@@ -322,18 +693,50 @@ func (a *AuthService) CreateProviderRequest(providerId string) (ProviderRequestR
 		delete:     t.Add(authProviderRequestDeletionDuration),
 	}
 
+	// Generate the PKCE verifier, the S256 challenge is sent with
+	// the auth url
+	if !provider.config.DisablePkce {
+		request.pkceVerifier = oauth2.GenerateVerifier()
+	}
+
+	// Generate the nonce used to bind the ID token to this request
+	request.nonce, err = utils.GenerateAuthChallenge()
+	if err != nil {
+		return ProviderRequestResult{}, authErr.Errorf("generate nonce: %w", err)
+	}
+
+	// Generate the signed state, this is used instead of the request id
+	// so that only we can create a valid state for the request
+	state, err := a.signProviderState(request)
+	if err != nil {
+		return ProviderRequestResult{}, authErr.Errorf("sign state: %w", err)
+	}
+
 	// Generate the OAuth2 URL so that the frontend can redirect/open window
 	// with this url
-	request.oauth2Url = provider.oauth2Config.AuthCodeURL(request.id)
+	request.oauth2Url = provider.oauth2Config.AuthCodeURL(state, provider.authCodeOptions(request)...)
 
-	// Check if the request id is already used
-	_, exists = a.ProviderRequests[id]
-	if exists {
-		return ProviderRequestResult{}, ErrAuthServiceRequestAlreadyExists
-	}
+	// Save the request, this fails if the request id is already used
+	err = a.db.CreateAuthProviderRequest(context.TODO(), database.CreateAuthProviderRequestParams{
+		Id:         request.id,
+		ProviderId: request.providerId,
+		Status:     string(request.status),
+		Challenge:  request.challenge,
+		OAuth2Url:  request.oauth2Url,
 
-	// Save the request
-	a.ProviderRequests[id] = request
+		PkceVerifier: request.pkceVerifier,
+		Nonce:        request.nonce,
+
+		Expires:  request.expires.UnixMilli(),
+		DeleteAt: request.delete.UnixMilli(),
+	})
+	if err != nil {
+		if errors.Is(err, database.ErrItemAlreadyExists) {
+			return ProviderRequestResult{}, ErrAuthServiceRequestAlreadyExists
+		}
+
+		return ProviderRequestResult{}, authErr.Errorf("create provider request: %w", err)
+	}
 
 	return ProviderRequestResult{
 		RequestId: request.id,
@@ -353,6 +756,9 @@ type QuickConnectRequestResult struct {
 	// The challenge code used to varify request calls
 	Challenge string
 
+	// The minimum interval between polling calls
+	Interval time.Duration
+
 	// The timestamp when this request expires
 	Expires time.Time
 }
@@ -360,6 +766,30 @@ type QuickConnectRequestResult struct {
 // CreateQuickConnectRequest creates a quick connect request and returns some
 // data about the request so that the user can complete the request
 func (a *AuthService) CreateQuickConnectRequest() (QuickConnectRequestResult, error) {
+	return a.createQuickConnectRequest("", "")
+}
+
+// CreateDeviceAuthorization creates a quick connect request for a
+// OAuth2 device client (RFC 8628), the challenge of the request is used
+// as the device code
+func (a *AuthService) CreateDeviceAuthorization(client *OAuthClient, scope string) (QuickConnectRequestResult, error) {
+	if !client.HasGrantType(GrantTypeDeviceCode) {
+		return QuickConnectRequestResult{}, ErrAuthServiceUnauthorizedClient
+	}
+
+	scopes, err := ParseScope(scope)
+	if err != nil {
+		return QuickConnectRequestResult{}, err
+	}
+
+	if !client.HasScopes(scopes) {
+		return QuickConnectRequestResult{}, ErrAuthServiceInvalidScope
+	}
+
+	return a.createQuickConnectRequest(client.Id, strings.Join(scopes, " "))
+}
+
+func (a *AuthService) createQuickConnectRequest(clientId, scope string) (QuickConnectRequestResult, error) {
 	// Generate the unique code for this quick connect request
 	code, err := utils.GenerateCode()
 	if err != nil {
@@ -375,28 +805,45 @@ func (a *AuthService) CreateQuickConnectRequest() (QuickConnectRequestResult, er
 	// Create the request
 	t := time.Now()
 	request := &authQuickConnectRequest{
-		status:    AuthQuickRequestStatusPending,
-		code:      code,
-		challenge: challenge,
-		expires:   t.Add(authQuickRequestExpireDuration),
-		delete:    t.Add(authQuickRequestDeletionDuration),
+		status:       AuthQuickRequestStatusPending,
+		code:         code,
+		challenge:    challenge,
+		clientId:     clientId,
+		scope:        scope,
+		pollInterval: authQuickRequestPollInterval,
+		expires:      t.Add(authQuickRequestExpireDuration),
+		delete:       t.Add(authQuickRequestDeletionDuration),
 	}
 
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	// Check if the code is already used
-	_, exists := a.QuickConnectRequests[code]
-	if exists {
-		return QuickConnectRequestResult{}, err
-	}
+	// Save the request, this fails if the code is already used
+	err = a.db.CreateAuthQuickConnectRequest(context.TODO(), database.CreateAuthQuickConnectRequestParams{
+		Code:      request.code,
+		Status:    string(request.status),
+		Challenge: request.challenge,
+		ClientId: sql.NullString{
+			String: request.clientId,
+			Valid:  request.clientId != "",
+		},
+		Scope:        request.scope,
+		PollInterval: int64(request.pollInterval / time.Second),
+		Expires:      request.expires.UnixMilli(),
+		DeleteAt:     request.delete.UnixMilli(),
+	})
+	if err != nil {
+		if errors.Is(err, database.ErrItemAlreadyExists) {
+			return QuickConnectRequestResult{}, ErrAuthServiceRequestAlreadyExists
+		}
 
-	// Save the request
-	a.QuickConnectRequests[code] = request
+		return QuickConnectRequestResult{}, authErr.Errorf("create quick connect request: %w", err)
+	}
 
 	return QuickConnectRequestResult{
 		Code:      request.code,
 		Challenge: request.challenge,
+		Interval:  request.pollInterval,
 		Expires:   request.expires,
 	}, nil
 }
@@ -408,54 +855,191 @@ func (a *AuthService) CompleteQuickConnectRequest(requestCode, userId string) er
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
+	ctx := context.TODO()
+
 	// Get the request
-	request, exists := a.QuickConnectRequests[requestCode]
-	if !exists {
-		return ErrAuthServiceRequestNotFound
+	request, err := a.getQuickConnectRequest(ctx, requestCode)
+	if err != nil {
+		return err
 	}
 
 	// Check if the request is expired and update the status
 	if time.Now().After(request.expires) {
-		request.status = AuthQuickRequestStatusExpired
+		err := a.setQuickConnectRequestStatus(ctx, request, AuthQuickRequestStatusExpired)
+		if err != nil {
+			return err
+		}
+
 		return ErrAuthServiceRequestExpired
 	}
 
 	// Check if the request is pending and update the status +
-	// save the userId
+	// save the userId, the update only happens if the request is still
+	// pending so another user can't replace the user of the request
 	if request.status == AuthQuickRequestStatusPending {
-		request.status = AuthQuickRequestStatusCompleted
-		request.userId = userId
+		updated, err := a.db.UpdateAuthQuickConnectRequestWithStatus(ctx, request.code, string(AuthQuickRequestStatusPending), database.AuthQuickConnectRequestChanges{
+			Status: types.Change[string]{
+				Value:   string(AuthQuickRequestStatusCompleted),
+				Changed: true,
+			},
+			UserId: types.Change[sql.NullString]{
+				Value: sql.NullString{
+					String: userId,
+					Valid:  true,
+				},
+				Changed: true,
+			},
+		})
+		if err != nil {
+			return authErr.Errorf("update quick connect request: %w", err)
+		}
+
+		if !updated {
+			return ErrAuthServiceRequestAlreadyUsed
+		}
 	}
 
 	return nil
 }
 
+// ProviderCallback holds the query parameters the provider sends to the
+// callback endpoint
+type ProviderCallback struct {
+	// The signed state we sent with the auth url
+	State string
+
+	// The authorization code, empty if the provider returned an error
+	Code string
+
+	// The "iss" parameter (RFC 9207), empty if the provider doesn't
+	// support it
+	Issuer string
+
+	// The "error" and "error_description" parameters, set when the
+	// provider fails or the user denies the request
+	Error            string
+	ErrorDescription string
+}
+
+// ProviderCallbackError is returned by CompleteProviderRequest when the
+// provider sent back an error instead of a code
+type ProviderCallbackError struct {
+	Code        string
+	Description string
+}
+
+func (e *ProviderCallbackError) Error() string {
+	return fmt.Sprintf("provider returned error: %s: %s", e.Code, e.Description)
+}
+
 // CompleteProviderRequest this is called after we get the code from
 // the OAuth2 provider and with the code we now can set the request status
 // to completed and later call CreateAuthTokenForProvider to
-// generate the user token
-func (a *AuthService) CompleteProviderRequest(requestId, code string) error {
+// generate the user token. The state is verified before anything is done
+// with the request and the request can only be completed once
+func (a *AuthService) CompleteProviderRequest(callback ProviderCallback) error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
+	ctx := context.TODO()
+
+	// Verify the signature of the state, this is the only way to get
+	// the request id
+	state, err := a.verifyProviderState(callback.State)
+	if err != nil {
+		if errors.Is(err, errSignedPayloadExpired) {
+			return ErrAuthServiceRequestExpired
+		}
+
+		return ErrAuthServiceInvalidState
+	}
+
 	// Get the request
-	request, exists := a.ProviderRequests[requestId]
+	request, err := a.getProviderRequest(ctx, state.RequestId)
+	if err != nil {
+		return err
+	}
+
+	// Check that the callback is for the same provider that the
+	// request was created for
+	if request.providerId != state.ProviderId {
+		return ErrAuthServiceProviderMismatch
+	}
+
+	provider, exists := a.providers[request.providerId]
 	if !exists {
-		return ErrAuthServiceRequestNotFound
+		return ErrAuthServiceProviderNotFound
+	}
+
+	// The request can be created by another instance of the server so
+	// we need to make sure that the provider is initialized
+	err = provider.init(ctx)
+	if err != nil {
+		return authErr.Errorf("initialize AuthProvider(%s): %w", provider.id, err)
+	}
+
+	// If the provider tells us the issuer then it needs to match the
+	// issuer from the discovery document, the same issuer the ID token
+	// is verified against
+	if callback.Issuer != "" && callback.Issuer != provider.issuer {
+		return ErrAuthServiceProviderMismatch
 	}
 
 	// Check if the request is expired and update the request status
 	// if it is expired
 	if time.Now().After(request.expires) {
-		request.status = AuthProviderRequestStatusExpired
+		err := a.setProviderRequestStatus(ctx, request, AuthProviderRequestStatusExpired)
+		if err != nil {
+			return err
+		}
+
 		return ErrAuthServiceRequestExpired
 	}
 
-	// Check for if the request status is pending and then set the status to
-	// completed and saves the code for later use
-	if request.status == AuthProviderRequestStatusPending {
-		request.status = AuthProviderRequestStatusCompleted
-		request.oauth2Code = code
+	// The provider returned an error, so mark the request as failed
+	if callback.Error != "" {
+		_, err := a.db.UpdateAuthProviderRequestWithStatus(ctx, request.id, string(AuthProviderRequestStatusPending), database.AuthProviderRequestChanges{
+			Status: types.Change[string]{
+				Value:   string(AuthProviderRequestStatusFailed),
+				Changed: true,
+			},
+		})
+		if err != nil {
+			return authErr.Errorf("update provider request: %w", err)
+		}
+
+		return &ProviderCallbackError{
+			Code:        callback.Error,
+			Description: callback.ErrorDescription,
+		}
+	}
+
+	if callback.Code == "" {
+		return ErrAuthServiceRequestInvalid
+	}
+
+	// Set the status to completed and save the code for later use, but
+	// only if the request is still pending so that the request can
+	// only be completed once
+	updated, err := a.db.UpdateAuthProviderRequestWithStatus(ctx, request.id, string(AuthProviderRequestStatusPending), database.AuthProviderRequestChanges{
+		Status: types.Change[string]{
+			Value:   string(AuthProviderRequestStatusCompleted),
+			Changed: true,
+		},
+		OAuth2Code: types.Change[sql.NullString]{
+			Value: sql.NullString{
+				String: callback.Code,
+				Valid:  true,
+			},
+			Changed: true,
+		},
+	})
+	if err != nil {
+		return authErr.Errorf("update provider request: %w", err)
+	}
+
+	if !updated {
+		return ErrAuthServiceRequestAlreadyUsed
 	}
 
 	return nil
@@ -467,10 +1051,12 @@ func (a *AuthService) CheckProviderRequestStatus(requestId, challenge string) (A
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
+	ctx := context.TODO()
+
 	// Get the request
-	request, exists := a.ProviderRequests[requestId]
-	if !exists {
-		return AuthProviderRequestStatusFailed, ErrAuthServiceRequestNotFound
+	request, err := a.getProviderRequest(ctx, requestId)
+	if err != nil {
+		return AuthProviderRequestStatusFailed, err
 	}
 
 	// Test the challenge
@@ -482,8 +1068,11 @@ func (a *AuthService) CheckProviderRequestStatus(requestId, challenge string) (A
 	// Check if the request is expired, and if it is set the request
 	// status to expired
 	now := time.Now()
-	if now.After(request.expires) {
-		request.status = AuthProviderRequestStatusExpired
+	if now.After(request.expires) && request.status != AuthProviderRequestStatusExpired {
+		err := a.setProviderRequestStatus(ctx, request, AuthProviderRequestStatusExpired)
+		if err != nil {
+			return AuthProviderRequestStatusFailed, err
+		}
 	}
 
 	return request.status, nil
@@ -495,10 +1084,12 @@ func (a *AuthService) CheckQuickConnectRequestStatus(requestCode, challenge stri
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
+	ctx := context.TODO()
+
 	// Get the request
-	request, exists := a.QuickConnectRequests[requestCode]
-	if !exists {
-		return AuthQuickRequestStatusFailed, ErrAuthServiceRequestNotFound
+	request, err := a.getQuickConnectRequest(ctx, requestCode)
+	if err != nil {
+		return AuthQuickRequestStatusFailed, err
 	}
 
 	// Test the challenge
@@ -509,58 +1100,102 @@ func (a *AuthService) CheckQuickConnectRequestStatus(requestCode, challenge stri
 	// Check if the request is expired, and if it is set the request
 	// status to expired
 	now := time.Now()
-	if now.After(request.expires) {
-		request.status = AuthQuickRequestStatusExpired
+	if now.After(request.expires) && request.status != AuthQuickRequestStatusExpired {
+		err := a.setQuickConnectRequestStatus(ctx, request, AuthQuickRequestStatusExpired)
+		if err != nil {
+			return AuthQuickRequestStatusFailed, err
+		}
 	}
 
 	return request.status, nil
 }
 
-// CreateAuthTokenForProvider create a user JWT token if the quick connect
+// CreateAuthTokenForProvider create the user tokens if the provider
 // request is complete, otherwise return error
 //
 // Thread-safe: locks the service
-func (a *AuthService) CreateAuthTokenForProvider(requestId, challenge string) (string, error) {
+func (a *AuthService) CreateAuthTokenForProvider(requestId, challenge string, info ClientInfo) (UserTokens, error) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
+	ctx := context.TODO()
+
 	// Get the request
-	request, exists := a.ProviderRequests[requestId]
-	if !exists {
-		return "", ErrAuthServiceRequestNotFound
+	request, err := a.getProviderRequest(ctx, requestId)
+	if err != nil {
+		return UserTokens{}, err
 	}
 
 	// Test the challenge
 	if request.challenge != challenge {
-		return "", ErrAuthServiceRequestNotFound
+		return UserTokens{}, ErrAuthServiceRequestNotFound
 	}
 
 	// Check the request status for completed
 	if request.status != AuthProviderRequestStatusCompleted {
-		return "", ErrAuthServiceRequestNotReady
+		return UserTokens{}, ErrAuthServiceRequestNotReady
 	}
 
-	// TODO(patrik): Check provider?
-	// Get the provider from the request
-	provider := a.providers[request.providerId]
+	// Get the provider from the request, the provider can be missing if
+	// the config changed between the request being created and now
+	provider, exists := a.providers[request.providerId]
+	if !exists {
+		a.setProviderRequestStatus(ctx, request, AuthProviderRequestStatusFailed)
+		return UserTokens{}, ErrAuthServiceProviderNotFound
+	}
+
+	// The request can be created by another instance of the server so
+	// we need to make sure that the provider is initialized
+	err = provider.init(ctx)
+	if err != nil {
+		a.setProviderRequestStatus(ctx, request, AuthProviderRequestStatusFailed)
+		return UserTokens{}, authErr.Errorf("initialize AuthProvider(%s): %w", provider.id, err)
+	}
 
 	// Check if the OAuth2Code is set, this should be set after the
 	// OAuth2 callback
 	if request.oauth2Code == "" {
 		// Set the request status to failed, because we have
 		// encountered an error with the OAuth2 code
-		request.status = AuthProviderRequestStatusFailed
-		return "", ErrAuthServiceRequestInvalid
+		a.setProviderRequestStatus(ctx, request, AuthProviderRequestStatusFailed)
+		return UserTokens{}, ErrAuthServiceRequestInvalid
 	}
 
+	// Set the request status to be expired so that we can't generate
+	// the token after this, the code can only be exchanged once. The
+	// status is only changed if the request is still completed so only
+	// one instance of the server can exchange the code.
+	updated, err := a.db.UpdateAuthProviderRequestWithStatus(ctx, request.id, string(AuthProviderRequestStatusCompleted), database.AuthProviderRequestChanges{
+		Status: types.Change[string]{
+			Value:   string(AuthProviderRequestStatusExpired),
+			Changed: true,
+		},
+	})
+	if err != nil {
+		return UserTokens{}, authErr.Errorf("update provider request: %w", err)
+	}
+
+	if !updated {
+		return UserTokens{}, ErrAuthServiceRequestAlreadyUsed
+	}
+
+	request.status = AuthProviderRequestStatusExpired
+
 	// Get the user id from the OAuth2 Code that is stored in the request
 	// after the provider completes the OAuth2 request
-	userId, err := a.getUserFromCode(context.TODO(), provider, request.oauth2Code)
+	userId, err := a.getUserFromCode(ctx, provider, request)
 	if err != nil {
+		// The ID token didn't pass the validation so we give the
+		// request it's own status so the user can see what went wrong
+		if errors.Is(err, ErrAuthServiceInvalidIdToken) {
+			a.setProviderRequestStatus(ctx, request, AuthProviderRequestStatusInvalidToken)
+			return UserTokens{}, err
+		}
+
 		// Set the request status to failed, because we have
 		// encountered an error with getting the user from the provider
-		request.status = AuthProviderRequestStatusFailed
-		return "", err
+		a.setProviderRequestStatus(ctx, request, AuthProviderRequestStatusFailed)
+		return UserTokens{}, err
 	}
 
 	// Check the user id just to be sure, this is not 100% necessary
@@ -569,70 +1204,243 @@ func (a *AuthService) CreateAuthTokenForProvider(requestId, challenge string) (s
 	if userId == "" {
 		// Set the request status to failed, because we have
 		// encountered an error with getting the user from the provider
-		request.status = AuthProviderRequestStatusFailed
-		return "", ErrAuthServiceRequestInvalid
+		a.setProviderRequestStatus(ctx, request, AuthProviderRequestStatusFailed)
+		return UserTokens{}, ErrAuthServiceRequestInvalid
 	}
 
-	// Set the request status to be expired so that we can't generate
-	// the token after this
-	request.status = AuthProviderRequestStatusExpired
-
-	// Create the JWT token for the user
-	token, err := a.SignUserToken(userId)
+	// Create the JWT tokens for the user
+	tokens, err := a.IssueLoginTokens(ctx, userId, AuthMethodProvider(provider.id), info)
 	if err != nil {
-		request.status = AuthProviderRequestStatusFailed
-		return "", err
+		// NOTE(patrik): The login continues with the second factor, so
+		// the request didn't fail
+		if errors.Is(err, ErrAuthServiceMfaRequired) {
+			return UserTokens{}, err
+		}
+
+		a.setProviderRequestStatus(ctx, request, AuthProviderRequestStatusFailed)
+		return UserTokens{}, err
 	}
 
-	return token, nil
+	return tokens, nil
 }
 
-// CreateAuthTokenForQuickConnect create a user JWT token if the quick connect
+// CreateAuthTokenForQuickConnect create the user tokens if the quick connect
 // request is complete, otherwise return error
 //
 // Thread-safe: locks the service
-func (a *AuthService) CreateAuthTokenForQuickConnect(requestCode, challenge string) (string, error) {
+func (a *AuthService) CreateAuthTokenForQuickConnect(requestCode, challenge string, info ClientInfo) (UserTokens, error) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
+	ctx := context.TODO()
+
 	// Get the request
-	request, exists := a.QuickConnectRequests[requestCode]
-	if !exists {
-		return "", ErrAuthServiceRequestNotFound
+	request, err := a.getQuickConnectRequest(ctx, requestCode)
+	if err != nil {
+		return UserTokens{}, err
 	}
 
 	// Test the challenge
 	if request.challenge != challenge {
-		return "", ErrAuthServiceRequestNotFound
+		return UserTokens{}, ErrAuthServiceRequestNotFound
 	}
 
 	// Check the request status for completed
 	if request.status != AuthQuickRequestStatusCompleted {
-		return "", ErrAuthServiceRequestInvalid
+		return UserTokens{}, ErrAuthServiceRequestInvalid
 	}
 
 	// Check if the userId is set because if the request is completed then
 	// this should be set after a user claims this request
 	if request.userId == "" {
-		return "", ErrAuthServiceRequestInvalid
+		return UserTokens{}, ErrAuthServiceRequestInvalid
 	}
 
 	// Set the request status to be expired so that we can't generate
 	// the token after this
-	request.status = AuthQuickRequestStatusExpired
+	updated, err := a.expireCompletedQuickConnectRequest(ctx, request)
+	if err != nil {
+		return UserTokens{}, err
+	}
+
+	if !updated {
+		return UserTokens{}, ErrAuthServiceRequestAlreadyUsed
+	}
+
+	// Create the JWT tokens for the user
+	tokens, err := a.IssueLoginTokens(ctx, request.userId, AuthMethodQuickConnect, info)
+	if err != nil {
+		return UserTokens{}, err
+	}
+
+	return tokens, nil
+}
+
+// DenyQuickConnectRequest is called when the user rejects the quick
+// connect request, the device polling the request gets "access_denied"
+func (a *AuthService) DenyQuickConnectRequest(requestCode string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	ctx := context.TODO()
+
+	// Get the request
+	request, err := a.getQuickConnectRequest(ctx, requestCode)
+	if err != nil {
+		return err
+	}
+
+	// Check if the request is expired and update the status
+	if time.Now().After(request.expires) {
+		err := a.setQuickConnectRequestStatus(ctx, request, AuthQuickRequestStatusExpired)
+		if err != nil {
+			return err
+		}
+
+		return ErrAuthServiceRequestExpired
+	}
+
+	// Only pending requests can be denied
+	if request.status != AuthQuickRequestStatusPending {
+		return ErrAuthServiceRequestInvalid
+	}
+
+	return a.setQuickConnectRequestStatus(ctx, request, AuthQuickRequestStatusDenied)
+}
+
+// CreateAuthTokenForDeviceCode is called when the device client polls the
+// token endpoint, returns the user tokens if the request is completed.
+// The errors returned maps to the RFC 8628 token endpoint errors:
+//   - ErrAuthServiceAuthorizationPending -> "authorization_pending"
+//   - ErrAuthServiceSlowDown             -> "slow_down"
+//   - ErrAuthServiceRequestExpired       -> "expired_token"
+//   - ErrAuthServiceRequestDenied        -> "access_denied"
+//   - ErrAuthServiceRequestNotFound      -> "invalid_grant"
+//
+// Returns a MfaRequiredError if the user has a second factor enabled.
+//
+// Thread-safe: locks the service
+func (a *AuthService) CreateAuthTokenForDeviceCode(client *OAuthClient, deviceCode string, info ClientInfo) (UserTokens, error) {
+	// NOTE(patrik): The client can lose the grant type after the device
+	// authorization was started
+	if !client.HasGrantType(GrantTypeDeviceCode) {
+		return UserTokens{}, ErrAuthServiceUnauthorizedClient
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	ctx := context.TODO()
+
+	// Get the request, the device code is the challenge of the request
+	dbRequest, err := a.db.GetAuthQuickConnectRequestByChallenge(ctx, deviceCode)
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return UserTokens{}, ErrAuthServiceRequestNotFound
+		}
 
-	// Create the JWT token for the user
-	token, err := a.SignUserToken(request.userId)
+		return UserTokens{}, authErr.Errorf("get quick connect request: %w", err)
+	}
+
+	request := quickConnectRequestFromDb(dbRequest)
+
+	// The device code is bound to the client that requested it
+	if request.clientId == "" || request.clientId != client.Id {
+		return UserTokens{}, ErrAuthServiceRequestNotFound
+	}
+
+	now := time.Now()
+
+	// Check if the request is expired and update the status
+	if now.After(request.expires) {
+		if request.status != AuthQuickRequestStatusExpired {
+			err := a.setQuickConnectRequestStatus(ctx, request, AuthQuickRequestStatusExpired)
+			if err != nil {
+				return UserTokens{}, err
+			}
+		}
+
+		return UserTokens{}, ErrAuthServiceRequestExpired
+	}
+
+	// Check if the client is polling faster then the interval, and if it
+	// is then increase the interval the client should use
+	changes := database.AuthQuickConnectRequestChanges{
+		LastPolled: types.Change[int64]{
+			Value:   now.UnixMilli(),
+			Changed: true,
+		},
+	}
+
+	slowDown := now.Sub(request.lastPolled) < request.pollInterval
+	if slowDown {
+		changes.PollInterval = types.Change[int64]{
+			Value:   int64((request.pollInterval + authQuickRequestPollIntervalIncrease) / time.Second),
+			Changed: true,
+		}
+	}
+
+	err = a.db.UpdateAuthQuickConnectRequest(ctx, request.code, changes)
+	if err != nil {
+		return UserTokens{}, authErr.Errorf("update quick connect request: %w", err)
+	}
+
+	if slowDown {
+		return UserTokens{}, ErrAuthServiceSlowDown
+	}
+
+	switch request.status {
+	case AuthQuickRequestStatusPending:
+		return UserTokens{}, ErrAuthServiceAuthorizationPending
+	case AuthQuickRequestStatusDenied:
+		return UserTokens{}, ErrAuthServiceRequestDenied
+	case AuthQuickRequestStatusExpired:
+		return UserTokens{}, ErrAuthServiceRequestExpired
+	case AuthQuickRequestStatusCompleted:
+	default:
+		return UserTokens{}, ErrAuthServiceRequestInvalid
+	}
+
+	// Check if the userId is set because if the request is completed then
+	// this should be set after a user claims this request
+	if request.userId == "" {
+		return UserTokens{}, ErrAuthServiceRequestInvalid
+	}
+
+	// Set the request status to be expired so that we can't generate
+	// the token after this
+	updated, err := a.expireCompletedQuickConnectRequest(ctx, request)
 	if err != nil {
-		return "", err
+		return UserTokens{}, err
 	}
 
-	return token, nil
+	// NOTE(patrik): Another poll got the tokens first
+	if !updated {
+		return UserTokens{}, ErrAuthServiceRequestExpired
+	}
+
+	// Create the JWT tokens for the user, the session is bound to the
+	// client and the scopes it requested like the sessions from the
+	// authorization code grant. If the user has a second factor then
+	// the device gets a challenge it needs to complete before the
+	// tokens are issued, the client and scopes follows the challenge
+	return a.issueLoginTokens(ctx, database.CreateSessionParams{
+		UserId:     request.userId,
+		AuthMethod: AuthMethodDeviceCode,
+		UserAgent:  info.UserAgent,
+		IpAddress:  info.IpAddress,
+		ClientId: sql.NullString{
+			String: client.Id,
+			Valid:  true,
+		},
+		Scope: request.scope,
+	})
 }
 
 // getUserFromCode tries to returns the user id after claiming the OAuth2 code
-func (a *AuthService) getUserFromCode(ctx context.Context, provider *authProvider, code string) (string, error) {
-	oidcClaims, err := provider.claim(ctx, code)
+// stored inside the request
+func (a *AuthService) getUserFromCode(ctx context.Context, provider *authProvider, request *authProviderRequest) (string, error) {
+	oidcClaims, err := provider.claim(ctx, request.oauth2Code, request)
 	if err != nil {
 		return "", authErr.Errorf("provider claim: %w", err)
 	}
@@ -641,8 +1449,20 @@ func (a *AuthService) getUserFromCode(ctx context.Context, provider *authProvide
 	getOrCreateUser := func() (string, error) {
 		// Check if the user with the email already exists
 		user, err := a.db.GetUserByEmail(ctx, oidcClaims.Email)
-		// If the user exists, just return that user id
+		// If the user exists, link the identity to that user
 		if err == nil {
+			// NOTE(patrik): Linking by the email gives the identity
+			// access to the account, so the provider needs to have
+			// verified that the email belongs to the user
+			if !oidcClaims.EmailVerified {
+				return "", ErrAuthServiceProviderEmailNotVerified
+			}
+
+			err := a.markEmailVerifiedByProof(ctx, user, provider.id, oidcClaims.Sub)
+			if err != nil {
+				return "", err
+			}
+
 			return user.Id, nil
 		}
 
@@ -659,9 +1479,10 @@ func (a *AuthService) getUserFromCode(ctx context.Context, provider *authProvide
 
 			// Create the database entry for the user
 			user, err = a.db.CreateUser(ctx, database.CreateUserParams{
-				Email:       oidcClaims.Email,
-				DisplayName: displayName,
-				Role:        "user",
+				Email:         oidcClaims.Email,
+				EmailVerified: bool(oidcClaims.EmailVerified),
+				DisplayName:   displayName,
+				Role:          "user",
 			})
 			if err != nil {
 				return "", authErr.Errorf("create user: %w", err)
@@ -676,6 +1497,11 @@ func (a *AuthService) getUserFromCode(ctx context.Context, provider *authProvide
 	identity, err := a.db.GetUserIdentity(ctx, provider.id, oidcClaims.Sub)
 	// If no error, just return the user id
 	if err == nil {
+		err := a.updateEmailVerifiedFromClaims(ctx, identity.UserId, oidcClaims)
+		if err != nil {
+			return "", err
+		}
+
 		return identity.UserId, nil
 	}
 
@@ -698,30 +1524,68 @@ func (a *AuthService) getUserFromCode(ctx context.Context, provider *authProvide
 			return "", authErr.Errorf("create user identity: %w", err)
 		}
 
+		err = a.updateEmailVerifiedFromClaims(ctx, userId, oidcClaims)
+		if err != nil {
+			return "", err
+		}
+
 		return userId, nil
 	} else {
 		return "", authErr.Errorf("get user identity: %w", err)
 	}
 }
 
-// SignUserToken generates a JWT token for the giving user id.
-// Returns the JWT token or error if the user doesn't exist or signing fails.
-func (a *AuthService) SignUserToken(userId string) (string, error) {
+// updateEmailVerifiedFromClaims marks the email of the user as verified
+// if the provider says that the provider has verified the same email.
+//
+// NOTE(patrik): The identity is already linked to the account, so this
+// is the account proving its own email and not someone taking it over
+func (a *AuthService) updateEmailVerifiedFromClaims(ctx context.Context, userId string, claims providerClaim) error {
+	if !claims.EmailVerified {
+		return nil
+	}
+
+	user, err := a.db.GetUserById(ctx, userId)
+	if err != nil {
+		return authErr.Errorf("get user: %w", err)
+	}
+
+	if user.Email != claims.Email {
+		return nil
+	}
+
+	return a.markEmailVerified(ctx, user)
+}
+
+// SignUserToken generates a JWT token for the user of the session, bound
+// to the session. Returns the JWT token or error if the user doesn't exist
+// or signing fails.
+func (a *AuthService) SignUserToken(session database.Session) (string, error) {
 	// Check if the user with the id exists in the database
-	user, err := a.db.GetUserById(context.Background(), userId)
+	user, err := a.db.GetUserById(context.Background(), session.UserId)
 	if err != nil {
 		return "", authErr.Errorf("signing token: get user by id: %w", err)
 	}
 
-	// Create jwt token with the for the user
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+	// Create jwt token with the for the user and sign it with the
+	// current signing key
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"jti":    utils.CreateId(),
 		"userId": user.Id,
-		"iat":    time.Now().Unix(),
-		// "exp":    time.Now().Add(1000 * time.Second).Unix(),
-	})
+		"sid":    session.Id,
+		"iat":    now.Unix(),
+		"exp":    now.Add(a.accessTokenDuration).Unix(),
+	}
 
-	// Sign the newly created token
-	tokenString, err := token.SignedString(([]byte)(a.jwtSecret))
+	// NOTE(patrik): Tokens issued to OAuth clients carries the client
+	// and the granted scopes
+	if session.ClientId.Valid {
+		claims["client_id"] = session.ClientId.String
+		claims["scope"] = session.Scope
+	}
+
+	tokenString, err := a.keys.Sign(claims)
 	if err != nil {
 		return "", authErr.Errorf("signing token: jwt sign: %w", err)
 	}
@@ -729,25 +1593,90 @@ func (a *AuthService) SignUserToken(userId string) (string, error) {
 	return tokenString, nil
 }
 
-// RemoveUnusedEntries performs cleanup on expired auth requests
+// RemoveUnusedEntries performs cleanup on expired auth requests by
+// purging them from the database
 func (a *AuthService) RemoveUnusedEntries() {
-	a.mu.Lock()
-	defer a.mu.Unlock()
-
-	now := time.Now()
+	ctx := context.TODO()
+	now := time.Now().UnixMilli()
 
 	// Remove expired provider OAuth2 requests
-	for k, request := range a.ProviderRequests {
-		if now.After(request.delete) {
-			delete(a.ProviderRequests, k)
-		}
+	err := a.db.DeleteOldAuthProviderRequests(ctx, now)
+	if err != nil {
+		slog.Error("auth-service: failed to remove old provider requests", "err", err)
 	}
 
 	// Remove expired quick connect requests
-	for k, request := range a.QuickConnectRequests {
-		if now.After(request.delete) {
-			delete(a.QuickConnectRequests, k)
-		}
+	err = a.db.DeleteOldAuthQuickConnectRequests(ctx, now)
+	if err != nil {
+		slog.Error("auth-service: failed to remove old quick connect requests", "err", err)
+	}
+
+	// Remove expired refresh tokens
+	err = a.db.DeleteExpiredRefreshTokens(ctx, now)
+	if err != nil {
+		slog.Error("auth-service: failed to remove expired refresh tokens", "err", err)
+	}
+
+	// Remove sessions that can't be used anymore, all the tokens for
+	// the session is expired at this point
+	inactive := time.Now().Add(-(a.refreshTokenDuration + a.accessTokenDuration))
+	err = a.db.DeleteInactiveSessions(ctx, inactive.UnixMilli())
+	if err != nil {
+		slog.Error("auth-service: failed to remove inactive sessions", "err", err)
+	}
+
+	// Remove expired authorization codes
+	err = a.db.DeleteExpiredOAuthAuthorizationCodes(ctx, now)
+	if err != nil {
+		slog.Error("auth-service: failed to remove expired authorization codes", "err", err)
+	}
+
+	// Remove revoked access tokens that have expired from the denylist
+	err = a.db.DeleteExpiredRevokedTokens(ctx, now)
+	if err != nil {
+		slog.Error("auth-service: failed to remove expired revoked tokens", "err", err)
+	}
+
+	// Remove expired initial access tokens
+	err = a.db.DeleteExpiredOAuthInitialAccessTokens(ctx, now)
+	if err != nil {
+		slog.Error("auth-service: failed to remove expired initial access tokens", "err", err)
+	}
+
+	// Remove expired consent requests
+	err = a.db.DeleteExpiredOAuthConsentRequests(ctx, now)
+	if err != nil {
+		slog.Error("auth-service: failed to remove expired consent requests", "err", err)
+	}
+
+	// Remove expired password reset tokens
+	err = a.db.DeleteExpiredPasswordResetTokens(ctx, now)
+	if err != nil {
+		slog.Error("auth-service: failed to remove expired password reset tokens", "err", err)
+	}
+
+	// Remove old magic link requests
+	err = a.db.DeleteOldMagicLinkRequests(ctx, now)
+	if err != nil {
+		slog.Error("auth-service: failed to remove old magic link requests", "err", err)
+	}
+
+	// Remove expired email verification tokens
+	err = a.db.DeleteExpiredEmailVerificationTokens(ctx, now)
+	if err != nil {
+		slog.Error("auth-service: failed to remove expired email verification tokens", "err", err)
+	}
+
+	// Remove expired mfa challenges
+	err = a.db.DeleteExpiredMfaChallenges(ctx, now)
+	if err != nil {
+		slog.Error("auth-service: failed to remove expired mfa challenges", "err", err)
+	}
+
+	// Remove expired passkey requests
+	err = a.db.DeleteExpiredPasskeyRequests(ctx, now)
+	if err != nil {
+		slog.Error("auth-service: failed to remove expired passkey requests", "err", err)
 	}
 }
 
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/nanoteck137/authlab/tools/utils"
+)
+
+// ClientTokens is the access token handed out to a client with the
+// client credentials grant, there is no refresh token because the
+// client can request a new token with the secret at any time
+type ClientTokens struct {
+	AccessToken        string
+	AccessTokenExpires time.Time
+
+	// The granted scopes separated by spaces
+	Scope string
+
+	// The audiences the token is valid for
+	Audience []string
+}
+
+// IssueClientToken creates a access token for the client itself, used
+// for service to service requests. The scope and the audiences needs
+// to be allowed for the client, when they are empty the token gets all
+// the scopes and audiences of the client.
+func (a *AuthService) IssueClientToken(client *OAuthClient, scope string, audience []string) (ClientTokens, error) {
+	if !client.HasGrantType(GrantTypeClientCredentials) || client.IsPublic() {
+		return ClientTokens{}, ErrAuthServiceUnauthorizedClient
+	}
+
+	scopes := strings.Fields(scope)
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+
+	if !client.HasScopes(scopes) {
+		return ClientTokens{}, ErrAuthServiceInvalidScope
+	}
+
+	if len(audience) == 0 {
+		audience = client.Audiences
+	}
+
+	for _, aud := range audience {
+		if !client.HasAudience(aud) {
+			return ClientTokens{}, ErrAuthServiceInvalidAudience
+		}
+	}
+
+	now := time.Now()
+	expires := now.Add(a.accessTokenDuration)
+
+	claims := jwt.MapClaims{
+		"jti":       utils.CreateId(),
+		"sub":       client.Id,
+		"client_id": client.Id,
+		"scope":     strings.Join(scopes, " "),
+		"iat":       now.Unix(),
+		"exp":       expires.Unix(),
+	}
+
+	if len(audience) > 0 {
+		claims["aud"] = audience
+	}
+
+	token, err := a.keys.Sign(claims)
+	if err != nil {
+		return ClientTokens{}, authErr.Errorf("sign client token: %w", err)
+	}
+
+	return ClientTokens{
+		AccessToken:        token,
+		AccessTokenExpires: expires,
+		Scope:              strings.Join(scopes, " "),
+		Audience:           audience,
+	}, nil
+}
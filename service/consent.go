@@ -0,0 +1,326 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/nanoteck137/authlab/database"
+)
+
+var (
+	ErrAuthServiceConsentRequestNotFound = authErr.Error("consent request not found")
+	ErrAuthServiceConsentRequestInvalid  = authErr.Error("consent request is invalid")
+	ErrAuthServiceGrantNotFound          = authErr.Error("grant not found")
+)
+
+// How long the user has to approve or deny the client on the consent
+// page
+const consentRequestDuration = 10 * time.Minute
+
+// NeedsConsent checks if the user needs to approve the scopes for the
+// client, trusted clients never needs consent and the user is only
+// asked again when the client requests scopes that was not approved
+// before
+func (a *AuthService) NeedsConsent(ctx context.Context, userId, clientId, scope string) (bool, error) {
+	client, err := a.GetOAuthClient(ctx, clientId)
+	if err != nil {
+		return false, err
+	}
+
+	if client.Trusted {
+		return false, nil
+	}
+
+	grant, err := a.db.GetUserGrant(ctx, userId, client.Id)
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return true, nil
+		}
+
+		return false, authErr.Errorf("get user grant: %w", err)
+	}
+
+	for _, s := range strings.Fields(scope) {
+		if !hasScope(grant.Scope, s) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// ConsentRequest is a authorization request waiting for the user to
+// approve or deny the client
+type ConsentRequest struct {
+	Id       string
+	UserId   string
+	Client   *OAuthClient
+	Request  AuthorizeRequest
+	AuthTime time.Time
+}
+
+// CreateConsentRequest saves the authorization request until the user
+// has approved or denied the client on the consent page
+func (a *AuthService) CreateConsentRequest(ctx context.Context, userId string, authTime time.Time, request AuthorizeRequest) (string, error) {
+	client, err := a.ValidateAuthorizeClient(ctx, request)
+	if err != nil {
+		return "", err
+	}
+
+	err = a.ValidateAuthorizeRequest(client, request)
+	if err != nil {
+		return "", err
+	}
+
+	id, err := a.db.CreateOAuthConsentRequest(ctx, database.CreateOAuthConsentRequestParams{
+		UserId:   userId,
+		ClientId: client.Id,
+
+		RedirectUri: request.RedirectUri,
+		Scope:       strings.Join(strings.Fields(request.Scope), " "),
+		State:       request.State,
+		Nonce: sql.NullString{
+			String: request.Nonce,
+			Valid:  request.Nonce != "",
+		},
+
+		CodeChallenge: sql.NullString{
+			String: request.CodeChallenge,
+			Valid:  request.CodeChallenge != "",
+		},
+		CodeChallengeMethod: sql.NullString{
+			String: request.CodeChallengeMethod,
+			Valid:  request.CodeChallenge != "",
+		},
+
+		AuthTime: authTime.UnixMilli(),
+
+		Expires: time.Now().Add(consentRequestDuration).UnixMilli(),
+	})
+	if err != nil {
+		return "", authErr.Errorf("create consent request: %w", err)
+	}
+
+	return id, nil
+}
+
+func (a *AuthService) getConsentRequest(ctx context.Context, id string) (database.OAuthConsentRequest, ConsentRequest, error) {
+	request, err := a.db.GetOAuthConsentRequestById(ctx, id)
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return database.OAuthConsentRequest{}, ConsentRequest{}, ErrAuthServiceConsentRequestNotFound
+		}
+
+		return database.OAuthConsentRequest{}, ConsentRequest{}, authErr.Errorf("get consent request: %w", err)
+	}
+
+	if request.Used > 0 || time.Now().After(time.UnixMilli(request.Expires)) {
+		return database.OAuthConsentRequest{}, ConsentRequest{}, ErrAuthServiceConsentRequestInvalid
+	}
+
+	client, err := a.GetOAuthClient(ctx, request.ClientId)
+	if err != nil {
+		if errors.Is(err, ErrAuthServiceClientNotFound) {
+			return database.OAuthConsentRequest{}, ConsentRequest{}, ErrAuthServiceConsentRequestInvalid
+		}
+
+		return database.OAuthConsentRequest{}, ConsentRequest{}, err
+	}
+
+	return request, ConsentRequest{
+		Id:     request.Id,
+		UserId: request.UserId,
+		Client: client,
+		Request: AuthorizeRequest{
+			ClientId:            request.ClientId,
+			RedirectUri:         request.RedirectUri,
+			Scope:               request.Scope,
+			Nonce:               request.Nonce.String,
+			State:               request.State,
+			CodeChallenge:       request.CodeChallenge.String,
+			CodeChallengeMethod: request.CodeChallengeMethod.String,
+		},
+		AuthTime: time.UnixMilli(request.AuthTime),
+	}, nil
+}
+
+func checkConsentCsrf(request database.OAuthConsentRequest, csrfToken string) error {
+	if !request.CsrfHash.Valid || csrfToken == "" {
+		return ErrAuthServiceConsentRequestInvalid
+	}
+
+	if subtle.ConstantTimeCompare([]byte(request.CsrfHash.String), []byte(hashToken(csrfToken))) != 1 {
+		return ErrAuthServiceConsentRequestInvalid
+	}
+
+	return nil
+}
+
+// GetConsentRequest returns the request for the consent page. The first
+// time the page is shown the request is bound to the CSRF token of the
+// browser, after that only the same browser can see and answer the
+// request.
+func (a *AuthService) GetConsentRequest(ctx context.Context, id, csrfToken string) (ConsentRequest, error) {
+	request, res, err := a.getConsentRequest(ctx, id)
+	if err != nil {
+		return ConsentRequest{}, err
+	}
+
+	if !request.CsrfHash.Valid {
+		bound, err := a.db.SetOAuthConsentRequestCsrfHash(ctx, request.Id, hashToken(csrfToken))
+		if err != nil {
+			return ConsentRequest{}, authErr.Errorf("set consent request csrf hash: %w", err)
+		}
+
+		// NOTE(patrik): Another browser bound the request first
+		if !bound {
+			return ConsentRequest{}, ErrAuthServiceConsentRequestInvalid
+		}
+
+		return res, nil
+	}
+
+	err = checkConsentCsrf(request, csrfToken)
+	if err != nil {
+		return ConsentRequest{}, err
+	}
+
+	return res, nil
+}
+
+func (a *AuthService) useConsentRequest(ctx context.Context, id, csrfToken string) (ConsentRequest, error) {
+	request, res, err := a.getConsentRequest(ctx, id)
+	if err != nil {
+		return ConsentRequest{}, err
+	}
+
+	err = checkConsentCsrf(request, csrfToken)
+	if err != nil {
+		return ConsentRequest{}, err
+	}
+
+	updated, err := a.db.MarkOAuthConsentRequestUsed(ctx, request.Id)
+	if err != nil {
+		return ConsentRequest{}, authErr.Errorf("mark consent request used: %w", err)
+	}
+
+	if !updated {
+		return ConsentRequest{}, ErrAuthServiceConsentRequestInvalid
+	}
+
+	return res, nil
+}
+
+// ApproveConsentRequest remembers the approved scopes for the client and
+// creates the authorization code that is sent back to the client
+func (a *AuthService) ApproveConsentRequest(ctx context.Context, id, csrfToken string) (ConsentRequest, string, error) {
+	request, err := a.useConsentRequest(ctx, id, csrfToken)
+	if err != nil {
+		return ConsentRequest{}, "", err
+	}
+
+	// NOTE(patrik): The new scopes are added to the scopes the user
+	// already approved for the client
+	scopes := strings.Fields(request.Request.Scope)
+
+	grant, err := a.db.GetUserGrant(ctx, request.UserId, request.Client.Id)
+	if err != nil && !errors.Is(err, database.ErrItemNotFound) {
+		return ConsentRequest{}, "", authErr.Errorf("get user grant: %w", err)
+	}
+
+	for _, s := range strings.Fields(grant.Scope) {
+		if !hasScope(request.Request.Scope, s) {
+			scopes = append(scopes, s)
+		}
+	}
+
+	err = a.db.SetUserGrant(ctx, database.SetUserGrantParams{
+		UserId:   request.UserId,
+		ClientId: request.Client.Id,
+		Scope:    strings.Join(scopes, " "),
+	})
+	if err != nil {
+		return ConsentRequest{}, "", authErr.Errorf("set user grant: %w", err)
+	}
+
+	code, err := a.CreateAuthorizationCode(ctx, request.UserId, request.AuthTime, request.Request)
+	if err != nil {
+		return ConsentRequest{}, "", err
+	}
+
+	return request, code, nil
+}
+
+// DenyConsentRequest marks the request as used, the user should be sent
+// back to the client with the "access_denied" error
+func (a *AuthService) DenyConsentRequest(ctx context.Context, id, csrfToken string) (ConsentRequest, error) {
+	return a.useConsentRequest(ctx, id, csrfToken)
+}
+
+// UserGrant is the scopes the user has approved for a client
+type UserGrant struct {
+	Client *OAuthClient
+	Scopes []string
+
+	Created time.Time
+	Updated time.Time
+}
+
+func (a *AuthService) GetUserGrants(ctx context.Context, userId string) ([]UserGrant, error) {
+	grants, err := a.db.GetAllUserGrantsForUser(ctx, userId)
+	if err != nil {
+		return nil, authErr.Errorf("get all user grants: %w", err)
+	}
+
+	res := make([]UserGrant, 0, len(grants))
+	for _, grant := range grants {
+		client, err := a.GetOAuthClient(ctx, grant.ClientId)
+		if err != nil {
+			// NOTE(patrik): The client was removed from the config,
+			// the grant can't be used anymore
+			if errors.Is(err, ErrAuthServiceClientNotFound) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		res = append(res, UserGrant{
+			Client:  client,
+			Scopes:  strings.Fields(grant.Scope),
+			Created: time.UnixMilli(grant.Created),
+			Updated: time.UnixMilli(grant.Updated),
+		})
+	}
+
+	return res, nil
+}
+
+// RevokeUserGrant removes the grant, the sessions the user has with the
+// client are revoked as well so the client loses access right away
+func (a *AuthService) RevokeUserGrant(ctx context.Context, userId, clientId string) error {
+	_, err := a.db.GetUserGrant(ctx, userId, clientId)
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return ErrAuthServiceGrantNotFound
+		}
+
+		return authErr.Errorf("get user grant: %w", err)
+	}
+
+	err = a.db.DeleteUserGrant(ctx, userId, clientId)
+	if err != nil {
+		return authErr.Errorf("delete user grant: %w", err)
+	}
+
+	err = a.db.DeleteAllSessionsForUserClient(ctx, userId, clientId)
+	if err != nil {
+		return authErr.Errorf("delete sessions for client: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nanoteck137/authlab/database"
+)
+
+func newTestDeviceService(t *testing.T) *AuthService {
+	t.Helper()
+
+	db, err := database.Open(filepath.Join(t.TempDir(), "data.db"))
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+
+	err = db.RunMigrateUp()
+	if err != nil {
+		t.Fatalf("run migrations: %v", err)
+	}
+
+	a := newTestExchangeService(t)
+	a.db = db
+	a.totpKey = deriveKey("test-secret", "authlab-totp")
+
+	return a
+}
+
+func TestDeviceCodeRequiresMfa(t *testing.T) {
+	a := newTestDeviceService(t)
+	ctx := context.Background()
+
+	user, err := a.db.CreateUser(ctx, database.CreateUserParams{
+		Email:         "device@example.com",
+		EmailVerified: true,
+		DisplayName:   "Device",
+		Role:          "user",
+	})
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	login, err := a.createSession(ctx, database.CreateSessionParams{
+		UserId:     user.Id,
+		AuthMethod: AuthMethodPassword,
+	})
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+
+	enrollment, err := a.EnrollTotp(ctx, user, login.Id)
+	if err != nil {
+		t.Fatalf("enroll totp: %v", err)
+	}
+
+	secret, err := totpEncoding.DecodeString(enrollment.Secret)
+	if err != nil {
+		t.Fatalf("decode totp secret: %v", err)
+	}
+
+	_, err = a.ConfirmTotp(ctx, user.Id, login.Id, generateTotpCode(secret, totpStep(time.Now())), ClientInfo{})
+	if err != nil {
+		t.Fatalf("confirm totp: %v", err)
+	}
+
+	// NOTE(patrik): Only the sessions created by the device are checked
+	// below
+	err = a.db.DeleteSession(ctx, login.Id)
+	if err != nil {
+		t.Fatalf("delete session: %v", err)
+	}
+
+	client := &OAuthClient{
+		Id:         "tv",
+		GrantTypes: []string{GrantTypeDeviceCode},
+		Scopes:     []string{"openid", "profile"},
+	}
+
+	request, err := a.CreateDeviceAuthorization(client, "openid")
+	if err != nil {
+		t.Fatalf("create device authorization: %v", err)
+	}
+
+	err = a.CompleteQuickConnectRequest(request.Code, user.Id)
+	if err != nil {
+		t.Fatalf("complete quick connect request: %v", err)
+	}
+
+	_, err = a.CreateAuthTokenForDeviceCode(client, request.Challenge, ClientInfo{})
+
+	var mfaErr *MfaRequiredError
+	if !errors.As(err, &mfaErr) {
+		t.Fatalf("got error %v, want %v", err, ErrAuthServiceMfaRequired)
+	}
+
+	sessions, err := a.db.GetAllSessionsForUser(ctx, user.Id)
+	if err != nil {
+		t.Fatalf("get sessions: %v", err)
+	}
+
+	if len(sessions) != 0 {
+		t.Fatalf("got %d sessions before the second factor, want 0", len(sessions))
+	}
+
+	// NOTE(patrik): The code from the confirmation is already used, so
+	// use the code from the next step
+	code := generateTotpCode(secret, totpStep(time.Now())+1)
+
+	_, err = a.CompleteMfaChallenge(ctx, mfaErr.Challenge, MfaMethodTotp, code, ClientInfo{})
+	if err != nil {
+		t.Fatalf("complete mfa challenge: %v", err)
+	}
+
+	sessions, err = a.db.GetAllSessionsForUser(ctx, user.Id)
+	if err != nil {
+		t.Fatalf("get sessions: %v", err)
+	}
+
+	if len(sessions) != 1 {
+		t.Fatalf("got %d sessions, want 1", len(sessions))
+	}
+
+	// NOTE(patrik): The session is bound to the device client like the
+	// sessions created without a second factor
+	session := sessions[0]
+	if session.ClientId.String != client.Id || session.Scope != "openid" {
+		t.Fatalf("got client %q with scope %q, want %q with scope %q", session.ClientId.String, session.Scope, client.Id, "openid")
+	}
+}
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/nanoteck137/authlab/database"
+	"github.com/nanoteck137/authlab/tools/utils"
+	"github.com/nanoteck137/authlab/types"
+)
+
+var (
+	ErrAuthServiceEmailNotVerified         = authErr.Error("email is not verified")
+	ErrAuthServiceEmailAlreadyVerified     = authErr.Error("email is already verified")
+	ErrAuthServiceInvalidVerificationToken = authErr.Error("invalid email verification token")
+	ErrAuthServiceProviderEmailNotVerified = authErr.Error("provider has not verified the email")
+)
+
+// How long the link inside the verification email works
+const emailVerificationDuration = 24 * time.Hour
+
+func (a *AuthService) RequireVerifiedEmail() bool {
+	return a.requireVerifiedEmail
+}
+
+// checkLoginPolicy is called before the tokens of a new session are
+// issued, returns ErrAuthServiceEmailNotVerified if the server requires
+// a verified email and the user hasn't verified it
+func (a *AuthService) checkLoginPolicy(ctx context.Context, userId string) error {
+	if !a.requireVerifiedEmail {
+		return nil
+	}
+
+	user, err := a.db.GetUserById(ctx, userId)
+	if err != nil {
+		return authErr.Errorf("get user: %w", err)
+	}
+
+	if user.EmailVerified == 0 {
+		return ErrAuthServiceEmailNotVerified
+	}
+
+	return nil
+}
+
+// SetEmailVerified sets if the email of the user is verified, used by
+// the admins and when the user proves that the email belongs to them
+func (a *AuthService) SetEmailVerified(ctx context.Context, userId string, verified bool) error {
+	value := 0
+	if verified {
+		value = 1
+	}
+
+	err := a.db.UpdateUser(ctx, userId, database.UserChanges{
+		EmailVerified: types.Change[int]{
+			Value:   value,
+			Changed: true,
+		},
+	})
+	if err != nil {
+		return authErr.Errorf("update user: %w", err)
+	}
+
+	return nil
+}
+
+// markEmailVerified marks the email of the user as verified if it isn't
+// already
+func (a *AuthService) markEmailVerified(ctx context.Context, user database.User) error {
+	if user.EmailVerified > 0 {
+		return nil
+	}
+
+	return a.SetEmailVerified(ctx, user.Id, true)
+}
+
+// claimUnverifiedAccount is called when someone has proven that they own
+// the email some other way than with the account itself, and marks the
+// email as verified. Anyone could have created an account with an
+// unverified email, so the password, the sessions, the identities and
+// the other credentials the creator has set up are removed. The identity
+// with the provider and provider id is kept, the magic links has no
+// identity. Everything is done in one transaction so the account can't
+// end up partly claimed.
+func (a *AuthService) claimUnverifiedAccount(ctx context.Context, user database.User, provider, providerId string) error {
+	tx, err := a.db.Begin()
+	if err != nil {
+		return authErr.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.UpdateUser(ctx, user.Id, database.UserChanges{
+		PasswordHash: types.Change[sql.NullString]{
+			Value:   sql.NullString{},
+			Changed: true,
+		},
+		EmailVerified: types.Change[int]{
+			Value:   1,
+			Changed: true,
+		},
+	})
+	if err != nil {
+		return authErr.Errorf("update user: %w", err)
+	}
+
+	err = tx.DeleteOtherUserIdentitiesForUser(ctx, user.Id, provider, providerId)
+	if err != nil {
+		return authErr.Errorf("delete user identities: %w", err)
+	}
+
+	err = tx.DeleteAllApiTokensForUser(ctx, user.Id)
+	if err != nil {
+		return authErr.Errorf("delete api tokens: %w", err)
+	}
+
+	err = tx.DeleteAllPasskeysForUser(ctx, user.Id)
+	if err != nil {
+		return authErr.Errorf("delete passkeys: %w", err)
+	}
+
+	err = tx.DeleteUserTotp(ctx, user.Id)
+	if err != nil {
+		return authErr.Errorf("delete user totp: %w", err)
+	}
+
+	err = tx.DeleteAllMfaRecoveryCodesForUser(ctx, user.Id)
+	if err != nil {
+		return authErr.Errorf("delete recovery codes: %w", err)
+	}
+
+	err = tx.DeleteAllSessionsForUser(ctx, user.Id)
+	if err != nil {
+		return authErr.Errorf("delete all sessions: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return authErr.Errorf("commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// markEmailVerifiedByProof marks the email of the user as verified after
+// the email was proven some other way than with the account, by a
+// provider or a magic link. Accounts that was never verified are taken
+// over. The provider and provider id is the identity that proved the
+// email, empty for the magic links.
+func (a *AuthService) markEmailVerifiedByProof(ctx context.Context, user database.User, provider, providerId string) error {
+	if user.EmailVerified > 0 {
+		return nil
+	}
+
+	return a.claimUnverifiedAccount(ctx, user, provider, providerId)
+}
+
+// CreateEmailVerificationToken creates the token for the verification
+// email of the user with the email. Returns ErrAuthServiceUserNotFound if
+// there is no user with the email and ErrAuthServiceEmailAlreadyVerified
+// if the email is verified. The older tokens of the user stops working.
+func (a *AuthService) CreateEmailVerificationToken(ctx context.Context, email string) (database.User, string, error) {
+	user, err := a.db.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return database.User{}, "", ErrAuthServiceUserNotFound
+		}
+
+		return database.User{}, "", authErr.Errorf("get user by email: %w", err)
+	}
+
+	if user.EmailVerified > 0 {
+		return database.User{}, "", ErrAuthServiceEmailAlreadyVerified
+	}
+
+	err = a.db.DeleteAllEmailVerificationTokensForUser(ctx, user.Id)
+	if err != nil {
+		return database.User{}, "", authErr.Errorf("delete email verification tokens: %w", err)
+	}
+
+	token, err := utils.GenerateAuthChallenge()
+	if err != nil {
+		return database.User{}, "", authErr.Errorf("generate email verification token: %w", err)
+	}
+
+	_, err = a.db.CreateEmailVerificationToken(ctx, database.CreateEmailVerificationTokenParams{
+		UserId:    user.Id,
+		Email:     user.Email,
+		TokenHash: hashToken(token),
+		Expires:   time.Now().Add(emailVerificationDuration).UnixMilli(),
+	})
+	if err != nil {
+		return database.User{}, "", authErr.Errorf("create email verification token: %w", err)
+	}
+
+	return user, token, nil
+}
+
+// VerifyEmail marks the email of the user as verified with the token
+// from the verification email, the token can only be used once
+func (a *AuthService) VerifyEmail(ctx context.Context, token string) error {
+	verificationToken, err := a.db.GetEmailVerificationTokenByHash(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return ErrAuthServiceInvalidVerificationToken
+		}
+
+		return authErr.Errorf("get email verification token: %w", err)
+	}
+
+	if verificationToken.Used > 0 || time.Now().After(time.UnixMilli(verificationToken.Expires)) {
+		return ErrAuthServiceInvalidVerificationToken
+	}
+
+	user, err := a.db.GetUserById(ctx, verificationToken.UserId)
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return ErrAuthServiceInvalidVerificationToken
+		}
+
+		return authErr.Errorf("get user: %w", err)
+	}
+
+	// NOTE(patrik): The token only verifies the address it was sent to
+	if user.Email != verificationToken.Email {
+		return ErrAuthServiceInvalidVerificationToken
+	}
+
+	used, err := a.db.MarkEmailVerificationTokenUsed(ctx, verificationToken.Id)
+	if err != nil {
+		return authErr.Errorf("mark email verification token used: %w", err)
+	}
+
+	if !used {
+		return ErrAuthServiceInvalidVerificationToken
+	}
+
+	return a.markEmailVerified(ctx, user)
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nanoteck137/authlab/config"
+	"github.com/nanoteck137/authlab/database"
+)
+
+var (
+	ErrAuthServiceInvalidForwardSession = authErr.Error("forward session is invalid")
+	ErrAuthServiceForwardAccessDenied   = authErr.Error("user is not allowed to access the host")
+)
+
+const (
+	ForwardAuthPolicyAuthenticated = "authenticated"
+	ForwardAuthPolicyDeny          = "deny"
+)
+
+// forwardSession is the payload of the session cookie checked by the
+// forward auth endpoint
+type forwardSession struct {
+	UserId    string `json:"uid"`
+	SessionId string `json:"sid"`
+	Expires   int64  `json:"exp"`
+}
+
+// CreateForwardSession creates the value of the session cookie for the
+// hosts behind the reverse proxy. The cookie is tied to the session of
+// the user so it stops working when the session is revoked.
+func (a *AuthService) CreateForwardSession(userId, sessionId string) (string, time.Time, error) {
+	expires := time.Now().Add(a.forwardAuth.SessionDuration)
+
+	value, err := signPayload(a.forwardKey, forwardSession{
+		UserId:    userId,
+		SessionId: sessionId,
+		Expires:   expires.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, authErr.Errorf("sign forward session: %w", err)
+	}
+
+	return value, expires, nil
+}
+
+// VerifyForwardSession checks the signature and the expiration of the
+// session cookie and returns the user and the session it was created
+// for, the caller still needs to check that the session is active
+func (a *AuthService) VerifyForwardSession(value string) (string, string, error) {
+	var session forwardSession
+	err := verifyPayload(a.forwardKey, value, &session)
+	if err != nil {
+		return "", "", ErrAuthServiceInvalidForwardSession
+	}
+
+	if time.Now().After(time.Unix(session.Expires, 0)) {
+		return "", "", ErrAuthServiceInvalidForwardSession
+	}
+
+	return session.UserId, session.SessionId, nil
+}
+
+// matchForwardHost checks if the host matches the pattern, patterns
+// starting with "*." matches all the subdomains
+func matchForwardHost(pattern, host string) bool {
+	pattern = strings.ToLower(pattern)
+
+	if suffix, found := strings.CutPrefix(pattern, "*"); found {
+		return strings.HasSuffix(host, suffix) && len(host) > len(suffix)
+	}
+
+	return host == pattern
+}
+
+func normalizeForwardHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	return strings.ToLower(host)
+}
+
+func (a *AuthService) findForwardRule(host string) (config.ConfigForwardAuthRule, bool) {
+	for _, rule := range a.forwardAuth.Rules {
+		for _, pattern := range rule.Hosts {
+			if matchForwardHost(pattern, host) {
+				return rule, true
+			}
+		}
+	}
+
+	return config.ConfigForwardAuthRule{}, false
+}
+
+// CheckForwardAccess checks the rules for the host, the first rule that
+// matches the host decides if the user is allowed. Hosts without a rule
+// uses the default policy.
+func (a *AuthService) CheckForwardAccess(user *database.User, host string) error {
+	host = normalizeForwardHost(host)
+
+	rule, found := a.findForwardRule(host)
+	if !found {
+		if a.forwardAuth.DefaultPolicy == ForwardAuthPolicyDeny {
+			return ErrAuthServiceForwardAccessDenied
+		}
+
+		return nil
+	}
+
+	if len(rule.Roles) == 0 && len(rule.Users) == 0 {
+		return nil
+	}
+
+	if slices.Contains(rule.Roles, user.Role) {
+		return nil
+	}
+
+	for _, u := range rule.Users {
+		if u == user.Id || strings.EqualFold(u, user.Email) {
+			return nil
+		}
+	}
+
+	return ErrAuthServiceForwardAccessDenied
+}
+
+// IsForwardRedirectAllowed checks that the user can be sent back to the
+// url after the login, only the hosts that can get the session cookie
+// and the hosts with a rule are allowed so the login page can't be used
+// to send the user to another site
+func (a *AuthService) IsForwardRedirectAllowed(redirect string) bool {
+	u, err := url.Parse(redirect)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return false
+	}
+
+	host := normalizeForwardHost(u.Host)
+
+	if domain := strings.ToLower(strings.TrimPrefix(a.forwardAuth.CookieDomain, ".")); domain != "" {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+
+	_, found := a.findForwardRule(host)
+	return found
+}
@@ -0,0 +1,1158 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/nanoteck137/authlab/config"
+)
+
+var keyErr = NewServiceErrCreator("key-service")
+
+var (
+	ErrKeyServiceUnknownAlgorithm = keyErr.Error("unknown algorithm")
+	ErrKeyServiceKeyNotFound      = keyErr.Error("key not found")
+	ErrKeyServiceKeyExpired       = keyErr.Error("key expired")
+	ErrKeyServiceKeyActive        = keyErr.Error("key is the active signing key")
+	ErrKeyServiceNoActiveKey      = keyErr.Error("no active signing key")
+)
+
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmES256 = "ES256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+var Algorithms = []string{
+	AlgorithmHS256,
+	AlgorithmRS256,
+	AlgorithmES256,
+	AlgorithmEdDSA,
+}
+
+const (
+	keyManifestFile = "keys.json"
+
+	// how often the routine checks for expired keys and scheduled
+	// rotations
+	keyRoutineInterval = 1 * time.Minute
+)
+
+type KeyStatus string
+
+const (
+	// The key used to sign new tokens, only one key is active
+	KeyStatusActive KeyStatus = "active"
+
+	// The key is only used for verifying tokens until it expires
+	KeyStatusInactive KeyStatus = "inactive"
+
+	// The key is not used anymore, the key material is deleted
+	KeyStatusRetired KeyStatus = "retired"
+)
+
+// keyManifest is the list of keys stored inside the keys directory
+type keyManifest struct {
+	// The jwt_signing_algorithm from the config when the manifest was
+	// last written, used to detect when the config has changed
+	Algorithm string `json:"algorithm"`
+
+	Keys []keyManifestEntry `json:"keys"`
+}
+
+type keyManifestEntry struct {
+	Id        string    `json:"id"`
+	Algorithm string    `json:"algorithm"`
+	Status    KeyStatus `json:"status"`
+
+	// The key is the jwt_secret from the config, a copy is stored inside
+	// the keys directory so the key can be used for verifying after the
+	// jwt_secret has been changed
+	FromConfig bool `json:"fromConfig,omitempty"`
+
+	Created int64 `json:"created"`
+
+	// When an inactive key stops being valid for verifying
+	Expires int64 `json:"expires,omitempty"`
+}
+
+type KeyInfo struct {
+	Id         string
+	Algorithm  string
+	Status     KeyStatus
+	FromConfig bool
+	Created    time.Time
+	Expires    time.Time
+}
+
+// signingKey is a key that can be used to sign and verify tokens
+type signingKey struct {
+	// The id of the key, sent as the "kid" header of the tokens
+	id string
+
+	// The JWT algorithm of the key
+	algorithm string
+
+	// The method used to sign with the key
+	method jwt.SigningMethod
+
+	// The key used for signing, []byte for HMAC keys
+	private crypto.PrivateKey
+
+	// The key used for verifying, the same as private for HMAC keys
+	public crypto.PublicKey
+
+	// When the key stops being valid for verifying, zero for the active
+	// key
+	expires time.Time
+}
+
+// KeyService holds the key ring used to sign and verify the user tokens.
+// The ring is stored inside the keys directory so that the CLI can
+// rotate keys while the server is running, the server picks up the
+// changes when the manifest is modified.
+type KeyService struct {
+	mu sync.RWMutex
+
+	// The directory where the manifest and the keys are stored
+	dir string
+
+	// The secret from the config, used as the legacy HMAC key
+	hmacSecret []byte
+
+	// The algorithm used for new keys
+	algorithm string
+
+	// How long old keys are kept for verifying after a rotation, should
+	// be the lifetime of the tokens signed by the keys
+	gracePeriod time.Duration
+
+	// How often the signing key is rotated, zero disables the scheduled
+	// rotation
+	rotationInterval time.Duration
+
+	// The loaded manifest and the modification time of the file
+	manifest keyManifest
+	modTime  time.Time
+
+	// The key that is used to sign new tokens
+	signing *signingKey
+
+	// All the keys that can be used to verify tokens
+	keys map[string]*signingKey
+}
+
+func NewKeyService(dir string, config *config.Config) (*KeyService, error) {
+	k := &KeyService{
+		dir:              dir,
+		hmacSecret:       []byte(config.JwtSecret),
+		algorithm:        config.JwtSigningAlgorithm,
+		gracePeriod:      config.AccessTokenDuration,
+		rotationInterval: config.KeyRotationInterval,
+		keys:             make(map[string]*signingKey),
+	}
+
+	if k.algorithm == "" {
+		k.algorithm = AlgorithmHS256
+	}
+
+	if !slices.Contains(Algorithms, k.algorithm) {
+		return nil, ErrKeyServiceUnknownAlgorithm
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	manifest, err := k.readManifest()
+	created := errors.Is(err, os.ErrNotExist)
+	if created {
+		manifest, err = k.initManifest()
+	}
+	if err != nil {
+		return nil, keyErr.Errorf("read manifest: %w", err)
+	}
+
+	changed, err := k.syncConfigKey(&manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	algorithmChanged := manifest.Algorithm != k.algorithm
+	manifest.Algorithm = k.algorithm
+
+	if created || changed || algorithmChanged {
+		err = k.saveManifest(manifest)
+	} else {
+		err = k.load(manifest)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// NOTE(patrik): Changing jwt_signing_algorithm rotates to a new key,
+	// the old key is kept for verifying until the tokens have expired.
+	// Keys rotated to another algorithm with the CLI are left alone.
+	if algorithmChanged && k.signing.algorithm != k.algorithm {
+		err := k.rotate(k.algorithm)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return k, nil
+}
+
+func (k *KeyService) manifestPath() string {
+	return path.Join(k.dir, keyManifestFile)
+}
+
+func (k *KeyService) keyPath(entry keyManifestEntry) string {
+	if entry.Algorithm == AlgorithmHS256 {
+		return path.Join(k.dir, entry.Id+".key")
+	}
+
+	return path.Join(k.dir, entry.Id+".pem")
+}
+
+func (k *KeyService) readManifest() (keyManifest, error) {
+	data, err := os.ReadFile(k.manifestPath())
+	if err != nil {
+		return keyManifest{}, err
+	}
+
+	var manifest keyManifest
+	err = json.Unmarshal(data, &manifest)
+	if err != nil {
+		return keyManifest{}, keyErr.Errorf("parse manifest: %w", err)
+	}
+
+	return manifest, nil
+}
+
+// saveManifest writes the manifest and loads the keys from it, the file
+// is replaced atomically so other processes never reads half a file
+func (k *KeyService) saveManifest(manifest keyManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return keyErr.Errorf("marshal manifest: %w", err)
+	}
+
+	tmp := k.manifestPath() + ".tmp"
+	err = os.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return keyErr.Errorf("write manifest: %w", err)
+	}
+
+	err = os.Rename(tmp, k.manifestPath())
+	if err != nil {
+		return keyErr.Errorf("write manifest: %w", err)
+	}
+
+	return k.load(manifest)
+}
+
+// initManifest creates the first manifest, the jwt_secret from the config
+// is added so that tokens from before the key ring still works
+func (k *KeyService) initManifest() (keyManifest, error) {
+	now := time.Now()
+
+	configEntry := keyManifestEntry{
+		Id:         newHmacKey(k.hmacSecret).id,
+		Algorithm:  AlgorithmHS256,
+		Status:     KeyStatusActive,
+		FromConfig: true,
+		Created:    now.UnixMilli(),
+	}
+
+	if k.algorithm == AlgorithmHS256 {
+		return keyManifest{
+			Algorithm: k.algorithm,
+			Keys:      []keyManifestEntry{configEntry},
+		}, nil
+	}
+
+	configEntry.Status = KeyStatusInactive
+	configEntry.Expires = now.Add(k.gracePeriod).UnixMilli()
+
+	// NOTE(patrik): Keys from before the manifest was added was stored
+	// as "<alg>.pem", reuse them so the issued tokens still works
+	var key *signingKey
+	legacyPath := path.Join(k.dir, strings.ToLower(k.algorithm)+".pem")
+	data, err := os.ReadFile(legacyPath)
+	if err == nil {
+		key, err = parsePrivateKey(k.algorithm, data)
+		if err != nil {
+			return keyManifest{}, err
+		}
+
+		err = os.Rename(legacyPath, path.Join(k.dir, key.id+".pem"))
+		if err != nil {
+			return keyManifest{}, keyErr.Errorf("move legacy key: %w", err)
+		}
+	} else if errors.Is(err, os.ErrNotExist) {
+		key, err = k.generateKey(k.algorithm)
+		if err != nil {
+			return keyManifest{}, err
+		}
+	} else {
+		return keyManifest{}, keyErr.Errorf("read legacy key: %w", err)
+	}
+
+	return keyManifest{
+		Algorithm: k.algorithm,
+		Keys: []keyManifestEntry{
+			configEntry,
+			{
+				Id:        key.id,
+				Algorithm: key.algorithm,
+				Status:    KeyStatusActive,
+				Created:   now.UnixMilli(),
+			},
+		},
+	}, nil
+}
+
+// storeConfigKey writes the jwt_secret to the keys directory, so the key
+// can still be used for verifying after the jwt_secret has been changed
+func (k *KeyService) storeConfigKey(id string) error {
+	p := path.Join(k.dir, id+".key")
+
+	_, err := os.Stat(p)
+	if err == nil {
+		return nil
+	}
+
+	if !errors.Is(err, os.ErrNotExist) {
+		return keyErr.Errorf("stat config key: %w", err)
+	}
+
+	data := base64.StdEncoding.EncodeToString(k.hmacSecret)
+
+	err = os.WriteFile(p, []byte(data), 0600)
+	if err != nil {
+		return keyErr.Errorf("write config key: %w", err)
+	}
+
+	return nil
+}
+
+// EncryptionKey returns the key with the name used to encrypt data stored
+// inside the database, the key is generated the first time and stored
+// inside the keys directory. The key doesn't depend on the jwt_secret,
+// so changing the secret doesn't break the encrypted data. Returns true
+// if the key was generated.
+func (k *KeyService) EncryptionKey(name string) ([]byte, bool, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	p := path.Join(k.dir, name+".secret")
+
+	data, err := os.ReadFile(p)
+	if err == nil {
+		key, err := base64.StdEncoding.DecodeString(string(data))
+		if err != nil {
+			return nil, false, keyErr.Errorf("decode encryption key: %w", err)
+		}
+
+		return key, false, nil
+	}
+
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, false, keyErr.Errorf("read encryption key: %w", err)
+	}
+
+	key := make([]byte, 32)
+	_, err = rand.Read(key)
+	if err != nil {
+		return nil, false, keyErr.Errorf("generate encryption key: %w", err)
+	}
+
+	data = []byte(base64.StdEncoding.EncodeToString(key))
+
+	err = os.WriteFile(p, data, 0600)
+	if err != nil {
+		return nil, false, keyErr.Errorf("write encryption key: %w", err)
+	}
+
+	return key, true, nil
+}
+
+// syncConfigKey handles when the jwt_secret inside the config has been
+// changed, the old secret is kept for verifying until the tokens signed
+// with it have expired. Returns true if the manifest was changed.
+func (k *KeyService) syncConfigKey(manifest *keyManifest) (bool, error) {
+	id := newHmacKey(k.hmacSecret).id
+
+	err := k.storeConfigKey(id)
+	if err != nil {
+		return false, err
+	}
+
+	for _, entry := range manifest.Keys {
+		if entry.FromConfig && entry.Status != KeyStatusRetired && entry.Id == id {
+			return false, nil
+		}
+	}
+
+	now := time.Now()
+
+	changed := false
+	wasActive := false
+	for i, entry := range manifest.Keys {
+		if !entry.FromConfig || entry.Status == KeyStatusRetired {
+			continue
+		}
+
+		wasActive = wasActive || entry.Status == KeyStatusActive
+		changed = true
+
+		// NOTE(patrik): Secrets from before the secret was stored inside
+		// the keys directory are gone, so the key can only be retired
+		_, err := os.Stat(k.keyPath(entry))
+		if err != nil {
+			slog.Warn("key-service: old jwt_secret is not stored, tokens signed with it stops working", "id", entry.Id)
+
+			manifest.Keys[i].Status = KeyStatusRetired
+			manifest.Keys[i].Expires = 0
+			continue
+		}
+
+		if entry.Status == KeyStatusActive {
+			manifest.Keys[i].Status = KeyStatusInactive
+			manifest.Keys[i].Expires = now.Add(k.gracePeriod).UnixMilli()
+		}
+	}
+
+	// NOTE(patrik): The secret was the signing key so the new secret
+	// takes its place, same as before the key ring was added
+	if wasActive {
+		manifest.Keys = append(manifest.Keys, keyManifestEntry{
+			Id:         id,
+			Algorithm:  AlgorithmHS256,
+			Status:     KeyStatusActive,
+			FromConfig: true,
+			Created:    now.UnixMilli(),
+		})
+	}
+
+	return changed, nil
+}
+
+// load loads all the keys that are not retired from the manifest, needs
+// the write lock
+func (k *KeyService) load(manifest keyManifest) error {
+	keys := make(map[string]*signingKey, len(manifest.Keys))
+	var signing *signingKey
+
+	for _, entry := range manifest.Keys {
+		if entry.Status == KeyStatusRetired {
+			continue
+		}
+
+		// NOTE(patrik): Reuse the already loaded keys so we don't need
+		// to parse every key on every reload
+		key, exists := k.keys[entry.Id]
+		if !exists {
+			var err error
+			key, err = k.loadKey(entry)
+			if err != nil {
+				return err
+			}
+		}
+
+		// NOTE(patrik): Copy so the keys handed out by findKey are never
+		// modified
+		key = &signingKey{
+			id:        key.id,
+			algorithm: key.algorithm,
+			method:    key.method,
+			private:   key.private,
+			public:    key.public,
+		}
+
+		if entry.Status == KeyStatusInactive {
+			key.expires = time.UnixMilli(entry.Expires)
+		}
+
+		keys[key.id] = key
+
+		if entry.Status == KeyStatusActive {
+			signing = key
+		}
+	}
+
+	if signing == nil {
+		return ErrKeyServiceNoActiveKey
+	}
+
+	info, err := os.Stat(k.manifestPath())
+	if err != nil {
+		return keyErr.Errorf("stat manifest: %w", err)
+	}
+
+	k.manifest = manifest
+	k.modTime = info.ModTime()
+	k.signing = signing
+	k.keys = keys
+
+	return nil
+}
+
+func (k *KeyService) loadKey(entry keyManifestEntry) (*signingKey, error) {
+	// NOTE(patrik): Old secrets from the config are read from the keys
+	// directory like the generated keys
+	if entry.FromConfig {
+		key := newHmacKey(k.hmacSecret)
+		if key.id == entry.Id {
+			return key, nil
+		}
+	}
+
+	data, err := os.ReadFile(k.keyPath(entry))
+	if err != nil {
+		return nil, keyErr.Errorf("read key %s: %w", entry.Id, err)
+	}
+
+	if entry.Algorithm == AlgorithmHS256 {
+		secret, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, keyErr.Errorf("decode key %s: %w", entry.Id, err)
+		}
+
+		return newHmacKey(secret), nil
+	}
+
+	return parsePrivateKey(entry.Algorithm, data)
+}
+
+// refresh reloads the manifest if it was changed by another process
+func (k *KeyService) refresh() error {
+	info, err := os.Stat(k.manifestPath())
+	if err != nil {
+		return keyErr.Errorf("stat manifest: %w", err)
+	}
+
+	k.mu.RLock()
+	changed := !info.ModTime().Equal(k.modTime)
+	k.mu.RUnlock()
+
+	if !changed {
+		return nil
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return k.reload()
+}
+
+// reload reads the manifest from disk and loads it, needs the write lock
+func (k *KeyService) reload() error {
+	manifest, err := k.readManifest()
+	if err != nil {
+		return keyErr.Errorf("read manifest: %w", err)
+	}
+
+	return k.load(manifest)
+}
+
+func newHmacKey(secret []byte) *signingKey {
+	// NOTE(patrik): The id is derived from the secret so that it stays
+	// the same between restarts, the hash doesn't leak the secret
+	sum := sha256.Sum256(secret)
+
+	return &signingKey{
+		id:        "hs256-" + base64.RawURLEncoding.EncodeToString(sum[:8]),
+		algorithm: AlgorithmHS256,
+		method:    jwt.SigningMethodHS256,
+		private:   secret,
+		public:    secret,
+	}
+}
+
+// generateKey generates a new key for the algorithm and stores it inside
+// the keys directory
+func (k *KeyService) generateKey(algorithm string) (*signingKey, error) {
+	if algorithm == AlgorithmHS256 {
+		secret := make([]byte, 32)
+		_, err := rand.Read(secret)
+		if err != nil {
+			return nil, keyErr.Errorf("generate key: %w", err)
+		}
+
+		key := newHmacKey(secret)
+		data := base64.StdEncoding.EncodeToString(secret)
+
+		err = os.WriteFile(path.Join(k.dir, key.id+".key"), []byte(data), 0600)
+		if err != nil {
+			return nil, keyErr.Errorf("write key: %w", err)
+		}
+
+		return key, nil
+	}
+
+	private, err := generatePrivateKey(algorithm)
+	if err != nil {
+		return nil, keyErr.Errorf("generate key: %w", err)
+	}
+
+	key, err := newSigningKey(algorithm, private)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, keyErr.Errorf("marshal key: %w", err)
+	}
+
+	data := pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: der,
+	})
+
+	err = os.WriteFile(path.Join(k.dir, key.id+".pem"), data, 0600)
+	if err != nil {
+		return nil, keyErr.Errorf("write key: %w", err)
+	}
+
+	return key, nil
+}
+
+func generatePrivateKey(algorithm string) (crypto.PrivateKey, error) {
+	switch algorithm {
+	case AlgorithmRS256:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case AlgorithmES256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgorithmEdDSA:
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		return private, err
+	}
+
+	return nil, ErrKeyServiceUnknownAlgorithm
+}
+func parsePrivateKey(algorithm string, data []byte) (*signingKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, keyErr.Error("failed to decode pem")
+	}
+
+	private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, keyErr.Errorf("parse key: %w", err)
+	}
+
+	return newSigningKey(algorithm, private)
+}
+
+func newSigningKey(algorithm string, private crypto.PrivateKey) (*signingKey, error) {
+	key := &signingKey{
+		algorithm: algorithm,
+		private:   private,
+	}
+
+	switch p := private.(type) {
+	case *rsa.PrivateKey:
+		if algorithm != AlgorithmRS256 {
+			return nil, keyErr.Errorf("key type doesn't match algorithm %s", algorithm)
+		}
+
+		key.method = jwt.SigningMethodRS256
+		key.public = &p.PublicKey
+	case *ecdsa.PrivateKey:
+		if algorithm != AlgorithmES256 || p.Curve != elliptic.P256() {
+			return nil, keyErr.Errorf("key type doesn't match algorithm %s", algorithm)
+		}
+
+		key.method = jwt.SigningMethodES256
+		key.public = &p.PublicKey
+	case ed25519.PrivateKey:
+		if algorithm != AlgorithmEdDSA {
+			return nil, keyErr.Errorf("key type doesn't match algorithm %s", algorithm)
+		}
+
+		key.method = jwt.SigningMethodEdDSA
+		key.public = p.Public()
+	default:
+		return nil, keyErr.Errorf("unsupported key type %T", private)
+	}
+
+	jwk, err := publicJwk(key)
+	if err != nil {
+		return nil, err
+	}
+
+	key.id, err = jwkThumbprint(jwk)
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// rotate generates a new signing key, the old signing key is kept for
+// verifying until the tokens signed with it have expired. Needs the
+// write lock.
+func (k *KeyService) rotate(algorithm string) error {
+	key, err := k.generateKey(algorithm)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	manifest := keyManifest{
+		Algorithm: k.manifest.Algorithm,
+		Keys:      slices.Clone(k.manifest.Keys),
+	}
+
+	for i, entry := range manifest.Keys {
+		if entry.Status == KeyStatusActive {
+			manifest.Keys[i].Status = KeyStatusInactive
+			manifest.Keys[i].Expires = now.Add(k.gracePeriod).UnixMilli()
+		}
+	}
+
+	manifest.Keys = append(manifest.Keys, keyManifestEntry{
+		Id:        key.id,
+		Algorithm: key.algorithm,
+		Status:    KeyStatusActive,
+		Created:   now.UnixMilli(),
+	})
+
+	k.keys[key.id] = key
+
+	return k.saveManifest(manifest)
+}
+
+// Rotate generates a new signing key with the algorithm, if the algorithm
+// is empty then the algorithm from the config is used. Returns the id of
+// the new key.
+func (k *KeyService) Rotate(algorithm string) (string, error) {
+	if algorithm == "" {
+		algorithm = k.algorithm
+	}
+
+	if !slices.Contains(Algorithms, algorithm) {
+		return "", ErrKeyServiceUnknownAlgorithm
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	err := k.reload()
+	if err != nil {
+		return "", err
+	}
+
+	err = k.rotate(algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	return k.signing.id, nil
+}
+
+// Retire removes the key from the key ring, tokens signed with the key
+// stops working right away. The active key can't be retired, rotate
+// first.
+func (k *KeyService) Retire(id string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	err := k.reload()
+	if err != nil {
+		return err
+	}
+
+	manifest := keyManifest{
+		Algorithm: k.manifest.Algorithm,
+		Keys:      slices.Clone(k.manifest.Keys),
+	}
+
+	idx := slices.IndexFunc(manifest.Keys, func(entry keyManifestEntry) bool {
+		return entry.Id == id
+	})
+	if idx == -1 {
+		return ErrKeyServiceKeyNotFound
+	}
+
+	entry := manifest.Keys[idx]
+	if entry.Status == KeyStatusActive {
+		return ErrKeyServiceKeyActive
+	}
+
+	if entry.Status == KeyStatusRetired {
+		return nil
+	}
+
+	return k.retire(manifest, []int{idx})
+}
+
+// retire marks the entries as retired and deletes the key files, needs
+// the write lock
+func (k *KeyService) retire(manifest keyManifest, indices []int) error {
+	for _, idx := range indices {
+		entry := manifest.Keys[idx]
+
+		err := os.Remove(k.keyPath(entry))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return keyErr.Errorf("remove key %s: %w", entry.Id, err)
+		}
+
+		manifest.Keys[idx].Status = KeyStatusRetired
+		manifest.Keys[idx].Expires = 0
+	}
+
+	return k.saveManifest(manifest)
+}
+
+// RetireExpiredKeys retires the inactive keys where all the tokens signed
+// with them have expired
+func (k *KeyService) RetireExpiredKeys() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	err := k.reload()
+	if err != nil {
+		return err
+	}
+
+	manifest := keyManifest{
+		Algorithm: k.manifest.Algorithm,
+		Keys:      slices.Clone(k.manifest.Keys),
+	}
+
+	now := time.Now().UnixMilli()
+
+	var expired []int
+	for i, entry := range manifest.Keys {
+		if entry.Status == KeyStatusInactive && entry.Expires <= now {
+			expired = append(expired, i)
+		}
+	}
+
+	if len(expired) == 0 {
+		return nil
+	}
+
+	return k.retire(manifest, expired)
+}
+
+// List returns all the keys inside the key ring, including retired keys
+func (k *KeyService) List() ([]KeyInfo, error) {
+	err := k.refresh()
+	if err != nil {
+		return nil, err
+	}
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	res := make([]KeyInfo, 0, len(k.manifest.Keys))
+	for _, entry := range k.manifest.Keys {
+		info := KeyInfo{
+			Id:         entry.Id,
+			Algorithm:  entry.Algorithm,
+			Status:     entry.Status,
+			FromConfig: entry.FromConfig,
+			Created:    time.UnixMilli(entry.Created),
+		}
+
+		if entry.Expires != 0 {
+			info.Expires = time.UnixMilli(entry.Expires)
+		}
+
+		res = append(res, info)
+	}
+
+	return res, nil
+}
+
+// rotationDue checks if the signing key is older than the rotation
+// interval
+func (k *KeyService) rotationDue() bool {
+	if k.rotationInterval <= 0 {
+		return false
+	}
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	for _, entry := range k.manifest.Keys {
+		if entry.Status == KeyStatusActive {
+			created := time.UnixMilli(entry.Created)
+			return time.Since(created) >= k.rotationInterval
+		}
+	}
+
+	return false
+}
+
+func (k *KeyService) RotateRoutine() {
+	ticker := time.NewTicker(keyRoutineInterval)
+	for range ticker.C {
+		err := k.RetireExpiredKeys()
+		if err != nil {
+			slog.Error("key-service: failed to retire expired keys", "err", err)
+		}
+
+		if k.rotationDue() {
+			slog.Info("key-service: rotating signing key")
+
+			_, err := k.Rotate("")
+			if err != nil {
+				slog.Error("key-service: failed to rotate signing key", "err", err)
+			}
+		}
+	}
+}
+
+// Sign signs the claims with the current signing key, the id of the key
+// is added as the "kid" header
+func (k *KeyService) Sign(claims jwt.Claims) (string, error) {
+	// NOTE(patrik): Pick up rotations done by the CLI
+	err := k.refresh()
+	if err != nil {
+		slog.Warn("key-service: failed to refresh keys", "err", err)
+	}
+
+	k.mu.RLock()
+	key := k.signing
+	k.mu.RUnlock()
+
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.id
+
+	res, err := token.SignedString(key.private)
+	if err != nil {
+		return "", keyErr.Errorf("sign token: %w", err)
+	}
+
+	return res, nil
+}
+
+func (k *KeyService) findKey(kid string) *signingKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if kid != "" {
+		return k.keys[kid]
+	}
+
+	// NOTE(patrik): Tokens from before we had key ids are always signed
+	// with the HMAC secret from the config
+	for _, entry := range k.manifest.Keys {
+		if entry.FromConfig && entry.Status != KeyStatusRetired {
+			return k.keys[entry.Id]
+		}
+	}
+
+	return nil
+}
+
+// Keyfunc is used when parsing tokens to get the key to verify the
+// token with, the key is found by the "kid" header and the algorithm
+// of the token needs to match the algorithm of the key
+func (k *KeyService) Keyfunc(token *jwt.Token) (any, error) {
+	// NOTE(patrik): Pick up keys rotated or retired by the CLI
+	err := k.refresh()
+	if err != nil {
+		return nil, err
+	}
+
+	kid, _ := token.Header["kid"].(string)
+
+	key := k.findKey(kid)
+	if key == nil {
+		return nil, ErrKeyServiceKeyNotFound
+	}
+
+	if !key.expires.IsZero() && time.Now().After(key.expires) {
+		return nil, ErrKeyServiceKeyExpired
+	}
+
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	return key.public, nil
+}
+
+// ValidMethods returns the algorithms of the tokens that can be verified
+func (k *KeyService) ValidMethods() []string {
+	// NOTE(patrik): All the supported algorithms are valid, the key
+	// picked by Keyfunc makes sure the token uses the algorithm of the
+	// key
+	return Algorithms
+}
+
+// SigningAlgorithm returns the algorithm used for new tokens
+func (k *KeyService) SigningAlgorithm() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return k.signing.algorithm
+}
+
+// JsonWebKey is the public part of a key (RFC 7517)
+type JsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// EC and OKP
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JsonWebKeySet struct {
+	Keys []JsonWebKey `json:"keys"`
+}
+
+// JWKS returns the public keys that can be used to verify tokens,
+// HMAC keys are secret and are never included
+func (k *KeyService) JWKS() JsonWebKeySet {
+	err := k.refresh()
+	if err != nil {
+		slog.Warn("key-service: failed to refresh keys", "err", err)
+	}
+
+	now := time.Now()
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	res := JsonWebKeySet{
+		Keys: []JsonWebKey{},
+	}
+
+	for _, key := range k.keys {
+		if key.algorithm == AlgorithmHS256 {
+			continue
+		}
+
+		if !key.expires.IsZero() && now.After(key.expires) {
+			continue
+		}
+
+		jwk, err := publicJwk(key)
+		if err != nil {
+			continue
+		}
+
+		jwk.Kid = key.id
+		jwk.Use = "sig"
+		jwk.Alg = key.method.Alg()
+
+		res.Keys = append(res.Keys, jwk)
+	}
+
+	return res
+}
+
+func encodeBase64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// publicJwk returns the required members of the JWK for the public key
+func publicJwk(key *signingKey) (JsonWebKey, error) {
+	switch p := key.public.(type) {
+	case *rsa.PublicKey:
+		return JsonWebKey{
+			Kty: "RSA",
+			N:   encodeBase64(p.N.Bytes()),
+			E:   encodeBase64(big.NewInt(int64(p.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		ecdhKey, err := p.ECDH()
+		if err != nil {
+			return JsonWebKey{}, keyErr.Errorf("convert ecdsa key: %w", err)
+		}
+
+		// NOTE(patrik): Uncompressed point format 0x04 || X || Y
+		b := ecdhKey.Bytes()
+		size := (len(b) - 1) / 2
+
+		return JsonWebKey{
+			Kty: "EC",
+			Crv: "P-256",
+			X:   encodeBase64(b[1 : 1+size]),
+			Y:   encodeBase64(b[1+size:]),
+		}, nil
+	case ed25519.PublicKey:
+		return JsonWebKey{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   encodeBase64(p),
+		}, nil
+	}
+
+	return JsonWebKey{}, keyErr.Errorf("unsupported public key type %T", key.public)
+}
+
+// jwkThumbprint creates the JWK thumbprint (RFC 7638) used as the key id
+func jwkThumbprint(jwk JsonWebKey) (string, error) {
+	var members any
+
+	// NOTE(patrik): Only the required members in lexicographic order
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Crv, jwk.Kty, jwk.X, jwk.Y}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	default:
+		return "", keyErr.Errorf("unsupported key type %s", jwk.Kty)
+	}
+
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return encodeBase64(sum[:]), nil
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/nanoteck137/authlab/database"
+	"github.com/nanoteck137/authlab/types"
+)
+
+var (
+	ErrAuthServiceLocalAccountsDisabled = authErr.Error("local accounts are disabled")
+	ErrAuthServiceInvalidCredentials    = authErr.Error("invalid credentials")
+	ErrAuthServiceUsernameTaken         = authErr.Error("username is taken")
+	ErrAuthServiceEmailTaken            = authErr.Error("email is taken")
+)
+
+func (a *AuthService) LocalAccountsEnabled() bool {
+	return a.localAccounts
+}
+
+// NormalizeUsername returns the username in the form it's stored in,
+// usernames are case insensitive
+func NormalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+type SignupLocalUserParams struct {
+	Username    string
+	Email       string
+	Password    string
+	DisplayName string
+}
+
+// SignupLocalUser creates a new user with a username and a password and
+// logs the user in
+func (a *AuthService) SignupLocalUser(ctx context.Context, params SignupLocalUserParams, info ClientInfo) (UserTokens, error) {
+	if !a.localAccounts {
+		return UserTokens{}, ErrAuthServiceLocalAccountsDisabled
+	}
+
+	username := NormalizeUsername(params.Username)
+
+	_, err := a.db.GetUserByUsername(ctx, username)
+	if err == nil {
+		return UserTokens{}, ErrAuthServiceUsernameTaken
+	} else if !errors.Is(err, database.ErrItemNotFound) {
+		return UserTokens{}, authErr.Errorf("get user by username: %w", err)
+	}
+
+	// NOTE(patrik): The email is unique, but the account doesn't own it
+	// until it's verified. A provider that has verified the email or a
+	// magic link can take over an unverified account, and the password
+	// is removed when that happens.
+	_, err = a.db.GetUserByEmail(ctx, params.Email)
+	if err == nil {
+		return UserTokens{}, ErrAuthServiceEmailTaken
+	} else if !errors.Is(err, database.ErrItemNotFound) {
+		return UserTokens{}, authErr.Errorf("get user by email: %w", err)
+	}
+
+	hash, err := hashPassword(params.Password, a.passwordHashing)
+	if err != nil {
+		return UserTokens{}, authErr.Errorf("hash password: %w", err)
+	}
+
+	displayName := params.DisplayName
+	if displayName == "" {
+		displayName = username
+	}
+
+	user, err := a.db.CreateUser(ctx, database.CreateUserParams{
+		Email: params.Email,
+		Username: sql.NullString{
+			String: username,
+			Valid:  true,
+		},
+		PasswordHash: sql.NullString{
+			String: hash,
+			Valid:  true,
+		},
+		DisplayName: displayName,
+		Role:        "user",
+	})
+	if err != nil {
+		return UserTokens{}, authErr.Errorf("create user: %w", err)
+	}
+
+	return a.IssueUserTokens(ctx, user.Id, AuthMethodPassword, info)
+}
+
+// checkUserPassword checks the password of the user, the hash is updated
+// if the hashing parameters has changed since the password was set
+func (a *AuthService) checkUserPassword(ctx context.Context, user database.User, password string) error {
+	if !user.PasswordHash.Valid {
+		return ErrAuthServiceInvalidCredentials
+	}
+
+	valid, rehash, err := verifyPassword(password, user.PasswordHash.String, a.passwordHashing)
+	if err != nil {
+		return authErr.Errorf("verify password: %w", err)
+	}
+
+	if !valid {
+		return ErrAuthServiceInvalidCredentials
+	}
+
+	if rehash {
+		err := a.setUserPassword(ctx, user.Id, password)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (a *AuthService) setUserPassword(ctx context.Context, userId, password string) error {
+	hash, err := hashPassword(password, a.passwordHashing)
+	if err != nil {
+		return authErr.Errorf("hash password: %w", err)
+	}
+
+	err = a.db.UpdateUser(ctx, userId, database.UserChanges{
+		PasswordHash: types.Change[sql.NullString]{
+			Value: sql.NullString{
+				String: hash,
+				Valid:  true,
+			},
+			Changed: true,
+		},
+	})
+	if err != nil {
+		return authErr.Errorf("update user password: %w", err)
+	}
+
+	return nil
+}
+
+// LoginLocalUser logs in the user with the username and the password
+func (a *AuthService) LoginLocalUser(ctx context.Context, username, password string, info ClientInfo) (UserTokens, error) {
+	if !a.localAccounts {
+		return UserTokens{}, ErrAuthServiceLocalAccountsDisabled
+	}
+
+	user, err := a.db.GetUserByUsername(ctx, NormalizeUsername(username))
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			// NOTE(patrik): Hash the password anyway so the response
+			// time doesn't tell if the username exists
+			hashPassword(password, a.passwordHashing)
+			return UserTokens{}, ErrAuthServiceInvalidCredentials
+		}
+
+		return UserTokens{}, authErr.Errorf("get user by username: %w", err)
+	}
+
+	err = a.checkUserPassword(ctx, user, password)
+	if err != nil {
+		return UserTokens{}, err
+	}
+
+	return a.IssueLoginTokens(ctx, user.Id, AuthMethodPassword, info)
+}
+
+// ChangePassword sets a new password for the user after checking the
+// current password. All the other sessions of the user are revoked, the
+// session the request came from is kept.
+func (a *AuthService) ChangePassword(ctx context.Context, userId, sessionId, currentPassword, newPassword string) error {
+	if !a.localAccounts {
+		return ErrAuthServiceLocalAccountsDisabled
+	}
+
+	user, err := a.db.GetUserById(ctx, userId)
+	if err != nil {
+		return authErr.Errorf("get user by id: %w", err)
+	}
+
+	err = a.checkUserPassword(ctx, user, currentPassword)
+	if err != nil {
+		return err
+	}
+
+	err = a.setUserPassword(ctx, user.Id, newPassword)
+	if err != nil {
+		return err
+	}
+
+	err = a.db.DeleteOtherSessionsForUser(ctx, user.Id, sessionId)
+	if err != nil {
+		return authErr.Errorf("delete other sessions: %w", err)
+	}
+
+	return nil
+}
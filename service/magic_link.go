@@ -0,0 +1,349 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/nanoteck137/authlab/database"
+	"github.com/nanoteck137/authlab/tools/utils"
+)
+
+var (
+	ErrAuthServiceMagicLinksDisabled = authErr.Error("magic links are disabled")
+	ErrAuthServiceTooManyRequests    = authErr.Error("too many requests")
+)
+
+const (
+	magicLinkRequestExpireDuration   = 10 * time.Minute
+	magicLinkRequestDeletionDuration = magicLinkRequestExpireDuration + 10*time.Minute
+
+	// The limits for sending links, so the endpoint can't be used to
+	// flood an inbox with emails. The ip address limit is counted over
+	// the expire duration of the requests.
+	magicLinkMaxPendingPerEmail = 3
+	magicLinkMaxRequestsPerIp   = 10
+)
+
+type MagicLinkStatus string
+
+const (
+	MagicLinkStatusPending   MagicLinkStatus = "pending"
+	MagicLinkStatusCompleted MagicLinkStatus = "completed"
+	MagicLinkStatusExpired   MagicLinkStatus = "expired"
+)
+
+// magicLinkState is the payload of the signed token inside the link
+type magicLinkState struct {
+	RequestId string `json:"rid"`
+	Expires   int64  `json:"exp"`
+}
+
+func (a *AuthService) MagicLinksEnabled() bool {
+	return a.magicLinks
+}
+
+// MagicLinkRequestResult is the structure returned by
+// CreateMagicLinkRequest
+type MagicLinkRequestResult struct {
+	RequestId string
+
+	// The challenge the browser that started the request uses to check
+	// the status and to get the tokens
+	Challenge string
+
+	// The code shown both in the browser and on the page the link opens,
+	// so the user can check that it's the same request
+	Code string
+
+	// The signed token for the link sent to the email
+	Token string
+
+	Expires time.Time
+}
+
+// CreateMagicLinkRequest creates the login request for the email, the
+// token needs to be sent inside a link to the email. The request is
+// created even when there is no user with the email, the user is
+// created when the link is opened. Returns ErrAuthServiceTooManyRequests
+// if the email has too many pending requests or the ip address has
+// created too many requests.
+//
+// Thread-safe: locks the service
+func (a *AuthService) CreateMagicLinkRequest(ctx context.Context, email string, info ClientInfo) (MagicLinkRequestResult, error) {
+	if !a.magicLinks {
+		return MagicLinkRequestResult{}, ErrAuthServiceMagicLinksDisabled
+	}
+
+	// NOTE(patrik): Locked so the requests checked against the limits
+	// can't be created at the same time
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	t := time.Now()
+
+	pending, err := a.db.CountMagicLinkRequestsForEmail(ctx, email, string(MagicLinkStatusPending), t.UnixMilli())
+	if err != nil {
+		return MagicLinkRequestResult{}, authErr.Errorf("count pending magic link requests: %w", err)
+	}
+
+	if pending >= magicLinkMaxPendingPerEmail {
+		return MagicLinkRequestResult{}, ErrAuthServiceTooManyRequests
+	}
+
+	recent, err := a.db.CountMagicLinkRequestsForIp(ctx, info.IpAddress, t.Add(-magicLinkRequestExpireDuration).UnixMilli())
+	if err != nil {
+		return MagicLinkRequestResult{}, authErr.Errorf("count magic link requests: %w", err)
+	}
+
+	if recent >= magicLinkMaxRequestsPerIp {
+		return MagicLinkRequestResult{}, ErrAuthServiceTooManyRequests
+	}
+
+	code, err := utils.GenerateCode()
+	if err != nil {
+		return MagicLinkRequestResult{}, authErr.Errorf("generate code: %w", err)
+	}
+
+	challenge, err := utils.GenerateAuthChallenge()
+	if err != nil {
+		return MagicLinkRequestResult{}, authErr.Errorf("generate auth challenge: %w", err)
+	}
+
+	expires := t.Add(magicLinkRequestExpireDuration)
+
+	id, err := a.db.CreateMagicLinkRequest(ctx, database.CreateMagicLinkRequestParams{
+		Email:     email,
+		Code:      code,
+		Challenge: challenge,
+		Status:    string(MagicLinkStatusPending),
+		UserAgent: info.UserAgent,
+		IpAddress: info.IpAddress,
+		Expires:   expires.UnixMilli(),
+		DeleteAt:  t.Add(magicLinkRequestDeletionDuration).UnixMilli(),
+	})
+	if err != nil {
+		return MagicLinkRequestResult{}, authErr.Errorf("create magic link request: %w", err)
+	}
+
+	token, err := signPayload(a.magicLinkKey, magicLinkState{
+		RequestId: id,
+		Expires:   expires.Unix(),
+	})
+	if err != nil {
+		return MagicLinkRequestResult{}, authErr.Errorf("sign magic link: %w", err)
+	}
+
+	return MagicLinkRequestResult{
+		RequestId: id,
+		Challenge: challenge,
+		Code:      code,
+		Token:     token,
+		Expires:   expires,
+	}, nil
+}
+
+func (a *AuthService) getMagicLinkRequest(ctx context.Context, id string) (database.MagicLinkRequest, error) {
+	request, err := a.db.GetMagicLinkRequestById(ctx, id)
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return database.MagicLinkRequest{}, ErrAuthServiceRequestNotFound
+		}
+
+		return database.MagicLinkRequest{}, authErr.Errorf("get magic link request: %w", err)
+	}
+
+	// Check if the request is expired, and if it is set the request
+	// status to expired
+	if request.Status == string(MagicLinkStatusPending) && time.Now().After(time.UnixMilli(request.Expires)) {
+		_, err := a.db.SetMagicLinkRequestStatus(ctx, request.Id, request.Status, string(MagicLinkStatusExpired), "")
+		if err != nil {
+			return database.MagicLinkRequest{}, authErr.Errorf("set magic link request status: %w", err)
+		}
+
+		request.Status = string(MagicLinkStatusExpired)
+	}
+
+	return request, nil
+}
+
+// getMagicLinkRequestFromToken verifies the signed token from the link
+// and returns the pending request
+func (a *AuthService) getMagicLinkRequestFromToken(ctx context.Context, token string) (database.MagicLinkRequest, error) {
+	var state magicLinkState
+	err := verifyPayload(a.magicLinkKey, token, &state)
+	if err != nil {
+		return database.MagicLinkRequest{}, ErrAuthServiceRequestInvalid
+	}
+
+	if time.Now().After(time.Unix(state.Expires, 0)) {
+		return database.MagicLinkRequest{}, ErrAuthServiceRequestExpired
+	}
+
+	request, err := a.getMagicLinkRequest(ctx, state.RequestId)
+	if err != nil {
+		return database.MagicLinkRequest{}, err
+	}
+
+	switch MagicLinkStatus(request.Status) {
+	case MagicLinkStatusPending:
+		return request, nil
+	case MagicLinkStatusExpired:
+		return database.MagicLinkRequest{}, ErrAuthServiceRequestExpired
+	}
+
+	return database.MagicLinkRequest{}, ErrAuthServiceRequestAlreadyUsed
+}
+
+// MagicLinkRequest is the infomation shown on the page the link opens,
+// so the user can check that the request came from them
+type MagicLinkRequest struct {
+	Email string
+	Code  string
+
+	UserAgent string
+	IpAddress string
+}
+
+// GetMagicLinkRequest returns the pending request for the link
+func (a *AuthService) GetMagicLinkRequest(ctx context.Context, token string) (MagicLinkRequest, error) {
+	if !a.magicLinks {
+		return MagicLinkRequest{}, ErrAuthServiceMagicLinksDisabled
+	}
+
+	request, err := a.getMagicLinkRequestFromToken(ctx, token)
+	if err != nil {
+		return MagicLinkRequest{}, err
+	}
+
+	return MagicLinkRequest{
+		Email:     request.Email,
+		Code:      request.Code,
+		UserAgent: request.UserAgent,
+		IpAddress: request.IpAddress,
+	}, nil
+}
+
+// getOrCreateUserForEmail returns the user with the email, a new user is
+// created if no user has the email. The user opened the link sent to the
+// email so the email is marked as verified, and an account that was
+// never verified is taken over.
+func (a *AuthService) getOrCreateUserForEmail(ctx context.Context, email string) (string, error) {
+	user, err := a.db.GetUserByEmail(ctx, email)
+	if err == nil {
+		err := a.markEmailVerifiedByProof(ctx, user, "", "")
+		if err != nil {
+			return "", err
+		}
+
+		return user.Id, nil
+	}
+
+	if !errors.Is(err, database.ErrItemNotFound) {
+		return "", authErr.Errorf("get user by email: %w", err)
+	}
+
+	displayName, _, _ := strings.Cut(email, "@")
+
+	user, err = a.db.CreateUser(ctx, database.CreateUserParams{
+		Email:         email,
+		EmailVerified: true,
+		DisplayName:   displayName,
+		Role:          "user",
+	})
+	if err != nil {
+		return "", authErr.Errorf("create user: %w", err)
+	}
+
+	return user.Id, nil
+}
+
+// ConfirmMagicLink completes the request after the user opened the link,
+// the link can only be used once. After this the browser that started
+// the request can get the tokens with CreateAuthTokenForMagicLink.
+func (a *AuthService) ConfirmMagicLink(ctx context.Context, token string) error {
+	if !a.magicLinks {
+		return ErrAuthServiceMagicLinksDisabled
+	}
+
+	request, err := a.getMagicLinkRequestFromToken(ctx, token)
+	if err != nil {
+		return err
+	}
+
+	userId, err := a.getOrCreateUserForEmail(ctx, request.Email)
+	if err != nil {
+		return err
+	}
+
+	updated, err := a.db.SetMagicLinkRequestStatus(ctx, request.Id, string(MagicLinkStatusPending), string(MagicLinkStatusCompleted), userId)
+	if err != nil {
+		return authErr.Errorf("set magic link request status: %w", err)
+	}
+
+	if !updated {
+		return ErrAuthServiceRequestAlreadyUsed
+	}
+
+	return nil
+}
+
+func (a *AuthService) getMagicLinkRequestWithChallenge(ctx context.Context, id, challenge string) (database.MagicLinkRequest, error) {
+	request, err := a.getMagicLinkRequest(ctx, id)
+	if err != nil {
+		return database.MagicLinkRequest{}, err
+	}
+
+	// Test the challenge
+	if subtle.ConstantTimeCompare([]byte(request.Challenge), []byte(challenge)) != 1 {
+		return database.MagicLinkRequest{}, ErrAuthServiceRequestNotFound
+	}
+
+	return request, nil
+}
+
+// CheckMagicLinkRequestStatus returns the current status of the request,
+// polled by the browser that started the request
+func (a *AuthService) CheckMagicLinkRequestStatus(ctx context.Context, id, challenge string) (MagicLinkStatus, error) {
+	request, err := a.getMagicLinkRequestWithChallenge(ctx, id, challenge)
+	if err != nil {
+		return MagicLinkStatusExpired, err
+	}
+
+	return MagicLinkStatus(request.Status), nil
+}
+
+// CreateAuthTokenForMagicLink creates the user tokens if the link has
+// been opened, otherwise return error
+func (a *AuthService) CreateAuthTokenForMagicLink(ctx context.Context, id, challenge string, info ClientInfo) (UserTokens, error) {
+	request, err := a.getMagicLinkRequestWithChallenge(ctx, id, challenge)
+	if err != nil {
+		return UserTokens{}, err
+	}
+
+	switch MagicLinkStatus(request.Status) {
+	case MagicLinkStatusPending:
+		return UserTokens{}, ErrAuthServiceRequestNotReady
+	case MagicLinkStatusExpired:
+		return UserTokens{}, ErrAuthServiceRequestExpired
+	}
+
+	if !request.UserId.Valid {
+		return UserTokens{}, ErrAuthServiceRequestInvalid
+	}
+
+	// NOTE(patrik): Set the request status to be expired so that we
+	// can't generate the tokens after this
+	updated, err := a.db.SetMagicLinkRequestStatus(ctx, request.Id, string(MagicLinkStatusCompleted), string(MagicLinkStatusExpired), "")
+	if err != nil {
+		return UserTokens{}, authErr.Errorf("set magic link request status: %w", err)
+	}
+
+	if !updated {
+		return UserTokens{}, ErrAuthServiceRequestAlreadyUsed
+	}
+
+	return a.IssueLoginTokens(ctx, request.UserId.String, AuthMethodMagicLink, info)
+}
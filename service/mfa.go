@@ -0,0 +1,323 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/nanoteck137/authlab/database"
+	"github.com/nanoteck137/authlab/tools/utils"
+)
+
+var (
+	ErrAuthServiceMfaRequired         = authErr.Error("second factor required")
+	ErrAuthServiceInvalidMfaChallenge = authErr.Error("invalid mfa challenge")
+	ErrAuthServiceUnknownMfaMethod    = authErr.Error("unknown mfa method")
+	ErrAuthServiceMfaLocked           = authErr.Error("too many failed second factor attempts")
+)
+
+const (
+	// How long the user has to complete the second factor
+	mfaChallengeDuration = 5 * time.Minute
+
+	// How many wrong codes can be entered for a challenge, after that
+	// the user needs to log in again
+	mfaChallengeMaxAttempts = 5
+
+	// How many wrong codes can be entered across all the challenges of
+	// the user before the user is locked out, so a new challenge can't be
+	// created for every few guesses
+	mfaMaxFailedAttempts = 10
+	mfaLockoutDuration   = 15 * time.Minute
+)
+
+// The second factors the user can use to complete a challenge
+const (
+	MfaMethodTotp         = "totp"
+	MfaMethodPasskey      = "passkey"
+	MfaMethodRecoveryCode = "recovery-code"
+)
+
+// MfaRequiredError is returned instead of the tokens when the first
+// factor of the login succeeded but the user needs to complete a second
+// factor, the challenge is used with CompleteMfaChallenge
+type MfaRequiredError struct {
+	Challenge string
+	Methods   []string
+	Expires   time.Time
+}
+
+func (e *MfaRequiredError) Error() string {
+	return ErrAuthServiceMfaRequired.Error()
+}
+
+func (e *MfaRequiredError) Unwrap() error {
+	return ErrAuthServiceMfaRequired
+}
+
+// userMfaFactors returns the second factors the user has enabled, the
+// recovery codes are not counted as a factor
+func (a *AuthService) userMfaFactors(ctx context.Context, userId string) ([]string, error) {
+	var methods []string
+
+	totpEnabled, err := a.TotpEnabled(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if totpEnabled {
+		methods = append(methods, MfaMethodTotp)
+	}
+
+	if a.webauthn != nil {
+		passkeys, err := a.db.GetAllPasskeysForUser(ctx, userId)
+		if err != nil {
+			return nil, authErr.Errorf("get passkeys: %w", err)
+		}
+
+		if len(passkeys) > 0 {
+			methods = append(methods, MfaMethodPasskey)
+		}
+	}
+
+	return methods, nil
+}
+
+// userMfaMethods returns the methods the user can complete a challenge
+// with, empty if the user has no second factor enabled
+func (a *AuthService) userMfaMethods(ctx context.Context, userId string) ([]string, error) {
+	methods, err := a.userMfaFactors(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(methods) == 0 {
+		return nil, nil
+	}
+
+	remaining, err := a.RecoveryCodesRemaining(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if remaining > 0 {
+		methods = append(methods, MfaMethodRecoveryCode)
+	}
+
+	return methods, nil
+}
+
+// IssueLoginTokens is called when the first factor of a login succeeds,
+// returns the tokens if the user has no second factor enabled otherwise
+// returns a MfaRequiredError with the challenge
+func (a *AuthService) IssueLoginTokens(ctx context.Context, userId, authMethod string, info ClientInfo) (UserTokens, error) {
+	return a.issueLoginTokens(ctx, database.CreateSessionParams{
+		UserId:     userId,
+		AuthMethod: authMethod,
+		UserAgent:  info.UserAgent,
+		IpAddress:  info.IpAddress,
+	})
+}
+
+// issueLoginTokens is IssueLoginTokens with the session params, the
+// client and scope of the params is stored on the challenge so the
+// session created after the second factor is bound to the same client
+func (a *AuthService) issueLoginTokens(ctx context.Context, params database.CreateSessionParams) (UserTokens, error) {
+	// NOTE(patrik): Check the policy before the challenge is created, so
+	// the user doesn't enter the code just to be denied
+	err := a.checkLoginPolicy(ctx, params.UserId)
+	if err != nil {
+		return UserTokens{}, err
+	}
+
+	methods, err := a.userMfaMethods(ctx, params.UserId)
+	if err != nil {
+		return UserTokens{}, err
+	}
+
+	if len(methods) == 0 {
+		return a.issueSessionTokens(ctx, params)
+	}
+
+	challenge, err := utils.GenerateAuthChallenge()
+	if err != nil {
+		return UserTokens{}, authErr.Errorf("generate mfa challenge: %w", err)
+	}
+
+	expires := time.Now().Add(mfaChallengeDuration)
+
+	_, err = a.db.CreateMfaChallenge(ctx, database.CreateMfaChallengeParams{
+		UserId:        params.UserId,
+		ChallengeHash: hashToken(challenge),
+		AuthMethod:    params.AuthMethod,
+		ClientId:      params.ClientId,
+		Scope:         params.Scope,
+		Expires:       expires.UnixMilli(),
+	})
+	if err != nil {
+		return UserTokens{}, authErr.Errorf("create mfa challenge: %w", err)
+	}
+
+	return UserTokens{}, &MfaRequiredError{
+		Challenge: challenge,
+		Methods:   methods,
+		Expires:   expires,
+	}
+}
+
+// checkMfaCode checks the code for the second factor of the user, the
+// recovery codes are checked with useRecoveryCodeForChallenge instead
+func (a *AuthService) checkMfaCode(ctx context.Context, userId, method, code string) (bool, error) {
+	switch method {
+	case MfaMethodTotp:
+		totp, err := a.getUserTotp(ctx, userId)
+		if err != nil {
+			if errors.Is(err, ErrAuthServiceTotpNotEnabled) {
+				return false, nil
+			}
+
+			return false, err
+		}
+
+		if totp.Enabled == 0 {
+			return false, nil
+		}
+
+		return a.checkTotpCode(ctx, totp, code)
+	}
+
+	return false, ErrAuthServiceUnknownMfaMethod
+}
+
+// checkMfaLockout returns ErrAuthServiceMfaLocked if the user has
+// entered too many wrong codes
+func (a *AuthService) checkMfaLockout(ctx context.Context, userId string) error {
+	lockout, err := a.db.GetMfaLockout(ctx, userId)
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return nil
+		}
+
+		return authErr.Errorf("get mfa lockout: %w", err)
+	}
+
+	if time.Now().Before(time.UnixMilli(lockout.LockedUntil)) {
+		return ErrAuthServiceMfaLocked
+	}
+
+	return nil
+}
+
+// getMfaChallenge returns the challenge if it can still be completed
+func (a *AuthService) getMfaChallenge(ctx context.Context, challenge string) (database.MfaChallenge, error) {
+	mfaChallenge, err := a.db.GetMfaChallengeByHash(ctx, hashToken(challenge))
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return database.MfaChallenge{}, ErrAuthServiceInvalidMfaChallenge
+		}
+
+		return database.MfaChallenge{}, authErr.Errorf("get mfa challenge: %w", err)
+	}
+
+	if mfaChallenge.Used > 0 ||
+		mfaChallenge.Attempts >= mfaChallengeMaxAttempts ||
+		time.Now().After(time.UnixMilli(mfaChallenge.Expires)) {
+		return database.MfaChallenge{}, ErrAuthServiceInvalidMfaChallenge
+	}
+
+	err = a.checkMfaLockout(ctx, mfaChallenge.UserId)
+	if err != nil {
+		return database.MfaChallenge{}, err
+	}
+
+	return mfaChallenge, nil
+}
+
+// completeMfaChallenge returns the tokens if the second factor was valid,
+// otherwise the failed attempt is counted for both the challenge and the
+// user
+func (a *AuthService) completeMfaChallenge(ctx context.Context, mfaChallenge database.MfaChallenge, method string, valid bool, info ClientInfo) (UserTokens, error) {
+	if !valid {
+		locked, err := a.db.AddMfaFailedAttempt(ctx, mfaChallenge.UserId, mfaMaxFailedAttempts, time.Now().Add(mfaLockoutDuration).UnixMilli())
+		if err != nil {
+			return UserTokens{}, authErr.Errorf("add mfa failed attempt: %w", err)
+		}
+
+		if locked {
+			return UserTokens{}, ErrAuthServiceMfaLocked
+		}
+
+		ok, err := a.db.AddMfaChallengeAttempt(ctx, mfaChallenge.Id, mfaChallengeMaxAttempts)
+		if err != nil {
+			return UserTokens{}, authErr.Errorf("add mfa challenge attempt: %w", err)
+		}
+
+		if !ok {
+			return UserTokens{}, ErrAuthServiceInvalidMfaChallenge
+		}
+
+		return UserTokens{}, ErrAuthServiceInvalidMfaCode
+	}
+
+	used, err := a.db.MarkMfaChallengeUsed(ctx, mfaChallenge.Id)
+	if err != nil {
+		return UserTokens{}, authErr.Errorf("mark mfa challenge used: %w", err)
+	}
+
+	if !used {
+		return UserTokens{}, ErrAuthServiceInvalidMfaChallenge
+	}
+
+	return a.issueMfaSessionTokens(ctx, mfaChallenge, method, info)
+}
+
+// issueMfaSessionTokens creates the session after the challenge has been
+// marked as used
+func (a *AuthService) issueMfaSessionTokens(ctx context.Context, mfaChallenge database.MfaChallenge, method string, info ClientInfo) (UserTokens, error) {
+	err := a.db.ResetMfaFailedAttempts(ctx, mfaChallenge.UserId)
+	if err != nil {
+		return UserTokens{}, authErr.Errorf("reset mfa failed attempts: %w", err)
+	}
+
+	return a.issueSessionTokens(ctx, database.CreateSessionParams{
+		UserId:     mfaChallenge.UserId,
+		AuthMethod: mfaChallenge.AuthMethod + "+" + method,
+		UserAgent:  info.UserAgent,
+		IpAddress:  info.IpAddress,
+		ClientId:   mfaChallenge.ClientId,
+		Scope:      mfaChallenge.Scope,
+	})
+}
+
+// CompleteMfaChallenge checks the code for the second factor and returns
+// the tokens, the challenge can only be used once. Returns
+// ErrAuthServiceMfaLocked if the user has entered too many wrong codes.
+func (a *AuthService) CompleteMfaChallenge(ctx context.Context, challenge, method, code string, info ClientInfo) (UserTokens, error) {
+	mfaChallenge, err := a.getMfaChallenge(ctx, challenge)
+	if err != nil {
+		return UserTokens{}, err
+	}
+
+	// NOTE(patrik): The recovery code is only used up together with the
+	// challenge, so a code isn't lost on a challenge that can't be
+	// completed
+	if method == MfaMethodRecoveryCode {
+		valid, err := a.useRecoveryCodeForChallenge(ctx, mfaChallenge, code, info)
+		if err != nil {
+			return UserTokens{}, err
+		}
+
+		if !valid {
+			return a.completeMfaChallenge(ctx, mfaChallenge, method, false, info)
+		}
+
+		return a.issueMfaSessionTokens(ctx, mfaChallenge, method, info)
+	}
+
+	valid, err := a.checkMfaCode(ctx, mfaChallenge.UserId, method, code)
+	if err != nil {
+		return UserTokens{}, err
+	}
+
+	return a.completeMfaChallenge(ctx, mfaChallenge, method, valid, info)
+}
@@ -0,0 +1,732 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nanoteck137/authlab/config"
+	"github.com/nanoteck137/authlab/database"
+	"github.com/nanoteck137/authlab/tools/utils"
+	"github.com/nanoteck137/authlab/types"
+)
+
+var (
+	ErrAuthServiceClientNotFound      = authErr.Error("oauth client not found")
+	ErrAuthServiceClientAlreadyExists = authErr.Error("oauth client already exists")
+	ErrAuthServiceClientIsStatic      = authErr.Error("oauth client is defined in the config")
+	ErrAuthServiceClientIsPublic      = authErr.Error("oauth client is public and has no secret")
+	ErrAuthServiceInvalidClient       = authErr.Error("invalid oauth client credentials")
+	ErrAuthServiceUnauthorizedClient  = authErr.Error("oauth client is not allowed to use the grant type")
+	ErrAuthServiceInvalidGrantType    = authErr.Error("invalid grant type")
+	ErrAuthServiceInvalidLogoUrl      = authErr.Error("invalid logo url")
+	ErrAuthServiceInvalidAudience     = authErr.Error("invalid audience")
+	ErrAuthServicePublicClientGrant   = authErr.Error("public clients can't use the grant type")
+)
+
+const (
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeRefreshToken      = "refresh_token"
+	GrantTypeClientCredentials = "client_credentials"
+	GrantTypeTokenExchange     = "urn:ietf:params:oauth:grant-type:token-exchange"
+	GrantTypeDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code"
+)
+
+// The grant types where the client acts on its own, these are only
+// authenticated with the secret so public clients can't use them
+var confidentialGrantTypes = []string{
+	GrantTypeClientCredentials,
+	GrantTypeTokenExchange,
+}
+
+// The grant types that clients can be allowed to use
+var SupportedGrantTypes = []string{
+	GrantTypeAuthorizationCode,
+	GrantTypeRefreshToken,
+	GrantTypeClientCredentials,
+	GrantTypeTokenExchange,
+	GrantTypeDeviceCode,
+}
+
+// The grant types clients gets when none is specified
+var defaultGrantTypes = []string{
+	GrantTypeAuthorizationCode,
+	GrantTypeRefreshToken,
+}
+
+// OAuthClient is a client that uses authlab as an OpenID Connect
+// provider
+type OAuthClient struct {
+	Id      string
+	Name    string
+	LogoUrl string
+
+	// Public clients has no secret and needs to use PKCE
+	Public bool
+
+	// Trusted clients are first party apps that skips the consent screen
+	Trusted bool
+
+	RedirectUris []string
+	GrantTypes   []string
+	Scopes       []string
+
+	// The audiences the client can request tokens for with the client
+	// credentials grant, the tokens are issued for all of them when the
+	// client doesn't ask for a specific audience
+	Audiences []string
+
+	// The policy for the token exchange grant, the audiences the client
+	// can exchange tokens for and the scopes the new tokens can have.
+	// When ExchangeScopes is empty the client can't exchange tokens.
+	ExchangeAudiences []string
+	ExchangeScopes    []string
+
+	// Static clients comes from the config file and can't be changed
+	// at runtime
+	Static bool
+
+	Created time.Time
+	Updated time.Time
+
+	// The hash of the secret, empty for public clients
+	secretHash string
+
+	// The hash of the registration access token, only set for clients
+	// registered with the dynamic client registration endpoint
+	registrationTokenHash string
+}
+
+// IsPublic returns true if the client has no secret, public clients
+// needs to use PKCE
+func (c *OAuthClient) IsPublic() bool {
+	return c.Public
+}
+
+func (c *OAuthClient) HasRedirectUri(uri string) bool {
+	return slices.Contains(c.RedirectUris, uri)
+}
+
+func (c *OAuthClient) HasGrantType(grantType string) bool {
+	return slices.Contains(c.GrantTypes, grantType)
+}
+
+func (c *OAuthClient) HasAudience(audience string) bool {
+	return slices.Contains(c.Audiences, audience)
+}
+
+func (c *OAuthClient) HasExchangeAudience(audience string) bool {
+	return slices.Contains(c.ExchangeAudiences, audience)
+}
+
+// HasScopes checks that the client is allowed to request all of the
+// scopes
+func (c *OAuthClient) HasScopes(scopes []string) bool {
+	for _, s := range scopes {
+		if !slices.Contains(c.Scopes, s) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newOAuthClients(clients map[string]config.ConfigOAuthClient) (map[string]*OAuthClient, error) {
+	res := make(map[string]*OAuthClient, len(clients))
+
+	for id, client := range clients {
+		name := client.Name
+		if name == "" {
+			name = id
+		}
+
+		c := &OAuthClient{
+			Id:           id,
+			Name:         name,
+			Public:       client.Secret == "",
+			Trusted:      client.Trusted,
+			RedirectUris: client.RedirectUris,
+			GrantTypes:   defaultGrantTypes,
+			Scopes:       SupportedScopes,
+			Static:       true,
+		}
+
+		if len(client.GrantTypes) > 0 {
+			c.GrantTypes = client.GrantTypes
+		}
+
+		err := validateGrantTypes(c.GrantTypes)
+		if err != nil {
+			return nil, authErr.Errorf("oauth client %q: %w", id, err)
+		}
+
+		if c.Public {
+			for _, grantType := range confidentialGrantTypes {
+				if c.HasGrantType(grantType) {
+					return nil, authErr.Errorf("oauth client %q: %w", id, ErrAuthServicePublicClientGrant)
+				}
+			}
+		}
+
+		if !c.Public {
+			c.secretHash = hashToken(client.Secret)
+		}
+
+		res[id] = c
+	}
+
+	return res, nil
+}
+
+func newOAuthClientFromDb(client database.OAuthClient) *OAuthClient {
+	return &OAuthClient{
+		Id:           client.Id,
+		Name:         client.Name,
+		LogoUrl:      client.LogoUrl.String,
+		Public:       client.Public > 0,
+		Trusted:      client.Trusted > 0,
+		RedirectUris: strings.Fields(client.RedirectUris),
+		GrantTypes:   strings.Fields(client.GrantTypes),
+		Scopes:       strings.Fields(client.Scopes),
+		Audiences:    strings.Fields(client.Audiences),
+		Created:      time.UnixMilli(client.Created),
+		Updated:      time.UnixMilli(client.Updated),
+		secretHash:   client.SecretHash.String,
+
+		ExchangeAudiences: strings.Fields(client.ExchangeAudiences),
+		ExchangeScopes:    strings.Fields(client.ExchangeScopes),
+
+		registrationTokenHash: client.RegistrationTokenHash.String,
+	}
+}
+
+// GetOAuthClient returns the client, the clients from the config file
+// takes priority over the clients stored inside the database
+func (a *AuthService) GetOAuthClient(ctx context.Context, clientId string) (*OAuthClient, error) {
+	client, exists := a.clients[clientId]
+	if exists {
+		return client, nil
+	}
+
+	dbClient, err := a.db.GetOAuthClientById(ctx, clientId)
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return nil, ErrAuthServiceClientNotFound
+		}
+
+		return nil, authErr.Errorf("get oauth client: %w", err)
+	}
+
+	return newOAuthClientFromDb(dbClient), nil
+}
+
+// GetAllOAuthClients returns the clients from the config file followed
+// by the clients stored inside the database
+func (a *AuthService) GetAllOAuthClients(ctx context.Context) ([]*OAuthClient, error) {
+	res := make([]*OAuthClient, 0, len(a.clients))
+	for _, client := range a.clients {
+		res = append(res, client)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Id < res[j].Id
+	})
+
+	clients, err := a.db.GetAllOAuthClients(ctx)
+	if err != nil {
+		return nil, authErr.Errorf("get all oauth clients: %w", err)
+	}
+
+	for _, client := range clients {
+		res = append(res, newOAuthClientFromDb(client))
+	}
+
+	return res, nil
+}
+
+// AuthenticateOAuthClient checks the credentials of the client, public
+// clients authenticates with only the client id
+func (a *AuthService) AuthenticateOAuthClient(ctx context.Context, clientId, secret string) (*OAuthClient, error) {
+	client, err := a.GetOAuthClient(ctx, clientId)
+	if err != nil {
+		if errors.Is(err, ErrAuthServiceClientNotFound) {
+			return nil, ErrAuthServiceInvalidClient
+		}
+
+		return nil, err
+	}
+
+	if client.IsPublic() {
+		if secret != "" {
+			return nil, ErrAuthServiceInvalidClient
+		}
+
+		return client, nil
+	}
+
+	if secret == "" || subtle.ConstantTimeCompare([]byte(client.secretHash), []byte(hashToken(secret))) != 1 {
+		return nil, ErrAuthServiceInvalidClient
+	}
+
+	return client, nil
+}
+
+// CheckClientGrant checks that the client a token was issued to is still
+// allowed to use the grant type the token came from, the tokens stops
+// working when the client is deleted or loses the grant type
+func (a *AuthService) CheckClientGrant(ctx context.Context, clientId, grantType string) (*OAuthClient, error) {
+	client, err := a.GetOAuthClient(ctx, clientId)
+	if err != nil {
+		if errors.Is(err, ErrAuthServiceClientNotFound) {
+			return nil, ErrAuthServiceUnauthorizedClient
+		}
+
+		return nil, err
+	}
+
+	if !client.HasGrantType(grantType) {
+		return nil, ErrAuthServiceUnauthorizedClient
+	}
+
+	return client, nil
+}
+
+func validateRedirectUris(uris []string) error {
+	for _, uri := range uris {
+		// NOTE(patrik): The uris are stored space separated
+		if strings.ContainsAny(uri, " \t\r\n") {
+			return ErrAuthServiceInvalidRedirectUri
+		}
+
+		// NOTE(patrik): Native apps uses custom schemes without a host,
+		// so only require the uri to be absolute (RFC 6749 section 3.1.2)
+		u, err := url.Parse(uri)
+		if err != nil || !u.IsAbs() || u.Fragment != "" {
+			return ErrAuthServiceInvalidRedirectUri
+		}
+	}
+
+	return nil
+}
+
+func validateGrantTypes(grantTypes []string) error {
+	for _, grantType := range grantTypes {
+		if !slices.Contains(SupportedGrantTypes, grantType) {
+			return ErrAuthServiceInvalidGrantType
+		}
+	}
+
+	return nil
+}
+
+// isScopeToken checks that the value only contains the characters
+// allowed inside a scope (RFC 6749 section 3.3), the same rule is used
+// for audiences
+func isScopeToken(value string) bool {
+	if value == "" {
+		return false
+	}
+
+	for _, c := range value {
+		if c < 0x21 || c > 0x7e || c == '"' || c == '\\' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// validateScopes checks the scopes of a client, besides the OpenID
+// Connect scopes the clients can have custom scopes that are used with
+// the client credentials grant
+func validateScopes(scopes []string) error {
+	for _, s := range scopes {
+		if !isScopeToken(s) {
+			return ErrAuthServiceInvalidScope
+		}
+	}
+
+	return nil
+}
+
+func validateAudiences(audiences []string) error {
+	for _, audience := range audiences {
+		if !isScopeToken(audience) {
+			return ErrAuthServiceInvalidAudience
+		}
+	}
+
+	return nil
+}
+
+func validateLogoUrl(logoUrl string) error {
+	if logoUrl == "" {
+		return nil
+	}
+
+	u, err := url.Parse(logoUrl)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return ErrAuthServiceInvalidLogoUrl
+	}
+
+	return nil
+}
+
+func validateOAuthClient(client *OAuthClient) error {
+	err := validateRedirectUris(client.RedirectUris)
+	if err != nil {
+		return err
+	}
+
+	err = validateGrantTypes(client.GrantTypes)
+	if err != nil {
+		return err
+	}
+
+	err = validateScopes(client.Scopes)
+	if err != nil {
+		return err
+	}
+
+	err = validateAudiences(client.Audiences)
+	if err != nil {
+		return err
+	}
+
+	err = validateLogoUrl(client.LogoUrl)
+	if err != nil {
+		return err
+	}
+
+	if client.HasGrantType(GrantTypeAuthorizationCode) && len(client.RedirectUris) == 0 {
+		return ErrAuthServiceInvalidRedirectUri
+	}
+
+	err = validateAudiences(client.ExchangeAudiences)
+	if err != nil {
+		return err
+	}
+
+	err = validateScopes(client.ExchangeScopes)
+	if err != nil {
+		return err
+	}
+
+	if client.Public {
+		for _, grantType := range confidentialGrantTypes {
+			if client.HasGrantType(grantType) {
+				return ErrAuthServicePublicClientGrant
+			}
+		}
+	}
+
+	return nil
+}
+
+func generateClientSecret() (string, string, error) {
+	secret, err := utils.GenerateAuthChallenge()
+	if err != nil {
+		return "", "", authErr.Errorf("generate client secret: %w", err)
+	}
+
+	return secret, hashToken(secret), nil
+}
+
+type CreateOAuthClientParams struct {
+	// Generated when empty
+	Id string
+
+	Name    string
+	LogoUrl string
+
+	Public  bool
+	Trusted bool
+
+	RedirectUris []string
+
+	// Defaults to "authorization_code" and "refresh_token"
+	GrantTypes []string
+
+	// Defaults to all the supported scopes
+	Scopes []string
+
+	Audiences []string
+
+	ExchangeAudiences []string
+	ExchangeScopes    []string
+}
+
+// CreateOAuthClient registers a new client, for confidential clients the
+// secret is returned and it's only available here, only the hash of the
+// secret is stored
+func (a *AuthService) CreateOAuthClient(ctx context.Context, params CreateOAuthClientParams) (*OAuthClient, string, error) {
+	return a.createOAuthClient(ctx, params, "")
+}
+
+func (a *AuthService) createOAuthClient(ctx context.Context, params CreateOAuthClientParams, registrationTokenHash string) (*OAuthClient, string, error) {
+	if _, exists := a.clients[params.Id]; exists {
+		return nil, "", ErrAuthServiceClientAlreadyExists
+	}
+
+	client := &OAuthClient{
+		Id:           params.Id,
+		Name:         params.Name,
+		LogoUrl:      params.LogoUrl,
+		Public:       params.Public,
+		Trusted:      params.Trusted,
+		RedirectUris: params.RedirectUris,
+		GrantTypes:   params.GrantTypes,
+		Scopes:       params.Scopes,
+		Audiences:    params.Audiences,
+
+		ExchangeAudiences: params.ExchangeAudiences,
+		ExchangeScopes:    params.ExchangeScopes,
+	}
+
+	if len(client.GrantTypes) == 0 {
+		client.GrantTypes = defaultGrantTypes
+	}
+
+	if len(client.Scopes) == 0 {
+		client.Scopes = SupportedScopes
+	}
+
+	err := validateOAuthClient(client)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var secret string
+	var secretHash sql.NullString
+
+	if !client.Public {
+		secret, secretHash.String, err = generateClientSecret()
+		if err != nil {
+			return nil, "", err
+		}
+
+		secretHash.Valid = true
+	}
+
+	dbClient, err := a.db.CreateOAuthClient(ctx, database.CreateOAuthClientParams{
+		Id:   client.Id,
+		Name: client.Name,
+		LogoUrl: sql.NullString{
+			String: client.LogoUrl,
+			Valid:  client.LogoUrl != "",
+		},
+		Public:     client.Public,
+		SecretHash: secretHash,
+		Trusted:    client.Trusted,
+		RegistrationTokenHash: sql.NullString{
+			String: registrationTokenHash,
+			Valid:  registrationTokenHash != "",
+		},
+		RedirectUris: strings.Join(client.RedirectUris, " "),
+		GrantTypes:   strings.Join(client.GrantTypes, " "),
+		Scopes:       strings.Join(client.Scopes, " "),
+		Audiences:    strings.Join(client.Audiences, " "),
+
+		ExchangeAudiences: strings.Join(client.ExchangeAudiences, " "),
+		ExchangeScopes:    strings.Join(client.ExchangeScopes, " "),
+	})
+	if err != nil {
+		if errors.Is(err, database.ErrItemAlreadyExists) {
+			return nil, "", ErrAuthServiceClientAlreadyExists
+		}
+
+		return nil, "", authErr.Errorf("create oauth client: %w", err)
+	}
+
+	return newOAuthClientFromDb(dbClient), secret, nil
+}
+
+// OAuthClientChanges is the changes to a client, nil fields are left
+// unchanged
+type OAuthClientChanges struct {
+	Name    *string
+	LogoUrl *string
+	Trusted *bool
+
+	RedirectUris *[]string
+	GrantTypes   *[]string
+	Scopes       *[]string
+	Audiences    *[]string
+
+	ExchangeAudiences *[]string
+	ExchangeScopes    *[]string
+}
+
+// getDbOAuthClient returns the client if it's stored inside the
+// database, the clients from the config can't be changed
+func (a *AuthService) getDbOAuthClient(ctx context.Context, clientId string) (*OAuthClient, error) {
+	client, err := a.GetOAuthClient(ctx, clientId)
+	if err != nil {
+		return nil, err
+	}
+
+	if client.Static {
+		return nil, ErrAuthServiceClientIsStatic
+	}
+
+	return client, nil
+}
+
+func (a *AuthService) UpdateOAuthClient(ctx context.Context, clientId string, changes OAuthClientChanges) (*OAuthClient, error) {
+	client, err := a.getDbOAuthClient(ctx, clientId)
+	if err != nil {
+		return nil, err
+	}
+
+	dbChanges := database.OAuthClientChanges{}
+
+	if changes.Name != nil {
+		client.Name = *changes.Name
+		dbChanges.Name = types.Change[string]{
+			Value:   client.Name,
+			Changed: true,
+		}
+	}
+
+	if changes.LogoUrl != nil {
+		client.LogoUrl = *changes.LogoUrl
+		dbChanges.LogoUrl = types.Change[sql.NullString]{
+			Value: sql.NullString{
+				String: client.LogoUrl,
+				Valid:  client.LogoUrl != "",
+			},
+			Changed: true,
+		}
+	}
+
+	if changes.Trusted != nil {
+		client.Trusted = *changes.Trusted
+
+		trusted := 0
+		if client.Trusted {
+			trusted = 1
+		}
+
+		dbChanges.Trusted = types.Change[int]{
+			Value:   trusted,
+			Changed: true,
+		}
+	}
+
+	if changes.RedirectUris != nil {
+		client.RedirectUris = *changes.RedirectUris
+		dbChanges.RedirectUris = types.Change[string]{
+			Value:   strings.Join(client.RedirectUris, " "),
+			Changed: true,
+		}
+	}
+
+	if changes.GrantTypes != nil {
+		client.GrantTypes = *changes.GrantTypes
+		dbChanges.GrantTypes = types.Change[string]{
+			Value:   strings.Join(client.GrantTypes, " "),
+			Changed: true,
+		}
+	}
+
+	if changes.Scopes != nil {
+		client.Scopes = *changes.Scopes
+		dbChanges.Scopes = types.Change[string]{
+			Value:   strings.Join(client.Scopes, " "),
+			Changed: true,
+		}
+	}
+
+	if changes.Audiences != nil {
+		client.Audiences = *changes.Audiences
+		dbChanges.Audiences = types.Change[string]{
+			Value:   strings.Join(client.Audiences, " "),
+			Changed: true,
+		}
+	}
+
+	if changes.ExchangeAudiences != nil {
+		client.ExchangeAudiences = *changes.ExchangeAudiences
+		dbChanges.ExchangeAudiences = types.Change[string]{
+			Value:   strings.Join(client.ExchangeAudiences, " "),
+			Changed: true,
+		}
+	}
+
+	if changes.ExchangeScopes != nil {
+		client.ExchangeScopes = *changes.ExchangeScopes
+		dbChanges.ExchangeScopes = types.Change[string]{
+			Value:   strings.Join(client.ExchangeScopes, " "),
+			Changed: true,
+		}
+	}
+
+	err = validateOAuthClient(client)
+	if err != nil {
+		return nil, err
+	}
+
+	err = a.db.UpdateOAuthClient(ctx, client.Id, dbChanges)
+	if err != nil {
+		return nil, authErr.Errorf("update oauth client: %w", err)
+	}
+
+	return a.GetOAuthClient(ctx, client.Id)
+}
+
+// RotateOAuthClientSecret generates a new secret for the client, the old
+// secret stops working right away
+func (a *AuthService) RotateOAuthClientSecret(ctx context.Context, clientId string) (string, error) {
+	client, err := a.getDbOAuthClient(ctx, clientId)
+	if err != nil {
+		return "", err
+	}
+
+	if client.Public {
+		return "", ErrAuthServiceClientIsPublic
+	}
+
+	secret, secretHash, err := generateClientSecret()
+	if err != nil {
+		return "", err
+	}
+
+	err = a.db.UpdateOAuthClientSecret(ctx, client.Id, secretHash)
+	if err != nil {
+		return "", authErr.Errorf("update oauth client secret: %w", err)
+	}
+
+	return secret, nil
+}
+
+// DeleteOAuthClient removes the client together with all the sessions
+// and grants created for the client
+func (a *AuthService) DeleteOAuthClient(ctx context.Context, clientId string) error {
+	client, err := a.getDbOAuthClient(ctx, clientId)
+	if err != nil {
+		return err
+	}
+
+	err = a.db.DeleteAllSessionsForClient(ctx, client.Id)
+	if err != nil {
+		return authErr.Errorf("delete sessions for client: %w", err)
+	}
+
+	err = a.db.DeleteAllUserGrantsForClient(ctx, client.Id)
+	if err != nil {
+		return authErr.Errorf("delete grants for client: %w", err)
+	}
+
+	err = a.db.DeleteOAuthClient(ctx, client.Id)
+	if err != nil {
+		return authErr.Errorf("delete oauth client: %w", err)
+	}
+
+	return nil
+}
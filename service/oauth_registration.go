@@ -0,0 +1,270 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/nanoteck137/authlab/database"
+	"github.com/nanoteck137/authlab/tools/utils"
+)
+
+var (
+	ErrAuthServiceInitialAccessTokenNotFound = authErr.Error("initial access token not found")
+	ErrAuthServiceInvalidInitialAccessToken  = authErr.Error("invalid initial access token")
+	ErrAuthServiceInvalidRegistrationToken   = authErr.Error("invalid registration access token")
+	ErrAuthServiceClientTypeChanged          = authErr.Error("oauth client can't change between public and confidential")
+)
+
+// InitialAccessToken is a token that allows clients to register
+// themselves with the dynamic client registration endpoint, the token
+// can be used until it expires or is deleted
+type InitialAccessToken struct {
+	Id   string
+	Name string
+
+	// The admin that created the token, empty when created with the cli
+	UserId string
+
+	// Zero if the token never expires
+	Expires time.Time
+
+	// Zero if the token hasn't been used
+	LastUsed time.Time
+
+	Created time.Time
+}
+
+func newInitialAccessToken(token database.OAuthInitialAccessToken) InitialAccessToken {
+	res := InitialAccessToken{
+		Id:      token.Id,
+		Name:    token.Name,
+		UserId:  token.UserId.String,
+		Created: time.UnixMilli(token.Created),
+	}
+
+	if token.Expires.Valid {
+		res.Expires = time.UnixMilli(token.Expires.Int64)
+	}
+
+	if token.LastUsed.Valid {
+		res.LastUsed = time.UnixMilli(token.LastUsed.Int64)
+	}
+
+	return res
+}
+
+// CreateInitialAccessToken creates a new initial access token, the token
+// is only returned here. A duration of zero creates a token that never
+// expires.
+func (a *AuthService) CreateInitialAccessToken(ctx context.Context, userId, name string, duration time.Duration) (InitialAccessToken, string, error) {
+	token, err := utils.GenerateAuthChallenge()
+	if err != nil {
+		return InitialAccessToken{}, "", authErr.Errorf("generate initial access token: %w", err)
+	}
+
+	var expires sql.NullInt64
+	if duration > 0 {
+		expires = sql.NullInt64{
+			Int64: time.Now().Add(duration).UnixMilli(),
+			Valid: true,
+		}
+	}
+
+	res, err := a.db.CreateOAuthInitialAccessToken(ctx, database.CreateOAuthInitialAccessTokenParams{
+		TokenHash: hashToken(token),
+		Name:      name,
+		UserId: sql.NullString{
+			String: userId,
+			Valid:  userId != "",
+		},
+		Expires: expires,
+	})
+	if err != nil {
+		return InitialAccessToken{}, "", authErr.Errorf("create initial access token: %w", err)
+	}
+
+	return newInitialAccessToken(res), token, nil
+}
+
+func (a *AuthService) GetAllInitialAccessTokens(ctx context.Context) ([]InitialAccessToken, error) {
+	tokens, err := a.db.GetAllOAuthInitialAccessTokens(ctx)
+	if err != nil {
+		return nil, authErr.Errorf("get all initial access tokens: %w", err)
+	}
+
+	res := make([]InitialAccessToken, len(tokens))
+	for i, token := range tokens {
+		res[i] = newInitialAccessToken(token)
+	}
+
+	return res, nil
+}
+
+func (a *AuthService) DeleteInitialAccessToken(ctx context.Context, id string) error {
+	_, err := a.db.GetOAuthInitialAccessTokenById(ctx, id)
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return ErrAuthServiceInitialAccessTokenNotFound
+		}
+
+		return authErr.Errorf("get initial access token: %w", err)
+	}
+
+	err = a.db.DeleteOAuthInitialAccessToken(ctx, id)
+	if err != nil {
+		return authErr.Errorf("delete initial access token: %w", err)
+	}
+
+	return nil
+}
+
+func (a *AuthService) useInitialAccessToken(ctx context.Context, token string) error {
+	res, err := a.db.GetOAuthInitialAccessTokenByHash(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return ErrAuthServiceInvalidInitialAccessToken
+		}
+
+		return authErr.Errorf("get initial access token: %w", err)
+	}
+
+	now := time.Now()
+
+	if res.Expires.Valid && now.After(time.UnixMilli(res.Expires.Int64)) {
+		return ErrAuthServiceInvalidInitialAccessToken
+	}
+
+	err = a.db.UpdateOAuthInitialAccessTokenLastUsed(ctx, res.Id, now.UnixMilli())
+	if err != nil {
+		return authErr.Errorf("update initial access token last used: %w", err)
+	}
+
+	return nil
+}
+
+// ClientMetadata is the metadata a client sends when registering itself
+// (RFC 7591 section 2), empty grant types and scopes gets the defaults
+type ClientMetadata struct {
+	Name    string
+	LogoUrl string
+
+	Public bool
+
+	RedirectUris []string
+	GrantTypes   []string
+	Scopes       []string
+}
+
+// RegisteredClient is the result of a client registering itself, the
+// secret and the registration access token are only returned here
+type RegisteredClient struct {
+	Client *OAuthClient
+
+	// Empty for public clients
+	Secret string
+
+	// The token the client uses to read, update and delete the
+	// registration (RFC 7592)
+	RegistrationToken string
+}
+
+// RegisterOAuthClient registers a new client with the dynamic client
+// registration endpoint, the request needs a valid initial access token
+func (a *AuthService) RegisterOAuthClient(ctx context.Context, initialAccessToken string, metadata ClientMetadata) (RegisteredClient, error) {
+	err := a.useInitialAccessToken(ctx, initialAccessToken)
+	if err != nil {
+		return RegisteredClient{}, err
+	}
+
+	registrationToken, err := utils.GenerateAuthChallenge()
+	if err != nil {
+		return RegisteredClient{}, authErr.Errorf("generate registration access token: %w", err)
+	}
+
+	// NOTE(patrik): The client name is optional but the database
+	// requires a name, so fallback to the client id
+	id := utils.CreateOAuthClientId()
+
+	name := metadata.Name
+	if name == "" {
+		name = id
+	}
+
+	client, secret, err := a.createOAuthClient(ctx, CreateOAuthClientParams{
+		Id:           id,
+		Name:         name,
+		LogoUrl:      metadata.LogoUrl,
+		Public:       metadata.Public,
+		RedirectUris: metadata.RedirectUris,
+		GrantTypes:   metadata.GrantTypes,
+		Scopes:       metadata.Scopes,
+	}, hashToken(registrationToken))
+	if err != nil {
+		return RegisteredClient{}, err
+	}
+
+	return RegisteredClient{
+		Client:            client,
+		Secret:            secret,
+		RegistrationToken: registrationToken,
+	}, nil
+}
+
+// AuthenticateClientRegistration checks the registration access token of
+// the client, only the clients registered with the dynamic client
+// registration endpoint has a registration access token
+func (a *AuthService) AuthenticateClientRegistration(ctx context.Context, clientId, registrationToken string) (*OAuthClient, error) {
+	client, err := a.GetOAuthClient(ctx, clientId)
+	if err != nil {
+		if errors.Is(err, ErrAuthServiceClientNotFound) {
+			return nil, ErrAuthServiceInvalidRegistrationToken
+		}
+
+		return nil, err
+	}
+
+	if client.registrationTokenHash == "" || registrationToken == "" {
+		return nil, ErrAuthServiceInvalidRegistrationToken
+	}
+
+	if subtle.ConstantTimeCompare([]byte(client.registrationTokenHash), []byte(hashToken(registrationToken))) != 1 {
+		return nil, ErrAuthServiceInvalidRegistrationToken
+	}
+
+	return client, nil
+}
+
+// UpdateRegisteredOAuthClient replaces the metadata of the client
+// (RFC 7592 section 2.2), the fields that are left out are reset to the
+// defaults
+func (a *AuthService) UpdateRegisteredOAuthClient(ctx context.Context, client *OAuthClient, metadata ClientMetadata) (*OAuthClient, error) {
+	if metadata.Public != client.Public {
+		return nil, ErrAuthServiceClientTypeChanged
+	}
+
+	name := metadata.Name
+	if name == "" {
+		name = client.Id
+	}
+
+	grantTypes := metadata.GrantTypes
+	if len(grantTypes) == 0 {
+		grantTypes = defaultGrantTypes
+	}
+
+	scopes := metadata.Scopes
+	if len(scopes) == 0 {
+		scopes = SupportedScopes
+	}
+
+	return a.UpdateOAuthClient(ctx, client.Id, OAuthClientChanges{
+		Name:         &name,
+		LogoUrl:      &metadata.LogoUrl,
+		RedirectUris: &metadata.RedirectUris,
+		GrantTypes:   &grantTypes,
+		Scopes:       &scopes,
+	})
+}
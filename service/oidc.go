@@ -0,0 +1,409 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"hash"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/nanoteck137/authlab/database"
+	"github.com/nanoteck137/authlab/tools/utils"
+)
+
+var (
+	ErrAuthServiceInvalidRedirectUri       = authErr.Error("invalid redirect uri")
+	ErrAuthServiceInvalidScope             = authErr.Error("invalid scope")
+	ErrAuthServicePkceRequired             = authErr.Error("pkce required")
+	ErrAuthServiceUnsupportedPkceMethod    = authErr.Error("unsupported pkce method")
+	ErrAuthServiceInvalidAuthorizationCode = authErr.Error("invalid authorization code")
+	ErrAuthServiceIdTokenKeyInvalid        = authErr.Error("id tokens needs an asymmetric signing key")
+)
+
+const (
+	ScopeOpenId  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+// The scopes that clients can request
+var SupportedScopes = []string{
+	ScopeOpenId,
+	ScopeProfile,
+	ScopeEmail,
+}
+
+const PkceMethodS256 = "S256"
+
+// How long the authorization codes are valid for, the client should
+// exchange the code right away
+const authorizationCodeDuration = 1 * time.Minute
+
+// ParseScope splits the scope parameter and checks that all the scopes
+// are supported
+func ParseScope(scope string) ([]string, error) {
+	scopes := strings.Fields(scope)
+
+	for _, s := range scopes {
+		if !slices.Contains(SupportedScopes, s) {
+			return nil, ErrAuthServiceInvalidScope
+		}
+	}
+
+	return scopes, nil
+}
+
+func hasScope(scope, s string) bool {
+	return slices.Contains(strings.Fields(scope), s)
+}
+
+// AuthorizeRequest is the parameters of an authorization request from
+// a client
+type AuthorizeRequest struct {
+	ClientId    string
+	RedirectUri string
+	Scope       string
+	Nonce       string
+
+	// Sent back to the client together with the code
+	State string
+
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// ValidateAuthorizeClient checks the client and the redirect uri of the
+// request, if these are not valid then the user should not be redirected
+// back to the client
+func (a *AuthService) ValidateAuthorizeClient(ctx context.Context, request AuthorizeRequest) (*OAuthClient, error) {
+	client, err := a.GetOAuthClient(ctx, request.ClientId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !client.HasRedirectUri(request.RedirectUri) {
+		return nil, ErrAuthServiceInvalidRedirectUri
+	}
+
+	return client, nil
+}
+
+// ValidateAuthorizeRequest checks the rest of the authorization request,
+// the errors from this should be sent back to the client
+func (a *AuthService) ValidateAuthorizeRequest(client *OAuthClient, request AuthorizeRequest) error {
+	if !client.HasGrantType(GrantTypeAuthorizationCode) {
+		return ErrAuthServiceUnauthorizedClient
+	}
+
+	scopes, err := ParseScope(request.Scope)
+	if err != nil {
+		return err
+	}
+
+	if !client.HasScopes(scopes) {
+		return ErrAuthServiceInvalidScope
+	}
+
+	if request.CodeChallenge == "" {
+		if client.IsPublic() {
+			return ErrAuthServicePkceRequired
+		}
+
+		return nil
+	}
+
+	// NOTE(patrik): The "plain" method gives no protection, so only
+	// S256 is supported
+	if request.CodeChallengeMethod != PkceMethodS256 {
+		return ErrAuthServiceUnsupportedPkceMethod
+	}
+
+	return nil
+}
+
+// CreateAuthorizationCode creates the code that is sent back to the
+// client after the user has authorized the request. The authTime is when
+// the user logged in to authlab.
+func (a *AuthService) CreateAuthorizationCode(ctx context.Context, userId string, authTime time.Time, request AuthorizeRequest) (string, error) {
+	client, err := a.ValidateAuthorizeClient(ctx, request)
+	if err != nil {
+		return "", err
+	}
+
+	err = a.ValidateAuthorizeRequest(client, request)
+	if err != nil {
+		return "", err
+	}
+
+	code, err := utils.GenerateAuthChallenge()
+	if err != nil {
+		return "", authErr.Errorf("generate authorization code: %w", err)
+	}
+
+	err = a.db.CreateOAuthAuthorizationCode(ctx, database.CreateOAuthAuthorizationCodeParams{
+		CodeHash: hashToken(code),
+		ClientId: client.Id,
+		UserId:   userId,
+
+		RedirectUri: request.RedirectUri,
+		Scope:       strings.Join(strings.Fields(request.Scope), " "),
+		Nonce: sql.NullString{
+			String: request.Nonce,
+			Valid:  request.Nonce != "",
+		},
+
+		CodeChallenge: sql.NullString{
+			String: request.CodeChallenge,
+			Valid:  request.CodeChallenge != "",
+		},
+		CodeChallengeMethod: sql.NullString{
+			String: request.CodeChallengeMethod,
+			Valid:  request.CodeChallenge != "",
+		},
+
+		AuthTime: authTime.UnixMilli(),
+
+		Expires: time.Now().Add(authorizationCodeDuration).UnixMilli(),
+	})
+	if err != nil {
+		return "", authErr.Errorf("create authorization code: %w", err)
+	}
+
+	return code, nil
+}
+
+// OidcTokens is the tokens handed out to a client after exchanging the
+// authorization code
+type OidcTokens struct {
+	UserTokens
+
+	// The ID token, only set when the "openid" scope was granted
+	IdToken string
+
+	// The granted scopes
+	Scope string
+}
+
+type ExchangeAuthorizationCodeParams struct {
+	// The authenticated client
+	Client *OAuthClient
+
+	Code         string
+	RedirectUri  string
+	CodeVerifier string
+
+	// The issuer of the ID token
+	Issuer string
+
+	Info ClientInfo
+}
+
+func verifyPkce(challenge, method, verifier string) bool {
+	if method != PkceMethodS256 || verifier == "" {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// ExchangeAuthorizationCode exchanges the authorization code for tokens,
+// a new session is created for the client. The code can only be used
+// once, if the code is used again the session created from the code is
+// revoked (RFC 6749 section 4.1.2).
+func (a *AuthService) ExchangeAuthorizationCode(ctx context.Context, params ExchangeAuthorizationCodeParams) (OidcTokens, error) {
+	if !params.Client.HasGrantType(GrantTypeAuthorizationCode) {
+		return OidcTokens{}, ErrAuthServiceUnauthorizedClient
+	}
+
+	code, err := a.db.GetOAuthAuthorizationCodeByHash(ctx, hashToken(params.Code))
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return OidcTokens{}, ErrAuthServiceInvalidAuthorizationCode
+		}
+
+		return OidcTokens{}, authErr.Errorf("get authorization code: %w", err)
+	}
+
+	if code.ClientId != params.Client.Id {
+		return OidcTokens{}, ErrAuthServiceInvalidAuthorizationCode
+	}
+
+	if time.Now().After(time.UnixMilli(code.Expires)) {
+		return OidcTokens{}, ErrAuthServiceInvalidAuthorizationCode
+	}
+
+	if code.RedirectUri != params.RedirectUri {
+		return OidcTokens{}, ErrAuthServiceInvalidAuthorizationCode
+	}
+
+	if code.CodeChallenge.Valid {
+		if !verifyPkce(code.CodeChallenge.String, code.CodeChallengeMethod.String, params.CodeVerifier) {
+			return OidcTokens{}, ErrAuthServiceInvalidAuthorizationCode
+		}
+	} else if params.CodeVerifier != "" {
+		return OidcTokens{}, ErrAuthServiceInvalidAuthorizationCode
+	}
+
+	updated, err := a.db.MarkOAuthAuthorizationCodeUsed(ctx, code.Id)
+	if err != nil {
+		return OidcTokens{}, authErr.Errorf("mark authorization code used: %w", err)
+	}
+
+	if !updated {
+		if code.SessionId.Valid {
+			err := a.db.DeleteSession(ctx, code.SessionId.String)
+			if err != nil {
+				return OidcTokens{}, authErr.Errorf("delete session: %w", err)
+			}
+		}
+
+		return OidcTokens{}, ErrAuthServiceInvalidAuthorizationCode
+	}
+
+	session, err := a.createSession(ctx, database.CreateSessionParams{
+		UserId:     code.UserId,
+		AuthMethod: AuthMethodOAuthClient(code.ClientId),
+		UserAgent:  params.Info.UserAgent,
+		IpAddress:  params.Info.IpAddress,
+		ClientId: sql.NullString{
+			String: code.ClientId,
+			Valid:  true,
+		},
+		Scope: code.Scope,
+	})
+	if err != nil {
+		return OidcTokens{}, err
+	}
+
+	err = a.db.SetOAuthAuthorizationCodeSession(ctx, code.Id, session.Id)
+	if err != nil {
+		return OidcTokens{}, authErr.Errorf("set authorization code session: %w", err)
+	}
+
+	tokens, err := a.issueUserTokens(ctx, session)
+	if err != nil {
+		return OidcTokens{}, err
+	}
+
+	res := OidcTokens{
+		UserTokens: tokens,
+		Scope:      code.Scope,
+	}
+
+	if hasScope(code.Scope, ScopeOpenId) {
+		user, err := a.db.GetUserById(ctx, code.UserId)
+		if err != nil {
+			return OidcTokens{}, authErr.Errorf("get user: %w", err)
+		}
+
+		res.IdToken, err = a.SignIdToken(IdTokenParams{
+			Issuer:      params.Issuer,
+			User:        user,
+			ClientId:    code.ClientId,
+			Scope:       code.Scope,
+			Nonce:       code.Nonce.String,
+			AuthTime:    time.UnixMilli(code.AuthTime),
+			AccessToken: tokens.AccessToken,
+		})
+		if err != nil {
+			return OidcTokens{}, err
+		}
+	}
+
+	return res, nil
+}
+
+// UserClaims returns the claims about the user for the granted scopes,
+// used for both the ID token and the userinfo endpoint
+func UserClaims(user database.User, scope string) map[string]any {
+	claims := map[string]any{
+		"sub":  user.Id,
+		"role": user.Role,
+	}
+
+	if hasScope(scope, ScopeEmail) {
+		claims["email"] = user.Email
+		claims["email_verified"] = user.EmailVerified > 0
+	}
+
+	if hasScope(scope, ScopeProfile) {
+		claims["name"] = user.DisplayName
+	}
+
+	return claims
+}
+
+type IdTokenParams struct {
+	Issuer   string
+	User     database.User
+	ClientId string
+	Scope    string
+	Nonce    string
+	AuthTime time.Time
+
+	// The access token issued together with the ID token, used for the
+	// "at_hash" claim
+	AccessToken string
+}
+
+// accessTokenHash creates the "at_hash" claim, the left half of the hash
+// of the access token. The hash function depends on the algorithm of the
+// ID token.
+func accessTokenHash(algorithm, accessToken string) string {
+	var h hash.Hash
+	switch algorithm {
+	case AlgorithmEdDSA:
+		h = sha512.New()
+	default:
+		h = sha256.New()
+	}
+
+	h.Write([]byte(accessToken))
+	sum := h.Sum(nil)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+}
+
+// SignIdToken creates the ID token for the client, the ID token is
+// signed with the current signing key which needs to be asymmetric so
+// that the clients can verify the token with the JWKS
+func (a *AuthService) SignIdToken(params IdTokenParams) (string, error) {
+	algorithm := a.keys.SigningAlgorithm()
+	if algorithm == AlgorithmHS256 {
+		return "", ErrAuthServiceIdTokenKeyInvalid
+	}
+
+	now := time.Now()
+
+	claims := jwt.MapClaims(UserClaims(params.User, params.Scope))
+	claims["iss"] = params.Issuer
+	claims["aud"] = params.ClientId
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(a.accessTokenDuration).Unix()
+	claims["auth_time"] = params.AuthTime.Unix()
+
+	if params.Nonce != "" {
+		claims["nonce"] = params.Nonce
+	}
+
+	if params.AccessToken != "" {
+		claims["at_hash"] = accessTokenHash(algorithm, params.AccessToken)
+	}
+
+	token, err := a.keys.Sign(claims)
+	if err != nil {
+		return "", authErr.Errorf("sign id token: %w", err)
+	}
+
+	return token, nil
+}
@@ -0,0 +1,570 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/nanoteck137/authlab"
+	"github.com/nanoteck137/authlab/database"
+	"github.com/nanoteck137/authlab/types"
+)
+
+var (
+	ErrAuthServicePasskeysDisabled = authErr.Error("passkeys are disabled")
+	ErrAuthServicePasskeyNotFound  = authErr.Error("passkey not found")
+	ErrAuthServiceInvalidPasskey   = authErr.Error("invalid passkey")
+)
+
+// How long the browser has to complete a passkey ceremony
+const passkeyRequestDuration = 5 * time.Minute
+
+// The ceremonies stored as passkey requests
+const (
+	passkeyRequestRegistration = "registration"
+	passkeyRequestLogin        = "login"
+	passkeyRequestMfa          = "mfa"
+)
+
+// newWebAuthn creates the relying party for the passkeys, the passkeys
+// are bound to the host of the public url so the url can't change after
+// the passkeys are registered
+func newWebAuthn(publicUrl string) (*webauthn.WebAuthn, error) {
+	u, err := url.Parse(publicUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	return webauthn.New(&webauthn.Config{
+		RPID:          u.Hostname(),
+		RPDisplayName: authlab.AppName,
+		RPOrigins:     []string{u.Scheme + "://" + u.Host},
+	})
+}
+
+// webauthnUser is the user handed to the webauthn library, the user
+// handle stored on the passkeys is the id of the user
+type webauthnUser struct {
+	user        database.User
+	credentials []webauthn.Credential
+}
+
+func (u *webauthnUser) WebAuthnID() []byte {
+	return []byte(u.user.Id)
+}
+
+func (u *webauthnUser) WebAuthnName() string {
+	if u.user.Username.Valid {
+		return u.user.Username.String
+	}
+
+	return u.user.Email
+}
+
+func (u *webauthnUser) WebAuthnDisplayName() string {
+	return u.user.DisplayName
+}
+
+func (u *webauthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+func encodeCredentialId(id []byte) string {
+	return base64.RawURLEncoding.EncodeToString(id)
+}
+
+func (a *AuthService) PasskeysEnabled() bool {
+	return a.webauthn != nil
+}
+
+func (a *AuthService) getWebauthnUser(ctx context.Context, user database.User) (*webauthnUser, error) {
+	passkeys, err := a.db.GetAllPasskeysForUser(ctx, user.Id)
+	if err != nil {
+		return nil, authErr.Errorf("get passkeys: %w", err)
+	}
+
+	credentials := make([]webauthn.Credential, 0, len(passkeys))
+	for _, passkey := range passkeys {
+		var credential webauthn.Credential
+		err := json.Unmarshal([]byte(passkey.Credential), &credential)
+		if err != nil {
+			return nil, authErr.Errorf("unmarshal passkey credential: %w", err)
+		}
+
+		credentials = append(credentials, credential)
+	}
+
+	return &webauthnUser{
+		user:        user,
+		credentials: credentials,
+	}, nil
+}
+
+func (a *AuthService) getWebauthnUserById(ctx context.Context, userId string) (*webauthnUser, error) {
+	user, err := a.db.GetUserById(ctx, userId)
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return nil, ErrAuthServiceUserNotFound
+		}
+
+		return nil, authErr.Errorf("get user: %w", err)
+	}
+
+	return a.getWebauthnUser(ctx, user)
+}
+
+// PasskeyOptions is the start of a passkey ceremony, the options are
+// passed to the browser and the response from the authenticator is sent
+// back together with the request id
+type PasskeyOptions struct {
+	RequestId string
+
+	// The options for navigator.credentials as json
+	Options []byte
+
+	Expires time.Time
+}
+
+func (a *AuthService) createPasskeyRequest(ctx context.Context, requestType string, userId, mfaChallengeId sql.NullString, session *webauthn.SessionData, options any) (PasskeyOptions, error) {
+	sessionData, err := json.Marshal(session)
+	if err != nil {
+		return PasskeyOptions{}, authErr.Errorf("marshal passkey session: %w", err)
+	}
+
+	optionsData, err := json.Marshal(options)
+	if err != nil {
+		return PasskeyOptions{}, authErr.Errorf("marshal passkey options: %w", err)
+	}
+
+	expires := time.Now().Add(passkeyRequestDuration)
+
+	id, err := a.db.CreatePasskeyRequest(ctx, database.CreatePasskeyRequestParams{
+		UserId:         userId,
+		Type:           requestType,
+		Session:        string(sessionData),
+		MfaChallengeId: mfaChallengeId,
+		Expires:        expires.UnixMilli(),
+	})
+	if err != nil {
+		return PasskeyOptions{}, authErr.Errorf("create passkey request: %w", err)
+	}
+
+	return PasskeyOptions{
+		RequestId: id,
+		Options:   optionsData,
+		Expires:   expires,
+	}, nil
+}
+
+// usePasskeyRequest returns the session data of the request, the request
+// can only be used once even if the response from the authenticator
+// turns out to be invalid
+func (a *AuthService) usePasskeyRequest(ctx context.Context, id, requestType string) (database.PasskeyRequest, webauthn.SessionData, error) {
+	request, err := a.db.GetPasskeyRequestById(ctx, id)
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return database.PasskeyRequest{}, webauthn.SessionData{}, ErrAuthServiceRequestNotFound
+		}
+
+		return database.PasskeyRequest{}, webauthn.SessionData{}, authErr.Errorf("get passkey request: %w", err)
+	}
+
+	if request.Type != requestType {
+		return database.PasskeyRequest{}, webauthn.SessionData{}, ErrAuthServiceRequestNotFound
+	}
+
+	if time.Now().After(time.UnixMilli(request.Expires)) {
+		return database.PasskeyRequest{}, webauthn.SessionData{}, ErrAuthServiceRequestExpired
+	}
+
+	used, err := a.db.MarkPasskeyRequestUsed(ctx, request.Id)
+	if err != nil {
+		return database.PasskeyRequest{}, webauthn.SessionData{}, authErr.Errorf("mark passkey request used: %w", err)
+	}
+
+	if !used {
+		return database.PasskeyRequest{}, webauthn.SessionData{}, ErrAuthServiceRequestAlreadyUsed
+	}
+
+	var session webauthn.SessionData
+	err = json.Unmarshal([]byte(request.Session), &session)
+	if err != nil {
+		return database.PasskeyRequest{}, webauthn.SessionData{}, authErr.Errorf("unmarshal passkey session: %w", err)
+	}
+
+	return request, session, nil
+}
+
+// BeginPasskeyRegistration starts the registration of a new passkey for
+// the user. The passkeys are created as discoverable credentials so they
+// can be used to log in without entering a username. The session needs
+// to be from a recent login.
+func (a *AuthService) BeginPasskeyRegistration(ctx context.Context, user database.User, sessionId string) (PasskeyOptions, error) {
+	if a.webauthn == nil {
+		return PasskeyOptions{}, ErrAuthServicePasskeysDisabled
+	}
+
+	err := a.checkRecentLogin(ctx, user.Id, sessionId)
+	if err != nil {
+		return PasskeyOptions{}, err
+	}
+
+	wUser, err := a.getWebauthnUser(ctx, user)
+	if err != nil {
+		return PasskeyOptions{}, err
+	}
+
+	creation, session, err := a.webauthn.BeginRegistration(
+		wUser,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		webauthn.WithExclusions(webauthn.Credentials(wUser.credentials).CredentialDescriptors()),
+	)
+	if err != nil {
+		return PasskeyOptions{}, authErr.Errorf("begin passkey registration: %w", err)
+	}
+
+	return a.createPasskeyRequest(ctx, passkeyRequestRegistration, sql.NullString{String: user.Id, Valid: true}, sql.NullString{}, session, creation)
+}
+
+// FinishPasskeyRegistrationResult is the structure returned by
+// FinishPasskeyRegistration
+type FinishPasskeyRegistrationResult struct {
+	Passkey database.Passkey
+
+	// Only set if the user didn't have any recovery codes
+	RecoveryCodes []string
+}
+
+// FinishPasskeyRegistration verifies the response from the authenticator
+// and stores the new passkey
+func (a *AuthService) FinishPasskeyRegistration(ctx context.Context, userId, requestId, name string, response []byte, info ClientInfo) (FinishPasskeyRegistrationResult, error) {
+	if a.webauthn == nil {
+		return FinishPasskeyRegistrationResult{}, ErrAuthServicePasskeysDisabled
+	}
+
+	request, session, err := a.usePasskeyRequest(ctx, requestId, passkeyRequestRegistration)
+	if err != nil {
+		return FinishPasskeyRegistrationResult{}, err
+	}
+
+	if request.UserId.String != userId {
+		return FinishPasskeyRegistrationResult{}, ErrAuthServiceRequestNotFound
+	}
+
+	wUser, err := a.getWebauthnUserById(ctx, userId)
+	if err != nil {
+		return FinishPasskeyRegistrationResult{}, err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(response)
+	if err != nil {
+		return FinishPasskeyRegistrationResult{}, ErrAuthServiceInvalidPasskey
+	}
+
+	credential, err := a.webauthn.CreateCredential(wUser, session, parsed)
+	if err != nil {
+		return FinishPasskeyRegistrationResult{}, ErrAuthServiceInvalidPasskey
+	}
+
+	data, err := json.Marshal(credential)
+	if err != nil {
+		return FinishPasskeyRegistrationResult{}, authErr.Errorf("marshal passkey credential: %w", err)
+	}
+
+	id, err := a.db.CreatePasskey(ctx, database.CreatePasskeyParams{
+		UserId:       userId,
+		CredentialId: encodeCredentialId(credential.ID),
+		Name:         name,
+		Credential:   string(data),
+	})
+	if err != nil {
+		if errors.Is(err, database.ErrItemAlreadyExists) {
+			return FinishPasskeyRegistrationResult{}, ErrAuthServiceInvalidPasskey
+		}
+
+		return FinishPasskeyRegistrationResult{}, authErr.Errorf("create passkey: %w", err)
+	}
+
+	passkey, err := a.db.GetPasskeyById(ctx, id)
+	if err != nil {
+		return FinishPasskeyRegistrationResult{}, authErr.Errorf("get passkey: %w", err)
+	}
+
+	recoveryCodes, err := a.createInitialRecoveryCodes(ctx, userId, info)
+	if err != nil {
+		return FinishPasskeyRegistrationResult{}, err
+	}
+
+	return FinishPasskeyRegistrationResult{
+		Passkey:       passkey,
+		RecoveryCodes: recoveryCodes,
+	}, nil
+}
+
+// updatePasskeyAfterLogin stores the new sign count and flags of the
+// credential, the sign count is used to detect cloned authenticators
+func (a *AuthService) updatePasskeyAfterLogin(ctx context.Context, credential *webauthn.Credential) error {
+	// NOTE(patrik): The sign count went backwards, so there might be a
+	// copy of the private key somewhere else
+	if credential.Authenticator.CloneWarning {
+		return ErrAuthServiceInvalidPasskey
+	}
+
+	passkey, err := a.db.GetPasskeyByCredentialId(ctx, encodeCredentialId(credential.ID))
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return ErrAuthServiceInvalidPasskey
+		}
+
+		return authErr.Errorf("get passkey: %w", err)
+	}
+
+	data, err := json.Marshal(credential)
+	if err != nil {
+		return authErr.Errorf("marshal passkey credential: %w", err)
+	}
+
+	err = a.db.UpdatePasskey(ctx, passkey.Id, database.PasskeyChanges{
+		Credential: types.Change[string]{
+			Value:   string(data),
+			Changed: true,
+		},
+		LastUsed: types.Change[int64]{
+			Value:   time.Now().UnixMilli(),
+			Changed: true,
+		},
+	})
+	if err != nil {
+		return authErr.Errorf("update passkey: %w", err)
+	}
+
+	return nil
+}
+
+// BeginPasskeyLogin starts a passwordless login, the user picks the
+// passkey in the browser so no username is needed
+func (a *AuthService) BeginPasskeyLogin(ctx context.Context) (PasskeyOptions, error) {
+	if a.webauthn == nil {
+		return PasskeyOptions{}, ErrAuthServicePasskeysDisabled
+	}
+
+	// NOTE(patrik): The passkey replaces both the password and the
+	// second factor, so the authenticator needs to verify the user with
+	// a PIN or biometrics
+	assertion, session, err := a.webauthn.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+	)
+	if err != nil {
+		return PasskeyOptions{}, authErr.Errorf("begin passkey login: %w", err)
+	}
+
+	return a.createPasskeyRequest(ctx, passkeyRequestLogin, sql.NullString{}, sql.NullString{}, session, assertion)
+}
+
+// FinishPasskeyLogin verifies the response from the authenticator and
+// returns the tokens for the user the passkey belongs to
+func (a *AuthService) FinishPasskeyLogin(ctx context.Context, requestId string, response []byte, info ClientInfo) (UserTokens, error) {
+	if a.webauthn == nil {
+		return UserTokens{}, ErrAuthServicePasskeysDisabled
+	}
+
+	_, session, err := a.usePasskeyRequest(ctx, requestId, passkeyRequestLogin)
+	if err != nil {
+		return UserTokens{}, err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return UserTokens{}, ErrAuthServiceInvalidPasskey
+	}
+
+	handler := func(rawId, userHandle []byte) (webauthn.User, error) {
+		passkey, err := a.db.GetPasskeyByCredentialId(ctx, encodeCredentialId(rawId))
+		if err != nil {
+			return nil, err
+		}
+
+		if passkey.UserId != string(userHandle) {
+			return nil, ErrAuthServiceInvalidPasskey
+		}
+
+		return a.getWebauthnUserById(ctx, passkey.UserId)
+	}
+
+	user, credential, err := a.webauthn.ValidatePasskeyLogin(handler, session, parsed)
+	if err != nil {
+		return UserTokens{}, ErrAuthServiceInvalidPasskey
+	}
+
+	err = a.updatePasskeyAfterLogin(ctx, credential)
+	if err != nil {
+		return UserTokens{}, err
+	}
+
+	return a.IssueUserTokens(ctx, string(user.WebAuthnID()), AuthMethodPasskey, info)
+}
+
+// BeginPasskeyMfa starts the passkey ceremony used as the second factor
+// for the challenge
+func (a *AuthService) BeginPasskeyMfa(ctx context.Context, challenge string) (PasskeyOptions, error) {
+	if a.webauthn == nil {
+		return PasskeyOptions{}, ErrAuthServicePasskeysDisabled
+	}
+
+	mfaChallenge, err := a.getMfaChallenge(ctx, challenge)
+	if err != nil {
+		return PasskeyOptions{}, err
+	}
+
+	wUser, err := a.getWebauthnUserById(ctx, mfaChallenge.UserId)
+	if err != nil {
+		return PasskeyOptions{}, err
+	}
+
+	if len(wUser.credentials) == 0 {
+		return PasskeyOptions{}, ErrAuthServicePasskeyNotFound
+	}
+
+	assertion, session, err := a.webauthn.BeginLogin(wUser)
+	if err != nil {
+		return PasskeyOptions{}, authErr.Errorf("begin passkey login: %w", err)
+	}
+
+	return a.createPasskeyRequest(
+		ctx,
+		passkeyRequestMfa,
+		sql.NullString{String: mfaChallenge.UserId, Valid: true},
+		sql.NullString{String: mfaChallenge.Id, Valid: true},
+		session,
+		assertion,
+	)
+}
+
+// CompletePasskeyMfa completes the challenge with the response from the
+// authenticator, an invalid response counts as a failed attempt
+func (a *AuthService) CompletePasskeyMfa(ctx context.Context, challenge, requestId string, response []byte, info ClientInfo) (UserTokens, error) {
+	if a.webauthn == nil {
+		return UserTokens{}, ErrAuthServicePasskeysDisabled
+	}
+
+	mfaChallenge, err := a.getMfaChallenge(ctx, challenge)
+	if err != nil {
+		return UserTokens{}, err
+	}
+
+	request, session, err := a.usePasskeyRequest(ctx, requestId, passkeyRequestMfa)
+	if err != nil {
+		return UserTokens{}, err
+	}
+
+	if request.MfaChallengeId.String != mfaChallenge.Id {
+		return UserTokens{}, ErrAuthServiceRequestNotFound
+	}
+
+	valid, err := a.checkPasskeyAssertion(ctx, mfaChallenge.UserId, session, response)
+	if err != nil {
+		return UserTokens{}, err
+	}
+
+	return a.completeMfaChallenge(ctx, mfaChallenge, MfaMethodPasskey, valid, info)
+}
+
+func (a *AuthService) checkPasskeyAssertion(ctx context.Context, userId string, session webauthn.SessionData, response []byte) (bool, error) {
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return false, nil
+	}
+
+	wUser, err := a.getWebauthnUserById(ctx, userId)
+	if err != nil {
+		return false, err
+	}
+
+	credential, err := a.webauthn.ValidateLogin(wUser, session, parsed)
+	if err != nil {
+		return false, nil
+	}
+
+	err = a.updatePasskeyAfterLogin(ctx, credential)
+	if err != nil {
+		if errors.Is(err, ErrAuthServiceInvalidPasskey) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (a *AuthService) GetPasskeys(ctx context.Context, userId string) ([]database.Passkey, error) {
+	passkeys, err := a.db.GetAllPasskeysForUser(ctx, userId)
+	if err != nil {
+		return nil, authErr.Errorf("get passkeys: %w", err)
+	}
+
+	return passkeys, nil
+}
+
+func (a *AuthService) getUserPasskey(ctx context.Context, userId, id string) (database.Passkey, error) {
+	passkey, err := a.db.GetPasskeyById(ctx, id)
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return database.Passkey{}, ErrAuthServicePasskeyNotFound
+		}
+
+		return database.Passkey{}, authErr.Errorf("get passkey: %w", err)
+	}
+
+	if passkey.UserId != userId {
+		return database.Passkey{}, ErrAuthServicePasskeyNotFound
+	}
+
+	return passkey, nil
+}
+
+func (a *AuthService) RenamePasskey(ctx context.Context, userId, id, name string) error {
+	passkey, err := a.getUserPasskey(ctx, userId, id)
+	if err != nil {
+		return err
+	}
+
+	err = a.db.UpdatePasskey(ctx, passkey.Id, database.PasskeyChanges{
+		Name: types.Change[string]{
+			Value:   name,
+			Changed: true,
+		},
+	})
+	if err != nil {
+		return authErr.Errorf("update passkey: %w", err)
+	}
+
+	return nil
+}
+
+// DeletePasskey removes the passkey of the user, the session needs to be
+// from a recent login
+func (a *AuthService) DeletePasskey(ctx context.Context, userId, sessionId, id string) error {
+	passkey, err := a.getUserPasskey(ctx, userId, id)
+	if err != nil {
+		return err
+	}
+
+	err = a.checkRecentLogin(ctx, userId, sessionId)
+	if err != nil {
+		return err
+	}
+
+	err = a.db.DeletePasskey(ctx, passkey.Id)
+	if err != nil {
+		return authErr.Errorf("delete passkey: %w", err)
+	}
+
+	return a.removeUnusableRecoveryCodes(ctx, userId)
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/nanoteck137/authlab/config"
+	"golang.org/x/crypto/argon2"
+)
+
+var errInvalidPasswordHash = errors.New("invalid password hash")
+
+// hashPassword hashes the password with argon2id, the result is encoded
+// in the PHC string format so the parameters are stored together with
+// the hash: "$argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>"
+func hashPassword(password string, params config.ConfigPasswordHashing) (string, error) {
+	salt := make([]byte, params.SaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		params.Memory,
+		params.Iterations,
+		params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+type passwordHash struct {
+	params config.ConfigPasswordHashing
+	salt   []byte
+	key    []byte
+}
+
+func decodePasswordHash(encoded string) (passwordHash, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return passwordHash{}, errInvalidPasswordHash
+	}
+
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return passwordHash{}, errInvalidPasswordHash
+	}
+
+	var res passwordHash
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &res.params.Memory, &res.params.Iterations, &res.params.Parallelism)
+	if err != nil {
+		return passwordHash{}, errInvalidPasswordHash
+	}
+
+	res.salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return passwordHash{}, errInvalidPasswordHash
+	}
+
+	res.key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return passwordHash{}, errInvalidPasswordHash
+	}
+
+	res.params.SaltLength = uint32(len(res.salt))
+	res.params.KeyLength = uint32(len(res.key))
+
+	return res, nil
+}
+
+// verifyPassword checks the password against the hash created by
+// hashPassword, returns if the password matches and if the hash needs
+// to be recreated because the parameters has changed
+func verifyPassword(password, encoded string, params config.ConfigPasswordHashing) (bool, bool, error) {
+	hash, err := decodePasswordHash(encoded)
+	if err != nil {
+		return false, false, err
+	}
+
+	key := argon2.IDKey([]byte(password), hash.salt, hash.params.Iterations, hash.params.Memory, hash.params.Parallelism, hash.params.KeyLength)
+	if subtle.ConstantTimeCompare(key, hash.key) != 1 {
+		return false, false, nil
+	}
+
+	return true, hash.params != params, nil
+}
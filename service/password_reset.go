@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/nanoteck137/authlab/database"
+	"github.com/nanoteck137/authlab/tools/utils"
+)
+
+var (
+	ErrAuthServiceInvalidResetToken = authErr.Error("invalid password reset token")
+	ErrAuthServiceUserNotFound      = authErr.Error("user not found")
+)
+
+// How long the link inside the password reset email works
+const passwordResetDuration = 1 * time.Hour
+
+// CreatePasswordResetToken creates the token for the password reset
+// email of the user with the email. Only local accounts has a password
+// to reset, returns ErrAuthServiceUserNotFound for the other users. The
+// older tokens of the user stops working.
+func (a *AuthService) CreatePasswordResetToken(ctx context.Context, email string) (database.User, string, error) {
+	if !a.localAccounts {
+		return database.User{}, "", ErrAuthServiceLocalAccountsDisabled
+	}
+
+	user, err := a.db.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return database.User{}, "", ErrAuthServiceUserNotFound
+		}
+
+		return database.User{}, "", authErr.Errorf("get user by email: %w", err)
+	}
+
+	if !user.PasswordHash.Valid {
+		return database.User{}, "", ErrAuthServiceUserNotFound
+	}
+
+	err = a.db.DeleteAllPasswordResetTokensForUser(ctx, user.Id)
+	if err != nil {
+		return database.User{}, "", authErr.Errorf("delete password reset tokens: %w", err)
+	}
+
+	token, err := utils.GenerateAuthChallenge()
+	if err != nil {
+		return database.User{}, "", authErr.Errorf("generate password reset token: %w", err)
+	}
+
+	_, err = a.db.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+		UserId:    user.Id,
+		TokenHash: hashToken(token),
+		Expires:   time.Now().Add(passwordResetDuration).UnixMilli(),
+	})
+	if err != nil {
+		return database.User{}, "", authErr.Errorf("create password reset token: %w", err)
+	}
+
+	return user, token, nil
+}
+
+// ResetPassword sets the new password with the token from the password
+// reset email. The token can only be used once, and all the sessions of
+// the user are revoked so whoever knew the old password loses access.
+func (a *AuthService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	if !a.localAccounts {
+		return ErrAuthServiceLocalAccountsDisabled
+	}
+
+	resetToken, err := a.db.GetPasswordResetTokenByHash(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return ErrAuthServiceInvalidResetToken
+		}
+
+		return authErr.Errorf("get password reset token: %w", err)
+	}
+
+	if resetToken.Used > 0 || time.Now().After(time.UnixMilli(resetToken.Expires)) {
+		return ErrAuthServiceInvalidResetToken
+	}
+
+	used, err := a.db.MarkPasswordResetTokenUsed(ctx, resetToken.Id)
+	if err != nil {
+		return authErr.Errorf("mark password reset token used: %w", err)
+	}
+
+	if !used {
+		return ErrAuthServiceInvalidResetToken
+	}
+
+	err = a.setUserPassword(ctx, resetToken.UserId, newPassword)
+	if err != nil {
+		return err
+	}
+
+	// NOTE(patrik): The link was sent to the email of the user, so the
+	// user has proven that the email belongs to them
+	err = a.SetEmailVerified(ctx, resetToken.UserId, true)
+	if err != nil {
+		return err
+	}
+
+	return a.RevokeAllSessions(ctx, resetToken.UserId)
+}
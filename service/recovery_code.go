@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	"github.com/nanoteck137/authlab/database"
+	"github.com/nanoteck137/authlab/tools/utils"
+)
+
+var (
+	ErrAuthServiceMfaNotEnabled = authErr.Error("mfa is not enabled")
+)
+
+// How many recovery codes the user gets
+const mfaRecoveryCodeCount = 10
+
+// normalizeRecoveryCode lets the user enter the code without the dash
+// and in any case
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	code = strings.ReplaceAll(code, " ", "")
+
+	return code
+}
+
+func hashRecoveryCode(code string) string {
+	return hashToken(normalizeRecoveryCode(code))
+}
+
+// generateRecoveryCodes replaces the recovery codes of the user with a
+// new set, the codes are only returned here and only the hashes are
+// stored
+func (a *AuthService) generateRecoveryCodes(ctx context.Context, userId string, info ClientInfo) ([]string, error) {
+	codes := make([]string, mfaRecoveryCodeCount)
+	hashes := make([]string, mfaRecoveryCodeCount)
+
+	for i := range codes {
+		code, err := utils.GenerateRecoveryCode()
+		if err != nil {
+			return nil, authErr.Errorf("generate recovery code: %w", err)
+		}
+
+		codes[i] = code
+		hashes[i] = hashRecoveryCode(code)
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		return nil, authErr.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.DeleteAllMfaRecoveryCodesForUser(ctx, userId)
+	if err != nil {
+		return nil, authErr.Errorf("delete recovery codes: %w", err)
+	}
+
+	err = tx.CreateMfaRecoveryCodes(ctx, userId, hashes)
+	if err != nil {
+		return nil, authErr.Errorf("create recovery codes: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, authErr.Errorf("commit transaction: %w", err)
+	}
+
+	err = a.recordUserEvent(ctx, userId, UserEventRecoveryCodesGenerated, info)
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// createInitialRecoveryCodes is called when the user enables a second
+// factor, the codes are only generated if the user has no codes left so
+// enabling another factor doesn't replace the codes the user has saved
+func (a *AuthService) createInitialRecoveryCodes(ctx context.Context, userId string, info ClientInfo) ([]string, error) {
+	remaining, err := a.RecoveryCodesRemaining(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if remaining > 0 {
+		return []string{}, nil
+	}
+
+	return a.generateRecoveryCodes(ctx, userId, info)
+}
+
+// removeUnusableRecoveryCodes removes the recovery codes after the last
+// second factor of the user is removed
+func (a *AuthService) removeUnusableRecoveryCodes(ctx context.Context, userId string) error {
+	factors, err := a.userMfaFactors(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	if len(factors) > 0 {
+		return nil
+	}
+
+	err = a.db.DeleteAllMfaRecoveryCodesForUser(ctx, userId)
+	if err != nil {
+		return authErr.Errorf("delete recovery codes: %w", err)
+	}
+
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the user, the
+// old codes stops working. The session needs to be from a recent login.
+func (a *AuthService) RegenerateRecoveryCodes(ctx context.Context, userId, sessionId string, info ClientInfo) ([]string, error) {
+	err := a.checkRecentLogin(ctx, userId, sessionId)
+	if err != nil {
+		return nil, err
+	}
+
+	factors, err := a.userMfaFactors(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(factors) == 0 {
+		return nil, ErrAuthServiceMfaNotEnabled
+	}
+
+	return a.generateRecoveryCodes(ctx, userId, info)
+}
+
+func (a *AuthService) RecoveryCodesRemaining(ctx context.Context, userId string) (int, error) {
+	remaining, err := a.db.CountUnusedMfaRecoveryCodes(ctx, userId)
+	if err != nil {
+		return 0, authErr.Errorf("count recovery codes: %w", err)
+	}
+
+	return remaining, nil
+}
+
+// useRecoveryCodeForChallenge marks the challenge as used and then the
+// code, in one transaction so the code is only used and the event only
+// recorded if the challenge is completed. Returns false if the code
+// isn't one of the unused codes of the user, the challenge is left
+// unused then.
+func (a *AuthService) useRecoveryCodeForChallenge(ctx context.Context, mfaChallenge database.MfaChallenge, code string, info ClientInfo) (bool, error) {
+	tx, err := a.db.Begin()
+	if err != nil {
+		return false, authErr.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	used, err := tx.MarkMfaChallengeUsed(ctx, mfaChallenge.Id)
+	if err != nil {
+		return false, authErr.Errorf("mark mfa challenge used: %w", err)
+	}
+
+	if !used {
+		return false, ErrAuthServiceInvalidMfaChallenge
+	}
+
+	valid, err := tx.UseMfaRecoveryCode(ctx, mfaChallenge.UserId, hashRecoveryCode(code))
+	if err != nil {
+		return false, authErr.Errorf("use recovery code: %w", err)
+	}
+
+	if !valid {
+		return false, nil
+	}
+
+	_, err = tx.CreateUserEvent(ctx, database.CreateUserEventParams{
+		UserId:    mfaChallenge.UserId,
+		Type:      UserEventRecoveryCodeUsed,
+		UserAgent: info.UserAgent,
+		IpAddress: info.IpAddress,
+	})
+	if err != nil {
+		return false, authErr.Errorf("create user event: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return false, authErr.Errorf("commit transaction: %w", err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/nanoteck137/authlab/database"
+)
+
+var (
+	ErrAuthServiceSessionNotFound = authErr.Error("session not found")
+	ErrAuthServiceReauthRequired  = authErr.Error("reauthentication required")
+)
+
+// How often the last seen timestamp of a session is updated
+const sessionLastSeenInterval = 1 * time.Minute
+
+// How long after the login the session can be used to change how the
+// user logs in, after this the user needs to log in again
+const sessionReauthDuration = 10 * time.Minute
+
+// The auth methods stored on the sessions
+const (
+	AuthMethodQuickConnect = "quick-connect"
+	AuthMethodDeviceCode   = "device-code"
+	AuthMethodPassword     = "password"
+	AuthMethodMagicLink    = "magic-link"
+	AuthMethodPasskey      = "passkey"
+)
+
+func AuthMethodProvider(providerId string) string {
+	return "provider:" + providerId
+}
+
+func AuthMethodOAuthClient(clientId string) string {
+	return "oauth-client:" + clientId
+}
+
+// ClientInfo is the infomation about the client that is saved with
+// the session
+type ClientInfo struct {
+	UserAgent string
+	IpAddress string
+}
+
+// createSession creates a new session for the user
+func (a *AuthService) createSession(ctx context.Context, params database.CreateSessionParams) (database.Session, error) {
+	session, err := a.db.CreateSession(ctx, params)
+	if err != nil {
+		return database.Session{}, authErr.Errorf("create session: %w", err)
+	}
+
+	return session, nil
+}
+
+// checkRecentLogin checks that the session was created by a login that
+// happened within sessionReauthDuration, so a stolen session can't be
+// used to add or remove the ways the user logs in.
+//
+// NOTE(patrik): Sessions from a quick connect without a second factor
+// doesn't count, the request can be approved with a stolen session
+func (a *AuthService) checkRecentLogin(ctx context.Context, userId, sessionId string) error {
+	session, err := a.db.GetSessionById(ctx, sessionId)
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return ErrAuthServiceSessionNotFound
+		}
+
+		return authErr.Errorf("get session: %w", err)
+	}
+
+	if session.UserId != userId {
+		return ErrAuthServiceSessionNotFound
+	}
+
+	if session.AuthMethod == AuthMethodQuickConnect {
+		return ErrAuthServiceReauthRequired
+	}
+
+	if time.Since(time.UnixMilli(session.Created)) > sessionReauthDuration {
+		return ErrAuthServiceReauthRequired
+	}
+
+	return nil
+}
+
+// CheckSession checks if the session exists and belongs to the user,
+// and updates the last seen timestamp of the session
+func (a *AuthService) CheckSession(ctx context.Context, sessionId, userId string) error {
+	session, err := a.db.GetSessionById(ctx, sessionId)
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return ErrAuthServiceSessionNotFound
+		}
+
+		return authErr.Errorf("get session: %w", err)
+	}
+
+	if session.UserId != userId {
+		return ErrAuthServiceSessionNotFound
+	}
+
+	// Only update the last seen timestamp every once in a while, so we
+	// don't write to the database on every request
+	now := time.Now()
+	if now.Sub(time.UnixMilli(session.LastSeen)) > sessionLastSeenInterval {
+		err := a.db.UpdateSessionLastSeen(ctx, session.Id, now.UnixMilli())
+		if err != nil {
+			return authErr.Errorf("update session last seen: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// RevokeSession revokes a single session of the user, all the tokens
+// issued for the session stops working
+func (a *AuthService) RevokeSession(ctx context.Context, userId, sessionId string) error {
+	session, err := a.db.GetSessionById(ctx, sessionId)
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return ErrAuthServiceSessionNotFound
+		}
+
+		return authErr.Errorf("get session: %w", err)
+	}
+
+	if session.UserId != userId {
+		return ErrAuthServiceSessionNotFound
+	}
+
+	err = a.db.DeleteSession(ctx, session.Id)
+	if err != nil {
+		return authErr.Errorf("delete session: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeAllSessions revokes all the sessions for the user, logging the
+// user out everywhere
+func (a *AuthService) RevokeAllSessions(ctx context.Context, userId string) error {
+	err := a.db.DeleteAllSessionsForUser(ctx, userId)
+	if err != nil {
+		return authErr.Errorf("delete all sessions: %w", err)
+	}
+
+	return nil
+}
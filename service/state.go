@@ -0,0 +1,102 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	errSignedPayloadInvalid = errors.New("signed payload is invalid")
+	errSignedPayloadExpired = errors.New("signed payload is expired")
+)
+
+// deriveKey creates a key for a specific purpose from the secret, so
+// that the same secret is never used directly for different things
+func deriveKey(secret, purpose string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// signPayload encodes the payload as JSON and signs it with HMAC-SHA256,
+// the result is "<payload>.<signature>" both base64url encoded
+func signPayload(key []byte, payload any) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(data)
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(encoded))
+	signature := base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	return encoded + "." + signature, nil
+}
+
+// verifyPayload checks the signature of the token created by signPayload
+// and decodes the payload into dest
+func verifyPayload(key []byte, token string, dest any) error {
+	encoded, signature, found := strings.Cut(token, ".")
+	if !found {
+		return errSignedPayloadInvalid
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return errSignedPayloadInvalid
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(encoded))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return errSignedPayloadInvalid
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return errSignedPayloadInvalid
+	}
+
+	err = json.Unmarshal(data, dest)
+	if err != nil {
+		return errSignedPayloadInvalid
+	}
+
+	return nil
+}
+
+// providerState is the payload of the OAuth2 state sent to the provider
+type providerState struct {
+	RequestId  string `json:"rid"`
+	ProviderId string `json:"pid"`
+	Expires    int64  `json:"exp"`
+}
+
+func (a *AuthService) signProviderState(request *authProviderRequest) (string, error) {
+	return signPayload(a.stateKey, providerState{
+		RequestId:  request.id,
+		ProviderId: request.providerId,
+		Expires:    request.expires.Unix(),
+	})
+}
+
+func (a *AuthService) verifyProviderState(state string) (providerState, error) {
+	var res providerState
+	err := verifyPayload(a.stateKey, state, &res)
+	if err != nil {
+		return providerState{}, err
+	}
+
+	if time.Now().After(time.Unix(res.Expires, 0)) {
+		return providerState{}, errSignedPayloadExpired
+	}
+
+	return res, nil
+}
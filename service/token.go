@@ -0,0 +1,236 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/nanoteck137/authlab/database"
+	"github.com/nanoteck137/authlab/tools/utils"
+)
+
+var (
+	ErrAuthServiceInvalidRefreshToken = authErr.Error("invalid refresh token")
+	ErrAuthServiceRefreshTokenReused  = authErr.Error("refresh token reused")
+	ErrAuthServiceTokenClientMismatch = authErr.Error("token was issued to another client")
+)
+
+// UserTokens is the access and refresh token pair handed out to the
+// user after a successful login
+type UserTokens struct {
+	// The short lived JWT access token
+	AccessToken string
+
+	// The timestamp for when the access token expires
+	AccessTokenExpires time.Time
+
+	// The opaque refresh token used to get a new token pair
+	RefreshToken string
+
+	// The timestamp for when the refresh token expires
+	RefreshTokenExpires time.Time
+}
+
+// hashToken returns the hash of a token that we store inside the
+// database, the tokens are random so we don't need a slow hash
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IssueUserTokens creates a new session for the user together with a
+// access token and a refresh token, the refresh token starts a new
+// token family that is bound to the session. This is where every login
+// ends, so the login policy is checked here.
+func (a *AuthService) IssueUserTokens(ctx context.Context, userId, authMethod string, info ClientInfo) (UserTokens, error) {
+	return a.issueSessionTokens(ctx, database.CreateSessionParams{
+		UserId:     userId,
+		AuthMethod: authMethod,
+		UserAgent:  info.UserAgent,
+		IpAddress:  info.IpAddress,
+	})
+}
+
+// issueSessionTokens checks the login policy for the user and creates a
+// new session with the params, returns the tokens for the session
+func (a *AuthService) issueSessionTokens(ctx context.Context, params database.CreateSessionParams) (UserTokens, error) {
+	err := a.checkLoginPolicy(ctx, params.UserId)
+	if err != nil {
+		return UserTokens{}, err
+	}
+
+	session, err := a.createSession(ctx, params)
+	if err != nil {
+		return UserTokens{}, err
+	}
+
+	return a.issueUserTokens(ctx, session)
+}
+
+func (a *AuthService) issueUserTokens(ctx context.Context, session database.Session) (UserTokens, error) {
+	accessToken, err := a.SignUserToken(session)
+	if err != nil {
+		return UserTokens{}, err
+	}
+
+	refreshToken, err := utils.GenerateAuthChallenge()
+	if err != nil {
+		return UserTokens{}, authErr.Errorf("generate refresh token: %w", err)
+	}
+
+	now := time.Now()
+	refreshExpires := now.Add(a.refreshTokenDuration)
+
+	_, err = a.db.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+		FamilyId:  session.Id,
+		UserId:    session.UserId,
+		SessionId: session.Id,
+		TokenHash: hashToken(refreshToken),
+		Expires:   refreshExpires.UnixMilli(),
+	})
+	if err != nil {
+		return UserTokens{}, authErr.Errorf("create refresh token: %w", err)
+	}
+
+	return UserTokens{
+		AccessToken:         accessToken,
+		AccessTokenExpires:  now.Add(a.accessTokenDuration),
+		RefreshToken:        refreshToken,
+		RefreshTokenExpires: refreshExpires,
+	}, nil
+}
+
+// RefreshUserTokens exchanges the refresh token for a new token pair, the
+// old refresh token can't be used again. If a refresh token is used twice
+// then the whole token family and the session is revoked, because then
+// someone else has a copy of the token. The clientId is the OAuth client
+// making the request, empty for the first party clients, and needs to be
+// the client the session was created for
+func (a *AuthService) RefreshUserTokens(ctx context.Context, refreshToken, clientId string) (UserTokens, error) {
+	token, err := a.db.GetRefreshTokenByHash(ctx, hashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return UserTokens{}, ErrAuthServiceInvalidRefreshToken
+		}
+
+		return UserTokens{}, authErr.Errorf("get refresh token: %w", err)
+	}
+
+	if time.Now().After(time.UnixMilli(token.Expires)) {
+		return UserTokens{}, ErrAuthServiceInvalidRefreshToken
+	}
+
+	session, err := a.db.GetSessionById(ctx, token.SessionId)
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return UserTokens{}, ErrAuthServiceInvalidRefreshToken
+		}
+
+		return UserTokens{}, authErr.Errorf("get session: %w", err)
+	}
+
+	// NOTE(patrik): Checked before marking the token as used, a client
+	// with the wrong credentials shouldn't be able to burn the token
+	if session.ClientId.String != clientId {
+		return UserTokens{}, ErrAuthServiceInvalidRefreshToken
+	}
+
+	// Mark the token as used, if it's already used then someone is
+	// reusing the token and we revoke the whole family
+	updated, err := a.db.MarkRefreshTokenUsed(ctx, token.Id)
+	if err != nil {
+		return UserTokens{}, authErr.Errorf("mark refresh token used: %w", err)
+	}
+
+	if !updated {
+		err := a.db.DeleteRefreshTokenFamily(ctx, token.FamilyId)
+		if err != nil {
+			return UserTokens{}, authErr.Errorf("delete refresh token family: %w", err)
+		}
+
+		// Deleting the session also makes the access tokens
+		// issued for the session invalid
+		err = a.db.DeleteSession(ctx, token.SessionId)
+		if err != nil {
+			return UserTokens{}, authErr.Errorf("delete session: %w", err)
+		}
+
+		return UserTokens{}, ErrAuthServiceRefreshTokenReused
+	}
+
+	err = a.db.UpdateSessionLastSeen(ctx, token.SessionId, time.Now().UnixMilli())
+	if err != nil {
+		return UserTokens{}, authErr.Errorf("update session last seen: %w", err)
+	}
+
+	return a.issueUserTokens(ctx, session)
+}
+
+// RevokeRefreshToken revokes the refresh token together with the session
+// it was issued for, the access tokens issued for the session stops
+// working as well. The clientId is the OAuth client making the request,
+// empty for the first party clients, and needs to be the client the
+// session was created for
+func (a *AuthService) RevokeRefreshToken(ctx context.Context, refreshToken, clientId string) error {
+	token, err := a.db.GetRefreshTokenByHash(ctx, hashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return ErrAuthServiceInvalidRefreshToken
+		}
+
+		return authErr.Errorf("get refresh token: %w", err)
+	}
+
+	session, err := a.db.GetSessionById(ctx, token.SessionId)
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return ErrAuthServiceInvalidRefreshToken
+		}
+
+		return authErr.Errorf("get session: %w", err)
+	}
+
+	if session.ClientId.String != clientId {
+		return ErrAuthServiceTokenClientMismatch
+	}
+
+	// NOTE(patrik): The refresh tokens are deleted together with the
+	// session
+	err = a.db.DeleteSession(ctx, token.SessionId)
+	if err != nil {
+		return authErr.Errorf("delete session: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeAccessToken adds the id (jti) of the access token to the
+// denylist, the entry is kept until the token would have expired
+func (a *AuthService) RevokeAccessToken(ctx context.Context, tokenId string, expires time.Time) error {
+	err := a.db.CreateRevokedToken(ctx, database.CreateRevokedTokenParams{
+		Jti:     tokenId,
+		Expires: expires.UnixMilli(),
+	})
+	if err != nil {
+		return authErr.Errorf("create revoked token: %w", err)
+	}
+
+	return nil
+}
+
+// IsAccessTokenRevoked checks the denylist for the id (jti) of the
+// access token
+func (a *AuthService) IsAccessTokenRevoked(ctx context.Context, tokenId string) (bool, error) {
+	_, err := a.db.GetRevokedTokenByJti(ctx, tokenId)
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return false, nil
+		}
+
+		return false, authErr.Errorf("get revoked token: %w", err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/nanoteck137/authlab/tools/utils"
+)
+
+// ExchangeSubject is the user token that a client exchanges for a new
+// token (RFC 8693)
+type ExchangeSubject struct {
+	UserId string
+
+	// The session the token was issued for, empty for api tokens
+	SessionId string
+
+	// The OAuth client the token was issued to, empty for the tokens
+	// issued to the first party clients and for api tokens. Tokens
+	// issued to clients are limited to the scopes inside Scope.
+	ClientId string
+	Scope    string
+
+	// The clients that already has exchanged the token, the most recent
+	// actor first
+	Actors []string
+
+	// When the token expires, zero for api tokens
+	Expires time.Time
+}
+
+// ExchangedToken is the token the client gets back from the token
+// exchange grant
+type ExchangedToken struct {
+	AccessToken        string
+	AccessTokenExpires time.Time
+
+	// The granted scopes separated by spaces
+	Scope string
+
+	// The audiences the token is valid for
+	Audience []string
+}
+
+// ActorClaim creates the "act" claim from the chain of actors, the
+// earlier actors are nested inside the claim (RFC 8693 section 4.1)
+func ActorClaim(actors []string) map[string]any {
+	if len(actors) == 0 {
+		return nil
+	}
+
+	claim := map[string]any{
+		"sub": actors[0],
+	}
+
+	if prev := ActorClaim(actors[1:]); prev != nil {
+		claim["act"] = prev
+	}
+
+	return claim
+}
+
+// ParseActorClaim returns the chain of actors from the "act" claim, the
+// most recent actor first
+func ParseActorClaim(claim any) []string {
+	var actors []string
+
+	for claim != nil {
+		act, ok := claim.(map[string]any)
+		if !ok {
+			break
+		}
+
+		sub, _ := act["sub"].(string)
+		if sub == "" {
+			break
+		}
+
+		actors = append(actors, sub)
+		claim = act["act"]
+	}
+
+	return actors
+}
+
+// ExchangeToken issues a new token for the user of the subject token,
+// the new token is restricted to the requested audiences and scopes and
+// records the client inside the "act" claim. The exchange policy of the
+// client decides the audiences and the scopes that can be requested,
+// and the scopes can never be more than the subject token has. Clients
+// without exchange scopes can't exchange tokens.
+func (a *AuthService) ExchangeToken(client *OAuthClient, subject ExchangeSubject, scope string, audience []string) (ExchangedToken, error) {
+	if !client.HasGrantType(GrantTypeTokenExchange) || client.IsPublic() {
+		return ExchangedToken{}, ErrAuthServiceUnauthorizedClient
+	}
+
+	// NOTE(patrik): The first party tokens and the api tokens has no
+	// scopes and can do everything
+	limited := subject.ClientId != ""
+	subjectScopes := strings.Fields(subject.Scope)
+
+	scopes := strings.Fields(scope)
+	if len(scopes) == 0 {
+		scopes = client.ExchangeScopes
+		if limited {
+			scopes = slices.DeleteFunc(slices.Clone(scopes), func(s string) bool {
+				return !slices.Contains(subjectScopes, s)
+			})
+		}
+	}
+
+	if len(scopes) == 0 {
+		return ExchangedToken{}, ErrAuthServiceInvalidScope
+	}
+
+	// NOTE(patrik): The first party tokens are not limited by the subject,
+	// so the exchange policy of the client is the only limit and an
+	// empty policy allows nothing
+	for _, s := range scopes {
+		if !slices.Contains(client.ExchangeScopes, s) {
+			return ExchangedToken{}, ErrAuthServiceInvalidScope
+		}
+
+		if limited && !slices.Contains(subjectScopes, s) {
+			return ExchangedToken{}, ErrAuthServiceInvalidScope
+		}
+	}
+
+	if len(audience) == 0 {
+		audience = client.ExchangeAudiences
+	}
+
+	if len(audience) == 0 {
+		return ExchangedToken{}, ErrAuthServiceInvalidAudience
+	}
+
+	for _, aud := range audience {
+		if !client.HasExchangeAudience(aud) {
+			return ExchangedToken{}, ErrAuthServiceInvalidAudience
+		}
+	}
+
+	// NOTE(patrik): The new token can't outlive the subject token
+	now := time.Now()
+	expires := now.Add(a.accessTokenDuration)
+	if !subject.Expires.IsZero() && subject.Expires.Before(expires) {
+		expires = subject.Expires
+	}
+
+	actors := append([]string{client.Id}, subject.Actors...)
+
+	claims := jwt.MapClaims{
+		"jti":       utils.CreateId(),
+		"sub":       subject.UserId,
+		"userId":    subject.UserId,
+		"client_id": client.Id,
+		"scope":     strings.Join(scopes, " "),
+		"aud":       audience,
+		"act":       ActorClaim(actors),
+		"iat":       now.Unix(),
+		"exp":       expires.Unix(),
+	}
+
+	// NOTE(patrik): Tokens exchanged from api tokens has no session, they
+	// are short lived so they expire on their own when the api token is
+	// deleted
+	if subject.SessionId != "" {
+		claims["sid"] = subject.SessionId
+	}
+
+	token, err := a.keys.Sign(claims)
+	if err != nil {
+		return ExchangedToken{}, authErr.Errorf("sign exchanged token: %w", err)
+	}
+
+	return ExchangedToken{
+		AccessToken:        token,
+		AccessTokenExpires: expires,
+		Scope:              strings.Join(scopes, " "),
+		Audience:           audience,
+	}, nil
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nanoteck137/authlab/config"
+)
+
+func newTestExchangeService(t *testing.T) *AuthService {
+	t.Helper()
+
+	keys, err := NewKeyService(t.TempDir(), &config.Config{
+		JwtSecret:           "test-secret",
+		JwtSigningAlgorithm: AlgorithmHS256,
+		AccessTokenDuration: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("create key service: %v", err)
+	}
+
+	return &AuthService{
+		keys:                keys,
+		accessTokenDuration: time.Hour,
+	}
+}
+
+func newTestExchangeClient(scopes ...string) *OAuthClient {
+	return &OAuthClient{
+		Id:                "exchanger",
+		GrantTypes:        []string{GrantTypeTokenExchange},
+		ExchangeAudiences: []string{"api"},
+		ExchangeScopes:    scopes,
+	}
+}
+
+func TestExchangeTokenFirstPartySubject(t *testing.T) {
+	a := newTestExchangeService(t)
+
+	subject := ExchangeSubject{
+		UserId:    "user",
+		SessionId: "session",
+		Expires:   time.Now().Add(time.Hour),
+	}
+
+	tests := []struct {
+		name    string
+		client  *OAuthClient
+		scope   string
+		want    string
+		wantErr error
+	}{
+		{
+			name:    "no exchange scopes and no requested scope",
+			client:  newTestExchangeClient(),
+			wantErr: ErrAuthServiceInvalidScope,
+		},
+		{
+			name:    "no exchange scopes and requested scope",
+			client:  newTestExchangeClient(),
+			scope:   "openid email",
+			wantErr: ErrAuthServiceInvalidScope,
+		},
+		{
+			name:    "scope outside the exchange scopes",
+			client:  newTestExchangeClient("openid"),
+			scope:   "openid email",
+			wantErr: ErrAuthServiceInvalidScope,
+		},
+		{
+			name:   "defaults to the exchange scopes",
+			client: newTestExchangeClient("openid", "email"),
+			want:   "openid email",
+		},
+		{
+			name:   "requested scope inside the exchange scopes",
+			client: newTestExchangeClient("openid", "email"),
+			scope:  "email",
+			want:   "email",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token, err := a.ExchangeToken(test.client, subject, test.scope, nil)
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("got error %v, want %v", err, test.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("exchange token: %v", err)
+			}
+
+			if token.Scope != test.want {
+				t.Fatalf("got scope %q, want %q", token.Scope, test.want)
+			}
+		})
+	}
+}
+
+func TestExchangeTokenClientSubject(t *testing.T) {
+	a := newTestExchangeService(t)
+
+	subject := ExchangeSubject{
+		UserId:    "user",
+		SessionId: "session",
+		ClientId:  "app",
+		Scope:     "openid profile",
+		Expires:   time.Now().Add(time.Hour),
+	}
+
+	client := newTestExchangeClient("openid", "email")
+
+	token, err := a.ExchangeToken(client, subject, "", nil)
+	if err != nil {
+		t.Fatalf("exchange token: %v", err)
+	}
+
+	// NOTE(patrik): Only the scopes both the subject token and the
+	// exchange policy has
+	if token.Scope != "openid" {
+		t.Fatalf("got scope %q, want %q", token.Scope, "openid")
+	}
+
+	_, err = a.ExchangeToken(client, subject, "email", nil)
+	if !errors.Is(err, ErrAuthServiceInvalidScope) {
+		t.Fatalf("got error %v, want %v", err, ErrAuthServiceInvalidScope)
+	}
+
+	_, err = a.ExchangeToken(newTestExchangeClient(), subject, "openid", nil)
+	if !errors.Is(err, ErrAuthServiceInvalidScope) {
+		t.Fatalf("got error %v, want %v", err, ErrAuthServiceInvalidScope)
+	}
+}
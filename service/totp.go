@@ -0,0 +1,348 @@
+package service
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nanoteck137/authlab"
+	"github.com/nanoteck137/authlab/database"
+)
+
+var (
+	ErrAuthServiceTotpAlreadyEnabled = authErr.Error("totp is already enabled")
+	ErrAuthServiceTotpNotEnabled     = authErr.Error("totp is not enabled")
+	ErrAuthServiceInvalidMfaCode     = authErr.Error("invalid mfa code")
+)
+
+// The TOTP parameters, these are the defaults of RFC 6238 and the only
+// ones most authenticator apps supports
+const (
+	totpPeriod       = 30
+	totpDigits       = 6
+	totpSecretLength = 20
+
+	// How many time steps before and after the current step that are
+	// accepted, allows the clock of the phone to be a bit off
+	totpSkew = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func totpStep(t time.Time) int64 {
+	return t.Unix() / totpPeriod
+}
+
+// generateTotpCode creates the HOTP code (RFC 4226) for the step
+func generateTotpCode(secret []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for range totpDigits {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", totpDigits, value%mod)
+}
+
+// verifyTotpCode checks the code against the steps around the time,
+// returns the step the code belongs to
+func verifyTotpCode(secret []byte, code string, t time.Time) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := totpStep(t)
+	for i := -totpSkew; i <= totpSkew; i++ {
+		step := current + int64(i)
+		expected := generateTotpCode(secret, step)
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// totpUri creates the otpauth:// uri that the authenticator apps reads
+// from the QR code
+func totpUri(account, secret string) string {
+	label := url.PathEscape(authlab.AppName) + ":" + url.PathEscape(account)
+
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", authlab.AppName)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", strconv.Itoa(totpDigits))
+	query.Set("period", strconv.Itoa(totpPeriod))
+
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// encryptSecret encrypts the secret with AES-GCM, the result is the nonce
+// followed by the ciphertext base64url encoded
+func encryptSecret(key, secret []byte) (string, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+
+	data := gcm.Seal(nonce, nonce, secret, nil)
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decryptSecret(key []byte, encrypted string) ([]byte, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encrypted)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("encrypted secret is too short")
+	}
+
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+// reencryptTotpSecrets encrypts the secrets that was encrypted with the
+// old key again with the current key, the secrets that can't be
+// decrypted are left alone and the users needs to enroll again
+func (a *AuthService) reencryptTotpSecrets(ctx context.Context, oldKey []byte) error {
+	totps, err := a.db.GetAllUserTotps(ctx)
+	if err != nil {
+		return authErr.Errorf("get all user totps: %w", err)
+	}
+
+	for _, totp := range totps {
+		_, err := decryptSecret(a.totpKey, totp.Secret)
+		if err == nil {
+			continue
+		}
+
+		secret, err := decryptSecret(oldKey, totp.Secret)
+		if err != nil {
+			slog.Warn("Failed to decrypt the totp secret", "userId", totp.UserId, "err", err)
+			continue
+		}
+
+		encrypted, err := encryptSecret(a.totpKey, secret)
+		if err != nil {
+			return authErr.Errorf("encrypt totp secret: %w", err)
+		}
+
+		err = a.db.UpdateUserTotpSecret(ctx, totp.UserId, encrypted)
+		if err != nil {
+			return authErr.Errorf("update user totp secret: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// checkTotpCode checks the code against the authenticator of the user, a
+// code can only be used once
+func (a *AuthService) checkTotpCode(ctx context.Context, totp database.UserTotp, code string) (bool, error) {
+	secret, err := decryptSecret(a.totpKey, totp.Secret)
+	if err != nil {
+		return false, authErr.Errorf("decrypt totp secret: %w", err)
+	}
+
+	step, valid := verifyTotpCode(secret, code, time.Now())
+	if !valid {
+		return false, nil
+	}
+
+	used, err := a.db.UseUserTotpStep(ctx, totp.UserId, step)
+	if err != nil {
+		return false, authErr.Errorf("use totp step: %w", err)
+	}
+
+	return used, nil
+}
+
+func (a *AuthService) getUserTotp(ctx context.Context, userId string) (database.UserTotp, error) {
+	totp, err := a.db.GetUserTotp(ctx, userId)
+	if err != nil {
+		if errors.Is(err, database.ErrItemNotFound) {
+			return database.UserTotp{}, ErrAuthServiceTotpNotEnabled
+		}
+
+		return database.UserTotp{}, authErr.Errorf("get user totp: %w", err)
+	}
+
+	return totp, nil
+}
+
+// TotpEnabled returns if the user has a TOTP authenticator enabled
+func (a *AuthService) TotpEnabled(ctx context.Context, userId string) (bool, error) {
+	totp, err := a.getUserTotp(ctx, userId)
+	if err != nil {
+		if errors.Is(err, ErrAuthServiceTotpNotEnabled) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return totp.Enabled > 0, nil
+}
+
+type TotpEnrollment struct {
+	// The base32 encoded secret, for the users that can't scan the QR
+	// code
+	Secret string
+
+	// The otpauth:// uri for the QR code
+	Uri string
+}
+
+// EnrollTotp creates a new secret for the user, the authenticator isn't
+// enabled until the user has entered a code with ConfirmTotp. The
+// session needs to be from a recent login.
+func (a *AuthService) EnrollTotp(ctx context.Context, user database.User, sessionId string) (TotpEnrollment, error) {
+	err := a.checkRecentLogin(ctx, user.Id, sessionId)
+	if err != nil {
+		return TotpEnrollment{}, err
+	}
+
+	enabled, err := a.TotpEnabled(ctx, user.Id)
+	if err != nil {
+		return TotpEnrollment{}, err
+	}
+
+	if enabled {
+		return TotpEnrollment{}, ErrAuthServiceTotpAlreadyEnabled
+	}
+
+	secret := make([]byte, totpSecretLength)
+	_, err = rand.Read(secret)
+	if err != nil {
+		return TotpEnrollment{}, authErr.Errorf("generate totp secret: %w", err)
+	}
+
+	encrypted, err := encryptSecret(a.totpKey, secret)
+	if err != nil {
+		return TotpEnrollment{}, authErr.Errorf("encrypt totp secret: %w", err)
+	}
+
+	err = a.db.SetUserTotpSecret(ctx, user.Id, encrypted)
+	if err != nil {
+		return TotpEnrollment{}, authErr.Errorf("set user totp secret: %w", err)
+	}
+
+	encoded := totpEncoding.EncodeToString(secret)
+
+	return TotpEnrollment{
+		Secret: encoded,
+		Uri:    totpUri(user.Email, encoded),
+	}, nil
+}
+
+// ConfirmTotp enables the authenticator after the user has proven that
+// the authenticator app has the secret, returns the recovery codes if
+// the user didn't have any. The session needs to be from a recent login.
+func (a *AuthService) ConfirmTotp(ctx context.Context, userId, sessionId, code string, info ClientInfo) ([]string, error) {
+	err := a.checkRecentLogin(ctx, userId, sessionId)
+	if err != nil {
+		return nil, err
+	}
+
+	totp, err := a.getUserTotp(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if totp.Enabled > 0 {
+		return nil, ErrAuthServiceTotpAlreadyEnabled
+	}
+
+	valid, err := a.checkTotpCode(ctx, totp, code)
+	if err != nil {
+		return nil, err
+	}
+
+	if !valid {
+		return nil, ErrAuthServiceInvalidMfaCode
+	}
+
+	err = a.db.EnableUserTotp(ctx, userId)
+	if err != nil {
+		return nil, authErr.Errorf("enable user totp: %w", err)
+	}
+
+	return a.createInitialRecoveryCodes(ctx, userId, info)
+}
+
+// DisableTotp removes the authenticator of the user, the user needs to
+// enter a code so a stolen session can't remove it
+func (a *AuthService) DisableTotp(ctx context.Context, userId, code string) error {
+	totp, err := a.getUserTotp(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	if totp.Enabled == 0 {
+		return ErrAuthServiceTotpNotEnabled
+	}
+
+	valid, err := a.checkTotpCode(ctx, totp, code)
+	if err != nil {
+		return err
+	}
+
+	if !valid {
+		return ErrAuthServiceInvalidMfaCode
+	}
+
+	err = a.db.DeleteUserTotp(ctx, userId)
+	if err != nil {
+		return authErr.Errorf("delete user totp: %w", err)
+	}
+
+	return a.removeUnusableRecoveryCodes(ctx, userId)
+}
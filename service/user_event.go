@@ -0,0 +1,41 @@
+package service
+
+import (
+	"context"
+
+	"github.com/nanoteck137/authlab/database"
+)
+
+// How many events are returned by GetUserEvents
+const userEventLimit = 100
+
+// The events stored in the history of the user
+const (
+	UserEventRecoveryCodesGenerated = "recovery_codes_generated"
+	UserEventRecoveryCodeUsed       = "recovery_code_used"
+)
+
+// recordUserEvent adds the event to the history of the user
+func (a *AuthService) recordUserEvent(ctx context.Context, userId, eventType string, info ClientInfo) error {
+	_, err := a.db.CreateUserEvent(ctx, database.CreateUserEventParams{
+		UserId:    userId,
+		Type:      eventType,
+		UserAgent: info.UserAgent,
+		IpAddress: info.IpAddress,
+	})
+	if err != nil {
+		return authErr.Errorf("create user event: %w", err)
+	}
+
+	return nil
+}
+
+// GetUserEvents returns the newest events from the history of the user
+func (a *AuthService) GetUserEvents(ctx context.Context, userId string) ([]database.UserEvent, error) {
+	events, err := a.db.GetUserEvents(ctx, userId, userEventLimit)
+	if err != nil {
+		return nil, authErr.Errorf("get user events: %w", err)
+	}
+
+	return events, nil
+}
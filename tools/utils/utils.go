@@ -22,6 +22,7 @@ var CreateTrackId = createIdGenerator(32)
 var CreateTrackMediaId = createIdGenerator(32)
 
 var CreateApiTokenId = createIdGenerator(32)
+var CreateOAuthClientId = createIdGenerator(24)
 
 func createIdGenerator(length int) func() string {
 	res, err := cuid2.Init(cuid2.WithLength(length))
@@ -100,6 +101,10 @@ func TotalPages(perPage, totalItems int) int {
 const (
 	letters = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
 	digits  = "0123456789"
+
+	// NOTE(patrik): 32 characters so every character is picked with the
+	// same chance by randomString
+	recoveryCodeChars = "abcdefghijklmnopqrstuvwxyz234567"
 )
 
 func randomString(charset string, length int) (string, error) {
@@ -134,6 +139,22 @@ func GenerateCode() (string, error) {
 	return fmt.Sprintf("%s-%s-%s", part1, part2, part3), nil
 }
 
+// GenerateRecoveryCode generates a code in the format "xxxxx-xxxxx", the
+// code has 50 bits of randomness
+func GenerateRecoveryCode() (string, error) {
+	part1, err := randomString(recoveryCodeChars, 5)
+	if err != nil {
+		return "", err
+	}
+
+	part2, err := randomString(recoveryCodeChars, 5)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s-%s", part1, part2), nil
+}
+
 func GenerateAuthChallenge() (string, error) {
 	b := make([]byte, 64)
 	if _, err := rand.Read(b); err != nil {
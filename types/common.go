@@ -12,6 +12,14 @@ func (d WorkDir) DatabaseFile() string {
 	return path.Join(d.String(), "data.db")
 }
 
+func (d WorkDir) KeysDir() string {
+	return path.Join(d.String(), "keys")
+}
+
+func (d WorkDir) MailDir() string {
+	return path.Join(d.String(), "mail")
+}
+
 type Change[T any] struct {
 	Value   T
 	Changed bool
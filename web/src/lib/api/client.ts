@@ -11,11 +11,63 @@ export class ApiClient extends BaseApiClient {
     this.url = new ClientUrls(baseUrl);
   }
   
+  authBeginPasskeyLogin(options?: ExtraOptions) {
+    return this.request("/api/v1/auth/passkey/login/begin", "POST", api.PasskeyOptions, z.any(), undefined, options)
+  }
+  
+  authBeginPasskeyMfa(body: api.AuthBeginPasskeyMfaBody, options?: ExtraOptions) {
+    return this.request("/api/v1/auth/mfa/passkey/begin", "POST", api.PasskeyOptions, z.any(), body, options)
+  }
+  
+  authBeginPasskeyRegistration(options?: ExtraOptions) {
+    return this.request("/api/v1/auth/passkeys/register/begin", "POST", api.PasskeyOptions, z.any(), undefined, options)
+  }
+  
+  
+  authChangePassword(body: api.AuthChangePasswordBody, options?: ExtraOptions) {
+    return this.request("/api/v1/auth/local/password", "POST", z.undefined(), z.any(), body, options)
+  }
   
   authClaimQuickConnectCode(body: api.AuthClaimQuickConnectCodeBody, options?: ExtraOptions) {
     return this.request("/api/v1/auth/quick-connect/claim", "POST", z.undefined(), z.any(), body, options)
   }
   
+  authConfirmTotp(body: api.AuthTotpCodeBody, options?: ExtraOptions) {
+    return this.request("/api/v1/auth/mfa/totp/confirm", "POST", api.AuthConfirmTotp, z.any(), body, options)
+  }
+  
+  authCreateForwardSession(body: api.AuthCreateForwardSessionBody, options?: ExtraOptions) {
+    return this.request("/api/v1/auth/forward/session", "POST", api.AuthCreateForwardSession, z.any(), body, options)
+  }
+  
+  authDenyQuickConnectCode(body: api.AuthDenyQuickConnectCodeBody, options?: ExtraOptions) {
+    return this.request("/api/v1/auth/quick-connect/deny", "POST", z.undefined(), z.any(), body, options)
+  }
+  
+  authDisableTotp(body: api.AuthTotpCodeBody, options?: ExtraOptions) {
+    return this.request("/api/v1/auth/mfa/totp/disable", "POST", z.undefined(), z.any(), body, options)
+  }
+  
+  authEnrollTotp(options?: ExtraOptions) {
+    return this.request("/api/v1/auth/mfa/totp/enroll", "POST", api.AuthEnrollTotp, z.any(), undefined, options)
+  }
+  
+  authFinishMagicLink(body: api.AuthFinishMagicLinkBody, options?: ExtraOptions) {
+    return this.request("/api/v1/auth/magic-link/finish", "POST", api.AuthFinishMagicLink, z.any(), body, options)
+  }
+  
+  authFinishPasskeyLogin(body: api.AuthFinishPasskeyLoginBody, options?: ExtraOptions) {
+    return this.request("/api/v1/auth/passkey/login/finish", "POST", api.AuthFinishPasskeyLogin, z.any(), body, options)
+  }
+  
+  authFinishPasskeyMfa(body: api.AuthFinishPasskeyMfaBody, options?: ExtraOptions) {
+    return this.request("/api/v1/auth/mfa/passkey/finish", "POST", api.AuthFinishPasskeyMfa, z.any(), body, options)
+  }
+  
+  authFinishPasskeyRegistration(body: api.AuthFinishPasskeyRegistrationBody, options?: ExtraOptions) {
+    return this.request("/api/v1/auth/passkeys/register/finish", "POST", api.AuthFinishPasskeyRegistration, z.any(), body, options)
+  }
+  
   authFinishProvider(body: api.AuthFinishProviderBody, options?: ExtraOptions) {
     return this.request("/api/v1/auth/providers/finish", "POST", api.AuthFinishProvider, z.any(), body, options)
   }
@@ -24,6 +76,12 @@ export class ApiClient extends BaseApiClient {
     return this.request("/api/v1/auth/quick-connect/finish", "POST", api.AuthFinishQuickConnect, z.any(), body, options)
   }
   
+  
+  
+  authGetMagicLinkStatus(body: api.AuthGetMagicLinkStatusBody, options?: ExtraOptions) {
+    return this.request("/api/v1/auth/magic-link/status", "POST", api.AuthGetMagicLinkStatus, z.any(), body, options)
+  }
+  
   authGetProviderStatus(body: api.AuthGetProviderStatusBody, options?: ExtraOptions) {
     return this.request("/api/v1/auth/provider/status", "POST", api.AuthGetProviderStatus, z.any(), body, options)
   }
@@ -36,6 +94,24 @@ export class ApiClient extends BaseApiClient {
     return this.request("/api/v1/auth/quick-connect/status", "POST", api.AuthGetQuickConnectStatus, z.any(), body, options)
   }
   
+  authLocalLogin(body: api.AuthLocalLoginBody, options?: ExtraOptions) {
+    return this.request("/api/v1/auth/local/login", "POST", api.AuthLocalLogin, z.any(), body, options)
+  }
+  
+  authLocalSignup(body: api.AuthLocalSignupBody, options?: ExtraOptions) {
+    return this.request("/api/v1/auth/local/signup", "POST", api.AuthLocalSignup, z.any(), body, options)
+  }
+  
+  authLogout(options?: ExtraOptions) {
+    return this.request("/api/v1/auth/logout", "POST", z.undefined(), z.any(), undefined, options)
+  }
+  
+  
+  
+  authMagicLinkInitiate(body: api.AuthMagicLinkInitiateBody, options?: ExtraOptions) {
+    return this.request("/api/v1/auth/magic-link/initiate", "POST", api.AuthMagicLinkInitiate, z.any(), body, options)
+  }
+  
   authProviderInitiate(body: api.AuthInitiateBody, options?: ExtraOptions) {
     return this.request("/api/v1/auth/providers/initiate", "POST", api.AuthInitiate, z.any(), body, options)
   }
@@ -44,29 +120,176 @@ export class ApiClient extends BaseApiClient {
     return this.request("/api/v1/auth/quick-connect/initiate", "POST", api.AuthQuickConnectInitiate, z.any(), undefined, options)
   }
   
+  authRefreshToken(body: api.AuthRefreshTokenBody, options?: ExtraOptions) {
+    return this.request("/api/v1/auth/token/refresh", "POST", api.AuthRefreshToken, z.any(), body, options)
+  }
+  
+  authRegenerateRecoveryCodes(options?: ExtraOptions) {
+    return this.request("/api/v1/auth/mfa/recovery-codes", "POST", api.AuthRegenerateRecoveryCodes, z.any(), undefined, options)
+  }
+  
+  authRequestEmailVerification(body: api.AuthRequestEmailVerificationBody, options?: ExtraOptions) {
+    return this.request("/api/v1/auth/email/verify/request", "POST", z.undefined(), z.any(), body, options)
+  }
+  
+  authRequestPasswordReset(body: api.AuthRequestPasswordResetBody, options?: ExtraOptions) {
+    return this.request("/api/v1/auth/local/password/reset", "POST", z.undefined(), z.any(), body, options)
+  }
+  
+  authResetPassword(body: api.AuthResetPasswordBody, options?: ExtraOptions) {
+    return this.request("/api/v1/auth/local/password/reset/confirm", "POST", z.undefined(), z.any(), body, options)
+  }
+  
+  authVerifyEmail(body: api.AuthVerifyEmailBody, options?: ExtraOptions) {
+    return this.request("/api/v1/auth/email/verify/confirm", "POST", z.undefined(), z.any(), body, options)
+  }
+  
+  authVerifyMfa(body: api.AuthVerifyMfaBody, options?: ExtraOptions) {
+    return this.request("/api/v1/auth/mfa/verify", "POST", api.AuthVerifyMfa, z.any(), body, options)
+  }
+  
   createApiToken(body: api.CreateApiTokenBody, options?: ExtraOptions) {
     return this.request("/api/v1/user/apitoken", "POST", api.CreateApiToken, z.any(), body, options)
   }
   
+  createInitialAccessToken(body: api.CreateInitialAccessTokenBody, options?: ExtraOptions) {
+    return this.request("/api/v1/oauth/initial-tokens", "POST", api.CreateInitialAccessToken, z.any(), body, options)
+  }
+  
+  createOauthClient(body: api.CreateOAuthClientBody, options?: ExtraOptions) {
+    return this.request("/api/v1/oauth/clients", "POST", api.CreateOAuthClient, z.any(), body, options)
+  }
+  
   deleteApiToken(id: string, options?: ExtraOptions) {
     return this.request(`/api/v1/user/apitoken/${id}`, "DELETE", z.undefined(), z.any(), undefined, options)
   }
   
+  deleteInitialAccessToken(id: string, options?: ExtraOptions) {
+    return this.request(`/api/v1/oauth/initial-tokens/${id}`, "DELETE", z.undefined(), z.any(), undefined, options)
+  }
+  
+  deleteOauthClient(id: string, options?: ExtraOptions) {
+    return this.request(`/api/v1/oauth/clients/${id}`, "DELETE", z.undefined(), z.any(), undefined, options)
+  }
+  
+  deletePasskey(id: string, options?: ExtraOptions) {
+    return this.request(`/api/v1/auth/passkeys/${id}`, "DELETE", z.undefined(), z.any(), undefined, options)
+  }
+  
   getAllApiTokens(options?: ExtraOptions) {
     return this.request("/api/v1/user/apitoken", "GET", api.GetAllApiTokens, z.any(), undefined, options)
   }
   
+  getEvents(options?: ExtraOptions) {
+    return this.request("/api/v1/auth/events", "GET", api.GetUserEvents, z.any(), undefined, options)
+  }
+  
+  getGrants(options?: ExtraOptions) {
+    return this.request("/api/v1/user/grants", "GET", api.GetGrants, z.any(), undefined, options)
+  }
+  
+  getInitialAccessTokens(options?: ExtraOptions) {
+    return this.request("/api/v1/oauth/initial-tokens", "GET", api.GetInitialAccessTokens, z.any(), undefined, options)
+  }
+  
   getMe(options?: ExtraOptions) {
     return this.request("/api/v1/auth/me", "GET", api.GetMe, z.any(), undefined, options)
   }
   
+  getMfaStatus(options?: ExtraOptions) {
+    return this.request("/api/v1/auth/mfa", "GET", api.GetMfaStatus, z.any(), undefined, options)
+  }
+  
+  getOauthClientById(id: string, options?: ExtraOptions) {
+    return this.request(`/api/v1/oauth/clients/${id}`, "GET", api.OAuthClient, z.any(), undefined, options)
+  }
+  
+  getOauthClients(options?: ExtraOptions) {
+    return this.request("/api/v1/oauth/clients", "GET", api.GetOAuthClients, z.any(), undefined, options)
+  }
+  
+  getPasskeys(options?: ExtraOptions) {
+    return this.request("/api/v1/auth/passkeys", "GET", api.GetPasskeys, z.any(), undefined, options)
+  }
+  
+  getSessions(options?: ExtraOptions) {
+    return this.request("/api/v1/auth/sessions", "GET", api.GetSessions, z.any(), undefined, options)
+  }
+  
   getSystemInfo(options?: ExtraOptions) {
     return this.request("/api/v1/system/info", "GET", api.GetSystemInfo, z.any(), undefined, options)
   }
   
+  getUserEvents(id: string, options?: ExtraOptions) {
+    return this.request(`/api/v1/users/${id}/events`, "GET", api.GetUserEvents, z.any(), undefined, options)
+  }
+  
+  getUserSessions(id: string, options?: ExtraOptions) {
+    return this.request(`/api/v1/users/${id}/sessions`, "GET", api.GetSessions, z.any(), undefined, options)
+  }
+  
+  getWhoAmI(options?: ExtraOptions) {
+    return this.request("/api/v1/auth/whoami", "GET", api.GetWhoAmI, z.any(), undefined, options)
+  }
+  
+  oauthAuthorize(body: api.OAuthAuthorizeBody, options?: ExtraOptions) {
+    return this.request("/api/v1/oauth/authorize", "POST", api.OAuthAuthorize, z.any(), body, options)
+  }
+  
+  
+  
+  
+  
+  
+  
+  
+  
+  
+  
+  
+  
+  
+  revokeAllSessions(options?: ExtraOptions) {
+    return this.request("/api/v1/auth/sessions", "DELETE", z.undefined(), z.any(), undefined, options)
+  }
+  
+  revokeAllUserSessions(id: string, options?: ExtraOptions) {
+    return this.request(`/api/v1/users/${id}/sessions`, "DELETE", z.undefined(), z.any(), undefined, options)
+  }
+  
+  revokeGrant(clientId: string, options?: ExtraOptions) {
+    return this.request(`/api/v1/user/grants/${clientId}`, "DELETE", z.undefined(), z.any(), undefined, options)
+  }
+  
+  revokeSession(id: string, options?: ExtraOptions) {
+    return this.request(`/api/v1/auth/sessions/${id}`, "DELETE", z.undefined(), z.any(), undefined, options)
+  }
+  
+  revokeUserSession(id: string, sessionId: string, options?: ExtraOptions) {
+    return this.request(`/api/v1/users/${id}/sessions/${sessionId}`, "DELETE", z.undefined(), z.any(), undefined, options)
+  }
+  
+  rotateOauthClientSecret(id: string, options?: ExtraOptions) {
+    return this.request(`/api/v1/oauth/clients/${id}/secret`, "POST", api.RotateOAuthClientSecret, z.any(), undefined, options)
+  }
+  
+  setUserEmailVerified(id: string, body: api.SetUserEmailVerifiedBody, options?: ExtraOptions) {
+    return this.request(`/api/v1/users/${id}/email/verified`, "POST", z.undefined(), z.any(), body, options)
+  }
+  
+  updateOauthClient(id: string, body: api.UpdateOAuthClientBody, options?: ExtraOptions) {
+    return this.request(`/api/v1/oauth/clients/${id}`, "PATCH", api.OAuthClient, z.any(), body, options)
+  }
+  
+  updatePasskey(id: string, body: api.UpdatePasskeyBody, options?: ExtraOptions) {
+    return this.request(`/api/v1/auth/passkeys/${id}`, "PATCH", z.undefined(), z.any(), body, options)
+  }
+  
   updateUserSettings(body: api.UpdateUserSettingsBody, options?: ExtraOptions) {
     return this.request("/api/v1/user/settings", "PATCH", z.undefined(), z.any(), body, options)
   }
+  
+  
 }
 
 export class ClientUrls {
@@ -76,14 +299,66 @@ export class ClientUrls {
     this.baseUrl = baseUrl;
   }
   
+  authBeginPasskeyLogin() {
+    return createUrl(this.baseUrl, "/api/v1/auth/passkey/login/begin")
+  }
+  
+  authBeginPasskeyMfa() {
+    return createUrl(this.baseUrl, "/api/v1/auth/mfa/passkey/begin")
+  }
+  
+  authBeginPasskeyRegistration() {
+    return createUrl(this.baseUrl, "/api/v1/auth/passkeys/register/begin")
+  }
+  
   authCallback() {
     return createUrl(this.baseUrl, "/api/v1/auth/providers/callback")
   }
   
+  authChangePassword() {
+    return createUrl(this.baseUrl, "/api/v1/auth/local/password")
+  }
+  
   authClaimQuickConnectCode() {
     return createUrl(this.baseUrl, "/api/v1/auth/quick-connect/claim")
   }
   
+  authConfirmTotp() {
+    return createUrl(this.baseUrl, "/api/v1/auth/mfa/totp/confirm")
+  }
+  
+  authCreateForwardSession() {
+    return createUrl(this.baseUrl, "/api/v1/auth/forward/session")
+  }
+  
+  authDenyQuickConnectCode() {
+    return createUrl(this.baseUrl, "/api/v1/auth/quick-connect/deny")
+  }
+  
+  authDisableTotp() {
+    return createUrl(this.baseUrl, "/api/v1/auth/mfa/totp/disable")
+  }
+  
+  authEnrollTotp() {
+    return createUrl(this.baseUrl, "/api/v1/auth/mfa/totp/enroll")
+  }
+  
+  authFinishMagicLink() {
+    return createUrl(this.baseUrl, "/api/v1/auth/magic-link/finish")
+  }
+  
+  authFinishPasskeyLogin() {
+    return createUrl(this.baseUrl, "/api/v1/auth/passkey/login/finish")
+  }
+  
+  authFinishPasskeyMfa() {
+    return createUrl(this.baseUrl, "/api/v1/auth/mfa/passkey/finish")
+  }
+  
+  authFinishPasskeyRegistration() {
+    return createUrl(this.baseUrl, "/api/v1/auth/passkeys/register/finish")
+  }
+  
   authFinishProvider() {
     return createUrl(this.baseUrl, "/api/v1/auth/providers/finish")
   }
@@ -92,6 +367,18 @@ export class ClientUrls {
     return createUrl(this.baseUrl, "/api/v1/auth/quick-connect/finish")
   }
   
+  authForward() {
+    return createUrl(this.baseUrl, "/auth/forward")
+  }
+  
+  authForwardHead() {
+    return createUrl(this.baseUrl, "/auth/forward")
+  }
+  
+  authGetMagicLinkStatus() {
+    return createUrl(this.baseUrl, "/api/v1/auth/magic-link/status")
+  }
+  
   authGetProviderStatus() {
     return createUrl(this.baseUrl, "/api/v1/auth/provider/status")
   }
@@ -104,6 +391,30 @@ export class ClientUrls {
     return createUrl(this.baseUrl, "/api/v1/auth/quick-connect/status")
   }
   
+  authLocalLogin() {
+    return createUrl(this.baseUrl, "/api/v1/auth/local/login")
+  }
+  
+  authLocalSignup() {
+    return createUrl(this.baseUrl, "/api/v1/auth/local/signup")
+  }
+  
+  authLogout() {
+    return createUrl(this.baseUrl, "/api/v1/auth/logout")
+  }
+  
+  authMagicLink() {
+    return createUrl(this.baseUrl, "/auth/magic-link")
+  }
+  
+  authMagicLinkConfirm() {
+    return createUrl(this.baseUrl, "/auth/magic-link")
+  }
+  
+  authMagicLinkInitiate() {
+    return createUrl(this.baseUrl, "/api/v1/auth/magic-link/initiate")
+  }
+  
   authProviderInitiate() {
     return createUrl(this.baseUrl, "/api/v1/auth/providers/initiate")
   }
@@ -112,27 +423,219 @@ export class ClientUrls {
     return createUrl(this.baseUrl, "/api/v1/auth/quick-connect/initiate")
   }
   
+  authRefreshToken() {
+    return createUrl(this.baseUrl, "/api/v1/auth/token/refresh")
+  }
+  
+  authRegenerateRecoveryCodes() {
+    return createUrl(this.baseUrl, "/api/v1/auth/mfa/recovery-codes")
+  }
+  
+  authRequestEmailVerification() {
+    return createUrl(this.baseUrl, "/api/v1/auth/email/verify/request")
+  }
+  
+  authRequestPasswordReset() {
+    return createUrl(this.baseUrl, "/api/v1/auth/local/password/reset")
+  }
+  
+  authResetPassword() {
+    return createUrl(this.baseUrl, "/api/v1/auth/local/password/reset/confirm")
+  }
+  
+  authVerifyEmail() {
+    return createUrl(this.baseUrl, "/api/v1/auth/email/verify/confirm")
+  }
+  
+  authVerifyMfa() {
+    return createUrl(this.baseUrl, "/api/v1/auth/mfa/verify")
+  }
+  
   createApiToken() {
     return createUrl(this.baseUrl, "/api/v1/user/apitoken")
   }
   
+  createInitialAccessToken() {
+    return createUrl(this.baseUrl, "/api/v1/oauth/initial-tokens")
+  }
+  
+  createOauthClient() {
+    return createUrl(this.baseUrl, "/api/v1/oauth/clients")
+  }
+  
   deleteApiToken(id: string) {
     return createUrl(this.baseUrl, `/api/v1/user/apitoken/${id}`)
   }
   
+  deleteInitialAccessToken(id: string) {
+    return createUrl(this.baseUrl, `/api/v1/oauth/initial-tokens/${id}`)
+  }
+  
+  deleteOauthClient(id: string) {
+    return createUrl(this.baseUrl, `/api/v1/oauth/clients/${id}`)
+  }
+  
+  deletePasskey(id: string) {
+    return createUrl(this.baseUrl, `/api/v1/auth/passkeys/${id}`)
+  }
+  
   getAllApiTokens() {
     return createUrl(this.baseUrl, "/api/v1/user/apitoken")
   }
   
+  getEvents() {
+    return createUrl(this.baseUrl, "/api/v1/auth/events")
+  }
+  
+  getGrants() {
+    return createUrl(this.baseUrl, "/api/v1/user/grants")
+  }
+  
+  getInitialAccessTokens() {
+    return createUrl(this.baseUrl, "/api/v1/oauth/initial-tokens")
+  }
+  
   getMe() {
     return createUrl(this.baseUrl, "/api/v1/auth/me")
   }
   
+  getMfaStatus() {
+    return createUrl(this.baseUrl, "/api/v1/auth/mfa")
+  }
+  
+  getOauthClientById(id: string) {
+    return createUrl(this.baseUrl, `/api/v1/oauth/clients/${id}`)
+  }
+  
+  getOauthClients() {
+    return createUrl(this.baseUrl, "/api/v1/oauth/clients")
+  }
+  
+  getPasskeys() {
+    return createUrl(this.baseUrl, "/api/v1/auth/passkeys")
+  }
+  
+  getSessions() {
+    return createUrl(this.baseUrl, "/api/v1/auth/sessions")
+  }
+  
   getSystemInfo() {
     return createUrl(this.baseUrl, "/api/v1/system/info")
   }
   
+  getUserEvents(id: string) {
+    return createUrl(this.baseUrl, `/api/v1/users/${id}/events`)
+  }
+  
+  getUserSessions(id: string) {
+    return createUrl(this.baseUrl, `/api/v1/users/${id}/sessions`)
+  }
+  
+  getWhoAmI() {
+    return createUrl(this.baseUrl, "/api/v1/auth/whoami")
+  }
+  
+  oauthAuthorize() {
+    return createUrl(this.baseUrl, "/api/v1/oauth/authorize")
+  }
+  
+  oauthAuthorizeRedirect() {
+    return createUrl(this.baseUrl, "/oauth/authorize")
+  }
+  
+  oauthConsent() {
+    return createUrl(this.baseUrl, "/oauth/consent")
+  }
+  
+  oauthConsentAnswer() {
+    return createUrl(this.baseUrl, "/oauth/consent")
+  }
+  
+  oauthDeleteClientRegistration(id: string) {
+    return createUrl(this.baseUrl, `/oauth/register/${id}`)
+  }
+  
+  oauthDeviceAuthorization() {
+    return createUrl(this.baseUrl, "/oauth/device_authorization")
+  }
+  
+  oauthGetClientRegistration(id: string) {
+    return createUrl(this.baseUrl, `/oauth/register/${id}`)
+  }
+  
+  oauthIntrospect() {
+    return createUrl(this.baseUrl, "/oauth/introspect")
+  }
+  
+  oauthRegisterClient() {
+    return createUrl(this.baseUrl, "/oauth/register")
+  }
+  
+  oauthRevoke() {
+    return createUrl(this.baseUrl, "/oauth/revoke")
+  }
+  
+  oauthToken() {
+    return createUrl(this.baseUrl, "/oauth/token")
+  }
+  
+  oauthUpdateClientRegistration(id: string) {
+    return createUrl(this.baseUrl, `/oauth/register/${id}`)
+  }
+  
+  oauthUserInfo() {
+    return createUrl(this.baseUrl, "/oauth/userinfo")
+  }
+  
+  oauthUserInfoPost() {
+    return createUrl(this.baseUrl, "/oauth/userinfo")
+  }
+  
+  revokeAllSessions() {
+    return createUrl(this.baseUrl, "/api/v1/auth/sessions")
+  }
+  
+  revokeAllUserSessions(id: string) {
+    return createUrl(this.baseUrl, `/api/v1/users/${id}/sessions`)
+  }
+  
+  revokeGrant(clientId: string) {
+    return createUrl(this.baseUrl, `/api/v1/user/grants/${clientId}`)
+  }
+  
+  revokeSession(id: string) {
+    return createUrl(this.baseUrl, `/api/v1/auth/sessions/${id}`)
+  }
+  
+  revokeUserSession(id: string, sessionId: string) {
+    return createUrl(this.baseUrl, `/api/v1/users/${id}/sessions/${sessionId}`)
+  }
+  
+  rotateOauthClientSecret(id: string) {
+    return createUrl(this.baseUrl, `/api/v1/oauth/clients/${id}/secret`)
+  }
+  
+  setUserEmailVerified(id: string) {
+    return createUrl(this.baseUrl, `/api/v1/users/${id}/email/verified`)
+  }
+  
+  updateOauthClient(id: string) {
+    return createUrl(this.baseUrl, `/api/v1/oauth/clients/${id}`)
+  }
+  
+  updatePasskey(id: string) {
+    return createUrl(this.baseUrl, `/api/v1/auth/passkeys/${id}`)
+  }
+  
   updateUserSettings() {
     return createUrl(this.baseUrl, "/api/v1/user/settings")
   }
+  
+  wellKnownJwks() {
+    return createUrl(this.baseUrl, "/.well-known/jwks.json")
+  }
+  
+  wellKnownOpenIdConfiguration() {
+    return createUrl(this.baseUrl, "/.well-known/openid-configuration")
+  }
 }
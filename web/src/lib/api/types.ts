@@ -10,6 +10,22 @@ export const ApiToken = z.object({
 });
 export type ApiToken = z.infer<typeof ApiToken>;
 
+// Name: AuthBeginPasskeyMfaBody
+export const AuthBeginPasskeyMfaBody = z.object({
+  // Name: AuthBeginPasskeyMfaBody.challenge
+  "challenge": z.string(),
+});
+export type AuthBeginPasskeyMfaBody = z.infer<typeof AuthBeginPasskeyMfaBody>;
+
+// Name: AuthChangePasswordBody
+export const AuthChangePasswordBody = z.object({
+  // Name: AuthChangePasswordBody.currentPassword
+  "currentPassword": z.string(),
+  // Name: AuthChangePasswordBody.newPassword
+  "newPassword": z.string(),
+});
+export type AuthChangePasswordBody = z.infer<typeof AuthChangePasswordBody>;
+
 // Name: AuthClaimQuickConnectCodeBody
 export const AuthClaimQuickConnectCodeBody = z.object({
   // Name: AuthClaimQuickConnectCodeBody.code
@@ -17,10 +33,140 @@ export const AuthClaimQuickConnectCodeBody = z.object({
 });
 export type AuthClaimQuickConnectCodeBody = z.infer<typeof AuthClaimQuickConnectCodeBody>;
 
+// Name: AuthConfirmTotp
+export const AuthConfirmTotp = z.object({
+  // Name: AuthConfirmTotp.recoveryCodes
+  "recoveryCodes": z.array(z.string()),
+});
+export type AuthConfirmTotp = z.infer<typeof AuthConfirmTotp>;
+
+// Name: AuthCreateForwardSession
+export const AuthCreateForwardSession = z.object({
+  // Name: AuthCreateForwardSession.redirect
+  "redirect": z.string(),
+});
+export type AuthCreateForwardSession = z.infer<typeof AuthCreateForwardSession>;
+
+// Name: AuthCreateForwardSessionBody
+export const AuthCreateForwardSessionBody = z.object({
+  // Name: AuthCreateForwardSessionBody.redirect
+  "redirect": z.string(),
+});
+export type AuthCreateForwardSessionBody = z.infer<typeof AuthCreateForwardSessionBody>;
+
+// Name: AuthDenyQuickConnectCodeBody
+export const AuthDenyQuickConnectCodeBody = z.object({
+  // Name: AuthDenyQuickConnectCodeBody.code
+  "code": z.string(),
+});
+export type AuthDenyQuickConnectCodeBody = z.infer<typeof AuthDenyQuickConnectCodeBody>;
+
+// Name: AuthEnrollTotp
+export const AuthEnrollTotp = z.object({
+  // Name: AuthEnrollTotp.secret
+  "secret": z.string(),
+  // Name: AuthEnrollTotp.uri
+  "uri": z.string(),
+  // Name: AuthEnrollTotp.qrCode
+  "qrCode": z.string(),
+});
+export type AuthEnrollTotp = z.infer<typeof AuthEnrollTotp>;
+
+// Name: AuthFinishMagicLink
+export const AuthFinishMagicLink = z.object({
+  // Name: AuthFinishMagicLink.token
+  "token": z.string(),
+  // Name: AuthFinishMagicLink.refreshToken
+  "refreshToken": z.string(),
+});
+export type AuthFinishMagicLink = z.infer<typeof AuthFinishMagicLink>;
+
+// Name: AuthFinishMagicLinkBody
+export const AuthFinishMagicLinkBody = z.object({
+  // Name: AuthFinishMagicLinkBody.requestId
+  "requestId": z.string(),
+  // Name: AuthFinishMagicLinkBody.challenge
+  "challenge": z.string(),
+});
+export type AuthFinishMagicLinkBody = z.infer<typeof AuthFinishMagicLinkBody>;
+
+// Name: AuthFinishPasskeyLogin
+export const AuthFinishPasskeyLogin = z.object({
+  // Name: AuthFinishPasskeyLogin.token
+  "token": z.string(),
+  // Name: AuthFinishPasskeyLogin.refreshToken
+  "refreshToken": z.string(),
+});
+export type AuthFinishPasskeyLogin = z.infer<typeof AuthFinishPasskeyLogin>;
+
+// Name: AuthFinishPasskeyLoginBody
+export const AuthFinishPasskeyLoginBody = z.object({
+  // Name: AuthFinishPasskeyLoginBody.requestId
+  "requestId": z.string(),
+  // Name: AuthFinishPasskeyLoginBody.credential
+  "credential": z.string(),
+});
+export type AuthFinishPasskeyLoginBody = z.infer<typeof AuthFinishPasskeyLoginBody>;
+
+// Name: AuthFinishPasskeyMfa
+export const AuthFinishPasskeyMfa = z.object({
+  // Name: AuthFinishPasskeyMfa.token
+  "token": z.string(),
+  // Name: AuthFinishPasskeyMfa.refreshToken
+  "refreshToken": z.string(),
+});
+export type AuthFinishPasskeyMfa = z.infer<typeof AuthFinishPasskeyMfa>;
+
+// Name: AuthFinishPasskeyMfaBody
+export const AuthFinishPasskeyMfaBody = z.object({
+  // Name: AuthFinishPasskeyMfaBody.challenge
+  "challenge": z.string(),
+  // Name: AuthFinishPasskeyMfaBody.requestId
+  "requestId": z.string(),
+  // Name: AuthFinishPasskeyMfaBody.credential
+  "credential": z.string(),
+});
+export type AuthFinishPasskeyMfaBody = z.infer<typeof AuthFinishPasskeyMfaBody>;
+
+// Name: Passkey
+export const Passkey = z.object({
+  // Name: Passkey.id
+  "id": z.string(),
+  // Name: Passkey.name
+  "name": z.string(),
+  // Name: Passkey.lastUsed
+  "lastUsed": z.string(),
+  // Name: Passkey.created
+  "created": z.string(),
+});
+export type Passkey = z.infer<typeof Passkey>;
+
+// Name: AuthFinishPasskeyRegistration
+export const AuthFinishPasskeyRegistration = z.object({
+  // Name: AuthFinishPasskeyRegistration.passkey
+  "passkey": Passkey,
+  // Name: AuthFinishPasskeyRegistration.recoveryCodes
+  "recoveryCodes": z.array(z.string()),
+});
+export type AuthFinishPasskeyRegistration = z.infer<typeof AuthFinishPasskeyRegistration>;
+
+// Name: AuthFinishPasskeyRegistrationBody
+export const AuthFinishPasskeyRegistrationBody = z.object({
+  // Name: AuthFinishPasskeyRegistrationBody.requestId
+  "requestId": z.string(),
+  // Name: AuthFinishPasskeyRegistrationBody.name
+  "name": z.string(),
+  // Name: AuthFinishPasskeyRegistrationBody.credential
+  "credential": z.string(),
+});
+export type AuthFinishPasskeyRegistrationBody = z.infer<typeof AuthFinishPasskeyRegistrationBody>;
+
 // Name: AuthFinishProvider
 export const AuthFinishProvider = z.object({
   // Name: AuthFinishProvider.token
   "token": z.string(),
+  // Name: AuthFinishProvider.refreshToken
+  "refreshToken": z.string(),
 });
 export type AuthFinishProvider = z.infer<typeof AuthFinishProvider>;
 
@@ -37,6 +183,8 @@ export type AuthFinishProviderBody = z.infer<typeof AuthFinishProviderBody>;
 export const AuthFinishQuickConnect = z.object({
   // Name: AuthFinishQuickConnect.token
   "token": z.string(),
+  // Name: AuthFinishQuickConnect.refreshToken
+  "refreshToken": z.string(),
 });
 export type AuthFinishQuickConnect = z.infer<typeof AuthFinishQuickConnect>;
 
@@ -49,6 +197,22 @@ export const AuthFinishQuickConnectBody = z.object({
 });
 export type AuthFinishQuickConnectBody = z.infer<typeof AuthFinishQuickConnectBody>;
 
+// Name: AuthGetMagicLinkStatus
+export const AuthGetMagicLinkStatus = z.object({
+  // Name: AuthGetMagicLinkStatus.status
+  "status": z.string(),
+});
+export type AuthGetMagicLinkStatus = z.infer<typeof AuthGetMagicLinkStatus>;
+
+// Name: AuthGetMagicLinkStatusBody
+export const AuthGetMagicLinkStatusBody = z.object({
+  // Name: AuthGetMagicLinkStatusBody.requestId
+  "requestId": z.string(),
+  // Name: AuthGetMagicLinkStatusBody.challenge
+  "challenge": z.string(),
+});
+export type AuthGetMagicLinkStatusBody = z.infer<typeof AuthGetMagicLinkStatusBody>;
+
 // Name: AuthGetProviderStatus
 export const AuthGetProviderStatus = z.object({
   // Name: AuthGetProviderStatus.status
@@ -101,6 +265,66 @@ export const AuthInitiateBody = z.object({
 });
 export type AuthInitiateBody = z.infer<typeof AuthInitiateBody>;
 
+// Name: AuthLocalLogin
+export const AuthLocalLogin = z.object({
+  // Name: AuthLocalLogin.token
+  "token": z.string(),
+  // Name: AuthLocalLogin.refreshToken
+  "refreshToken": z.string(),
+});
+export type AuthLocalLogin = z.infer<typeof AuthLocalLogin>;
+
+// Name: AuthLocalLoginBody
+export const AuthLocalLoginBody = z.object({
+  // Name: AuthLocalLoginBody.username
+  "username": z.string(),
+  // Name: AuthLocalLoginBody.password
+  "password": z.string(),
+});
+export type AuthLocalLoginBody = z.infer<typeof AuthLocalLoginBody>;
+
+// Name: AuthLocalSignup
+export const AuthLocalSignup = z.object({
+  // Name: AuthLocalSignup.token
+  "token": z.string(),
+  // Name: AuthLocalSignup.refreshToken
+  "refreshToken": z.string(),
+});
+export type AuthLocalSignup = z.infer<typeof AuthLocalSignup>;
+
+// Name: AuthLocalSignupBody
+export const AuthLocalSignupBody = z.object({
+  // Name: AuthLocalSignupBody.username
+  "username": z.string(),
+  // Name: AuthLocalSignupBody.email
+  "email": z.string(),
+  // Name: AuthLocalSignupBody.password
+  "password": z.string(),
+  // Name: AuthLocalSignupBody.displayName
+  "displayName": z.string(),
+});
+export type AuthLocalSignupBody = z.infer<typeof AuthLocalSignupBody>;
+
+// Name: AuthMagicLinkInitiate
+export const AuthMagicLinkInitiate = z.object({
+  // Name: AuthMagicLinkInitiate.requestId
+  "requestId": z.string(),
+  // Name: AuthMagicLinkInitiate.challenge
+  "challenge": z.string(),
+  // Name: AuthMagicLinkInitiate.code
+  "code": z.string(),
+  // Name: AuthMagicLinkInitiate.expiresAt
+  "expiresAt": z.string(),
+});
+export type AuthMagicLinkInitiate = z.infer<typeof AuthMagicLinkInitiate>;
+
+// Name: AuthMagicLinkInitiateBody
+export const AuthMagicLinkInitiateBody = z.object({
+  // Name: AuthMagicLinkInitiateBody.email
+  "email": z.string(),
+});
+export type AuthMagicLinkInitiateBody = z.infer<typeof AuthMagicLinkInitiateBody>;
+
 // Name: AuthProvider
 export const AuthProvider = z.object({
   // Name: AuthProvider.id
@@ -123,6 +347,86 @@ export const AuthQuickConnectInitiate = z.object({
 });
 export type AuthQuickConnectInitiate = z.infer<typeof AuthQuickConnectInitiate>;
 
+// Name: AuthRefreshToken
+export const AuthRefreshToken = z.object({
+  // Name: AuthRefreshToken.token
+  "token": z.string(),
+  // Name: AuthRefreshToken.refreshToken
+  "refreshToken": z.string(),
+});
+export type AuthRefreshToken = z.infer<typeof AuthRefreshToken>;
+
+// Name: AuthRefreshTokenBody
+export const AuthRefreshTokenBody = z.object({
+  // Name: AuthRefreshTokenBody.refreshToken
+  "refreshToken": z.string(),
+});
+export type AuthRefreshTokenBody = z.infer<typeof AuthRefreshTokenBody>;
+
+// Name: AuthRegenerateRecoveryCodes
+export const AuthRegenerateRecoveryCodes = z.object({
+  // Name: AuthRegenerateRecoveryCodes.recoveryCodes
+  "recoveryCodes": z.array(z.string()),
+});
+export type AuthRegenerateRecoveryCodes = z.infer<typeof AuthRegenerateRecoveryCodes>;
+
+// Name: AuthRequestEmailVerificationBody
+export const AuthRequestEmailVerificationBody = z.object({
+  // Name: AuthRequestEmailVerificationBody.email
+  "email": z.string(),
+});
+export type AuthRequestEmailVerificationBody = z.infer<typeof AuthRequestEmailVerificationBody>;
+
+// Name: AuthRequestPasswordResetBody
+export const AuthRequestPasswordResetBody = z.object({
+  // Name: AuthRequestPasswordResetBody.email
+  "email": z.string(),
+});
+export type AuthRequestPasswordResetBody = z.infer<typeof AuthRequestPasswordResetBody>;
+
+// Name: AuthResetPasswordBody
+export const AuthResetPasswordBody = z.object({
+  // Name: AuthResetPasswordBody.token
+  "token": z.string(),
+  // Name: AuthResetPasswordBody.newPassword
+  "newPassword": z.string(),
+});
+export type AuthResetPasswordBody = z.infer<typeof AuthResetPasswordBody>;
+
+// Name: AuthTotpCodeBody
+export const AuthTotpCodeBody = z.object({
+  // Name: AuthTotpCodeBody.code
+  "code": z.string(),
+});
+export type AuthTotpCodeBody = z.infer<typeof AuthTotpCodeBody>;
+
+// Name: AuthVerifyEmailBody
+export const AuthVerifyEmailBody = z.object({
+  // Name: AuthVerifyEmailBody.token
+  "token": z.string(),
+});
+export type AuthVerifyEmailBody = z.infer<typeof AuthVerifyEmailBody>;
+
+// Name: AuthVerifyMfa
+export const AuthVerifyMfa = z.object({
+  // Name: AuthVerifyMfa.token
+  "token": z.string(),
+  // Name: AuthVerifyMfa.refreshToken
+  "refreshToken": z.string(),
+});
+export type AuthVerifyMfa = z.infer<typeof AuthVerifyMfa>;
+
+// Name: AuthVerifyMfaBody
+export const AuthVerifyMfaBody = z.object({
+  // Name: AuthVerifyMfaBody.challenge
+  "challenge": z.string(),
+  // Name: AuthVerifyMfaBody.method
+  "method": z.string(),
+  // Name: AuthVerifyMfaBody.code
+  "code": z.string(),
+});
+export type AuthVerifyMfaBody = z.infer<typeof AuthVerifyMfaBody>;
+
 // Name: CreateApiToken
 export const CreateApiToken = z.object({
   // Name: CreateApiToken.token
@@ -137,6 +441,108 @@ export const CreateApiTokenBody = z.object({
 });
 export type CreateApiTokenBody = z.infer<typeof CreateApiTokenBody>;
 
+// Name: InitialAccessToken
+export const InitialAccessToken = z.object({
+  // Name: InitialAccessToken.id
+  "id": z.string(),
+  // Name: InitialAccessToken.name
+  "name": z.string(),
+  // Name: InitialAccessToken.expires
+  "expires": z.string(),
+  // Name: InitialAccessToken.lastUsed
+  "lastUsed": z.string(),
+  // Name: InitialAccessToken.created
+  "created": z.string(),
+});
+export type InitialAccessToken = z.infer<typeof InitialAccessToken>;
+
+// Name: CreateInitialAccessToken
+export const CreateInitialAccessToken = z.object({
+  // Name: CreateInitialAccessToken.initialToken
+  "initialToken": InitialAccessToken,
+  // Name: CreateInitialAccessToken.token
+  "token": z.string(),
+});
+export type CreateInitialAccessToken = z.infer<typeof CreateInitialAccessToken>;
+
+// Name: CreateInitialAccessTokenBody
+export const CreateInitialAccessTokenBody = z.object({
+  // Name: CreateInitialAccessTokenBody.name
+  "name": z.string(),
+  // Name: CreateInitialAccessTokenBody.expiresIn
+  "expiresIn": z.number().optional(),
+});
+export type CreateInitialAccessTokenBody = z.infer<typeof CreateInitialAccessTokenBody>;
+
+// Name: OAuthClient
+export const OAuthClient = z.object({
+  // Name: OAuthClient.id
+  "id": z.string(),
+  // Name: OAuthClient.name
+  "name": z.string(),
+  // Name: OAuthClient.logoUrl
+  "logoUrl": z.string(),
+  // Name: OAuthClient.public
+  "public": z.boolean(),
+  // Name: OAuthClient.trusted
+  "trusted": z.boolean(),
+  // Name: OAuthClient.redirectUris
+  "redirectUris": z.array(z.string()),
+  // Name: OAuthClient.grantTypes
+  "grantTypes": z.array(z.string()),
+  // Name: OAuthClient.scopes
+  "scopes": z.array(z.string()),
+  // Name: OAuthClient.audiences
+  "audiences": z.array(z.string()),
+  // Name: OAuthClient.static
+  "static": z.boolean(),
+  // Name: OAuthClient.exchangeAudiences
+  "exchangeAudiences": z.array(z.string()),
+  // Name: OAuthClient.exchangeScopes
+  "exchangeScopes": z.array(z.string()),
+  // Name: OAuthClient.created
+  "created": z.string(),
+  // Name: OAuthClient.updated
+  "updated": z.string(),
+});
+export type OAuthClient = z.infer<typeof OAuthClient>;
+
+// Name: CreateOAuthClient
+export const CreateOAuthClient = z.object({
+  // Name: CreateOAuthClient.client
+  "client": OAuthClient,
+  // Name: CreateOAuthClient.secret
+  "secret": z.string(),
+});
+export type CreateOAuthClient = z.infer<typeof CreateOAuthClient>;
+
+// Name: CreateOAuthClientBody
+export const CreateOAuthClientBody = z.object({
+  // Name: CreateOAuthClientBody.id
+  "id": z.string().optional(),
+  // Name: CreateOAuthClientBody.name
+  "name": z.string(),
+  // Name: CreateOAuthClientBody.logoUrl
+  "logoUrl": z.string().optional(),
+  // Name: CreateOAuthClientBody.public
+  "public": z.boolean().optional(),
+  // Name: CreateOAuthClientBody.trusted
+  "trusted": z.boolean().optional(),
+  // Name: CreateOAuthClientBody.redirectUris
+  "redirectUris": z.array(z.string()),
+  // Name: CreateOAuthClientBody.grantTypes
+  "grantTypes": z.array(z.string()).optional(),
+  // Name: CreateOAuthClientBody.scopes
+  "scopes": z.array(z.string()).optional(),
+  // Name: CreateOAuthClientBody.audiences
+  "audiences": z.array(z.string()).optional(),
+  // Name: CreateOAuthClientBody.exchangeAudiences
+  "exchangeAudiences": z.array(z.string()).optional(),
+  // Name: CreateOAuthClientBody.exchangeScopes
+  "exchangeScopes": z.array(z.string()).optional(),
+});
+export type CreateOAuthClientBody = z.infer<typeof CreateOAuthClientBody>;
+
 // Name: GetAllApiTokens
 export const GetAllApiTokens = z.object({
   // Name: GetAllApiTokens.tokens
@@ -148,15 +554,54 @@ export type GetAllApiTokens = z.infer<typeof GetAllApiTokens>;
 export const GetAuthProviders = z.object({
   // Name: GetAuthProviders.providers
   "providers": z.array(AuthProvider),
+  // Name: GetAuthProviders.localAccounts
+  "localAccounts": z.boolean(),
+  // Name: GetAuthProviders.magicLinks
+  "magicLinks": z.boolean(),
+  // Name: GetAuthProviders.passkeys
+  "passkeys": z.boolean(),
 });
 export type GetAuthProviders = z.infer<typeof GetAuthProviders>;
 
+// Name: Grant
+export const Grant = z.object({
+  // Name: Grant.clientId
+  "clientId": z.string(),
+  // Name: Grant.clientName
+  "clientName": z.string(),
+  // Name: Grant.clientLogoUrl
+  "clientLogoUrl": z.string(),
+  // Name: Grant.scopes
+  "scopes": z.array(z.string()),
+  // Name: Grant.created
+  "created": z.string(),
+  // Name: Grant.updated
+  "updated": z.string(),
+});
+export type Grant = z.infer<typeof Grant>;
+
+// Name: GetGrants
+export const GetGrants = z.object({
+  // Name: GetGrants.grants
+  "grants": z.array(Grant),
+});
+export type GetGrants = z.infer<typeof GetGrants>;
+
+// Name: GetInitialAccessTokens
+export const GetInitialAccessTokens = z.object({
+  // Name: GetInitialAccessTokens.tokens
+  "tokens": z.array(InitialAccessToken),
+});
+export type GetInitialAccessTokens = z.infer<typeof GetInitialAccessTokens>;
+
 // Name: GetMe
 export const GetMe = z.object({
   // Name: GetMe.id
   "id": z.string(),
   // Name: GetMe.email
   "email": z.string(),
+  // Name: GetMe.emailVerified
+  "emailVerified": z.boolean(),
   // Name: GetMe.displayName
   "displayName": z.string(),
   // Name: GetMe.role
@@ -164,6 +609,55 @@ export const GetMe = z.object({
 });
 export type GetMe = z.infer<typeof GetMe>;
 
+// Name: GetMfaStatus
+export const GetMfaStatus = z.object({
+  // Name: GetMfaStatus.totpEnabled
+  "totpEnabled": z.boolean(),
+  // Name: GetMfaStatus.recoveryCodesRemaining
+  "recoveryCodesRemaining": z.number(),
+});
+export type GetMfaStatus = z.infer<typeof GetMfaStatus>;
+
+// Name: GetOAuthClients
+export const GetOAuthClients = z.object({
+  // Name: GetOAuthClients.clients
+  "clients": z.array(OAuthClient),
+});
+export type GetOAuthClients = z.infer<typeof GetOAuthClients>;
+
+// Name: GetPasskeys
+export const GetPasskeys = z.object({
+  // Name: GetPasskeys.passkeys
+  "passkeys": z.array(Passkey),
+});
+export type GetPasskeys = z.infer<typeof GetPasskeys>;
+
+// Name: Session
+export const Session = z.object({
+  // Name: Session.id
+  "id": z.string(),
+  // Name: Session.authMethod
+  "authMethod": z.string(),
+  // Name: Session.userAgent
+  "userAgent": z.string(),
+  // Name: Session.ipAddress
+  "ipAddress": z.string(),
+  // Name: Session.current
+  "current": z.boolean(),
+  // Name: Session.lastSeen
+  "lastSeen": z.string(),
+  // Name: Session.created
+  "created": z.string(),
+});
+export type Session = z.infer<typeof Session>;
+
+// Name: GetSessions
+export const GetSessions = z.object({
+  // Name: GetSessions.sessions
+  "sessions": z.array(Session),
+});
+export type GetSessions = z.infer<typeof GetSessions>;
+
 // Name: GetSystemInfo
 export const GetSystemInfo = z.object({
   // Name: GetSystemInfo.version
@@ -171,6 +665,130 @@ export const GetSystemInfo = z.object({
 });
 export type GetSystemInfo = z.infer<typeof GetSystemInfo>;
 
+// Name: UserEvent
+export const UserEvent = z.object({
+  // Name: UserEvent.id
+  "id": z.string(),
+  // Name: UserEvent.type
+  "type": z.string(),
+  // Name: UserEvent.userAgent
+  "userAgent": z.string(),
+  // Name: UserEvent.ipAddress
+  "ipAddress": z.string(),
+  // Name: UserEvent.created
+  "created": z.string(),
+});
+export type UserEvent = z.infer<typeof UserEvent>;
+
+// Name: GetUserEvents
+export const GetUserEvents = z.object({
+  // Name: GetUserEvents.events
+  "events": z.array(UserEvent),
+});
+export type GetUserEvents = z.infer<typeof GetUserEvents>;
+
+// Name: GetWhoAmI
+export const GetWhoAmI = z.object({
+  // Name: GetWhoAmI.type
+  "type": z.string(),
+  // Name: GetWhoAmI.id
+  "id": z.string(),
+  // Name: GetWhoAmI.name
+  "name": z.string(),
+  // Name: GetWhoAmI.clientId
+  "clientId": z.string(),
+  // Name: GetWhoAmI.scopes
+  "scopes": z.array(z.string()),
+  // Name: GetWhoAmI.audience
+  "audience": z.array(z.string()),
+  // Name: GetWhoAmI.actors
+  "actors": z.array(z.string()),
+});
+export type GetWhoAmI = z.infer<typeof GetWhoAmI>;
+
+// Name: OAuthAuthorize
+export const OAuthAuthorize = z.object({
+  // Name: OAuthAuthorize.redirectUrl
+  "redirectUrl": z.string(),
+});
+export type OAuthAuthorize = z.infer<typeof OAuthAuthorize>;
+
+// Name: OAuthAuthorizeBody
+export const OAuthAuthorizeBody = z.object({
+  // Name: OAuthAuthorizeBody.responseType
+  "responseType": z.string(),
+  // Name: OAuthAuthorizeBody.clientId
+  "clientId": z.string(),
+  // Name: OAuthAuthorizeBody.redirectUri
+  "redirectUri": z.string(),
+  // Name: OAuthAuthorizeBody.scope
+  "scope": z.string(),
+  // Name: OAuthAuthorizeBody.state
+  "state": z.string(),
+  // Name: OAuthAuthorizeBody.nonce
+  "nonce": z.string(),
+  // Name: OAuthAuthorizeBody.codeChallenge
+  "codeChallenge": z.string(),
+  // Name: OAuthAuthorizeBody.codeChallengeMethod
+  "codeChallengeMethod": z.string(),
+});
+export type OAuthAuthorizeBody = z.infer<typeof OAuthAuthorizeBody>;
+
+// Name: PasskeyOptions
+export const PasskeyOptions = z.object({
+  // Name: PasskeyOptions.requestId
+  "requestId": z.string(),
+  // Name: PasskeyOptions.options
+  "options": z.string(),
+  // Name: PasskeyOptions.expiresAt
+  "expiresAt": z.string(),
+});
+export type PasskeyOptions = z.infer<typeof PasskeyOptions>;
+
+// Name: RotateOAuthClientSecret
+export const RotateOAuthClientSecret = z.object({
+  // Name: RotateOAuthClientSecret.secret
+  "secret": z.string(),
+});
+export type RotateOAuthClientSecret = z.infer<typeof RotateOAuthClientSecret>;
+
+// Name: SetUserEmailVerifiedBody
+export const SetUserEmailVerifiedBody = z.object({
+  // Name: SetUserEmailVerifiedBody.verified
+  "verified": z.boolean(),
+});
+export type SetUserEmailVerifiedBody = z.infer<typeof SetUserEmailVerifiedBody>;
+
+// Name: UpdateOAuthClientBody
+export const UpdateOAuthClientBody = z.object({
+  // Name: UpdateOAuthClientBody.name
+  "name": z.string().nullable().optional(),
+  // Name: UpdateOAuthClientBody.logoUrl
+  "logoUrl": z.string().nullable().optional(),
+  // Name: UpdateOAuthClientBody.trusted
+  "trusted": z.boolean().nullable().optional(),
+  // Name: UpdateOAuthClientBody.redirectUris
+  "redirectUris": z.array(z.string()).nullable().optional(),
+  // Name: UpdateOAuthClientBody.grantTypes
+  "grantTypes": z.array(z.string()).nullable().optional(),
+  // Name: UpdateOAuthClientBody.scopes
+  "scopes": z.array(z.string()).nullable().optional(),
+  // Name: UpdateOAuthClientBody.audiences
+  "audiences": z.array(z.string()).nullable().optional(),
+  // Name: UpdateOAuthClientBody.exchangeAudiences
+  "exchangeAudiences": z.array(z.string()).nullable().optional(),
+  // Name: UpdateOAuthClientBody.exchangeScopes
+  "exchangeScopes": z.array(z.string()).nullable().optional(),
+});
+export type UpdateOAuthClientBody = z.infer<typeof UpdateOAuthClientBody>;
+
+// Name: UpdatePasskeyBody
+export const UpdatePasskeyBody = z.object({
+  // Name: UpdatePasskeyBody.name
+  "name": z.string(),
+});
+export type UpdatePasskeyBody = z.infer<typeof UpdatePasskeyBody>;
+
 // Name: UpdateUserSettingsBody
 export const UpdateUserSettingsBody = z.object({
   // Name: UpdateUserSettingsBody.displayName
@@ -0,0 +1,122 @@
+// NOTE(patrik): The server sends the options as json where all the
+// binary fields are base64url encoded, the browser wants ArrayBuffers so
+// the fields are converted in both directions here
+
+function fromBase64Url(value: string): ArrayBuffer {
+  const base64 = value.replace(/-/g, "+").replace(/_/g, "/");
+  const padded = base64.padEnd(
+    base64.length + ((4 - (base64.length % 4)) % 4),
+    "=",
+  );
+  const binary = atob(padded);
+
+  const bytes = new Uint8Array(binary.length);
+  for (let i = 0; i < binary.length; i++) {
+    bytes[i] = binary.charCodeAt(i);
+  }
+
+  return bytes.buffer;
+}
+
+function toBase64Url(value: ArrayBuffer | null): string | undefined {
+  if (!value) {
+    return undefined;
+  }
+
+  let binary = "";
+  for (const byte of new Uint8Array(value)) {
+    binary += String.fromCharCode(byte);
+  }
+
+  return btoa(binary)
+    .replace(/\+/g, "-")
+    .replace(/\//g, "_")
+    .replace(/=+$/, "");
+}
+
+type CredentialDescriptorJson = {
+  id: string;
+  type: PublicKeyCredentialType;
+  transports?: AuthenticatorTransport[];
+};
+
+function convertDescriptors(descriptors?: CredentialDescriptorJson[]) {
+  return descriptors?.map((descriptor) => ({
+    ...descriptor,
+    id: fromBase64Url(descriptor.id),
+  }));
+}
+
+// createPasskey runs the registration ceremony with the options from
+// the server, returns the credential as json
+export async function createPasskey(options: string): Promise<string> {
+  const { publicKey } = JSON.parse(options);
+
+  const credential = (await navigator.credentials.create({
+    publicKey: {
+      ...publicKey,
+      challenge: fromBase64Url(publicKey.challenge),
+      user: {
+        ...publicKey.user,
+        id: fromBase64Url(publicKey.user.id),
+      },
+      excludeCredentials: convertDescriptors(publicKey.excludeCredentials),
+    },
+  })) as PublicKeyCredential | null;
+  if (!credential) {
+    throw new Error("no passkey was created");
+  }
+
+  const response = credential.response as AuthenticatorAttestationResponse;
+
+  return JSON.stringify({
+    id: credential.id,
+    rawId: toBase64Url(credential.rawId),
+    type: credential.type,
+    authenticatorAttachment: credential.authenticatorAttachment,
+    clientExtensionResults: credential.getClientExtensionResults(),
+    response: {
+      clientDataJSON: toBase64Url(response.clientDataJSON),
+      attestationObject: toBase64Url(response.attestationObject),
+      transports: response.getTransports?.() ?? [],
+    },
+  });
+}
+
+// getPasskey runs the login ceremony with the options from the server,
+// returns the credential as json
+export async function getPasskey(options: string): Promise<string> {
+  const { publicKey, mediation } = JSON.parse(options);
+
+  const credential = (await navigator.credentials.get({
+    mediation,
+    publicKey: {
+      ...publicKey,
+      challenge: fromBase64Url(publicKey.challenge),
+      allowCredentials: convertDescriptors(publicKey.allowCredentials),
+    },
+  })) as PublicKeyCredential | null;
+  if (!credential) {
+    throw new Error("no passkey was picked");
+  }
+
+  const response = credential.response as AuthenticatorAssertionResponse;
+
+  return JSON.stringify({
+    id: credential.id,
+    rawId: toBase64Url(credential.rawId),
+    type: credential.type,
+    authenticatorAttachment: credential.authenticatorAttachment,
+    clientExtensionResults: credential.getClientExtensionResults(),
+    response: {
+      clientDataJSON: toBase64Url(response.clientDataJSON),
+      authenticatorData: toBase64Url(response.authenticatorData),
+      signature: toBase64Url(response.signature),
+      userHandle: toBase64Url(response.userHandle),
+    },
+  });
+}
+
+export function passkeysSupported() {
+  return typeof window !== "undefined" && !!window.PublicKeyCredential;
+}
@@ -4,3 +4,17 @@ import { twMerge } from "tailwind-merge";
 export function cn(...inputs: ClassValue[]) {
   return twMerge(clsx(inputs));
 }
+
+// NOTE(patrik): Only allow redirects to paths on the same site, so the
+// redirect parameter can't be used to send the user somewhere else
+export function safeRedirect(redirect: string | null, fallback = "/") {
+  if (!redirect || !redirect.startsWith("/") || redirect.startsWith("//")) {
+    return fallback;
+  }
+
+  return redirect;
+}
+
+export function loginRedirect(url: URL) {
+  return "/login?redirect=" + encodeURIComponent(url.pathname + url.search);
+}
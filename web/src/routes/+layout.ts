@@ -22,12 +22,33 @@ export const load: LayoutLoad = async ({ url }) => {
 
   let user: GetMe | null = null;
   if (token) {
-    const res = await apiClient.getMe();
-    if (!res.success) {
-      error(res.error.code, { message: res.error.message });
+    let res = await apiClient.getMe();
+
+    // NOTE(patrik): The access token is short lived, so try to get a new
+    // one with the refresh token before giving up
+    const refreshToken = localStorage.getItem("refreshToken");
+    if (!res.success && res.error.type === "INVALID_AUTH" && refreshToken) {
+      const refresh = await apiClient.authRefreshToken({ refreshToken });
+      if (refresh.success) {
+        localStorage.setItem("token", refresh.data.token);
+        localStorage.setItem("refreshToken", refresh.data.refreshToken);
+        setApiClientAuth(apiClient, refresh.data.token);
+
+        res = await apiClient.getMe();
+      } else {
+        localStorage.removeItem("token");
+        localStorage.removeItem("refreshToken");
+        setApiClientAuth(apiClient, undefined);
+      }
     }
 
-    user = res.data;
+    if (!res.success) {
+      if (res.error.type !== "INVALID_AUTH") {
+        error(res.error.code, { message: res.error.message });
+      }
+    } else {
+      user = res.data;
+    }
   }
 
   return {
@@ -0,0 +1,40 @@
+import { loginRedirect } from "$lib/utils";
+import { error, redirect } from "@sveltejs/kit";
+import type { PageLoad } from "./$types";
+
+export const load: PageLoad = async ({ parent, url }) => {
+  const data = await parent();
+
+  if (!data.user) {
+    throw redirect(303, loginRedirect(url));
+  }
+
+  const mfa = await data.apiClient.getMfaStatus();
+  if (!mfa.success) {
+    throw error(mfa.error.code, { message: mfa.error.message });
+  }
+
+  const providers = await data.apiClient.authGetProviders();
+  if (!providers.success) {
+    throw error(providers.error.code, { message: providers.error.message });
+  }
+
+  const passkeys = await data.apiClient.getPasskeys();
+  if (!passkeys.success) {
+    throw error(passkeys.error.code, { message: passkeys.error.message });
+  }
+
+  const events = await data.apiClient.getEvents();
+  if (!events.success) {
+    throw error(events.error.code, { message: events.error.message });
+  }
+
+  return {
+    ...data,
+    user: data.user,
+    mfa: mfa.data,
+    passkeysEnabled: providers.data.passkeys,
+    passkeys: passkeys.data.passkeys,
+    events: events.data.events,
+  };
+};
@@ -0,0 +1,27 @@
+import { loginRedirect } from "$lib/utils";
+import { redirect } from "@sveltejs/kit";
+import type { PageLoad } from "./$types";
+
+export const load: PageLoad = async ({ parent, url }) => {
+  const data = await parent();
+
+  if (!data.user) {
+    throw redirect(303, loginRedirect(url));
+  }
+
+  const params = url.searchParams;
+
+  return {
+    ...data,
+    request: {
+      responseType: params.get("response_type") ?? "",
+      clientId: params.get("client_id") ?? "",
+      redirectUri: params.get("redirect_uri") ?? "",
+      scope: params.get("scope") ?? "",
+      state: params.get("state") ?? "",
+      nonce: params.get("nonce") ?? "",
+      codeChallenge: params.get("code_challenge") ?? "",
+      codeChallengeMethod: params.get("code_challenge_method") ?? "",
+    },
+  };
+};
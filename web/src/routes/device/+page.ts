@@ -0,0 +1,16 @@
+import { loginRedirect } from "$lib/utils";
+import { redirect } from "@sveltejs/kit";
+import type { PageLoad } from "./$types";
+
+export const load: PageLoad = async ({ parent, url }) => {
+  const data = await parent();
+
+  if (!data.user) {
+    throw redirect(303, loginRedirect(url));
+  }
+
+  return {
+    ...data,
+    code: url.searchParams.get("code") ?? "",
+  };
+};
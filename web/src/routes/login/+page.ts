@@ -1,11 +1,26 @@
+import { safeRedirect } from "$lib/utils";
 import { error, redirect } from "@sveltejs/kit";
 import type { PageLoad } from "./$types";
 
-export const load: PageLoad = async ({ parent }) => {
+export const load: PageLoad = async ({ parent, url }) => {
   const data = await parent();
 
   if (data.user) {
-    throw redirect(303, "/");
+    // NOTE(patrik): The user came from a host behind the reverse proxy,
+    // give the browser the session cookie and send the user back
+    const rd = url.searchParams.get("rd");
+    if (rd) {
+      const res = await data.apiClient.authCreateForwardSession({
+        redirect: rd,
+      });
+      if (!res.success) {
+        throw error(res.error.code, { message: res.error.message });
+      }
+
+      throw redirect(303, res.data.redirect);
+    }
+
+    throw redirect(303, safeRedirect(url.searchParams.get("redirect")));
   }
 
   const providers = await data.apiClient.authGetProviders();
@@ -16,5 +31,8 @@ export const load: PageLoad = async ({ parent }) => {
   return {
     ...data,
     providers: providers.data.providers,
+    localAccounts: providers.data.localAccounts,
+    magicLinks: providers.data.magicLinks,
+    passkeys: providers.data.passkeys,
   };
 };
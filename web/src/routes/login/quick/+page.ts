@@ -1,11 +1,12 @@
+import { safeRedirect } from "$lib/utils";
 import { redirect } from "@sveltejs/kit";
 import type { PageLoad } from "./$types";
 
-export const load: PageLoad = async ({ parent }) => {
+export const load: PageLoad = async ({ parent, url }) => {
   const data = await parent();
 
   if (data.user) {
-    throw redirect(303, "/");
+    throw redirect(303, safeRedirect(url.searchParams.get("redirect")));
   }
 
   return {
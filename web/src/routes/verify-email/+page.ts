@@ -0,0 +1,10 @@
+import type { PageLoad } from "./$types";
+
+export const load: PageLoad = async ({ parent, url }) => {
+  const data = await parent();
+
+  return {
+    ...data,
+    token: url.searchParams.get("token") ?? "",
+  };
+};